@@ -36,6 +36,15 @@ type ESXProfile struct {
 	StaticGatewayIp        string `json:"gateway,omitempty"`
 	StaticGatewayIpPrivate string `json:"gateway_private,omitempty"`
 	StaticSubnetSize       int    `json:"subnet_size,omitempty"`
+
+	// vCenter inventory paths, see esx.Options
+	Datacenter     string `json:"datacenter,omitempty"`
+	Cluster        string `json:"cluster,omitempty"`
+	ResourcePool   string `json:"resource_pool,omitempty"`
+	Datastore      string `json:"datastore,omitempty"`
+	Folder         string `json:"folder,omitempty"`
+	Network        string `json:"network,omitempty"`
+	PrivateNetwork string `json:"private_network,omitempty"`
 }
 
 // ReadESXConfig decodes a ESX config file, which is a custom format
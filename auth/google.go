@@ -78,13 +78,31 @@ func readCache(cachePath string) (*oauth2.Token, error) {
 	return tok, nil
 }
 
-func getToken() (*oauth2.Token, error) {
+func googleCachePath() (string, error) {
 	userInfo, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userInfo.HomeDir, ".mantle-cache-google.json"), nil
+}
+
+// HaveGoogleToken reports whether GoogleClient can authorize without
+// prompting for a token.
+func HaveGoogleToken() bool {
+	cachePath, err := googleCachePath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(cachePath)
+	return err == nil
+}
+
+func getToken() (*oauth2.Token, error) {
+	cachePath, err := googleCachePath()
 	if err != nil {
 		return nil, err
 	}
 
-	cachePath := filepath.Join(userInfo.HomeDir, ".mantle-cache-google.json")
 	tok, err := readCache(cachePath)
 	if err != nil {
 		log.Printf("Error reading google token cache file: %v", err)
@@ -0,0 +1,61 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+const HetznerConfigPath = ".config/hetzner.json"
+
+// HetznerProfile represents a parsed Hetzner Cloud profile.  This is a
+// custom format specific to Mantle.
+type HetznerProfile struct {
+	Token string `json:"token"`
+}
+
+// ReadHetznerConfig decodes a Hetzner Cloud config file, which is a custom
+// format used by Mantle to hold project API tokens.
+//
+// If path is empty, $HOME/.config/hetzner.json is read.
+func ReadHetznerConfig(path string) (map[string]HetznerProfile, error) {
+	if path == "" {
+		user, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(user.HomeDir, HetznerConfigPath)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var profiles map[string]HetznerProfile
+	if err := json.NewDecoder(f).Decode(&profiles); err != nil {
+		return nil, err
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("Hetzner config %q contains no profiles", path)
+	}
+
+	return profiles, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar-linux/mantle/sdk"
+)
+
+var (
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the shared SDK and image download cache",
+	}
+	cacheListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List cached downloads",
+		Run:   runCacheList,
+	}
+	cachePruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove cached downloads",
+		Long: `Remove cached downloads.
+
+Entries not used for longer than --older-than are removed, or all of
+them with --all. Checkouts keep their hard linked copies.`,
+		Run: runCachePrune,
+	}
+
+	cacheDir       string
+	cacheJSON      bool
+	cacheOlderThan time.Duration
+	cacheAll       bool
+	cacheDryRun    bool
+)
+
+func init() {
+	cacheCmd.PersistentFlags().StringVar(&cacheDir,
+		"cache-dir", sdk.DefaultCacheDir(), "Download cache directory")
+
+	cacheListCmd.Flags().BoolVar(&cacheJSON,
+		"json", false, "Print entries as JSON")
+	cacheCmd.AddCommand(cacheListCmd)
+
+	cachePruneCmd.Flags().DurationVar(&cacheOlderThan,
+		"older-than", 30*24*time.Hour, "Remove entries not used for this long")
+	cachePruneCmd.Flags().BoolVar(&cacheAll,
+		"all", false, "Remove all entries")
+	cachePruneCmd.Flags().BoolVar(&cacheDryRun,
+		"dry-run", false, "Only print what would be removed")
+	cacheCmd.AddCommand(cachePruneCmd)
+
+	root.AddCommand(cacheCmd)
+}
+
+func runCacheList(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		plog.Fatal("No args accepted")
+	}
+
+	cache := &sdk.Cache{Dir: cacheDir}
+	entries, err := cache.List()
+	if err != nil {
+		plog.Fatal(err)
+	}
+
+	if cacheJSON {
+		if entries == nil {
+			entries = []*sdk.CacheEntry{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			plog.Fatal(err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "DIGEST\tSIZE\tSIGNED\tLAST USED\tURL\n")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%.12s\t%d\t%t\t%s\t%s\n", e.Digest, e.Size, e.Signed,
+			e.LastUsed.Local().Format(time.RFC3339), e.URL)
+	}
+	w.Flush()
+}
+
+func runCachePrune(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		plog.Fatal("No args accepted")
+	}
+
+	cache := &sdk.Cache{Dir: cacheDir}
+	cutoff := time.Now().Add(-cacheOlderThan)
+	removed, err := cache.Prune(func(e *sdk.CacheEntry) bool {
+		return cacheAll || e.LastUsed.Before(cutoff)
+	}, cacheDryRun)
+	if err != nil {
+		plog.Fatalf("Pruning cache failed: %v", err)
+	}
+
+	for _, e := range removed {
+		if cacheDryRun {
+			fmt.Printf("Would remove %s\n", e.URL)
+		} else {
+			fmt.Printf("Removed %s\n", e.URL)
+		}
+	}
+}
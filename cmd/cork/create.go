@@ -15,6 +15,7 @@
 package main
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 
@@ -39,6 +40,10 @@ const (
 	// in Flatcar SDK to v2.10 with python3, and set the default branch back
 	// to "stable".
 	repoUpstreamBranch = "maint"
+
+	// pinnedManifestName is the file name a pinned manifest is copied
+	// to in .repo/manifests for `cork create --from-pinned`.
+	pinnedManifestName = "pinned.xml"
 )
 
 var (
@@ -61,9 +66,12 @@ var (
 
 	// only for `create` command
 	allowReplace bool
+	fromPinned   string
+	pinned       *repo.Manifest
 
 	// only for `enter` command
 	bindGpgAgent bool
+	rootless     bool
 
 	// for create/update/enter
 	useHostDNS bool
@@ -77,6 +85,10 @@ var (
 
 	verifyKeyFile string
 
+	// only for `verify` command
+	verifyPinned string
+	verifyJSON   bool
+
 	scriptsPatch string
 	portagePatch string
 	overlayPatch string
@@ -158,11 +170,15 @@ func init() {
 	createCmd.Flags().AddFlagSet(creationFlags)
 	createCmd.Flags().BoolVar(&allowReplace,
 		"replace", false, "Replace an existing SDK chroot")
+	createCmd.Flags().StringVar(&fromPinned,
+		"from-pinned", "", "Reproduce the source tree and SDK version of a pinned manifest")
 	root.AddCommand(createCmd)
 
 	enterCmd.Flags().AddFlagSet(chrootFlags)
 	enterCmd.Flags().BoolVar(&bindGpgAgent,
 		"bind-gpg-agent", true, "bind mount the gpg agent socket directory")
+	enterCmd.Flags().BoolVar(&rootless,
+		"rootless", false, "Enter the SDK chroot without root privileges, using user namespaces")
 	root.AddCommand(enterCmd)
 
 	deleteCmd.Flags().AddFlagSet(chrootFlags)
@@ -184,6 +200,10 @@ func init() {
 		"new-version", "", "Hint at the new version. Defaults to the version in version.txt")
 	root.AddCommand(updateCmd)
 
+	verifyCmd.Flags().StringVar(&verifyPinned,
+		"pinned", "", "Check the repo tree against a pinned manifest instead")
+	verifyCmd.Flags().BoolVar(&verifyJSON,
+		"json", false, "Print differences from the pinned manifest as JSON")
 	root.AddCommand(verifyCmd)
 }
 
@@ -233,6 +253,24 @@ func runCreate(cmd *cobra.Command, args []string) {
 		plog.Fatal("No args accepted")
 	}
 
+	if fromPinned != "" {
+		var err error
+		pinned, err = repo.LoadManifest(fromPinned)
+		if err != nil {
+			plog.Fatalf("Loading pinned manifest failed: %v", err)
+		}
+		if !repo.IsPinned(pinned) {
+			plog.Fatalf("%s is not a pinned manifest", fromPinned)
+		}
+		if scriptsPatch != "" || portagePatch != "" || overlayPatch != "" {
+			plog.Fatal("Patches cannot be applied to a pinned source tree")
+		}
+		if sdkVersion == "" && pinned.SDK != nil {
+			sdkVersion = pinned.SDK.Version
+			plog.Noticef("Found SDK version %s in pinned manifest", sdkVersion)
+		}
+	}
+
 	if sdkVersion == "" {
 		plog.Noticef("Detecting SDK version")
 
@@ -255,6 +293,14 @@ func runCreate(cmd *cobra.Command, args []string) {
 	unpackChroot(allowReplace)
 	updateRepo()
 	sdk.SetManifestSDKVersion(sdkVersion)
+
+	if pinned != nil {
+		drift, err := repo.VerifyPinned(sdk.RepoRoot(), pinned, sdkVersion)
+		if err != nil {
+			plog.Fatalf("Verify failed: %v", err)
+		}
+		reportDrift(drift)
+	}
 }
 
 func unpackChroot(replace bool) {
@@ -289,12 +335,20 @@ func updateRepo() {
 		}
 	}
 
+	syncManifest := ""
+	if pinned != nil {
+		if err := writePinnedManifest(); err != nil {
+			plog.Fatalf("Writing pinned manifest failed: %v", err)
+		}
+		syncManifest = pinnedManifestName
+	}
+
 	verbose := plog.LevelAt(capnslog.INFO)
-	if err := sdk.RepoSync(chrootName, forceSync, verbose, useHostDNS); err != nil {
+	if err := sdk.RepoSyncManifest(chrootName, syncManifest, forceSync, verbose, useHostDNS); err != nil {
 		plog.Fatalf("repo sync failed: %v", err)
 	}
 
-	if repoVerify {
+	if repoVerify && pinned == nil {
 		if err := repo.VerifySync(manifestName); err != nil {
 			plog.Fatalf("Verify failed: %v", err)
 		}
@@ -317,8 +371,27 @@ func updateRepo() {
 	}
 }
 
+// writePinnedManifest puts the pinned manifest into the manifests checkout
+// so repo sync can use it.
+func writePinnedManifest() error {
+	path := filepath.Join(sdk.RepoRoot(), ".repo", "manifests", pinnedManifestName)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := repo.WriteManifest(f, pinned); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func runEnter(cmd *cobra.Command, args []string) {
-	err := sdk.Enter(chrootName, bindGpgAgent, useHostDNS, args...)
+	enter := sdk.Enter
+	if rootless {
+		enter = sdk.EnterRootless
+	}
+	err := enter(chrootName, bindGpgAgent, useHostDNS, args...)
 	if err != nil && len(args) != 0 {
 		plog.Fatalf("Running %v failed: %v", args, err)
 	}
@@ -412,7 +485,48 @@ func runVerify(cmd *cobra.Command, args []string) {
 		plog.Fatal("No args accepted")
 	}
 
-	if err := repo.VerifySync(""); err != nil {
+	if verifyPinned == "" {
+		if verifyJSON {
+			plog.Fatal("--json requires --pinned")
+		}
+		if err := repo.VerifySync(""); err != nil {
+			plog.Fatalf("Verify failed: %v", err)
+		}
+		return
+	}
+
+	m, err := repo.LoadManifest(verifyPinned)
+	if err != nil {
+		plog.Fatalf("Loading pinned manifest failed: %v", err)
+	}
+	var version string
+	if ver, err := sdk.VersionsFromManifest(); err == nil {
+		version = ver.SDKVersion
+	}
+	drift, err := repo.VerifyPinned(sdk.RepoRoot(), m, version)
+	if err != nil {
 		plog.Fatalf("Verify failed: %v", err)
 	}
+
+	if verifyJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(drift); err != nil {
+			plog.Fatal(err)
+		}
+		if len(drift) != 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	reportDrift(drift)
+}
+
+func reportDrift(drift []repo.Drift) {
+	for _, d := range drift {
+		plog.Error(d)
+	}
+	if len(drift) != 0 {
+		plog.Fatalf("Verify failed: %d differences from pinned manifest", len(drift))
+	}
 }
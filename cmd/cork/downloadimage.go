@@ -163,6 +163,8 @@ func runDownloadImage(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	// images are shared with other checkouts through the download cache
+	cache := sdk.DefaultCache()
 	for _, suffixes := range downloadImagePlatformList {
 		for _, suffix := range suffixes {
 			fileName := downloadImagePrefix + suffix
@@ -171,18 +173,23 @@ func runDownloadImage(cmd *cobra.Command, args []string) {
 			// path.Join doesn't work with urls
 			url := strings.TrimRight(downloadImageRoot, "/") + "/" + fileName
 
+			var entry *sdk.CacheEntry
 			if downloadImageVerify {
 				plog.Noticef("Verifying and updating to latest image %v", fileName)
-				err := sdk.UpdateSignedFile(filePath, url, client, downloadImageVerifyKeyFile)
+				entry, err = cache.FetchSigned(url, client, downloadImageVerifyKeyFile)
 				if err != nil {
 					plog.Fatalf("updating signed file: %v", err)
 				}
 			} else {
 				plog.Noticef("Starting non-verified image update %v", fileName)
-				if err := sdk.UpdateFile(filePath, url, client); err != nil {
+				entry, err = cache.Fetch(url, client)
+				if err != nil {
 					plog.Fatalf("downloading image: %v", err)
 				}
 			}
+			if err := cache.Link(entry, filePath); err != nil {
+				plog.Fatalf("linking %v from cache: %v", fileName, err)
+			}
 		}
 	}
 }
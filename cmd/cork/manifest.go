@@ -0,0 +1,163 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar-linux/mantle/sdk"
+	"github.com/flatcar-linux/mantle/sdk/repo"
+)
+
+var (
+	manifestCmd = &cobra.Command{
+		Use:   "manifest",
+		Short: "Work with repo release manifests",
+	}
+	manifestDiffCmd = &cobra.Command{
+		Use:   "diff <old> <new>",
+		Short: "Compare the projects of two release manifests",
+		Long: `Compare the projects of two release manifests.
+
+Both manifests are resolved, including include, extend-project and
+remove-project elements, and the added, removed and changed projects
+are printed. If --mirror points at a local mirror of the projects,
+the commits between the old and new revision of each changed project
+are listed as well.`,
+		Run: runManifestDiff,
+	}
+	manifestPinCmd = &cobra.Command{
+		Use:   "pin <manifest>",
+		Short: "Resolve every project revision of a manifest to a commit",
+		Long: `Resolve every project revision of a manifest to a commit.
+
+The manifest is resolved like for diff and written out with the revision
+of each project replaced by a commit SHA1 and the SDK version recorded,
+so that cork create --from-pinned can reproduce the source tree. By
+default revisions are looked up on the project remotes; with --tree the
+commits checked out in the local repo tree are used instead.`,
+		Run: runManifestPin,
+	}
+
+	manifestMirror string
+	manifestFormat string
+
+	pinTree        bool
+	pinManifestURL string
+	pinSDKVersion  string
+	pinOutput      string
+)
+
+func init() {
+	manifestDiffCmd.Flags().StringVar(&manifestMirror,
+		"mirror", "", "Local mirror of the projects, used for shortlogs")
+	manifestDiffCmd.Flags().StringVar(&manifestFormat,
+		"format", "markdown", "Output format: markdown or json")
+	manifestCmd.AddCommand(manifestDiffCmd)
+
+	manifestPinCmd.Flags().BoolVar(&pinTree,
+		"tree", false, "Pin to the commits checked out in the local repo tree")
+	manifestPinCmd.Flags().StringVar(&pinManifestURL,
+		"manifest-url", coreosManifestURL, "Manifest git repo location, used to resolve relative remotes")
+	manifestPinCmd.Flags().StringVar(&pinSDKVersion,
+		"sdk-version", "", "SDK version. Defaults to the SDK version in version.txt next to the manifest")
+	manifestPinCmd.Flags().StringVarP(&pinOutput,
+		"output", "o", "", "Write the pinned manifest to a file instead of stdout")
+	manifestCmd.AddCommand(manifestPinCmd)
+	root.AddCommand(manifestCmd)
+}
+
+func runManifestDiff(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		plog.Fatal("Expected old and new manifest paths")
+	}
+	if manifestFormat != "markdown" && manifestFormat != "json" {
+		plog.Fatalf("Unsupported format %q", manifestFormat)
+	}
+
+	oldManifest, err := repo.LoadManifest(args[0])
+	if err != nil {
+		plog.Fatalf("Loading manifest: %v", err)
+	}
+	newManifest, err := repo.LoadManifest(args[1])
+	if err != nil {
+		plog.Fatalf("Loading manifest: %v", err)
+	}
+
+	diff := repo.DiffManifests(oldManifest, newManifest)
+	if manifestMirror != "" {
+		if err := diff.Shortlogs(manifestMirror); err != nil {
+			plog.Fatalf("Generating shortlogs: %v", err)
+		}
+	}
+
+	if manifestFormat == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(diff)
+	} else {
+		err = diff.WriteMarkdown(os.Stdout)
+	}
+	if err != nil {
+		plog.Fatal(err)
+	}
+}
+
+func runManifestPin(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		plog.Fatal("Expected a manifest path")
+	}
+
+	m, err := repo.LoadManifest(args[0])
+	if err != nil {
+		plog.Fatalf("Loading manifest: %v", err)
+	}
+
+	version := pinSDKVersion
+	if version == "" {
+		ver, err := sdk.VersionsFromDir(filepath.Dir(args[0]))
+		if err != nil {
+			plog.Fatalf("Detecting SDK version: %v", err)
+		}
+		version = ver.SDKVersion
+	}
+	m.SDK = &repo.SDK{Version: version}
+
+	resolve := repo.RemoteResolver(m, pinManifestURL)
+	if pinTree {
+		resolve = repo.TreeResolver(sdk.RepoRoot())
+	}
+	if err := repo.PinManifest(m, resolve); err != nil {
+		plog.Fatalf("Pinning manifest: %v", err)
+	}
+
+	out := os.Stdout
+	if pinOutput != "" {
+		out, err = os.Create(pinOutput)
+		if err != nil {
+			plog.Fatal(err)
+		}
+	}
+	if err := repo.WriteManifest(out, m); err != nil {
+		plog.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		plog.Fatal(err)
+	}
+}
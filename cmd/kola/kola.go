@@ -53,6 +53,22 @@ var (
 If the glob pattern is exactly equal to the name of a single test, any
 restrictions on the versions of Container Linux supported by that test
 will be ignored.
+
+Flags and test patterns can be read from a YAML profile with --profile:
+
+  platform: aws
+  parallel: 4
+  tests: [cl.basic]
+  aws:
+    region: ${AWS_REGION}
+
+Nested keys are joined with "-", so this sets --aws-region. Environment
+variables are expanded and flags on the command line override the
+profile. Check profiles with "kola profile validate".
+
+To spread a run across CI workers, give each worker --shard i/n with the
+same tests and --shard-durations, then combine their output directories
+with "kola merge-reports".
 `,
 		Run:    runRun,
 		PreRun: preRun,
@@ -67,9 +83,12 @@ will be ignored.
 	listJSON   bool
 	listFilter bool
 
-	runRemove     bool
-	runSetSSHKeys bool
-	runSSHKeys    []string
+	runRemove      bool
+	runSetSSHKeys  bool
+	runSSHKeys     []string
+	runProfilePath string
+	runShard       string
+	runDurations   string
 )
 
 func init() {
@@ -82,6 +101,9 @@ func init() {
 	cmdRun.Flags().BoolVarP(&runRemove, "remove", "r", true, "remove instances after test exits (--remove=false will keep them)")
 	cmdRun.Flags().BoolVarP(&runSetSSHKeys, "keys", "k", false, "add SSH keys from --key options")
 	cmdRun.Flags().StringSliceVar(&runSSHKeys, "key", nil, "path to SSH public key (default: SSH agent + ~/.ssh/id_{rsa,dsa,ecdsa,ed25519}.pub)")
+	cmdRun.Flags().StringVar(&runProfilePath, "profile", "", "YAML file with flags and test patterns; flags given on the command line take precedence")
+	cmdRun.Flags().StringVar(&runShard, "shard", "", "only run part i of n of the selected tests, given as i/n")
+	cmdRun.Flags().StringVar(&runDurations, "shard-durations", "", "report.json of a previous run to balance --shard by test duration")
 
 }
 
@@ -90,6 +112,11 @@ func main() {
 }
 
 func preRun(cmd *cobra.Command, args []string) {
+	if err := applyProfile(cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(3)
+	}
+
 	err := syncOptions()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -109,10 +136,17 @@ func runRun(cmd *cobra.Command, args []string) {
 	var patterns []string
 	if len(args) >= 1 {
 		patterns = args
+	} else if runProfile != nil && len(runProfile.Tests) != 0 {
+		patterns = runProfile.Tests
 	} else {
 		patterns = []string{"*"} // run all tests by default
 	}
 
+	if err := setupShard(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2)
+	}
+
 	var err error
 	outputDir, err = kola.SetupOutputDir(outputDir, kolaPlatform)
 	if err != nil {
@@ -183,6 +217,11 @@ func writeProps() error {
 		Image       string `json:"image"`
 		MachineType string `json:"type"`
 	}
+	type Hetzner struct {
+		Location   string `json:"location"`
+		ServerType string `json:"servertype"`
+		Image      string `json:"image"`
+	}
 	type OpenStack struct {
 		Region string `json:"region"`
 		Image  string `json:"image"`
@@ -210,6 +249,7 @@ func writeProps() error {
 		DO              DO        `json:"do"`
 		ESX             ESX       `json:"esx"`
 		GCE             GCE       `json:"gce"`
+		Hetzner         Hetzner   `json:"hetzner"`
 		OpenStack       OpenStack `json:"openstack"`
 		Packet          Packet    `json:"packet"`
 		QEMU            QEMU      `json:"qemu"`
@@ -249,6 +289,11 @@ func writeProps() error {
 			Image:       kola.GCEOptions.Image,
 			MachineType: kola.GCEOptions.MachineType,
 		},
+		Hetzner: Hetzner{
+			Location:   kola.HetznerOptions.Location,
+			ServerType: kola.HetznerOptions.ServerType,
+			Image:      kola.HetznerOptions.Image,
+		},
 		OpenStack: OpenStack{
 			Region: kola.OpenStackOptions.Region,
 			Image:  kola.OpenStackOptions.Image,
@@ -39,7 +39,7 @@ var (
 	kolaOffering       string
 	defaultTargetBoard = sdk.DefaultBoard()
 	kolaArchitectures  = []string{"amd64"}
-	kolaPlatforms      = []string{"aws", "azure", "do", "esx", "external", "gce", "openstack", "packet", "qemu", "qemu-unpriv"}
+	kolaPlatforms      = []string{"aws", "azure", "do", "esx", "external", "gce", "hetzner", "libvirt", "openstack", "packet", "qemu", "qemu-unpriv"}
 	kolaDistros        = []string{"cl", "fcos", "rhcos"}
 	kolaChannels       = []string{"alpha", "beta", "stable", "edge", "lts"}
 	kolaOfferings      = []string{"basic", "pro"}
@@ -73,6 +73,8 @@ func init() {
 	root.PersistentFlags().StringVarP(&kola.Options.Distribution, "distro", "b", "cl", "Distribution: "+strings.Join(kolaDistros, ", "))
 	root.PersistentFlags().IntVarP(&kola.TestParallelism, "parallel", "j", 1, "number of tests to run in parallel")
 	sv(&kola.TAPFile, "tapfile", "", "file to write TAP results to")
+	sv(&kola.ImageRoot, "image-root", "", "Root filesystem to take container image binaries from (default board root for foreign architectures)")
+	sv(&kola.EventsDest, "events", "", "stream JSON test events to a file, unix:PATH or tcp:HOST:PORT")
 	sv(&kola.Options.BaseName, "basename", "kola", "Cluster name prefix")
 	ss("debug-systemd-unit", []string{}, "full-unit-name.service to enable SYSTEMD_LOG_LEVEL=debug on. Specify multiple times for multiple units.")
 	sv(&kola.UpdatePayloadFile, "update-payload", "", "Path to an update payload that should be made available to tests")
@@ -93,6 +95,7 @@ func init() {
 	sv(&kola.AWSOptions.InstanceType, "aws-type", "m4.large", "AWS instance type")
 	sv(&kola.AWSOptions.SecurityGroup, "aws-sg", "kola", "AWS security group name")
 	sv(&kola.AWSOptions.IAMInstanceProfile, "aws-iam-profile", "kola", "AWS IAM instance profile name")
+	sv(&kola.AWSOptions.Endpoint, "aws-endpoint", "", "AWS API endpoint URL (for testing)")
 
 	// azure-specific options
 	sv(&kola.AzureOptions.AzureProfile, "azure-profile", "", "Azure profile (default \"~/"+auth.AzureProfilePath+"\")")
@@ -115,12 +118,31 @@ func init() {
 	sv(&kola.DOOptions.Region, "do-region", "sfo2", "DigitalOcean region slug")
 	sv(&kola.DOOptions.Size, "do-size", "s-1vcpu-2gb", "DigitalOcean size slug")
 	sv(&kola.DOOptions.Image, "do-image", "alpha", "DigitalOcean image ID, {alpha, beta, stable}, or user image name")
+	sv(&kola.DOOptions.Endpoint, "do-endpoint", "", "DigitalOcean API endpoint URL (for testing)")
+
+	// hetzner-specific options
+	sv(&kola.HetznerOptions.ConfigPath, "hetzner-config-file", "", "Hetzner config file (default \"~/"+auth.HetznerConfigPath+"\")")
+	sv(&kola.HetznerOptions.Profile, "hetzner-profile", "", "Hetzner profile (default \"default\")")
+	sv(&kola.HetznerOptions.Token, "hetzner-token", "", "Hetzner project API token (overrides config file)")
+	sv(&kola.HetznerOptions.Location, "hetzner-location", "fsn1", "Hetzner location name")
+	sv(&kola.HetznerOptions.ServerType, "hetzner-server-type", "cx22", "Hetzner server type name")
+	sv(&kola.HetznerOptions.Image, "hetzner-image", "", "Hetzner numeric image ID or snapshot description")
+	sv(&kola.HetznerOptions.Network, "hetzner-network", "", "Hetzner private network name or ID (default public addresses only)")
+	sv(&kola.HetznerOptions.Endpoint, "hetzner-endpoint", "", "Hetzner API endpoint URL (for testing)")
 
 	// esx-specific options
 	sv(&kola.ESXOptions.ConfigPath, "esx-config-file", "", "ESX config file (default \"~/"+auth.ESXConfigPath+"\")")
 	sv(&kola.ESXOptions.Server, "esx-server", "", "ESX server")
 	sv(&kola.ESXOptions.Profile, "esx-profile", "", "ESX profile (default \"default\")")
 	sv(&kola.ESXOptions.BaseVMName, "esx-base-vm", "", "ESX base VM name")
+	sv(&kola.ESXOptions.BaseSnapshot, "esx-base-snapshot", "", "ESX base VM snapshot to create linked clones from")
+	sv(&kola.ESXOptions.Datacenter, "esx-datacenter", "", "vCenter datacenter (default the only one)")
+	sv(&kola.ESXOptions.Cluster, "esx-cluster", "", "vCenter compute cluster")
+	sv(&kola.ESXOptions.ResourcePool, "esx-resource-pool", "", "vCenter resource pool (default the cluster's or the only one)")
+	sv(&kola.ESXOptions.Datastore, "esx-datastore", "", "vCenter datastore (default the only one)")
+	sv(&kola.ESXOptions.Folder, "esx-folder", "", "vCenter VM folder (default the datacenter's VM folder)")
+	sv(&kola.ESXOptions.Network, "esx-network", "", "ESX network (default the only one)")
+	sv(&kola.ESXOptions.PrivateNetwork, "esx-private-network", "", "ESX network for a second NIC carrying the private static IP")
 	sv(&kola.ESXOptions.OvaPath, "esx-ova-path", "", "ESX VM image to upload instead of using the base VM (build with: ./image_to_vm.sh --format=vmware_ova ...)")
 	root.PersistentFlags().IntVarP(&kola.ESXOptions.StaticIPs, "esx-static-ips", "", 0, "Instead of DHCP, use this amount of static IP addresses")
 	sv(&kola.ESXOptions.StaticGatewayIp, "esx-gateway", "", "Public gateway (only needed for static IP addresses)")
@@ -147,6 +169,14 @@ func init() {
 	sv(&kola.GCEOptions.Network, "gce-network", "default", "GCE network")
 	bv(&kola.GCEOptions.ServiceAuth, "gce-service-auth", false, "for non-interactive auth when running within GCE")
 	sv(&kola.GCEOptions.JSONKeyFile, "gce-json-key", "", "use a service account's JSON key for authentication")
+	sv(&kola.GCEOptions.Endpoint, "gce-endpoint", "", "GCE compute API endpoint URL (for testing)")
+
+	// libvirt-specific options
+	sv(&kola.LibvirtOptions.URI, "libvirt-uri", "qemu:///system", "libvirt connection URI")
+	sv(&kola.LibvirtOptions.StoragePool, "libvirt-pool", "default", "libvirt storage pool for the image and machine disks")
+	sv(&kola.LibvirtOptions.Network, "libvirt-network", "", "libvirt network to attach machines to (default: a new network per cluster)")
+	root.PersistentFlags().IntVar(&kola.LibvirtOptions.Memory, "libvirt-memory", 2512, "libvirt machine memory in MiB")
+	root.PersistentFlags().IntVar(&kola.LibvirtOptions.CPUs, "libvirt-cpus", 2, "libvirt machine CPUs")
 
 	// openstack-specific options
 	sv(&kola.OpenStackOptions.ConfigPath, "openstack-config-file", "", "OpenStack config file (default \"~/"+auth.OpenStackConfigPath+"\")")
@@ -157,6 +187,7 @@ func init() {
 	sv(&kola.OpenStackOptions.Network, "openstack-network", "", "OpenStack network")
 	sv(&kola.OpenStackOptions.Domain, "openstack-domain", "", "OpenStack domain ID")
 	sv(&kola.OpenStackOptions.FloatingIPPool, "openstack-floating-ip-pool", "", "OpenStack floating IP pool for Compute v2 networking")
+	sv(&kola.OpenStackOptions.Endpoint, "openstack-endpoint", "", "OpenStack identity endpoint URL (overrides config file)")
 
 	// packet-specific options
 	sv(&kola.PacketOptions.ConfigPath, "packet-config-file", "", "Packet config file (default \"~/"+auth.PacketConfigPath+"\")")
@@ -170,12 +201,18 @@ func init() {
 	sv(&kola.PacketOptions.InstallerImageCpioURL, "packet-installer-image-cpio-url", "", "Packet installer image cpio URL, (default packet-installer-image-base-url/flatcar_production_pxe_image.cpio.gz)")
 	sv(&kola.PacketOptions.ImageURL, "packet-image-url", "", "Packet image URL (default board-dependent, e.g. \"https://alpha.release.flatcar-linux.net/amd64-usr/current/flatcar_production_packet_image.bin.bz2\")")
 	sv(&kola.PacketOptions.StorageURL, "packet-storage-url", "gs://users.developer.core-os.net/"+os.Getenv("USER")+"/mantle", "Google Storage base URL for temporary uploads")
+	sv(&kola.PacketOptions.Endpoint, "packet-endpoint", "", "Packet API endpoint URL (for testing)")
 
 	// QEMU-specific options
 	sv(&kola.QEMUOptions.Board, "board", defaultTargetBoard, "target board")
 	sv(&kola.QEMUOptions.DiskImage, "qemu-image", "", "path to CoreOS disk image")
 	sv(&kola.QEMUOptions.BIOSImage, "qemu-bios", "", "BIOS to use for QEMU vm")
 	bv(&kola.QEMUOptions.UseVanillaImage, "qemu-skip-mangle", false, "don't modify CL disk image to capture console log")
+	sv(&kola.QEMUOptions.Boot, "qemu-boot", "disk", "how QEMU machines boot: disk, pxe or pxe-install")
+	sv(&kola.QEMUOptions.PXEKernel, "qemu-pxe-kernel", "", "PXE kernel for --qemu-boot=pxe (default flatcar_production_pxe.vmlinuz next to the disk image)")
+	sv(&kola.QEMUOptions.PXEInitrd, "qemu-pxe-initrd", "", "PXE initramfs for --qemu-boot=pxe (default flatcar_production_pxe_image.cpio.gz next to the disk image)")
+	sv(&kola.QEMUOptions.InstallImage, "qemu-install-image", "", "image installed by --qemu-boot=pxe-install (default flatcar_production_image.bin.bz2 next to the disk image)")
+	root.PersistentFlags().StringSliceVar(&kola.QEMUOptions.RegistryImages, "qemu-registry-images", nil, "OCI layouts, image tarballs or image cache directories served to machines as registry mirror")
 }
 
 // Sync up the command line options if there is dependency
@@ -190,9 +227,11 @@ func syncOptions() error {
 	kola.ESXOptions.Board = board
 	kola.ExternalOptions.Board = board
 	kola.DOOptions.Board = board
+	kola.HetznerOptions.Board = board
 	kola.AzureOptions.Board = board
 	kola.AWSOptions.Board = board
 	kola.PacketOptions.Board = board
+	kola.LibvirtOptions.Board = board
 	kola.PacketOptions.GSOptions = &kola.GCEOptions
 
 	validateOption := func(name, item string, valid []string) error {
@@ -229,6 +268,20 @@ func syncOptions() error {
 		kola.QEMUOptions.DiskImage = image
 	}
 
+	imageDir := filepath.Dir(kola.QEMUOptions.DiskImage)
+	if kola.QEMUOptions.PXEKernel == "" {
+		kola.QEMUOptions.PXEKernel = filepath.Join(imageDir, "flatcar_production_pxe.vmlinuz")
+	}
+	if kola.QEMUOptions.PXEInitrd == "" {
+		kola.QEMUOptions.PXEInitrd = filepath.Join(imageDir, "flatcar_production_pxe_image.cpio.gz")
+	}
+	if kola.QEMUOptions.InstallImage == "" {
+		kola.QEMUOptions.InstallImage = filepath.Join(imageDir, "flatcar_production_image.bin.bz2")
+	}
+
+	// libvirt boots the same image as qemu
+	kola.LibvirtOptions.DiskImage = kola.QEMUOptions.DiskImage
+
 	if kola.QEMUOptions.BIOSImage == "" {
 		kola.QEMUOptions.BIOSImage = kolaDefaultBIOS[kola.QEMUOptions.Board]
 	}
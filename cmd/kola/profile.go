@@ -0,0 +1,99 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/flatcar-linux/mantle/kola/profile"
+)
+
+var (
+	cmdProfile = &cobra.Command{
+		Use:   "profile",
+		Short: "Manage kola run profiles",
+	}
+
+	cmdProfileValidate = &cobra.Command{
+		Use:   "validate <profile.yaml>...",
+		Short: "Check run profiles for unknown keys and invalid values",
+		Run:   runProfileValidate,
+	}
+
+	// runProfile is loaded by preRun when --profile is given.
+	runProfile *profile.Profile
+)
+
+func init() {
+	cmdProfile.AddCommand(cmdProfileValidate)
+	root.AddCommand(cmdProfile)
+}
+
+// runFlags returns all flags accepted by kola run. They share their
+// variables with the real flags, so profiles are only validated against
+// them and never applied.
+func runFlags() *pflag.FlagSet {
+	flags := pflag.NewFlagSet("run", pflag.ContinueOnError)
+	flags.AddFlagSet(cmdRun.Flags())
+	flags.AddFlagSet(root.PersistentFlags())
+	return flags
+}
+
+// applyProfile loads the profile given with --profile and sets the flags
+// of cmd that were not given on the command line.
+func applyProfile(cmd *cobra.Command) error {
+	if runProfilePath == "" {
+		return nil
+	}
+	p, err := profile.Load(runProfilePath)
+	if err != nil {
+		return err
+	}
+	if err := p.Apply(cmd.Flags()); err != nil {
+		return fmt.Errorf("%s: %v", runProfilePath, err)
+	}
+	runProfile = p
+	return nil
+}
+
+func runProfileValidate(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: kola profile validate <profile.yaml>...\n")
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range args {
+		p, err := profile.Load(path)
+		if err == nil {
+			if err = p.Validate(runFlags()); err != nil {
+				err = fmt.Errorf("%s: %v", path, err)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: OK\n", path)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar-linux/mantle/harness"
+	"github.com/flatcar-linux/mantle/harness/reporters"
+	"github.com/flatcar-linux/mantle/kola"
+	"github.com/flatcar-linux/mantle/kola/shard"
+)
+
+var (
+	cmdMergeReports = &cobra.Command{
+		Use:   "merge-reports --output-dir <dir> <shard output dir>...",
+		Short: "Combine the reports of sharded kola runs",
+		Long: `Combine the report.json and test.tap files of the output
+directories of "kola run --shard" invocations into the directory given
+with --output-dir.`,
+		Run: runMergeReports,
+	}
+)
+
+func init() {
+	root.AddCommand(cmdMergeReports)
+}
+
+// setupShard configures kola from --shard and --shard-durations.
+func setupShard() error {
+	if runShard == "" {
+		if runDurations != "" {
+			return fmt.Errorf("--shard-durations requires --shard")
+		}
+		return nil
+	}
+
+	sh, err := shard.Parse(runShard)
+	if err != nil {
+		return err
+	}
+	kola.TestShard = sh
+
+	if runDurations != "" {
+		kola.TestDurations, err = reporters.JSONDurations(runDurations)
+		if err != nil {
+			return fmt.Errorf("reading test durations: %v", err)
+		}
+	}
+	return nil
+}
+
+func runMergeReports(cmd *cobra.Command, args []string) {
+	if len(args) == 0 || outputDir == "" {
+		fmt.Fprintf(os.Stderr, "Usage: kola merge-reports --output-dir <dir> <shard output dir>...\n")
+		os.Exit(2)
+	}
+
+	var reports, taps []string
+	for _, dir := range args {
+		reports = append(reports, filepath.Join(dir, "reports", "report.json"))
+		taps = append(taps, filepath.Join(dir, "test.tap"))
+	}
+
+	reportDir := filepath.Join(outputDir, "reports")
+	if err := os.MkdirAll(reportDir, 0777); err != nil {
+		plog.Fatal(err)
+	}
+	if err := reporters.MergeJSONReports(reportDir, "report.json", reports); err != nil {
+		plog.Fatalf("Merging reports failed: %v", err)
+	}
+
+	tap, err := os.Create(filepath.Join(outputDir, "test.tap"))
+	if err != nil {
+		plog.Fatal(err)
+	}
+	defer tap.Close()
+	if err := harness.MergeTAP(tap, taps); err != nil {
+		plog.Fatalf("Merging TAP logs failed: %v", err)
+	}
+}
@@ -52,6 +52,7 @@ var (
 	spawnMachineOptions string
 	spawnSetSSHKeys     bool
 	spawnSSHKeys        []string
+	spawnConsole        bool
 )
 
 func init() {
@@ -64,9 +65,15 @@ func init() {
 	cmdSpawn.Flags().StringVar(&spawnMachineOptions, "qemu-options", "", "experimental: path to QEMU machine options json")
 	cmdSpawn.Flags().BoolVarP(&spawnSetSSHKeys, "keys", "k", false, "add SSH keys from --key options")
 	cmdSpawn.Flags().StringSliceVar(&spawnSSHKeys, "key", nil, "path to SSH public key (default: SSH agent + ~/.ssh/id_{rsa,dsa,ecdsa,ed25519}.pub)")
+	cmdSpawn.Flags().BoolVar(&spawnConsole, "console", false, "attach to the serial console of an instance instead of spawning a shell, without waiting for SSH (qemu only)")
 	root.AddCommand(cmdSpawn)
 }
 
+// qemuCluster is implemented by the clusters of the qemu platforms.
+type qemuCluster interface {
+	NewMachineWithOptions(userdata *conf.UserData, options platform.MachineOptions) (platform.Machine, error)
+}
+
 func runSpawn(cmd *cobra.Command, args []string) {
 	if err := doSpawn(cmd, args); err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
@@ -88,6 +95,10 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("Cluster Failed: nodecount must be one or more")
 	}
 
+	if spawnConsole && spawnOmahaPackage != "" {
+		return fmt.Errorf("--console can't be combined with --omaha-package")
+	}
+
 	var userdata *conf.UserData
 	if spawnUserData != "" {
 		userbytes, err := ioutil.ReadFile(spawnUserData)
@@ -162,20 +173,31 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 		var mach platform.Machine
 		var err error
 		plog.Infof("Spawning machine...")
-		if kolaPlatform == "qemu" && spawnMachineOptions != "" {
-			var b []byte
-			b, err = ioutil.ReadFile(spawnMachineOptions)
-			if err != nil {
-				return fmt.Errorf("Could not read machine options: %v", err)
+		if spawnMachineOptions != "" || spawnConsole {
+			qc, ok := cluster.(qemuCluster)
+			if !ok {
+				return errors.New("--qemu-options and --console are only supported on qemu")
 			}
 
 			var machineOpts platform.MachineOptions
-			err = json.Unmarshal(b, &machineOpts)
-			if err != nil {
-				return fmt.Errorf("Could not unmarshal machine options: %v", err)
+			if spawnMachineOptions != "" {
+				var b []byte
+				b, err = ioutil.ReadFile(spawnMachineOptions)
+				if err != nil {
+					return fmt.Errorf("Could not read machine options: %v", err)
+				}
+
+				err = json.Unmarshal(b, &machineOpts)
+				if err != nil {
+					return fmt.Errorf("Could not unmarshal machine options: %v", err)
+				}
+			}
+			if spawnConsole {
+				machineOpts.InteractiveConsole = true
+				machineOpts.SkipStartMachine = true
 			}
 
-			mach, err = cluster.(*qemu.Cluster).NewMachineWithOptions(userdata, machineOpts)
+			mach, err = qc.NewMachineWithOptions(userdata, machineOpts)
 		} else {
 			mach, err = cluster.NewMachine(userdata)
 		}
@@ -193,7 +215,15 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 		someMach = mach
 	}
 
-	if spawnShell {
+	if spawnConsole {
+		serial, err := someMach.(platform.ConsoleMachine).SerialConsole()
+		if err != nil {
+			return err
+		}
+		if err := platform.AttachConsole(serial); err != nil {
+			return fmt.Errorf("Attaching console failed: %v", err)
+		}
+	} else if spawnShell {
 		if spawnRemove {
 			reader := strings.NewReader(`PS1="\[\033[0;31m\][bound]\[\033[0m\] $PS1"` + "\n")
 			if err := platform.InstallFile(reader, someMach, "/etc/profile.d/kola-spawn-bound.sh"); err != nil {
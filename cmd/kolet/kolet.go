@@ -15,12 +15,16 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/spf13/cobra"
 
 	"github.com/flatcar-linux/mantle/cli"
+	"github.com/flatcar-linux/mantle/kola/native"
 	"github.com/flatcar-linux/mantle/kola/register"
 
 	// Register any tests that we may wish to execute in kolet.
@@ -41,13 +45,73 @@ var (
 		Short: "Run a given test's native function",
 		Run:   run,
 	}
+
+	resultFile string
+	timeout    time.Duration
 )
 
+func init() {
+	cmdRun.PersistentFlags().StringVar(&resultFile, "result-file", "", "write the function's result as JSON to this file")
+	cmdRun.PersistentFlags().DurationVar(&timeout, "timeout", 0, "override the function's timeout")
+}
+
 func run(cmd *cobra.Command, args []string) {
 	cmd.Usage()
 	os.Exit(2)
 }
 
+// runNative runs f, enforcing its timeout, and writes its result to
+// resultFile if set. Log lines are printed to stderr as they happen so kola
+// can stream them.
+func runNative(name string, f register.NativeFunc) error {
+	ctx := context.Background()
+	t := f.Timeout
+	if timeout != 0 {
+		t = timeout
+	}
+	if t > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t)
+		defer cancel()
+	}
+
+	result := native.NewResult(name, os.Stderr)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- f.Func(ctx, result)
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %v", t)
+	}
+	result.Finish(err)
+
+	if resultFile != "" {
+		if werr := writeResult(result); werr != nil {
+			plog.Errorf("writing result: %v", werr)
+		}
+	}
+	if err == nil && result.Failed() {
+		err = fmt.Errorf("%s failed", name)
+	}
+	return err
+}
+
+func writeResult(result *native.Result) error {
+	f, err := os.Create(resultFile)
+	if err != nil {
+		return err
+	}
+	if err := result.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func main() {
 	for testName, testObj := range register.Tests {
 		if len(testObj.NativeFuncs) == 0 {
@@ -58,13 +122,14 @@ func main() {
 			Run: run,
 		}
 		for nativeName := range testObj.NativeFuncs {
+			nativeName := nativeName
 			nativeFunc := testObj.NativeFuncs[nativeName]
 			nativeRun := func(cmd *cobra.Command, args []string) {
 				if len(args) != 0 {
 					cmd.Usage()
 					os.Exit(2)
 				}
-				if err := nativeFunc(); err != nil {
+				if err := runNative(nativeName, nativeFunc); err != nil {
 					plog.Fatal(err)
 				}
 				// Explicitly exit successfully.
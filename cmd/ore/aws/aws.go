@@ -22,6 +22,7 @@ import (
 	"github.com/flatcar-linux/mantle/cli"
 	"github.com/flatcar-linux/mantle/platform"
 	"github.com/flatcar-linux/mantle/platform/api/aws"
+	"github.com/flatcar-linux/mantle/platform/inventory"
 	"github.com/spf13/cobra"
 )
 
@@ -39,6 +40,7 @@ var (
 	profileName     string
 	accessKeyID     string
 	secretAccessKey string
+	endpoint        string
 )
 
 func init() {
@@ -52,27 +54,46 @@ func init() {
 	AWS.PersistentFlags().StringVar(&accessKeyID, "access-id", "", "AWS access key")
 	AWS.PersistentFlags().StringVar(&secretAccessKey, "secret-key", "", "AWS secret key")
 	AWS.PersistentFlags().StringVar(&region, "region", defaultRegion, "AWS region")
+	AWS.PersistentFlags().StringVar(&endpoint, "endpoint", "", "AWS API endpoint URL (for testing)")
 	cli.WrapPreRun(AWS, preflightCheck)
 }
 
 func preflightCheck(cmd *cobra.Command, args []string) error {
+	api, err := newAPI()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	API = api
+	return nil
+}
+
+func newAPI() (*aws.API, error) {
 	plog.Debugf("Running AWS Preflight check. Region: %v", region)
 	api, err := aws.New(&aws.Options{
 		Region:          region,
 		CredentialsFile: credentialsFile,
 		Profile:         profileName,
+		Endpoint:        endpoint,
 		Options:         &platform.Options{},
 	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "could not create AWS client: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("could not create AWS client: %v", err)
 	}
 	if err := api.PreflightCheck(); err != nil {
-		fmt.Fprintf(os.Stderr, "could not complete AWS preflight check: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("could not complete AWS preflight check: %v", err)
 	}
 
 	plog.Debugf("Preflight check success; we have liftoff")
-	API = api
-	return nil
+	return api, nil
+}
+
+// NewProvider creates an inventory provider for the AWS account
+// selected by the default options.
+func NewProvider() (inventory.Provider, error) {
+	api, err := newAPI()
+	if err != nil {
+		return nil, err
+	}
+	return api, nil
 }
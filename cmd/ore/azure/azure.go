@@ -15,12 +15,15 @@
 package azure
 
 import (
+	"fmt"
+
 	"github.com/coreos/pkg/capnslog"
 	"github.com/spf13/cobra"
 
 	"github.com/flatcar-linux/mantle/auth"
 	"github.com/flatcar-linux/mantle/cli"
 	"github.com/flatcar-linux/mantle/platform/api/azure"
+	"github.com/flatcar-linux/mantle/platform/inventory"
 )
 
 var (
@@ -52,16 +55,33 @@ func init() {
 func preauth(cmd *cobra.Command, args []string) error {
 	plog.Printf("Creating Azure API...")
 
-	a, err := azure.New(&azure.Options{
+	a, err := newAPI()
+	if err != nil {
+		plog.Fatalf("Failed to create Azure API: %v", err)
+	}
+
+	api = a
+	return nil
+}
+
+func newAPI() (*azure.API, error) {
+	return azure.New(&azure.Options{
 		AzureProfile:      azureProfile,
 		AzureAuthLocation: azureAuth,
 		AzureSubscription: azureSubscription,
 		Location:          azureLocation,
 	})
+}
+
+// NewProvider creates an inventory provider for the Azure subscription
+// selected by the default options.
+func NewProvider() (inventory.Provider, error) {
+	a, err := newAPI()
 	if err != nil {
-		plog.Fatalf("Failed to create Azure API: %v", err)
+		return nil, fmt.Errorf("creating Azure API: %v", err)
 	}
-
-	api = a
-	return nil
+	if err := a.SetupClients(); err != nil {
+		return nil, fmt.Errorf("setting up clients: %v", err)
+	}
+	return a, nil
 }
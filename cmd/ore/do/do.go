@@ -24,6 +24,7 @@ import (
 	"github.com/flatcar-linux/mantle/auth"
 	"github.com/flatcar-linux/mantle/cli"
 	"github.com/flatcar-linux/mantle/platform/api/do"
+	"github.com/flatcar-linux/mantle/platform/inventory"
 )
 
 var (
@@ -45,20 +46,39 @@ func init() {
 	DO.PersistentFlags().StringVar(&options.ConfigPath, "config-file", "", "config file (default \"~/"+auth.DOConfigPath+"\")")
 	DO.PersistentFlags().StringVar(&options.Profile, "profile", "", "profile (default \"default\")")
 	DO.PersistentFlags().StringVar(&options.AccessToken, "token", "", "access token (overrides config file)")
+	DO.PersistentFlags().StringVar(&options.Endpoint, "endpoint", "", "API endpoint URL (for testing)")
 	cli.WrapPreRun(DO, preflightCheck)
 }
 
 func preflightCheck(cmd *cobra.Command, args []string) error {
+	api, err := newAPI()
+	if err != nil {
+		return err
+	}
+	API = api
+	return nil
+}
+
+func newAPI() (*do.API, error) {
 	plog.Debugf("Running DigitalOcean preflight check")
 	api, err := do.New(&options)
 	if err != nil {
-		return fmt.Errorf("could not create DigitalOcean client: %v", err)
+		return nil, fmt.Errorf("could not create DigitalOcean client: %v", err)
 	}
 	if err := api.PreflightCheck(context.Background()); err != nil {
-		return fmt.Errorf("could not complete DigitalOcean preflight check: %v", err)
+		return nil, fmt.Errorf("could not complete DigitalOcean preflight check: %v", err)
 	}
 
 	plog.Debugf("Preflight check success; we have liftoff")
-	API = api
-	return nil
+	return api, nil
+}
+
+// NewProvider creates an inventory provider for the DigitalOcean account
+// selected by the default options.
+func NewProvider() (inventory.Provider, error) {
+	api, err := newAPI()
+	if err != nil {
+		return nil, err
+	}
+	return api, nil
 }
@@ -34,8 +34,9 @@ After a successful run, the final line of output will be the name of the VM crea
 		RunE: runBaseCreate,
 	}
 
-	ovaPath    string
-	baseVMName string
+	ovaPath      string
+	baseVMName   string
+	baseSnapshot string
 )
 
 func init() {
@@ -44,6 +45,7 @@ func init() {
 		sdk.BuildRoot()+"/images/amd64-usr/latest/flatcar_production_vmware_ova.ova",
 		"path to Flatcar image (build with: ./image_to_vm.sh --format=vmware_ova ...)")
 	cmdCreateBase.Flags().StringVar(&baseVMName, "name", "", "name of base VM")
+	cmdCreateBase.Flags().StringVar(&baseSnapshot, "snapshot", "", "snapshot the base VM for linked clones under this name")
 }
 
 func runBaseCreate(cmd *cobra.Command, args []string) error {
@@ -62,5 +64,13 @@ func runBaseCreate(cmd *cobra.Command, args []string) error {
 		fmt.Fprintf(os.Stderr, "Couldn't create base VM: %v\n", err)
 		os.Exit(1)
 	}
+
+	if baseSnapshot != "" {
+		err = API.CreateBaseSnapshot(vmName, baseSnapshot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't snapshot base VM: %v\n", err)
+			os.Exit(1)
+		}
+	}
 	return nil
 }
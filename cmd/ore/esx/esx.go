@@ -41,6 +41,12 @@ func init() {
 	ESX.PersistentFlags().StringVar(&options.Server, "server", "", "ESX server")
 	ESX.PersistentFlags().StringVar(&options.Profile, "profile", "", "Profile")
 	ESX.PersistentFlags().StringVar(&options.ConfigPath, "esx-config-file", "", "ESX config file (default \"~/"+auth.ESXConfigPath+"\")")
+	ESX.PersistentFlags().StringVar(&options.Datacenter, "datacenter", "", "vCenter datacenter (default the only one)")
+	ESX.PersistentFlags().StringVar(&options.Cluster, "cluster", "", "vCenter compute cluster")
+	ESX.PersistentFlags().StringVar(&options.ResourcePool, "resource-pool", "", "vCenter resource pool (default the cluster's or the only one)")
+	ESX.PersistentFlags().StringVar(&options.Datastore, "datastore", "", "vCenter datastore (default the only one)")
+	ESX.PersistentFlags().StringVar(&options.Folder, "folder", "", "vCenter VM folder (default the datacenter's VM folder)")
+	ESX.PersistentFlags().StringVar(&options.Network, "network", "", "network (default the only one)")
 	cli.WrapPreRun(ESX, preflightCheck)
 }
 
@@ -0,0 +1,74 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package esx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/flatcar-linux/mantle/sdk"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdPublishOVA = &cobra.Command{
+		Use:   "publish-ova",
+		Short: "Publish an OVA to a vCenter content library",
+		Long: `Upload an OVA as an item of a vCenter content library.
+
+The library is created on the selected datastore if it doesn't exist, and
+the files of an existing item are replaced.
+`,
+		RunE: runPublishOVA,
+	}
+
+	publishOVAPath string
+	publishLibrary string
+	publishName    string
+)
+
+func init() {
+	ESX.AddCommand(cmdPublishOVA)
+	cmdPublishOVA.Flags().StringVar(&publishOVAPath, "file",
+		sdk.BuildRoot()+"/images/amd64-usr/latest/flatcar_production_vmware_ova.ova",
+		"path to Flatcar image (build with: ./image_to_vm.sh --format=vmware_ova ...)")
+	cmdPublishOVA.Flags().StringVar(&publishLibrary, "library", "", "name of content library")
+	cmdPublishOVA.Flags().StringVar(&publishName, "name", "", "name of library item (default the image version)")
+}
+
+func runPublishOVA(cmd *cobra.Command, args []string) error {
+	if publishLibrary == "" {
+		fmt.Fprintf(os.Stderr, "--library is required\n")
+		os.Exit(2)
+	}
+
+	name := publishName
+	if name == "" {
+		ver, err := sdk.VersionsFromDir(filepath.Dir(publishOVAPath))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to get version from image directory, provide a -name flag or include a version.txt in the image directory: %v\n", err)
+			os.Exit(1)
+		}
+		name = ver.Version
+	}
+
+	err := API.PublishOVA(publishLibrary, name, publishOVAPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't publish OVA: %v\n", err)
+		os.Exit(1)
+	}
+	return nil
+}
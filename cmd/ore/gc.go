@@ -0,0 +1,106 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar-linux/mantle/platform/inventory"
+)
+
+var (
+	cmdGC = &cobra.Command{
+		Use:   "gc",
+		Short: "GC mantle-created resources across clouds",
+		Long: `Delete mantle-created resources selected by a policy.
+
+Without --policy, instances and Azure resource groups older than
+--duration are deleted, like the per-cloud gc commands do. A policy is
+a JSON file with an ordered list of rules; the first rule matching a
+resource decides whether it is deleted, and unmatched resources are
+kept:
+
+  {"rules": [
+    {"name": "release-*", "keep": true},
+    {"kind": "instance", "max_age": "5h"},
+    {"kind": "key", "orphans": true},
+    {"cloud": "openstack", "kind": "image", "max_age": "168h"}
+  ]}
+
+Rules match glob patterns on cloud, kind, name, owner and flight.
+"orphans" selects resources of unknown age, such as key pairs, whose
+kola flight has no instances left. It is ignored on clouds with
+instances of unknown flight.`,
+		RunE: runGC,
+	}
+
+	gcDuration time.Duration
+	gcPolicy   string
+	gcDryRun   bool
+)
+
+func init() {
+	addCloudFlags(cmdGC)
+	cmdGC.Flags().DurationVar(&gcDuration, "duration", 5*time.Hour, "how old resources must be before they're considered garbage, without --policy")
+	cmdGC.Flags().StringVar(&gcPolicy, "policy", "", "JSON policy file selecting the resources to delete")
+	cmdGC.Flags().BoolVar(&gcDryRun, "dry-run", false, "only list the resources that would be deleted")
+	root.AddCommand(cmdGC)
+}
+
+func runGC(cmd *cobra.Command, args []string) error {
+	policy := inventory.DefaultPolicy(gcDuration)
+	if gcPolicy != "" {
+		var err error
+		policy, err = inventory.LoadPolicy(gcPolicy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't load policy: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	ps, err := providers()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	resources, err := inventory.Collect(ctx, ps)
+	if err != nil {
+		// The failed clouds are simply not collected this time.
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+
+	garbage := policy.Garbage(resources, now)
+	if err := inventory.WriteTable(os.Stdout, garbage, now); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't write resources: %v\n", err)
+		os.Exit(1)
+	}
+	if gcDryRun {
+		return nil
+	}
+
+	if err := inventory.Delete(ctx, ps, garbage); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't gc: %v\n", err)
+		os.Exit(1)
+	}
+	return nil
+}
@@ -15,12 +15,16 @@
 package gcloud
 
 import (
+	"fmt"
+
 	"github.com/coreos/pkg/capnslog"
 	"github.com/spf13/cobra"
 
+	"github.com/flatcar-linux/mantle/auth"
 	"github.com/flatcar-linux/mantle/cli"
 	"github.com/flatcar-linux/mantle/platform"
 	"github.com/flatcar-linux/mantle/platform/api/gcloud"
+	"github.com/flatcar-linux/mantle/platform/inventory"
 )
 
 var (
@@ -47,6 +51,7 @@ func init() {
 	sv(&opts.BaseName, "basename", "kola", "instance name prefix")
 	sv(&opts.Network, "network", "default", "network name")
 	sv(&opts.JSONKeyFile, "json-key", "", "use a service account's JSON key for authentication")
+	sv(&opts.Endpoint, "endpoint", "", "compute API endpoint URL (for testing)")
 	GCloud.PersistentFlags().BoolVar(&opts.ServiceAuth, "service-auth", false, "use non-interactive auth when running within GCE")
 
 	cli.WrapPreRun(GCloud, preauth)
@@ -62,3 +67,16 @@ func preauth(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// NewProvider creates an inventory provider for the GCE project
+// selected by the default options.
+func NewProvider() (inventory.Provider, error) {
+	if opts.Endpoint == "" && !opts.ServiceAuth && opts.JSONKeyFile == "" && !auth.HaveGoogleToken() {
+		return nil, fmt.Errorf("no cached Google token; run an ore gcloud command to log in")
+	}
+	a, err := gcloud.New(&opts)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdConsole = &cobra.Command{
+		Use:   "console <id>",
+		Short: "Get Hetzner server console",
+		Long: `Print the URL and password of a server's VNC console.
+
+Hetzner Cloud has no API for console output; the console is only
+available interactively through VNC over WebSocket.`,
+		RunE: runConsole,
+	}
+)
+
+func init() {
+	Hetzner.AddCommand(cmdConsole)
+}
+
+func runConsole(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Specify one server.\n")
+		os.Exit(2)
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Bad server ID: %v\n", args[0])
+		os.Exit(2)
+	}
+
+	url, password, err := API.RequestConsole(context.Background(), id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't request console: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("URL: %s\nPassword: %s\n", url, password)
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	ctplatform "github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/flatcar-linux/mantle/platform/conf"
+)
+
+var (
+	cmdCreateServer = &cobra.Command{
+		Use:   "create-server [options]",
+		Short: "Create Hetzner server",
+		Long:  `Create a Hetzner Cloud server and print its ID and address.`,
+		RunE:  runCreateServer,
+	}
+
+	serverName   string
+	sshKeyName   string
+	userDataPath string
+)
+
+func init() {
+	Hetzner.AddCommand(cmdCreateServer)
+	cmdCreateServer.Flags().StringVar(&serverName, "name", "", "server name")
+	cmdCreateServer.Flags().StringVar(&options.Image, "image", "", "numeric image ID or snapshot description")
+	cmdCreateServer.Flags().StringVar(&options.Network, "network", "", "private network name or ID")
+	cmdCreateServer.Flags().StringVar(&sshKeyName, "ssh-key", "", "name of SSH key to add")
+	cmdCreateServer.Flags().StringVar(&userDataPath, "userdata-file", "", "path to file containing userdata")
+}
+
+func runCreateServer(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in hetzner create-server cmd: %v\n", args)
+		os.Exit(2)
+	}
+	if serverName == "" {
+		fmt.Fprintf(os.Stderr, "Server name must be specified\n")
+		os.Exit(2)
+	}
+
+	userdata := conf.Empty()
+	if userDataPath != "" {
+		data, err := ioutil.ReadFile(userDataPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't read userdata file %v: %v\n", userDataPath, err)
+			os.Exit(1)
+		}
+		userdata = conf.Unknown(string(data))
+	}
+	conf, err := userdata.Render(ctplatform.Custom)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't parse userdata file %v: %v\n", userDataPath, err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	var sshKeyID int64
+	if sshKeyName != "" {
+		keys, err := API.ListKeys(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't list keys: %v\n", err)
+			os.Exit(1)
+		}
+		for _, key := range keys {
+			if key.Name == sshKeyName {
+				sshKeyID = key.ID
+			}
+		}
+		if sshKeyID == 0 {
+			fmt.Fprintf(os.Stderr, "No such key: %v\n", sshKeyName)
+			os.Exit(1)
+		}
+	}
+
+	server, err := API.CreateServer(ctx, serverName, "", sshKeyID, conf.String())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't create server: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := struct {
+		ID        int64  `json:"id"`
+		Name      string `json:"name"`
+		IP        string `json:"public-ip"`
+		PrivateIP string `json:"private-ip,omitempty"`
+	}{
+		ID:   server.ID,
+		Name: server.Name,
+		IP:   server.PublicNet.IPv4.IP,
+	}
+	if len(server.PrivateNet) > 0 {
+		out.PrivateIP = server.PrivateNet[0].IP
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(&out); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't encode result: %v\n", err)
+		os.Exit(1)
+	}
+	return nil
+}
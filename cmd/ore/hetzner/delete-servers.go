@@ -0,0 +1,62 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdDeleteServers = &cobra.Command{
+		Use:   "delete-servers <id>...",
+		Short: "Delete Hetzner servers",
+		RunE:  runDeleteServers,
+	}
+)
+
+func init() {
+	Hetzner.AddCommand(cmdDeleteServers)
+}
+
+func runDeleteServers(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Specify at least one server.\n")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+
+	exit := 0
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Bad server ID: %v\n", arg)
+			exit = 1
+			continue
+		}
+		if err := API.DeleteServer(ctx, id); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			exit = 1
+		}
+	}
+
+	os.Exit(exit)
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar-linux/mantle/auth"
+	"github.com/flatcar-linux/mantle/cli"
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/hetzner"
+	"github.com/flatcar-linux/mantle/platform/inventory"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar-linux/mantle", "ore/hetzner")
+
+	Hetzner = &cobra.Command{
+		Use:   "hetzner [command]",
+		Short: "Hetzner Cloud machine utilities",
+	}
+
+	API     *hetzner.API
+	options = hetzner.Options{Options: &platform.Options{}}
+)
+
+func init() {
+	Hetzner.PersistentFlags().StringVar(&options.ConfigPath, "config-file", "", "config file (default \"~/"+auth.HetznerConfigPath+"\")")
+	Hetzner.PersistentFlags().StringVar(&options.Profile, "profile", "", "profile (default \"default\")")
+	Hetzner.PersistentFlags().StringVar(&options.Token, "token", "", "project API token (overrides config file)")
+	Hetzner.PersistentFlags().StringVar(&options.Endpoint, "endpoint", "", "API endpoint URL (for testing)")
+	Hetzner.PersistentFlags().StringVar(&options.Location, "location", "fsn1", "location name")
+	Hetzner.PersistentFlags().StringVar(&options.ServerType, "server-type", "cx22", "server type name")
+	cli.WrapPreRun(Hetzner, preflightCheck)
+}
+
+func preflightCheck(cmd *cobra.Command, args []string) error {
+	api, err := newAPI()
+	if err != nil {
+		return err
+	}
+	API = api
+	return nil
+}
+
+func newAPI() (*hetzner.API, error) {
+	plog.Debugf("Running Hetzner preflight check")
+	api, err := hetzner.New(&options)
+	if err != nil {
+		return nil, fmt.Errorf("could not create Hetzner client: %v", err)
+	}
+	if err := api.PreflightCheck(context.Background()); err != nil {
+		return nil, fmt.Errorf("could not complete Hetzner preflight check: %v", err)
+	}
+
+	plog.Debugf("Preflight check success; we have liftoff")
+	return api, nil
+}
+
+// NewProvider creates an inventory provider for the Hetzner Cloud
+// project selected by the default options.
+func NewProvider() (inventory.Provider, error) {
+	api, err := newAPI()
+	if err != nil {
+		return nil, err
+	}
+	return api, nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdListImages = &cobra.Command{
+		Use:   "list-images",
+		Short: "List Hetzner snapshots",
+		RunE:  runListImages,
+	}
+)
+
+func init() {
+	Hetzner.AddCommand(cmdListImages)
+}
+
+func runListImages(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in hetzner list-images cmd: %v\n", args)
+		os.Exit(2)
+	}
+
+	images, err := API.ListSnapshots(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't list snapshots: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, image := range images {
+		fmt.Printf("%d\t%s\t%s\n", image.ID, image.Status, image.Description)
+	}
+	return nil
+}
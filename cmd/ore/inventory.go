@@ -0,0 +1,131 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar-linux/mantle/cmd/ore/aws"
+	"github.com/flatcar-linux/mantle/cmd/ore/azure"
+	"github.com/flatcar-linux/mantle/cmd/ore/do"
+	"github.com/flatcar-linux/mantle/cmd/ore/gcloud"
+	"github.com/flatcar-linux/mantle/cmd/ore/hetzner"
+	"github.com/flatcar-linux/mantle/cmd/ore/openstack"
+	"github.com/flatcar-linux/mantle/cmd/ore/packet"
+	"github.com/flatcar-linux/mantle/platform/inventory"
+)
+
+var (
+	cmdInventory = &cobra.Command{
+		Use:   "inventory",
+		Short: "List mantle-created resources across clouds",
+		Long: `List the instances, images, keys, security groups and resource
+groups created by mantle tools, with their owner, kola flight and age.
+
+Each cloud is configured with the defaults of its ore subcommand:
+credentials and config files from the home directory and environment.`,
+		RunE: runInventory,
+	}
+
+	inventoryClouds []string
+	inventoryAll    bool
+
+	newProviders = map[string]func() (inventory.Provider, error){
+		"aws":       aws.NewProvider,
+		"azure":     azure.NewProvider,
+		"do":        do.NewProvider,
+		"gcloud":    gcloud.NewProvider,
+		"hetzner":   hetzner.NewProvider,
+		"openstack": openstack.NewProvider,
+		"packet":    packet.NewProvider,
+	}
+)
+
+func init() {
+	addCloudFlags(cmdInventory)
+	root.AddCommand(cmdInventory)
+}
+
+func addCloudFlags(cmd *cobra.Command) {
+	var clouds []string
+	for cloud := range newProviders {
+		clouds = append(clouds, cloud)
+	}
+	sort.Strings(clouds)
+
+	cmd.Flags().StringSliceVar(&inventoryClouds, "cloud", nil, "cloud to query, may be repeated: "+strings.Join(clouds, ", "))
+	cmd.Flags().BoolVar(&inventoryAll, "all", false, "query every cloud with usable credentials")
+}
+
+// providers creates the providers selected by --cloud and --all. With
+// --all, clouds that can't be set up are skipped with a warning.
+func providers() (map[string]inventory.Provider, error) {
+	clouds := inventoryClouds
+	if inventoryAll {
+		if len(clouds) > 0 {
+			return nil, fmt.Errorf("--all and --cloud are mutually exclusive")
+		}
+		for cloud := range newProviders {
+			clouds = append(clouds, cloud)
+		}
+	} else if len(clouds) == 0 {
+		return nil, fmt.Errorf("specify --cloud or --all")
+	}
+	sort.Strings(clouds)
+
+	ret := make(map[string]inventory.Provider)
+	for _, cloud := range clouds {
+		newProvider, ok := newProviders[cloud]
+		if !ok {
+			return nil, fmt.Errorf("unknown cloud %q", cloud)
+		}
+		p, err := newProvider()
+		if err != nil {
+			if inventoryAll {
+				fmt.Fprintf(os.Stderr, "Skipping %s: %v\n", cloud, err)
+				continue
+			}
+			return nil, fmt.Errorf("setting up %s: %v", cloud, err)
+		}
+		ret[cloud] = p
+	}
+	return ret, nil
+}
+
+func runInventory(cmd *cobra.Command, args []string) error {
+	ps, err := providers()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	resources, listErr := inventory.Collect(context.Background(), ps)
+	if err := inventory.WriteTable(os.Stdout, resources, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't write inventory: %v\n", err)
+		os.Exit(1)
+	}
+	if listErr != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", listErr)
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libvirt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdGC = &cobra.Command{
+		Use:   "gc",
+		Short: "GC resources in libvirt",
+		Long: `Delete domains, volumes and networks left behind by kola.
+
+Only resources whose name starts with the given prefix are considered.
+Domains and networks are deleted once created over the given duration
+ago, volumes once unmodified for that long. Volumes backing a domain or
+another volume and networks still used by a domain are kept, as are
+domains without a recorded creation time.`,
+		RunE: runGC,
+	}
+
+	gcPrefix   string
+	gcDuration time.Duration
+)
+
+func init() {
+	Libvirt.AddCommand(cmdGC)
+	cmdGC.Flags().StringVar(&gcPrefix, "prefix", "kola-", "name prefix of resources to delete")
+	cmdGC.Flags().DurationVar(&gcDuration, "duration", 5*time.Hour, "how old resources must be before they're considered garbage")
+}
+
+func runGC(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in libvirt gc cmd: %v\n", args)
+		os.Exit(2)
+	}
+	if gcPrefix == "" {
+		fmt.Fprintf(os.Stderr, "--prefix must not be empty\n")
+		os.Exit(2)
+	}
+	cutoff := time.Now().Add(-gcDuration)
+
+	failed := false
+	// gc returns how many resources it deleted.
+	gc := func(kind string, list func() ([]string, error), old func(string) (bool, error), del func(string) error) int {
+		names, err := list()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Listing %ss failed: %v\n", kind, err)
+			failed = true
+			return 0
+		}
+		deleted := 0
+		for _, name := range names {
+			if !strings.HasPrefix(name, gcPrefix) {
+				continue
+			}
+			if ok, err := old(name); err != nil {
+				fmt.Fprintf(os.Stderr, "Inspecting %s %s failed: %v\n", kind, name, err)
+				failed = true
+				continue
+			} else if !ok {
+				continue
+			}
+			if err := del(name); err != nil {
+				fmt.Fprintf(os.Stderr, "Deleting %s %s failed: %v\n", kind, name, err)
+				failed = true
+				continue
+			}
+			plog.Infof("Deleted %s %s", kind, name)
+			deleted++
+		}
+		return deleted
+	}
+
+	// domains first, since they hold on to volumes and networks
+	gc("domain", API.ListDomains, func(name string) (bool, error) {
+		info, err := API.DomainInfo(name)
+		if err != nil {
+			return false, err
+		}
+		if info.Created.IsZero() {
+			plog.Warningf("Domain %s has no creation time, skipping", name)
+			return false, nil
+		}
+		return info.Created.Before(cutoff), nil
+	}, API.DeleteDomain)
+	// the base volume of a flight is never written after its upload, so
+	// volumes backing a domain or another volume are kept. Deleting the
+	// overlays frees their base, so repeat until a pass deletes nothing.
+	for {
+		backing, err := usedVolumes()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Listing volumes in use failed: %v\n", err)
+			os.Exit(1)
+		}
+		if gc("volume", API.ListVolumes, func(name string) (bool, error) {
+			info, err := API.VolumeInfo(name)
+			if err != nil {
+				return false, err
+			}
+			if backing[info.Path] {
+				return false, nil
+			}
+			return info.Modified.Before(cutoff), nil
+		}, API.DeleteVolume) == 0 {
+			break
+		}
+	}
+
+	used, err := usedNetworks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Listing networks in use failed: %v\n", err)
+		os.Exit(1)
+	}
+	gc("network", API.ListNetworks, func(name string) (bool, error) {
+		if used[name] {
+			return false, nil
+		}
+		created, err := API.NetworkCreated(name)
+		if err != nil {
+			return false, err
+		}
+		// networks of older kola versions have no creation time
+		return created.Before(cutoff), nil
+	}, API.DeleteNetwork)
+
+	if failed {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// usedVolumes returns the paths of the volumes backing the remaining
+// domains and volumes.
+func usedVolumes() (map[string]bool, error) {
+	used := make(map[string]bool)
+	domains, err := API.ListDomains()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range domains {
+		info, err := API.DomainInfo(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, disk := range info.Disks {
+			used[disk] = true
+		}
+	}
+	volumes, err := API.ListVolumes()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range volumes {
+		info, err := API.VolumeInfo(name)
+		if err != nil {
+			return nil, err
+		}
+		if info.Backing != "" {
+			used[info.Backing] = true
+		}
+	}
+	return used, nil
+}
+
+// usedNetworks returns the networks the remaining domains are attached to.
+func usedNetworks() (map[string]bool, error) {
+	domains, err := API.ListDomains()
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	for _, name := range domains {
+		info, err := API.DomainInfo(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, network := range info.Networks {
+			used[network] = true
+		}
+	}
+	return used, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libvirt
+
+import (
+	"fmt"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/spf13/cobra"
+
+	"github.com/flatcar-linux/mantle/cli"
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/libvirt"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar-linux/mantle", "ore/libvirt")
+
+	Libvirt = &cobra.Command{
+		Use:   "libvirt [command]",
+		Short: "libvirt machine utilities",
+	}
+
+	API     *libvirt.API
+	options = libvirt.Options{Options: &platform.Options{}}
+)
+
+func init() {
+	Libvirt.PersistentFlags().StringVar(&options.URI, "uri", "qemu:///system", "libvirt connection URI")
+	Libvirt.PersistentFlags().StringVar(&options.StoragePool, "pool", "default", "libvirt storage pool")
+	cli.WrapPreRun(Libvirt, preflightCheck)
+}
+
+func preflightCheck(cmd *cobra.Command, args []string) error {
+	plog.Debugf("Running libvirt preflight check")
+	api, err := libvirt.New(&options)
+	if err != nil {
+		return fmt.Errorf("could not create libvirt client: %v", err)
+	}
+
+	plog.Debugf("Preflight check success; we have liftoff")
+	API = api
+	return nil
+}
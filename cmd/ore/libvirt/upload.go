@@ -0,0 +1,63 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libvirt
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cmdUpload = &cobra.Command{
+		Use:   "upload",
+		Short: "Upload a disk image to a libvirt storage pool",
+		Long: `Upload a disk image to a libvirt storage pool.
+
+The resulting volume can be used as a backing image for other volumes.`,
+		RunE: runUpload,
+	}
+
+	uploadFile   string
+	uploadName   string
+	uploadFormat string
+)
+
+func init() {
+	Libvirt.AddCommand(cmdUpload)
+	cmdUpload.Flags().StringVar(&uploadFile, "file", "", "path to the disk image")
+	cmdUpload.Flags().StringVar(&uploadName, "name", "", "volume name")
+	cmdUpload.Flags().StringVar(&uploadFormat, "format", "qcow2", "disk image format")
+}
+
+func runUpload(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Unrecognized args in libvirt upload cmd: %v\n", args)
+		os.Exit(2)
+	}
+	if uploadFile == "" || uploadName == "" {
+		fmt.Fprintf(os.Stderr, "--file and --name are required\n")
+		os.Exit(2)
+	}
+
+	path, err := API.UploadVolume(uploadName, uploadFile, uploadFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Uploading %v failed: %v\n", uploadFile, err)
+		os.Exit(1)
+	}
+	fmt.Println(path)
+	return nil
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/flatcar-linux/mantle/auth"
 	"github.com/flatcar-linux/mantle/cli"
 	"github.com/flatcar-linux/mantle/platform/api/openstack"
+	"github.com/flatcar-linux/mantle/platform/inventory"
 )
 
 var (
@@ -40,20 +41,39 @@ var (
 func init() {
 	OpenStack.PersistentFlags().StringVar(&options.ConfigPath, "config-file", "", "config file (default \"~/"+auth.OpenStackConfigPath+"\")")
 	OpenStack.PersistentFlags().StringVar(&options.Profile, "profile", "", "profile (default \"default\")")
+	OpenStack.PersistentFlags().StringVar(&options.Endpoint, "endpoint", "", "identity endpoint URL (overrides config file)")
 	cli.WrapPreRun(OpenStack, preflightCheck)
 }
 
 func preflightCheck(cmd *cobra.Command, args []string) error {
+	api, err := newAPI()
+	if err != nil {
+		return err
+	}
+	API = api
+	return nil
+}
+
+func newAPI() (*openstack.API, error) {
 	plog.Debugf("Running OpenStack preflight check")
 	api, err := openstack.New(&options)
 	if err != nil {
-		return fmt.Errorf("could not create OpenStack client: %v", err)
+		return nil, fmt.Errorf("could not create OpenStack client: %v", err)
 	}
 	if err := api.PreflightCheck(); err != nil {
-		return fmt.Errorf("could not complete OpenStack preflight check: %v", err)
+		return nil, fmt.Errorf("could not complete OpenStack preflight check: %v", err)
 	}
 
 	plog.Debugf("Preflight check success; we have liftoff")
-	API = api
-	return nil
+	return api, nil
+}
+
+// NewProvider creates an inventory provider for the OpenStack account
+// selected by the default options.
+func NewProvider() (inventory.Provider, error) {
+	api, err := newAPI()
+	if err != nil {
+		return nil, err
+	}
+	return api, nil
 }
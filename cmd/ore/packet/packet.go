@@ -24,6 +24,7 @@ import (
 	"github.com/flatcar-linux/mantle/platform"
 	"github.com/flatcar-linux/mantle/platform/api/gcloud"
 	"github.com/flatcar-linux/mantle/platform/api/packet"
+	"github.com/flatcar-linux/mantle/platform/inventory"
 	"github.com/spf13/cobra"
 )
 
@@ -49,21 +50,40 @@ func init() {
 	Packet.PersistentFlags().StringVar(&options.Profile, "profile", "", "profile (default \"default\")")
 	Packet.PersistentFlags().StringVar(&options.ApiKey, "api-key", "", "API key (overrides config file)")
 	Packet.PersistentFlags().StringVar(&options.Project, "project", "", "project UUID (overrides config file)")
+	Packet.PersistentFlags().StringVar(&options.Endpoint, "endpoint", "", "API endpoint URL (for testing)")
 	cli.WrapPreRun(Packet, preflightCheck)
 
 }
 
 func preflightCheck(cmd *cobra.Command, args []string) error {
+	api, err := newAPI()
+	if err != nil {
+		return err
+	}
+	API = api
+	return nil
+}
+
+func newAPI() (*packet.API, error) {
 	plog.Debugf("Running Packet preflight check")
 	api, err := packet.New(&options)
 	if err != nil {
-		return fmt.Errorf("could not create Packet client: %v", err)
+		return nil, fmt.Errorf("could not create Packet client: %v", err)
 	}
 	if err := api.PreflightCheck(); err != nil {
-		return fmt.Errorf("could not complete Packet preflight check: %v", err)
+		return nil, fmt.Errorf("could not complete Packet preflight check: %v", err)
 	}
 
 	plog.Debugf("Preflight check success; we have liftoff")
-	API = api
-	return nil
+	return api, nil
+}
+
+// NewProvider creates an inventory provider for the Packet account
+// selected by the default options.
+func NewProvider() (inventory.Provider, error) {
+	api, err := newAPI()
+	if err != nil {
+		return nil, err
+	}
+	return api, nil
 }
@@ -0,0 +1,167 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flatcar-linux/mantle/harness/testresult"
+)
+
+// Event actions, modeled on the output of `go test -json`.
+const (
+	EventStart  = "start"  // a test or, without Test, the suite started
+	EventLog    = "log"    // a test logged a message
+	EventOutput = "output" // the output of a finished test
+	EventPass   = "pass"
+	EventFail   = "fail"
+	EventSkip   = "skip"
+)
+
+// Event is a line of the JSON event stream written to Options.Events.
+// Events without Test refer to the whole suite.
+type Event struct {
+	Time    time.Time
+	Action  string
+	Test    string  `json:",omitempty"`
+	Elapsed float64 `json:",omitempty"` // seconds, on pass, fail and skip
+	Output  string  `json:",omitempty"`
+}
+
+// resultAction maps a test result to its event action.
+func resultAction(result testresult.TestResult) string {
+	switch result {
+	case testresult.Fail:
+		return EventFail
+	case testresult.Skip:
+		return EventSkip
+	}
+	return EventPass
+}
+
+// Limits on a slow event consumer, which must not hold up the tests.
+var (
+	eventBuffer  = 1024             // events queued before the stream is abandoned
+	eventTimeout = 10 * time.Second // allowed for writing a single event
+)
+
+// eventWriter serializes events from concurrently running tests. Events
+// are queued and written by a separate goroutine, so emitting never blocks
+// on the destination.
+type eventWriter struct {
+	w      io.Writer
+	enc    *json.Encoder
+	queue  chan Event
+	done   chan struct{}
+	mu     sync.Mutex
+	closed bool
+	failed bool // the stream is abandoned
+}
+
+// newEventWriter starts writing events to w until close is called.
+func newEventWriter(w io.Writer) *eventWriter {
+	if w == nil {
+		return nil
+	}
+	ew := &eventWriter{
+		w:     w,
+		enc:   json.NewEncoder(w),
+		queue: make(chan Event, eventBuffer),
+		done:  make(chan struct{}),
+	}
+	go ew.run()
+	return ew
+}
+
+// emit queues an event. Nil writers discard events. If the queue is full
+// or a write failed or timed out, the stream is abandoned rather than
+// holding up or failing the tests.
+func (ew *eventWriter) emit(e Event) {
+	if ew == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	if ew.closed || ew.failed {
+		return
+	}
+	select {
+	case ew.queue <- e:
+	default:
+		ew.failed = true
+	}
+}
+
+func (ew *eventWriter) run() {
+	defer close(ew.done)
+	conn, _ := ew.w.(interface{ SetWriteDeadline(time.Time) error })
+	for e := range ew.queue {
+		if ew.abandoned() {
+			continue
+		}
+		if conn != nil {
+			conn.SetWriteDeadline(time.Now().Add(eventTimeout))
+		}
+		if err := ew.enc.Encode(e); err != nil {
+			ew.mu.Lock()
+			ew.failed = true
+			ew.mu.Unlock()
+		}
+	}
+}
+
+func (ew *eventWriter) abandoned() bool {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	return ew.failed
+}
+
+// close writes the queued events, giving up on a destination which does
+// not support write deadlines after eventTimeout.
+func (ew *eventWriter) close() {
+	if ew == nil {
+		return
+	}
+	ew.mu.Lock()
+	ew.closed = true
+	close(ew.queue)
+	ew.mu.Unlock()
+	select {
+	case <-ew.done:
+	case <-time.After(eventTimeout):
+	}
+}
+
+// OpenEvents opens a destination for the event stream: a UNIX socket
+// given as unix:PATH, a TCP socket given as tcp:HOST:PORT, or else a file,
+// which is created or truncated.
+func OpenEvents(dest string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasPrefix(dest, "unix:"):
+		return net.Dial("unix", strings.TrimPrefix(dest, "unix:"))
+	case strings.HasPrefix(dest, "tcp:"):
+		return net.Dial("tcp", strings.TrimPrefix(dest, "tcp:"))
+	}
+	return os.Create(dest)
+}
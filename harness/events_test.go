@@ -0,0 +1,125 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	var suitedir string
+	if dir, err := ioutil.TempDir("", ""); err != nil {
+		t.Fatal(err)
+	} else {
+		defer os.RemoveAll(dir)
+		suitedir = filepath.Join(dir, "_test_temp")
+	}
+
+	events := &bytes.Buffer{}
+	opts := Options{
+		OutputDir: suitedir,
+		Parallel:  1,
+		Events:    events,
+	}
+	suite := NewSuite(opts, Tests{
+		"Events": func(h *H) {
+			h.Log("hello")
+			h.Run("skip", func(h *H) { h.Skip("skipping") })
+			h.Run("fail", func(h *H) { h.Fail() })
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != SuiteFailed {
+		t.Log("\n" + buf.String())
+		t.Errorf("expected SuiteFailed, got %v", err)
+	}
+
+	type step struct{ Action, Test, Output string }
+	var got []step
+	scanner := bufio.NewScanner(events)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid event %q: %v", scanner.Text(), err)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("event without time: %q", scanner.Text())
+		}
+		if e.Action == EventOutput {
+			// the formatting of the output is tested elsewhere
+			e.Output = ""
+		}
+		got = append(got, step{e.Action, e.Test, e.Output})
+	}
+
+	expect := []step{
+		{EventStart, "", ""},
+		{EventStart, "Events", ""},
+		{EventLog, "Events", "hello\n"},
+		{EventStart, "Events/skip", ""},
+		{EventLog, "Events/skip", "skipping\n"},
+		{EventOutput, "Events/skip", ""},
+		{EventSkip, "Events/skip", ""},
+		{EventStart, "Events/fail", ""},
+		{EventFail, "Events/fail", ""},
+		{EventOutput, "Events", ""},
+		{EventFail, "Events", ""},
+		{EventFail, "", ""},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got events\n%v\nexpected\n%v", got, expect)
+	}
+}
+
+func TestEventsStalled(t *testing.T) {
+	defer func(timeout time.Duration) { eventTimeout = timeout }(eventTimeout)
+	eventTimeout = 100 * time.Millisecond
+
+	// Nobody reads the other end, so every write blocks.
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	defer conn.Close()
+
+	suite := NewSuite(Options{Parallel: 1, Events: conn}, Tests{
+		"Stalled": func(h *H) {
+			for i := 0; i < 2*eventBuffer; i++ {
+				h.Log("hello")
+			}
+		},
+	})
+
+	finished := make(chan error)
+	go func() {
+		finished <- suite.runTests(&bytes.Buffer{}, nil)
+	}()
+	select {
+	case err := <-finished:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tests held up by the event stream")
+	}
+}
@@ -238,6 +238,7 @@ func (c *H) log(s string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.logger.Output(3, s)
+	c.suite.events.emit(Event{Action: EventLog, Test: c.name, Output: s})
 }
 
 // Log formats its arguments using default formatting, analogous to Println,
@@ -386,6 +387,17 @@ func (t *H) Parallel() {
 	t.start = time.Now()
 }
 
+// WaitFor blocks until done is closed. A parallel test waiting for other
+// tests does not count against Options.Parallel meanwhile, so it cannot
+// starve them.
+func (t *H) WaitFor(done <-chan struct{}) {
+	if t.isParallel {
+		t.suite.release()
+		defer t.suite.waitParallel()
+	}
+	<-done
+}
+
 func tRunner(t *H, fn func(t *H)) {
 	t.ctx, t.cancel = context.WithCancel(t.parentContext())
 	defer t.cancel()
@@ -438,6 +450,9 @@ func tRunner(t *H, fn func(t *H)) {
 	}()
 
 	t.start = time.Now()
+	if t.parent != nil {
+		t.suite.events.emit(Event{Time: t.start, Action: EventStart, Test: t.name})
+	}
 	fn(t)
 	t.finished = true
 }
@@ -506,6 +521,11 @@ func (t *H) report() {
 	// this being a TODO if you don't want to tackle it in this initial
 	// PR.
 	t.reporters.ReportTest(t.name, status, t.duration, t.output.Bytes())
+
+	if output := t.output.String(); output != "" {
+		t.suite.events.emit(Event{Action: EventOutput, Test: t.name, Output: output})
+	}
+	t.suite.events.emit(Event{Action: resultAction(status), Test: t.name, Elapsed: t.duration.Seconds()})
 }
 
 // CleanOutputDir creates/empties an output directory and returns the cleaned path.
@@ -71,6 +71,25 @@ func TestContextCancel(t *testing.T) {
 	}
 }
 
+func TestWaitFor(t *testing.T) {
+	done := make(chan struct{})
+	suite := NewSuite(Options{Parallel: 1}, Tests{
+		"Waiting": func(h *H) {
+			h.Parallel()
+			h.WaitFor(done)
+		},
+		"Closing": func(h *H) {
+			h.Parallel()
+			close(done)
+		},
+	})
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != nil {
+		t.Log("\n" + buf.String())
+		t.Error(err)
+	}
+}
+
 func TestSubTests(t *testing.T) {
 	realTest := t
 	testCases := []struct {
@@ -16,8 +16,10 @@ package reporters
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/flatcar-linux/mantle/harness/testresult"
@@ -70,3 +72,60 @@ func (r *jsonReporter) Output(path string) error {
 func (r *jsonReporter) SetResult(result testresult.TestResult) {
 	r.Result = result
 }
+
+func readJSONReport(path string) (*jsonReporter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r jsonReporter
+	if err := json.NewDecoder(f).Decode(&r); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return &r, nil
+}
+
+// JSONDurations returns the durations of the top-level tests in the JSON
+// report at path.
+func JSONDurations(path string) (map[string]time.Duration, error) {
+	r, err := readJSONReport(path)
+	if err != nil {
+		return nil, err
+	}
+	durations := make(map[string]time.Duration)
+	for _, t := range r.Tests {
+		if !strings.Contains(t.Name, "/") {
+			durations[t.Name] = t.Duration
+		}
+	}
+	return durations, nil
+}
+
+// MergeJSONReports combines the JSON reports at paths, e.g. of the shards
+// of a run, into filename in the directory dir. The merged run failed if
+// any of them failed.
+func MergeJSONReports(dir, filename string, paths []string) error {
+	merged := NewJSONReporter(filename, "", "")
+	merged.Result = testresult.Pass
+	for _, path := range paths {
+		r, err := readJSONReport(path)
+		if err != nil {
+			return err
+		}
+		if merged.Platform == "" {
+			merged.Platform = r.Platform
+		} else if r.Platform != "" && r.Platform != merged.Platform {
+			return fmt.Errorf("%s is for platform %s, not %s", path, r.Platform, merged.Platform)
+		}
+		if merged.Version == "" {
+			merged.Version = r.Version
+		}
+		if r.Result == testresult.Fail {
+			merged.Result = testresult.Fail
+		}
+		merged.Tests = append(merged.Tests, r.Tests...)
+	}
+	return merged.Output(dir)
+}
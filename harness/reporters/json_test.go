@@ -0,0 +1,60 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporters
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flatcar-linux/mantle/harness/testresult"
+)
+
+func TestMergeJSONReports(t *testing.T) {
+	dir := t.TempDir()
+
+	shard1 := NewJSONReporter("report1.json", "qemu", "2905.0.0")
+	shard1.ReportTest("a", testresult.Pass, time.Minute, nil)
+	shard1.ReportTest("a/sub", testresult.Pass, time.Second, nil)
+	shard1.SetResult(testresult.Pass)
+	require.NoError(t, shard1.Output(dir))
+
+	shard2 := NewJSONReporter("report2.json", "qemu", "2905.0.0")
+	shard2.ReportTest("b", testresult.Fail, time.Hour, []byte("boom"))
+	shard2.SetResult(testresult.Fail)
+	require.NoError(t, shard2.Output(dir))
+
+	paths := []string{filepath.Join(dir, "report1.json"), filepath.Join(dir, "report2.json")}
+	require.NoError(t, MergeJSONReports(dir, "report.json", paths))
+
+	merged, err := readJSONReport(filepath.Join(dir, "report.json"))
+	require.NoError(t, err)
+	assert.Equal(t, testresult.Fail, merged.Result)
+	assert.Equal(t, "qemu", merged.Platform)
+	assert.Equal(t, "2905.0.0", merged.Version)
+	assert.Len(t, merged.Tests, 3)
+
+	durations, err := JSONDurations(filepath.Join(dir, "report.json"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"a": time.Minute, "b": time.Hour}, durations)
+
+	other := NewJSONReporter("other.json", "aws", "")
+	require.NoError(t, other.Output(dir))
+	paths = append(paths, filepath.Join(dir, "other.json"))
+	assert.Error(t, MergeJSONReports(dir, "report.json", paths))
+}
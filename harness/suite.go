@@ -75,6 +75,10 @@ type Options struct {
 	Parallel int
 
 	Reporters reporters.Reporters
+
+	// Events receives a JSON object per line as tests start, log and
+	// finish. See Event.
+	Events io.Writer
 }
 
 // FlagSet can be used to setup options via command line flags.
@@ -145,6 +149,8 @@ type Suite struct {
 
 	// waiting is the number tests waiting to be run in parallel.
 	waiting int
+
+	events *eventWriter
 }
 
 func (c *Suite) waitParallel() {
@@ -283,6 +289,9 @@ func (s *Suite) runTests(out, tap io.Writer) error {
 		suite:     s,
 		reporters: s.opts.Reporters,
 	}
+	s.events = newEventWriter(s.opts.Events)
+	defer s.events.close()
+	s.events.emit(Event{Action: EventStart})
 	tRunner(t, func(t *H) {
 		for name, test := range s.tests {
 			t.Run(name, test)
@@ -292,6 +301,7 @@ func (s *Suite) runTests(out, tap io.Writer) error {
 		// phase as this pollutes the stacktrace output when aborting.
 		go func() { <-t.signal }()
 	})
+	s.events.emit(Event{Action: resultAction(t.status()), Elapsed: t.duration.Seconds()})
 	if !t.ran {
 		return SuiteEmpty
 	}
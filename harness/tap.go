@@ -0,0 +1,61 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// MergeTAP combines the TAP logs at paths, e.g. of the shards of a run,
+// into one with a plan covering all of their tests.
+func MergeTAP(w io.Writer, paths []string) error {
+	var planned int
+	var body bytes.Buffer
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "1..") {
+				var n int
+				if _, err := fmt.Sscanf(line, "1..%d", &n); err != nil {
+					return fmt.Errorf("parsing plan of %s: %v", path, err)
+				}
+				planned += n
+				continue
+			}
+			body.WriteString(line)
+			body.WriteByte('\n')
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("reading %s: %v", path, err)
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "1..%d\n", planned); err != nil {
+		return err
+	}
+	_, err := body.WriteTo(w)
+	return err
+}
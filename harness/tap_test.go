@@ -0,0 +1,47 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package harness
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeTAP(t *testing.T) {
+	dir := t.TempDir()
+	shards := []string{
+		"1..2\nok - a\nnot ok - b\n  ---\n  Error: \"1..3\"\n  ...\n",
+		"1..1\nok - c # SKIP\n",
+	}
+	var paths []string
+	for i, shard := range shards {
+		path := filepath.Join(dir, string(rune('a'+i))+".tap")
+		if err := ioutil.WriteFile(path, []byte(shard), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	var buf bytes.Buffer
+	if err := MergeTAP(&buf, paths); err != nil {
+		t.Fatal(err)
+	}
+	want := "1..3\nok - a\nnot ok - b\n  ---\n  Error: \"1..3\"\n  ...\nok - c # SKIP\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
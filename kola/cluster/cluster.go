@@ -15,13 +15,16 @@
 package cluster
 
 import (
-	"bytes"
+	"crypto/rand"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"golang.org/x/crypto/ssh"
+
 	"github.com/flatcar-linux/mantle/harness"
+	"github.com/flatcar-linux/mantle/kola/oci"
 	"github.com/flatcar-linux/mantle/platform"
 )
 
@@ -31,6 +34,9 @@ type TestCluster struct {
 	*harness.H
 	platform.Cluster
 	NativeFuncs []string
+	Images      []oci.Image
+	// ImageBuilder builds Images once for all machines of the flight.
+	ImageBuilder *oci.Builder
 
 	// If set to true and a sub-test fails all future sub-tests will be skipped
 	FailFast   bool
@@ -53,9 +59,16 @@ func (t *TestCluster) Run(name string, f func(c TestCluster)) bool {
 
 }
 
-// RunNative runs a registered NativeFunc on a remote machine
+// RunNative runs a registered NativeFunc on a remote machine. Its output
+// is logged as it arrives and its result, metrics and artifacts are
+// collected into the test's output directory.
 func (t *TestCluster) RunNative(funcName string, m platform.Machine) bool {
-	command := fmt.Sprintf("./kolet run %q %q", t.H.Name(), funcName)
+	// A fresh name per run, so a result left by an earlier run is
+	// never mistaken for this one's if kolet dies before writing it.
+	b := make([]byte, 5)
+	rand.Read(b)
+	resultFile := fmt.Sprintf("kolet-%s-%x.json", funcName, b)
+	command := fmt.Sprintf("./kolet run --result-file %q %q %q", resultFile, t.H.Name(), funcName)
 	return t.Run(funcName, func(c TestCluster) {
 		client, err := m.SSHClient()
 		if err != nil {
@@ -69,11 +82,33 @@ func (t *TestCluster) RunNative(funcName string, m platform.Machine) bool {
 		}
 		defer session.Close()
 
-		b, err := session.CombinedOutput(command)
-		b = bytes.TrimSpace(b)
-		if len(b) > 0 {
-			t.Logf("kolet:\n%s", b)
+		out, err := newNativeLogger(c.H, filepath.Join(c.H.OutputDir(), "kolet.log"))
+		if err != nil {
+			c.Fatalf("kolet log: %v", err)
+		}
+		defer out.Close()
+		session.Stdout = out
+		session.Stderr = out
+
+		if err := session.Start(command); err != nil {
+			c.Fatalf("kolet: %v", err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			done <- session.Wait()
+		}()
+		select {
+		case err = <-done:
+		case <-c.H.Context().Done():
+			// the harness timed out; don't leave kolet running
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+			err = c.H.Context().Err()
 		}
+		out.Flush()
+
+		c.collectNative(m, resultFile)
+		m.SSH(fmt.Sprintf("rm -f %q", resultFile))
 		if err != nil {
 			c.Errorf("kolet: %v", err)
 		}
@@ -86,6 +121,45 @@ func (t *TestCluster) ListNativeFunctions() []string {
 	return t.NativeFuncs
 }
 
+// LoadImages loads the images declared by the test into m. Machines
+// created by the harness already have them.
+func (t *TestCluster) LoadImages(m platform.Machine) error {
+	for i := range t.Images {
+		if err := t.ImageBuilder.Load(m, &t.Images[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeContent serves content under name to the machines of the cluster
+// and returns its URL for scheme. The test is skipped on platforms that
+// can't serve content.
+func (t *TestCluster) ServeContent(scheme, name string, content platform.Content) string {
+	cc, ok := t.Cluster.(platform.ContentCluster)
+	if !ok {
+		t.Skipf("platform %s can't serve content", t.Platform())
+	}
+	if err := cc.ServeContent(name, content); err != nil {
+		t.Fatalf("serving %s: %v", name, err)
+	}
+	url, err := cc.ContentURL(scheme, name)
+	if err != nil {
+		t.Fatalf("serving %s: %v", name, err)
+	}
+	return url
+}
+
+// ContentCA returns the PEM encoded CA certificate of the HTTPS content
+// server of the cluster.
+func (t *TestCluster) ContentCA() []byte {
+	cc, ok := t.Cluster.(platform.ContentCluster)
+	if !ok {
+		t.Skipf("platform %s can't serve content", t.Platform())
+	}
+	return cc.ContentCA()
+}
+
 // DropFile places file from localPath to ~/ on every machine in cluster
 func (t *TestCluster) DropFile(localPath string) error {
 	in, err := os.Open(localPath)
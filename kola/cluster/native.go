@@ -0,0 +1,175 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/flatcar-linux/mantle/harness"
+	"github.com/flatcar-linux/mantle/harness/testresult"
+	"github.com/flatcar-linux/mantle/kola/native"
+	"github.com/flatcar-linux/mantle/platform"
+)
+
+// nativeLogger streams kolet output into a log file and, line by line,
+// into the test log.
+type nativeLogger struct {
+	h    *harness.H
+	file *os.File
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func newNativeLogger(h *harness.H, path string) (*nativeLogger, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &nativeLogger{h: h, file: f}, nil
+}
+
+func (l *nativeLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(p); err != nil {
+		return 0, err
+	}
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.logLine(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (l *nativeLogger) logLine(line string) {
+	l.h.Log(line)
+}
+
+// Flush logs any incomplete last line.
+func (l *nativeLogger) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.buf) > 0 {
+		l.logLine(string(l.buf))
+		l.buf = nil
+	}
+}
+
+func (l *nativeLogger) Close() error {
+	return l.file.Close()
+}
+
+// collectNative reads the result kolet left in resultFile on m, saves it
+// in the test's output directory, and reports its metrics, artifacts and
+// sub-results.
+func (t *TestCluster) collectNative(m platform.Machine, resultFile string) {
+	rc, err := platform.ReadFile(m, resultFile)
+	if err != nil {
+		t.Logf("reading kolet result: %v", err)
+		return
+	}
+	result, err := native.LoadResult(rc)
+	rc.Close()
+	if err != nil {
+		t.Errorf("reading kolet result: %v", err)
+		return
+	}
+
+	f, err := os.Create(filepath.Join(t.H.OutputDir(), "result.json"))
+	if err != nil {
+		t.Errorf("saving kolet result: %v", err)
+		return
+	}
+	err = result.Save(f)
+	f.Close()
+	if err != nil {
+		t.Errorf("saving kolet result: %v", err)
+	}
+
+	logMetrics(t.H, result)
+	for _, path := range result.Artifacts {
+		if err := t.collectArtifact(m, path); err != nil {
+			t.Errorf("collecting artifact %s: %v", path, err)
+		}
+	}
+	reportSubResults(t.H, result.SubResults)
+}
+
+// collectArtifact copies path from m to the artifacts directory in the
+// test's output directory, keeping its directory structure.
+func (t *TestCluster) collectArtifact(m platform.Machine, path string) error {
+	dest := filepath.Join(t.H.OutputDir(), "artifacts", filepath.Clean("/"+path))
+	if err := os.MkdirAll(filepath.Dir(dest), 0777); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	in, err := platform.ReadFile(m, path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := in.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func logMetrics(h *harness.H, result *native.Result) {
+	var names []string
+	for name := range result.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h.Logf("metric %s: %v", name, result.Metrics[name])
+	}
+}
+
+// reportSubResults runs a subtest for each sub-result so they show up in
+// the test report. Their output was already logged by the parent.
+func reportSubResults(h *harness.H, results []*native.Result) {
+	for _, r := range results {
+		r := r
+		h.Run(r.Name, func(h *harness.H) {
+			logMetrics(h, r)
+			reportSubResults(h, r.SubResults)
+			if r.Result == testresult.Fail {
+				if r.Error != "" {
+					h.Error(r.Error)
+				} else {
+					h.Fail()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/flatcar-linux/mantle/harness"
+	"github.com/flatcar-linux/mantle/kola/register"
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/conf"
+)
+
+// discoveryError means no etcd discovery URL could be created for a
+// cluster, which is likely an outage rather than a problem with the OS.
+type discoveryError struct {
+	err error
+}
+
+func (e discoveryError) Error() string {
+	return fmt.Sprintf("Failed to create discovery endpoint: %v", e.err)
+}
+
+// testUserData returns the userdata of t for the Ignition version in use.
+func testUserData(t *register.Test) *conf.UserData {
+	if Options.IgnitionVersion == "v2" {
+		return t.UserData
+	} else if Options.IgnitionVersion == "v3" {
+		return t.UserDataV3
+	}
+	return nil
+}
+
+// startMachines boots the machines of t in c.
+func startMachines(c platform.Cluster, t *register.Test) error {
+	userdata := testUserData(t)
+	if userdata != nil && userdata.Contains("$discovery") {
+		url, err := c.GetDiscoveryURL(t.ClusterSize)
+		if err != nil {
+			return discoveryError{err}
+		}
+		userdata = userdata.Subst("$discovery", url)
+	}
+
+	if _, err := platform.NewMachines(c, userdata, t.ClusterSize); err != nil {
+		return fmt.Errorf("Cluster failed starting machines: %v", err)
+	}
+	return nil
+}
+
+func runtimeConfig(outputDir string, t *register.Test) *platform.RuntimeConfig {
+	return &platform.RuntimeConfig{
+		OutputDir:          outputDir,
+		NoSSHKeyInUserData: t.HasFlag(register.NoSSHKeyInUserData),
+		NoSSHKeyInMetadata: t.HasFlag(register.NoSSHKeyInMetadata),
+		NoEnableSelinux:    t.HasFlag(register.NoEnableSelinux),
+	}
+}
+
+// sharedFixture is the cluster of a register.Fixture shared by the
+// non-mutating tests of a run.
+type sharedFixture struct {
+	fixture *register.Fixture
+	test    *register.Test // carries the fixture's cluster settings
+	outDir  string
+	remove  bool
+
+	once    sync.Once
+	cluster platform.Cluster
+	err     error
+
+	serial sync.Mutex
+	mu     sync.Mutex
+	users  int
+	done   chan struct{} // closed once the last test released the fixture
+}
+
+// fixtures holds the shared fixtures of a run by name.
+type fixtures map[string]*sharedFixture
+
+// newFixtures prepares the shared fixtures of the tests, which must
+// already carry the settings of their fixture.
+func newFixtures(tests map[string]*register.Test, outputDir string, remove bool) fixtures {
+	fs := make(fixtures)
+	for _, t := range tests {
+		if t.Fixture == "" || t.Mutating {
+			continue
+		}
+		sf, ok := fs[t.Fixture]
+		if !ok {
+			f := register.Fixtures[t.Fixture]
+			sf = &sharedFixture{
+				fixture: f,
+				test: &register.Test{
+					Name:        f.Name,
+					UserData:    f.UserData,
+					UserDataV3:  f.UserDataV3,
+					ClusterSize: f.ClusterSize,
+					Flags:       f.Flags,
+				},
+				outDir: filepath.Join(outputDir, "_fixtures", f.Name),
+				remove: remove,
+				done:   make(chan struct{}),
+			}
+			fs[t.Fixture] = sf
+		}
+		sf.users++
+	}
+	return fs
+}
+
+// shared returns the shared fixture t runs against, or nil if t gets its
+// own cluster.
+func (fs fixtures) shared(t *register.Test) *sharedFixture {
+	if t.Fixture == "" || t.Mutating {
+		return nil
+	}
+	return fs[t.Fixture]
+}
+
+// acquire boots the cluster of the fixture on first use and returns it.
+func (sf *sharedFixture) acquire(flight platform.Flight) (platform.Cluster, error) {
+	sf.once.Do(func() {
+		plog.Noticef("Booting shared fixture %s", sf.fixture.Name)
+		if sf.err = os.MkdirAll(sf.outDir, 0777); sf.err != nil {
+			return
+		}
+		sf.cluster, sf.err = flight.NewCluster(runtimeConfig(sf.outDir, sf.test))
+		if sf.err != nil {
+			sf.err = fmt.Errorf("Cluster failed: %v", sf.err)
+			return
+		}
+		if sf.test.ClusterSize > 0 {
+			sf.err = startMachines(sf.cluster, sf.test)
+		}
+	})
+	return sf.cluster, sf.err
+}
+
+// release is called by every test of the fixture once it is done.
+func (sf *sharedFixture) release() {
+	sf.mu.Lock()
+	sf.users--
+	last := sf.users == 0
+	sf.mu.Unlock()
+	if last {
+		close(sf.done)
+	}
+}
+
+// name is the name of the harness test reporting on the fixture itself.
+func (sf *sharedFixture) name() string {
+	return "_fixture." + sf.fixture.Name
+}
+
+// run is the harness test of the fixture. It waits for the tests sharing
+// the cluster, then destroys it and checks its console output, so that
+// badness is not blamed on whichever test happened to finish last.
+func (sf *sharedFixture) run(h *harness.H) {
+	h.Parallel()
+	h.WaitFor(sf.done)
+	if sf.cluster == nil {
+		h.Skip("fixture was never booted")
+	}
+
+	plog.Noticef("Destroying shared fixture %s", sf.fixture.Name)
+	if sf.remove {
+		sf.cluster.Destroy()
+	}
+	checkClusterConsole(h, sf.cluster, sf.test)
+}
+
+// checkClusterConsole reports badness in the console and journal output
+// of the machines of c.
+func checkClusterConsole(h *harness.H, c platform.Cluster, t *register.Test) {
+	for id, output := range c.ConsoleOutput() {
+		for _, badness := range CheckConsole([]byte(output), t) {
+			h.Errorf("Found %s on machine %s console", badness, id)
+		}
+	}
+	for id, output := range c.JournalOutput() {
+		for _, badness := range CheckConsole([]byte(output), t) {
+			h.Errorf("Found %s on machine %s journal", badness, id)
+		}
+	}
+}
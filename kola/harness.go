@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
 	"time"
 
@@ -33,7 +34,9 @@ import (
 	"github.com/flatcar-linux/mantle/harness"
 	"github.com/flatcar-linux/mantle/harness/reporters"
 	"github.com/flatcar-linux/mantle/kola/cluster"
+	"github.com/flatcar-linux/mantle/kola/oci"
 	"github.com/flatcar-linux/mantle/kola/register"
+	"github.com/flatcar-linux/mantle/kola/shard"
 	"github.com/flatcar-linux/mantle/kola/torcx"
 	"github.com/flatcar-linux/mantle/platform"
 	awsapi "github.com/flatcar-linux/mantle/platform/api/aws"
@@ -41,19 +44,23 @@ import (
 	doapi "github.com/flatcar-linux/mantle/platform/api/do"
 	esxapi "github.com/flatcar-linux/mantle/platform/api/esx"
 	gcloudapi "github.com/flatcar-linux/mantle/platform/api/gcloud"
+	hetznerapi "github.com/flatcar-linux/mantle/platform/api/hetzner"
+	libvirtapi "github.com/flatcar-linux/mantle/platform/api/libvirt"
 	openstackapi "github.com/flatcar-linux/mantle/platform/api/openstack"
 	packetapi "github.com/flatcar-linux/mantle/platform/api/packet"
-	"github.com/flatcar-linux/mantle/platform/conf"
 	"github.com/flatcar-linux/mantle/platform/machine/aws"
 	"github.com/flatcar-linux/mantle/platform/machine/azure"
 	"github.com/flatcar-linux/mantle/platform/machine/do"
 	"github.com/flatcar-linux/mantle/platform/machine/esx"
 	"github.com/flatcar-linux/mantle/platform/machine/external"
 	"github.com/flatcar-linux/mantle/platform/machine/gcloud"
+	"github.com/flatcar-linux/mantle/platform/machine/hetzner"
+	"github.com/flatcar-linux/mantle/platform/machine/libvirt"
 	"github.com/flatcar-linux/mantle/platform/machine/openstack"
 	"github.com/flatcar-linux/mantle/platform/machine/packet"
 	"github.com/flatcar-linux/mantle/platform/machine/qemu"
 	"github.com/flatcar-linux/mantle/platform/machine/unprivqemu"
+	"github.com/flatcar-linux/mantle/sdk"
 	"github.com/flatcar-linux/mantle/system"
 )
 
@@ -67,13 +74,17 @@ var (
 	ESXOptions       = esxapi.Options{Options: &Options}       // glue to set platform options from main
 	ExternalOptions  = external.Options{Options: &Options}     // glue to set platform options from main
 	GCEOptions       = gcloudapi.Options{Options: &Options}    // glue to set platform options from main
+	HetznerOptions   = hetznerapi.Options{Options: &Options}   // glue to set platform options from main
+	LibvirtOptions   = libvirtapi.Options{Options: &Options}   // glue to set platform options from main
 	OpenStackOptions = openstackapi.Options{Options: &Options} // glue to set platform options from main
 	PacketOptions    = packetapi.Options{Options: &Options}    // glue to set platform options from main
 	QEMUOptions      = qemu.Options{Options: &Options}         // glue to set platform options from main
 
 	TestParallelism   int    //glue var to set test parallelism from main
 	TAPFile           string // if not "", write TAP results here
+	EventsDest        string // if not "", stream test events here, see harness.OpenEvents
 	TorcxManifestFile string // torcx manifest to expose to tests, if set
+	ImageRoot         string // if not "", take container image binaries from this root filesystem
 	// TorcxManifest is the unmarshalled torcx manifest file. It is available for
 	// tests to access via `kola.TorcxManifest`. It will be nil if there was no
 	// manifest given to kola.
@@ -81,6 +92,9 @@ var (
 
 	UpdatePayloadFile string
 
+	TestShard     shard.Shard              // if Count is not 0, only run this part of the tests
+	TestDurations map[string]time.Duration // durations of a previous run, to balance shards
+
 	consoleChecks = []struct {
 		desc        string
 		match       *regexp.Regexp
@@ -180,6 +194,10 @@ func NewFlight(pltfrm string) (flight platform.Flight, err error) {
 		flight, err = external.NewFlight(&ExternalOptions)
 	case "gce":
 		flight, err = gcloud.NewFlight(&GCEOptions)
+	case "hetzner":
+		flight, err = hetzner.NewFlight(&HetznerOptions)
+	case "libvirt":
+		flight, err = libvirt.NewFlight(&LibvirtOptions)
 	case "openstack":
 		flight, err = openstack.NewFlight(&OpenStackOptions)
 	case "packet":
@@ -323,6 +341,25 @@ func RunTests(patterns []string, channel, offering, pltfrm, outputDir string, ss
 		plog.Fatal(err)
 	}
 
+	for name, t := range tests {
+		if tests[name], err = t.WithFixture(); err != nil {
+			plog.Fatal(err)
+		}
+	}
+
+	if TestShard.Count != 0 {
+		var names []string
+		for name := range tests {
+			names = append(names, name)
+		}
+		selected := make(map[string]*register.Test)
+		for _, name := range TestShard.Select(names, TestDurations) {
+			selected[name] = tests[name]
+		}
+		plog.Noticef("Running %d of %d tests in shard %s", len(selected), len(tests), TestShard)
+		tests = selected
+	}
+
 	skipGetVersion := true
 	for name, t := range tests {
 		patternNotName := true
@@ -383,14 +420,27 @@ func RunTests(patterns []string, channel, offering, pltfrm, outputDir string, ss
 			reporters.NewJSONReporter("report.json", pltfrm, versionStr),
 		},
 	}
+	if EventsDest != "" {
+		events, err := harness.OpenEvents(EventsDest)
+		if err != nil {
+			return fmt.Errorf("opening event stream: %v", err)
+		}
+		defer events.Close()
+		opts.Events = events
+	}
+	fs := newFixtures(tests, outputDir, remove)
+	images := newImageBuilder(pltfrm)
 	var htests harness.Tests
 	for _, test := range tests {
 		test := test // for the closure
 		run := func(h *harness.H) {
-			runTest(h, test, pltfrm, flight, remove)
+			runTest(h, test, pltfrm, flight, images, remove, fs)
 		}
 		htests.Add(test.Name, run)
 	}
+	for _, sf := range fs {
+		htests.Add(sf.name(), sf.run)
+	}
 
 	suite := harness.NewSuite(opts, htests)
 	err = suite.Run()
@@ -483,56 +533,49 @@ func parseCLVersion(input string) (*semver.Version, error) {
 // runTest is a harness for running a single test.
 // outputDir is where various test logs and data will be written for
 // analysis after the test run. It should already exist.
-func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flight, remove bool) {
+func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flight, images *oci.Builder, remove bool, fs fixtures) {
 	h.Parallel()
 
-	rconf := &platform.RuntimeConfig{
-		OutputDir:          h.OutputDir(),
-		NoSSHKeyInUserData: t.HasFlag(register.NoSSHKeyInUserData),
-		NoSSHKeyInMetadata: t.HasFlag(register.NoSSHKeyInMetadata),
-		NoEnableSelinux:    t.HasFlag(register.NoEnableSelinux),
-	}
-	c, err := flight.NewCluster(rconf)
-	if err != nil {
-		h.Fatalf("Cluster failed: %v", err)
-	}
-	defer func() {
-		if remove {
-			c.Destroy()
-		}
-		for id, output := range c.ConsoleOutput() {
-			for _, badness := range CheckConsole([]byte(output), t) {
-				h.Errorf("Found %s on machine %s console", badness, id)
-			}
-		}
-		for id, output := range c.JournalOutput() {
-			for _, badness := range CheckConsole([]byte(output), t) {
-				h.Errorf("Found %s on machine %s journal", badness, id)
-			}
+	var c platform.Cluster
+	if sf := fs.shared(t); sf != nil {
+		defer sf.release()
+
+		var err error
+		c, err = sf.acquire(flight)
+		if _, ok := err.(discoveryError); ok {
+			// Skip instead of failing since the harness not being able to
+			// get a discovery url is likely an outage (e.g
+			// 503 Service Unavailable: Back-end server is at capacity)
+			// not a problem with the OS
+			h.Skip(err)
+		} else if err != nil {
+			h.Fatalf("Shared fixture %s failed: %v", t.Fixture, err)
 		}
-	}()
 
-	if t.ClusterSize > 0 {
-		var userdata *conf.UserData
-		if Options.IgnitionVersion == "v2" {
-			userdata = t.UserData
-		} else if Options.IgnitionVersion == "v3" {
-			userdata = t.UserDataV3
+		if sf.fixture.Serial {
+			sf.serial.Lock()
+			defer sf.serial.Unlock()
 		}
-		if userdata != nil && userdata.Contains("$discovery") {
-			url, err := c.GetDiscoveryURL(t.ClusterSize)
-			if err != nil {
-				// Skip instead of failing since the harness not being able to
-				// get a discovery url is likely an outage (e.g
-				// 503 Service Unavailable: Back-end server is at capacity)
-				// not a problem with the OS
-				h.Skipf("Failed to create discovery endpoint: %v", err)
-			}
-			userdata = userdata.Subst("$discovery", url)
+	} else {
+		var err error
+		c, err = flight.NewCluster(runtimeConfig(h.OutputDir(), t))
+		if err != nil {
+			h.Fatalf("Cluster failed: %v", err)
 		}
-
-		if _, err := platform.NewMachines(c, userdata, t.ClusterSize); err != nil {
-			h.Fatalf("Cluster failed starting machines: %v", err)
+		defer func() {
+			if remove {
+				c.Destroy()
+			}
+			checkClusterConsole(h, c, t)
+		}()
+
+		if t.ClusterSize > 0 {
+			err := startMachines(c, t)
+			if _, ok := err.(discoveryError); ok {
+				h.Skip(err)
+			} else if err != nil {
+				h.Fatal(err)
+			}
 		}
 	}
 
@@ -544,15 +587,24 @@ func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flig
 
 	// Cluster -> TestCluster
 	tcluster := cluster.TestCluster{
-		H:           h,
-		Cluster:     c,
-		NativeFuncs: names,
-		FailFast:    t.FailFast,
+		H:            h,
+		Cluster:      c,
+		NativeFuncs:  names,
+		Images:       t.Images,
+		ImageBuilder: images,
+		FailFast:     t.FailFast,
 	}
 
 	// drop kolet binary on machines
 	if t.NativeFuncs != nil {
-		scpKolet(tcluster, architecture(pltfrm))
+		installKolet(tcluster, architecture(pltfrm))
+	}
+
+	// load container images on machines
+	for _, m := range tcluster.Machines() {
+		if err := tcluster.LoadImages(m); err != nil {
+			h.Fatalf("Loading container images failed: %v", err)
+		}
 	}
 
 	defer func() {
@@ -565,28 +617,50 @@ func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flig
 	t.Run(tcluster)
 }
 
+// board returns the SDK board of the given platform, if it has one.
+func board(pltfrm string) string {
+	switch pltfrm {
+	case "qemu":
+		return QEMUOptions.Board
+	case "packet":
+		return PacketOptions.Board
+	case "aws":
+		return AWSOptions.Board
+	}
+	return ""
+}
+
 // architecture returns the machine architecture of the given platform.
 func architecture(pltfrm string) string {
 	nativeArch := "amd64"
-	if pltfrm == "qemu" && QEMUOptions.Board != "" {
-		nativeArch = boardToArch(QEMUOptions.Board)
-	}
-	if pltfrm == "packet" && PacketOptions.Board != "" {
-		nativeArch = boardToArch(PacketOptions.Board)
-	}
-	if pltfrm == "aws" && AWSOptions.Board != "" {
-		nativeArch = boardToArch(AWSOptions.Board)
+	if b := board(pltfrm); b != "" {
+		nativeArch = boardToArch(b)
 	}
 	return nativeArch
 }
 
+// newImageBuilder returns the builder of the container images of a
+// flight. Binaries of images for foreign machines are taken from the
+// board root, unless another root is given.
+func newImageBuilder(pltfrm string) *oci.Builder {
+	arch := architecture(pltfrm)
+	root := ImageRoot
+	if b := board(pltfrm); root == "" && b != "" && arch != runtime.GOARCH {
+		if _, err := os.Stat(sdk.BoardRoot(b)); err == nil {
+			root = sdk.BoardRoot(b)
+		}
+	}
+	return oci.NewBuilder(arch, root)
+}
+
 // returns the arch part of an sdk board name
 func boardToArch(board string) string {
 	return strings.SplitN(board, "-", 2)[0]
 }
 
-// scpKolet searches for a kolet binary and copies it to the machine.
-func scpKolet(c cluster.TestCluster, mArch string) {
+// installKolet searches for a kolet binary and unpacks it on the
+// machines as part of an image, which is built once per flight.
+func installKolet(c cluster.TestCluster, mArch string) {
 	for _, d := range []string{
 		".",
 		filepath.Dir(os.Args[0]),
@@ -595,8 +669,14 @@ func scpKolet(c cluster.TestCluster, mArch string) {
 	} {
 		kolet := filepath.Join(d, "kolet")
 		if _, err := os.Stat(kolet); err == nil {
-			if err := c.DropFile(kolet); err != nil {
-				c.Fatalf("dropping kolet binary: %v", err)
+			image := oci.Image{
+				Name:     "localhost/kolet",
+				Contents: map[string]string{"kolet": kolet},
+			}
+			for _, machine := range c.Machines() {
+				if err := c.ImageBuilder.Unpack(machine, &image, "."); err != nil {
+					c.Fatalf("dropping kolet binary: %v", err)
+				}
 			}
 			// The default SELinux rules do not allow init_t to execute user_home_t
 			if Options.Distribution == "rhcos" || Options.Distribution == "fcos" {
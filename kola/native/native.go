@@ -0,0 +1,159 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package native holds the types shared by kolet, which runs native test
+// functions on machines, and kola, which collects their results.
+package native
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/flatcar-linux/mantle/harness/testresult"
+)
+
+// Func is a test function run natively on a machine by kolet. The context
+// is cancelled when the function's timeout expires.
+type Func func(ctx context.Context, r *Result) error
+
+// Result is the structured outcome of a native function, written by kolet
+// as JSON and read back by kola.
+type Result struct {
+	Name     string                `json:"name"`
+	Result   testresult.TestResult `json:"result"`
+	Error    string                `json:"error,omitempty"`
+	Duration time.Duration         `json:"duration"`
+	Logs     []string              `json:"logs,omitempty"`
+	Metrics  map[string]float64    `json:"metrics,omitempty"`
+	// Artifacts are absolute paths of files on the machine that kola
+	// copies into the test's output directory.
+	Artifacts  []string  `json:"artifacts,omitempty"`
+	SubResults []*Result `json:"subresults,omitempty"`
+
+	mu     sync.Mutex
+	out    io.Writer
+	start  time.Time
+	failed bool
+}
+
+// NewResult creates a result for the function name. Log lines are also
+// written to out as they are logged, if out is not nil.
+func NewResult(name string, out io.Writer) *Result {
+	return &Result{
+		Name:  name,
+		out:   out,
+		start: time.Now(),
+	}
+}
+
+// Log records a log line.
+func (r *Result) Log(args ...interface{}) {
+	r.log(fmt.Sprintln(args...))
+}
+
+// Logf records a formatted log line.
+func (r *Result) Logf(format string, args ...interface{}) {
+	r.log(fmt.Sprintf(format, args...))
+}
+
+func (r *Result) log(s string) {
+	if len(s) > 0 && s[len(s)-1] == '\n' {
+		s = s[:len(s)-1]
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Logs = append(r.Logs, s)
+	if r.out != nil {
+		fmt.Fprintf(r.out, "%s: %s\n", r.Name, s)
+	}
+}
+
+// Metric records a named numeric measurement.
+func (r *Result) Metric(name string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Metrics == nil {
+		r.Metrics = make(map[string]float64)
+	}
+	r.Metrics[name] = value
+}
+
+// Artifact marks the file at path on the machine for collection by kola.
+func (r *Result) Artifact(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Artifacts = append(r.Artifacts, path)
+}
+
+// Run runs f as a sub-result named name and reports whether it succeeded.
+// A failing sub-result fails r as well.
+func (r *Result) Run(name string, f func(sub *Result) error) bool {
+	sub := NewResult(r.Name+"/"+name, r.out)
+	sub.Finish(f(sub))
+	sub.Name = name
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.SubResults = append(r.SubResults, sub)
+	if sub.failed {
+		r.failed = true
+	}
+	return !sub.failed
+}
+
+// Finish sets the outcome of r from the error returned by its function
+// and any failed sub-results.
+func (r *Result) Finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Duration = time.Since(r.start)
+	if err != nil {
+		r.failed = true
+		r.Error = err.Error()
+	}
+	if r.failed {
+		r.Result = testresult.Fail
+	} else {
+		r.Result = testresult.Pass
+	}
+}
+
+// Failed reports whether r or one of its sub-results failed.
+func (r *Result) Failed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failed || r.Result == testresult.Fail
+}
+
+// Save encodes r as JSON to w.
+func (r *Result) Save(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// LoadResult decodes a result written by Result.Save.
+func LoadResult(rd io.Reader) (*Result, error) {
+	var r Result
+	if err := json.NewDecoder(rd).Decode(&r); err != nil {
+		return nil, fmt.Errorf("decoding native result: %v", err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package native
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/flatcar-linux/mantle/harness/testresult"
+)
+
+func TestResultRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	r := NewResult("Func", &out)
+	r.Logf("starting %d", 1)
+	r.Metric("latency", 1.5)
+	r.Artifact("/var/log/test.log")
+	r.Run("ok", func(sub *Result) error {
+		sub.Log("fine")
+		return nil
+	})
+	if r.Run("bad", func(sub *Result) error { return errors.New("boom") }) {
+		t.Errorf("failing sub-result reported success")
+	}
+	r.Finish(nil)
+
+	if !r.Failed() {
+		t.Errorf("failed sub-result did not fail parent")
+	}
+	if got := out.String(); got != "Func: starting 1\nFunc/ok: fine\n" {
+		t.Errorf("unexpected streamed output %q", got)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadResult(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Result != testresult.Fail || loaded.Metrics["latency"] != 1.5 ||
+		len(loaded.Artifacts) != 1 || len(loaded.SubResults) != 2 {
+		t.Fatalf("unexpected result %+v", loaded)
+	}
+	if sub := loaded.SubResults[1]; sub.Name != "bad" || sub.Result != testresult.Fail || sub.Error != "boom" {
+		t.Errorf("unexpected sub-result %+v", sub)
+	}
+	if sub := loaded.SubResults[0]; sub.Result != testresult.Pass || len(sub.Logs) != 1 {
+		t.Errorf("unexpected sub-result %+v", sub)
+	}
+}
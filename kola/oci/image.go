@@ -0,0 +1,442 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oci builds single layer container images out of host binaries
+// and loads them into machines, so tests need no registry access.
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/system/targen"
+)
+
+const (
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeConfig   = "application/vnd.oci.image.config.v1+json"
+	mediaTypeLayer    = "application/vnd.oci.image.layer.v1.tar"
+)
+
+var plog = capnslog.NewPackageLogger("github.com/flatcar-linux/mantle", "kola/oci")
+
+// Image describes a scratch image made of files and binaries from the
+// host running kola, or from the root filesystem of its Builder.
+// Binaries are copied along with the libraries they link against.
+type Image struct {
+	// Name is the image reference, e.g. "localhost/ncat". The tag
+	// defaults to "latest".
+	Name string
+
+	// Runtime is the container engine the image is loaded into,
+	// "docker" or "podman". Defaults to "docker".
+	Runtime string
+
+	// Binaries are names or paths of host binaries. Names are looked
+	// up in $PATH.
+	Binaries []string
+
+	// Files are paths of additional host files.
+	Files []string
+
+	// Contents maps paths in the image to host files which are stored
+	// under a different path, such as kolet.  They are always taken
+	// from the host.
+	Contents map[string]string
+
+	// Entrypoint and Cmd are set in the image configuration.
+	Entrypoint []string
+	Cmd        []string
+}
+
+// Ref returns the image reference including its tag.
+func (i *Image) Ref() string {
+	if strings.LastIndex(i.Name, ":") > strings.LastIndex(i.Name, "/") {
+		return i.Name
+	}
+	return i.Name + ":latest"
+}
+
+func (i *Image) runtime() string {
+	if i.Runtime == "" {
+		return "docker"
+	}
+	return i.Runtime
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type blob struct {
+	data   []byte
+	digest string
+}
+
+func newBlob(data []byte) blob {
+	return blob{
+		data:   data,
+		digest: fmt.Sprintf("sha256:%x", sha256.Sum256(data)),
+	}
+}
+
+func (b blob) path() string {
+	return "blobs/sha256/" + strings.TrimPrefix(b.digest, "sha256:")
+}
+
+func (b blob) descriptor(mediaType string) descriptor {
+	return descriptor{
+		MediaType: mediaType,
+		Digest:    b.digest,
+		Size:      int64(len(b.data)),
+	}
+}
+
+func jsonBlob(v interface{}) (blob, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return blob{}, err
+	}
+	return newBlob(data), nil
+}
+
+// Builder builds the images for the machines of a flight. Each image is
+// built once and then reused for every machine.
+type Builder struct {
+	arch string
+	root string
+
+	mu    sync.Mutex
+	built map[string]*built
+}
+
+type built struct {
+	layer   []byte
+	archive []byte
+}
+
+// NewBuilder returns a Builder for machines of the architecture arch, in
+// GOARCH notation. Binaries and files are taken from the filesystem tree
+// at root, such as the board sysroot, or from the host if root is empty.
+// A root is needed if arch isn't the host's.
+func NewBuilder(arch, root string) *Builder {
+	return &Builder{
+		arch:  arch,
+		root:  root,
+		built: make(map[string]*built),
+	}
+}
+
+// build returns the layer and the archive of i, building them on first
+// use.
+func (b *Builder) build(i *Image) (*built, error) {
+	key, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r, ok := b.built[string(key)]; ok {
+		return r, nil
+	}
+
+	plog.Debugf("building image %s for %s", i.Ref(), b.arch)
+	layer, err := b.layer(i)
+	if err != nil {
+		return nil, fmt.Errorf("building image %s: %v", i.Ref(), err)
+	}
+	var buf bytes.Buffer
+	if err := b.archive(&buf, i, layer); err != nil {
+		return nil, fmt.Errorf("building image %s: %v", i.Ref(), err)
+	}
+	r := &built{layer: layer, archive: buf.Bytes()}
+	b.built[string(key)] = r
+	return r, nil
+}
+
+// lookPath finds a binary by name or path on the host or under the
+// builder's root.
+func (b *Builder) lookPath(bin string) (string, error) {
+	if b.root == "" {
+		return exec.LookPath(bin)
+	}
+	if filepath.IsAbs(bin) {
+		if _, err := os.Stat(filepath.Join(b.root, bin)); err != nil {
+			return "", err
+		}
+		return bin, nil
+	}
+	for _, dir := range []string{"/usr/sbin", "/usr/bin", "/sbin", "/bin"} {
+		path := filepath.Join(dir, bin)
+		if st, err := os.Stat(filepath.Join(b.root, path)); err == nil && st.Mode().IsRegular() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in %s", bin, b.root)
+}
+
+// layer generates the only layer of i.
+func (b *Builder) layer(i *Image) ([]byte, error) {
+	if b.root == "" && b.arch != runtime.GOARCH && len(i.Binaries)+len(i.Files) > 0 {
+		return nil, fmt.Errorf("host binaries can't run on %s machines, a root filesystem for %s is needed", b.arch, b.arch)
+	}
+
+	tg := targen.New()
+	if b.root != "" {
+		tg = targen.NewWithRoot(b.root)
+	}
+	for _, f := range i.Files {
+		tg.AddFile(f)
+	}
+	for _, bin := range i.Binaries {
+		path, err := b.lookPath(bin)
+		if err != nil {
+			return nil, fmt.Errorf("finding binary %q: %v", bin, err)
+		}
+		tg.AddBinary(path)
+	}
+
+	var generated bytes.Buffer
+	if err := tg.Generate(&generated); err != nil {
+		return nil, fmt.Errorf("generating layer: %v", err)
+	}
+	if len(i.Contents) == 0 {
+		return generated.Bytes(), nil
+	}
+
+	// targen closes its archive, so copy its entries into a new one
+	// which also gets the contents
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tr := tar.NewReader(&generated)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return nil, err
+		}
+	}
+	var names []string
+	for name := range i.Contents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		src := i.Contents[name]
+		st, err := os.Stat(src)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     strings.TrimPrefix(path.Clean("/"+name), "/"),
+			Mode:     int64(st.Mode().Perm()),
+			Size:     int64(len(data)),
+			ModTime:  st.ModTime(),
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Build writes i to w as a tar archive in OCI image layout, which also
+// carries a manifest.json so that both docker load and podman load
+// accept it.
+func (b *Builder) Build(w io.Writer, i *Image) error {
+	r, err := b.build(i)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(r.archive)
+	return err
+}
+
+func (b *Builder) archive(w io.Writer, i *Image, layerData []byte) error {
+	layer := newBlob(layerData)
+
+	config, err := jsonBlob(map[string]interface{}{
+		"created":      time.Now().UTC(),
+		"architecture": b.arch,
+		"os":           "linux",
+		"config": map[string]interface{}{
+			"Entrypoint": i.Entrypoint,
+			"Cmd":        i.Cmd,
+		},
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": []string{layer.digest},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	manifest, err := jsonBlob(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeManifest,
+		"config":        config.descriptor(mediaTypeConfig),
+		"layers":        []descriptor{layer.descriptor(mediaTypeLayer)},
+	})
+	if err != nil {
+		return err
+	}
+
+	ref := i.Ref()
+	desc := manifest.descriptor(mediaTypeManifest)
+	desc.Annotations = map[string]string{
+		"io.containerd.image.name":          ref,
+		"org.opencontainers.image.ref.name": ref[strings.LastIndex(ref, ":")+1:],
+	}
+	index, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests":     []descriptor{desc},
+	})
+	if err != nil {
+		return err
+	}
+
+	dockerManifest, err := json.Marshal([]map[string]interface{}{{
+		"Config":   config.path(),
+		"RepoTags": []string{ref},
+		"Layers":   []string{layer.path()},
+	}})
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	for _, dir := range []string{"blobs/", "blobs/sha256/"} {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     dir,
+			Mode:     0755,
+		}); err != nil {
+			return err
+		}
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)},
+		{layer.path(), layer.data},
+		{config.path(), config.data},
+		{manifest.path(), manifest.data},
+		{"index.json", index},
+		{"manifest.json", dockerManifest},
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.name,
+			Mode:     0644,
+			Size:     int64(len(f.data)),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// run streams data into cmd on m.
+func run(m platform.Machine, data []byte, cmd string) error {
+	client, err := m.SSHClient()
+	if err != nil {
+		return fmt.Errorf("creating SSH client: %v", err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("creating SSH session: %v", err)
+	}
+	defer session.Close()
+
+	session.Stdin = bytes.NewReader(data)
+	if out, err := session.CombinedOutput(cmd); err != nil {
+		return fmt.Errorf("%s: %v", bytes.TrimSpace(out), err)
+	}
+	return nil
+}
+
+// Load loads i into the container engine on m.
+func (b *Builder) Load(m platform.Machine, i *Image) error {
+	r, err := b.build(i)
+	if err != nil {
+		return err
+	}
+
+	plog.Debugf("loading image %s into %s on %s", i.Ref(), i.runtime(), m.ID())
+	if err := run(m, r.archive, fmt.Sprintf("sudo %s load", i.runtime())); err != nil {
+		return fmt.Errorf("loading image %s: %v", i.Ref(), err)
+	}
+	return nil
+}
+
+// Unpack extracts the files of i into dir on m, which is relative to
+// the home directory, without involving a container engine. It delivers
+// payloads such as kolet which run on the host.
+func (b *Builder) Unpack(m platform.Machine, i *Image, dir string) error {
+	r, err := b.build(i)
+	if err != nil {
+		return err
+	}
+
+	plog.Debugf("unpacking image %s into %s on %s", i.Ref(), dir, m.ID())
+	if err := run(m, r.layer, fmt.Sprintf("mkdir -p %q && tar -x --no-same-owner -C %q", dir, dir)); err != nil {
+		return fmt.Errorf("unpacking image %s: %v", i.Ref(), err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestImageRef(t *testing.T) {
+	for name, ref := range map[string]string{
+		"ncat":                  "ncat:latest",
+		"localhost/ncat":        "localhost/ncat:latest",
+		"localhost/ncat:v1":     "localhost/ncat:v1",
+		"localhost:5000/ncat":   "localhost:5000/ncat:latest",
+		"localhost:5000/ncat:1": "localhost:5000/ncat:1",
+	} {
+		i := Image{Name: name}
+		if got := i.Ref(); got != ref {
+			t.Errorf("%s: expected %s, got %s", name, ref, got)
+		}
+	}
+}
+
+func TestImageBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oci-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "hello")
+	if err := ioutil.WriteFile(file, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	i := Image{
+		Name:     "localhost/hello",
+		Files:    []string{file},
+		Contents: map[string]string{"/greeting": file},
+		Cmd:      []string{"/hello"},
+	}
+	contents := buildImage(t, NewBuilder(runtime.GOARCH, ""), &i)
+
+	for name, data := range contents {
+		if filepath.Dir(name) != "blobs/sha256" {
+			continue
+		}
+		if digest := fmt.Sprintf("%x", sha256.Sum256(data)); digest != filepath.Base(name) {
+			t.Errorf("blob %s has digest %s", name, digest)
+		}
+	}
+
+	var dockerManifest []struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	if err := json.Unmarshal(contents["manifest.json"], &dockerManifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(dockerManifest) != 1 || len(dockerManifest[0].RepoTags) != 1 ||
+		dockerManifest[0].RepoTags[0] != "localhost/hello:latest" {
+		t.Fatalf("unexpected manifest.json %+v", dockerManifest)
+	}
+
+	var config struct {
+		Architecture string
+	}
+	if err := json.Unmarshal(contents[dockerManifest[0].Config], &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Architecture != runtime.GOARCH {
+		t.Errorf("unexpected architecture %s", config.Architecture)
+	}
+
+	layer := readTar(t, contents[dockerManifest[0].Layers[0]])
+	if string(layer[file]) != "hello\n" || string(layer["greeting"]) != "hello\n" || len(layer) != 2 {
+		t.Errorf("unexpected layer entries %v", layer)
+	}
+
+	var index struct {
+		Manifests []descriptor
+	}
+	if err := json.Unmarshal(contents["index.json"], &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Annotations["org.opencontainers.image.ref.name"] != "latest" {
+		t.Fatalf("unexpected index.json %+v", index)
+	}
+	if _, ok := contents[filepath.Join("blobs", "sha256", index.Manifests[0].Digest[len("sha256:"):])]; !ok {
+		t.Errorf("index.json references missing manifest")
+	}
+}
+
+func TestImageBuildForeignArch(t *testing.T) {
+	arch := "arm64"
+	if runtime.GOARCH == arch {
+		arch = "amd64"
+	}
+	i := Image{
+		Name:     "localhost/sh",
+		Binaries: []string{"sh"},
+	}
+	if err := NewBuilder(arch, "").Build(ioutil.Discard, &i); err == nil {
+		t.Errorf("built %s image out of host binaries", arch)
+	}
+
+	// contents are arch independent
+	dir, err := ioutil.TempDir("", "oci-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "data")
+	if err := ioutil.WriteFile(file, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	i = Image{
+		Name:     "localhost/data",
+		Contents: map[string]string{"data": file},
+	}
+	if err := NewBuilder(arch, "").Build(ioutil.Discard, &i); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBuilderCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oci-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "data")
+	if err := ioutil.WriteFile(file, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBuilder(runtime.GOARCH, "")
+	i := Image{
+		Name:     "localhost/data",
+		Contents: map[string]string{"data": file},
+	}
+	var first, second bytes.Buffer
+	if err := b.Build(&first, &i); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Build(&second, &i); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Errorf("image was built twice")
+	}
+}
+
+// buildImage builds i with b and returns the contents of the archive.
+func buildImage(t *testing.T, b *Builder, i *Image) map[string][]byte {
+	var buf bytes.Buffer
+	if err := b.Build(&buf, i); err != nil {
+		t.Fatal(err)
+	}
+	return readTar(t, buf.Bytes())
+}
+
+// readTar returns the regular files of a tar archive.
+func readTar(t *testing.T, data []byte) map[string][]byte {
+	contents := make(map[string][]byte)
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[hdr.Name] = data
+	}
+	return contents
+}
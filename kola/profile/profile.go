@@ -0,0 +1,277 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package profile loads kola run profiles. A profile is a YAML mapping of
+// command line flags to their values, so that CI jobs can keep their
+// settings in a file instead of on the command line:
+//
+//	platform: aws
+//	board: amd64-usr
+//	parallel: 4
+//	tests: [cl.basic, "coreos.ignition.*"]
+//	aws:
+//	  region: ${AWS_REGION}
+//	  type: m5.large
+//
+// Nested mappings are joined with "-", so the example sets --aws-region
+// and --aws-type. Lists set flags that can be given more than once. The
+// tests key holds the test patterns. $VAR and ${VAR} in values are
+// replaced with environment variables.
+package profile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const testsKey = "tests"
+
+// Value is the value of a flag set by a profile.
+type Value struct {
+	Flag   string
+	Values []string
+	Line   int
+	// List is set if the values were given as a list, which only flags
+	// that can be given more than once accept.
+	List bool
+}
+
+// Profile is a parsed run profile.
+type Profile struct {
+	Tests  []string
+	Values []Value
+}
+
+// Errors lists all problems found in a profile.
+type Errors []string
+
+func (e Errors) Error() string {
+	return strings.Join(e, "\n")
+}
+
+// Load reads and parses the profile at path, expanding environment
+// variables.
+func Load(path string) (*Profile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return p, nil
+}
+
+// Parse parses a profile. lookupEnv resolves environment variables; using
+// an unset variable is an error.
+func Parse(data []byte, lookupEnv func(string) (string, bool)) (*Profile, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	p := &Profile{}
+	if len(doc.Content) == 0 {
+		return p, nil
+	}
+
+	var errs Errors
+	expand := func(n *yaml.Node) string {
+		return os.Expand(n.Value, func(name string) string {
+			v, ok := lookupEnv(name)
+			if !ok {
+				errs = append(errs, fmt.Sprintf("line %d: environment variable %s is not set", n.Line, name))
+			}
+			return v
+		})
+	}
+	scalars := func(n *yaml.Node) ([]string, bool) {
+		switch n.Kind {
+		case yaml.ScalarNode:
+			return []string{expand(n)}, true
+		case yaml.SequenceNode:
+			var l []string
+			for _, item := range n.Content {
+				if item.Kind != yaml.ScalarNode {
+					return nil, false
+				}
+				l = append(l, expand(item))
+			}
+			return l, true
+		}
+		return nil, false
+	}
+
+	var walk func(prefix string, n *yaml.Node)
+	walk = func(prefix string, n *yaml.Node) {
+		if n.Kind != yaml.MappingNode {
+			errs = append(errs, fmt.Sprintf("line %d: expected a mapping", n.Line))
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			name := prefix + key.Value
+			if name == testsKey {
+				tests, ok := scalars(value)
+				if !ok {
+					errs = append(errs, fmt.Sprintf("line %d: tests must be a list of patterns", value.Line))
+				}
+				p.Tests = append(p.Tests, tests...)
+				continue
+			}
+			if value.Kind == yaml.MappingNode {
+				walk(name+"-", value)
+				continue
+			}
+			values, ok := scalars(value)
+			if !ok {
+				errs = append(errs, fmt.Sprintf("line %d: %s must be a value or a list of values", value.Line, name))
+				continue
+			}
+			p.Values = append(p.Values, Value{
+				Flag:   name,
+				Values: values,
+				Line:   key.Line,
+				List:   value.Kind == yaml.SequenceNode,
+			})
+		}
+	}
+	walk("", doc.Content[0])
+
+	if len(errs) != 0 {
+		return nil, errs
+	}
+	return p, nil
+}
+
+// Apply sets the flags of the profile in flags. Flags given on the
+// command line take precedence over the profile. Unknown flags and
+// invalid values are reported together.
+func (p *Profile) Apply(flags *pflag.FlagSet) error {
+	var errs Errors
+	for _, v := range p.Values {
+		flag := flags.Lookup(v.Flag)
+		if flag == nil {
+			errs = append(errs, fmt.Sprintf("line %d: unknown key %s", v.Line, v.Flag))
+			continue
+		}
+		if flag.Changed {
+			continue
+		}
+		if v.List && !isList(flag) {
+			errs = append(errs, fmt.Sprintf("line %d: %s takes a single value, not a list", v.Line, v.Flag))
+			continue
+		}
+		for _, value := range v.Values {
+			if err := flags.Set(v.Flag, value); err != nil {
+				errs = append(errs, fmt.Sprintf("line %d: invalid value %q for %s: %v", v.Line, value, v.Flag, err))
+				break
+			}
+		}
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate reports the problems Apply would find with flags, without
+// changing them or the variables behind them.
+func (p *Profile) Validate(flags *pflag.FlagSet) error {
+	fresh, err := freshFlags(flags)
+	if err != nil {
+		return err
+	}
+	return p.Apply(fresh)
+}
+
+// isList reports whether flag can be given more than once.
+func isList(flag *pflag.Flag) bool {
+	typ := flag.Value.Type()
+	return strings.HasSuffix(typ, "Slice") || strings.HasSuffix(typ, "Array")
+}
+
+// freshFlags returns a flag set with the flags of flags backed by new
+// variables, none of them changed.
+func freshFlags(flags *pflag.FlagSet) (*pflag.FlagSet, error) {
+	fresh := pflag.NewFlagSet("validate", pflag.ContinueOnError)
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		name := flag.Name
+		switch typ := flag.Value.Type(); typ {
+		case "string":
+			fresh.String(name, "", "")
+		case "bool":
+			fresh.Bool(name, false, "")
+		case "int":
+			fresh.Int(name, 0, "")
+		case "int8":
+			fresh.Int8(name, 0, "")
+		case "int32":
+			fresh.Int32(name, 0, "")
+		case "int64":
+			fresh.Int64(name, 0, "")
+		case "uint":
+			fresh.Uint(name, 0, "")
+		case "uint8":
+			fresh.Uint8(name, 0, "")
+		case "uint16":
+			fresh.Uint16(name, 0, "")
+		case "uint32":
+			fresh.Uint32(name, 0, "")
+		case "uint64":
+			fresh.Uint64(name, 0, "")
+		case "float32":
+			fresh.Float32(name, 0, "")
+		case "float64":
+			fresh.Float64(name, 0, "")
+		case "duration":
+			fresh.Duration(name, time.Duration(0), "")
+		case "count":
+			fresh.Count(name, "")
+		case "stringSlice":
+			fresh.StringSlice(name, nil, "")
+		case "intSlice":
+			fresh.IntSlice(name, nil, "")
+		case "ip":
+			fresh.IP(name, nil, "")
+		case "ipMask":
+			fresh.IPMask(name, nil, "")
+		case "ipNet":
+			fresh.IPNet(name, net.IPNet{}, "")
+		default:
+			// other values, such as log levels, are pointers to
+			// scalars whose zero value is usable
+			v := reflect.ValueOf(flag.Value)
+			if v.Kind() == reflect.Ptr && v.Elem().Kind() != reflect.Struct {
+				if value, ok := reflect.New(v.Elem().Type()).Interface().(pflag.Value); ok {
+					fresh.Var(value, name, "")
+					return
+				}
+			}
+			if err == nil {
+				err = fmt.Errorf("flag %s has unsupported type %T", name, flag.Value)
+			}
+		}
+	})
+	return fresh, err
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func testEnv(name string) (string, bool) {
+	if name == "REGION" {
+		return "eu-central-1", true
+	}
+	return "", false
+}
+
+func testFlags() (*pflag.FlagSet, *string, *int, *[]string) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	region := flags.String("aws-region", "us-west-2", "")
+	parallel := flags.Int("parallel", 1, "")
+	units := flags.StringSlice("debug-systemd-unit", nil, "")
+	flags.String("platform", "qemu", "")
+	return flags, region, parallel, units
+}
+
+func TestProfile(t *testing.T) {
+	p, err := Parse([]byte(`
+platform: aws
+parallel: 4
+tests: [cl.basic, "coreos.ignition.*"]
+debug-systemd-unit:
+  - a.service
+  - b.service
+aws:
+  region: ${REGION}
+`), testEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.Tests, []string{"cl.basic", "coreos.ignition.*"}) {
+		t.Errorf("unexpected tests %q", p.Tests)
+	}
+
+	flags, region, parallel, units := testFlags()
+	// given on the command line
+	if err := flags.Parse([]string{"--platform", "qemu"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Apply(flags); err != nil {
+		t.Fatal(err)
+	}
+	if *region != "eu-central-1" {
+		t.Errorf("unexpected region %q", *region)
+	}
+	if *parallel != 4 {
+		t.Errorf("unexpected parallelism %d", *parallel)
+	}
+	if !reflect.DeepEqual(*units, []string{"a.service", "b.service"}) {
+		t.Errorf("unexpected units %q", *units)
+	}
+	if platform, _ := flags.GetString("platform"); platform != "qemu" {
+		t.Errorf("command line flag overridden with %q", platform)
+	}
+}
+
+func TestProfileErrors(t *testing.T) {
+	_, err := Parse([]byte(`
+aws:
+  region: $UNSET
+tests:
+  - {a: b}
+`), testEnv)
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, s := range []string{"line 3: environment variable UNSET is not set", "line 5: tests must be a list"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error lacks %q:\n%v", s, err)
+		}
+	}
+
+	p, err := Parse([]byte(`
+parallel: many
+gce:
+  zone: us-central1-a
+`), testEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags, _, _, _ := testFlags()
+	err = p.Apply(flags)
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, s := range []string{`line 2: invalid value "many" for parallel`, "line 4: unknown key gce-zone"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("error lacks %q:\n%v", s, err)
+		}
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	first, err := Parse([]byte("parallel: 2\n"), testEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Parse([]byte("parallel: many\n"), testEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both profiles are checked against the same flags, as by
+	// kola profile validate
+	flags, _, parallel, _ := testFlags()
+	if err := first.Validate(flags); err != nil {
+		t.Errorf("first profile: %v", err)
+	}
+	if err := second.Validate(flags); err == nil || !strings.Contains(err.Error(), `invalid value "many" for parallel`) {
+		t.Errorf("second profile: expected invalid value, got %v", err)
+	}
+	if *parallel != 1 || flags.Lookup("parallel").Changed {
+		t.Errorf("validation changed the flags")
+	}
+}
+
+func TestProfileList(t *testing.T) {
+	p, err := Parse([]byte(`
+platform: [qemu, aws]
+debug-systemd-unit: [a.service]
+`), testEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags, _, _, units := testFlags()
+	err = p.Apply(flags)
+	if err == nil || !strings.Contains(err.Error(), "line 2: platform takes a single value") {
+		t.Errorf("expected error for a list of platforms, got %v", err)
+	}
+	if !reflect.DeepEqual(*units, []string{"a.service"}) {
+		t.Errorf("unexpected units %q", *units)
+	}
+}
@@ -16,11 +16,15 @@
 package register
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/coreos/go-semver/semver"
 
 	"github.com/flatcar-linux/mantle/kola/cluster"
+	"github.com/flatcar-linux/mantle/kola/native"
+	"github.com/flatcar-linux/mantle/kola/oci"
 	"github.com/flatcar-linux/mantle/platform/conf"
 )
 
@@ -34,6 +38,25 @@ const (
 	NoKernelPanicCheck                // don't check console output for kernel panic
 )
 
+// NativeFunc is a function run directly on a machine by kolet.
+type NativeFunc struct {
+	Func native.Func
+
+	// Timeout cancels the function's context and fails it once
+	// exceeded. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// SimpleNativeFunc wraps a function without context or structured
+// result as a NativeFunc.
+func SimpleNativeFunc(f func() error) NativeFunc {
+	return NativeFunc{
+		Func: func(ctx context.Context, r *native.Result) error {
+			return f()
+		},
+	}
+}
+
 // Test provides the main test abstraction for kola. The run function is
 // the actual testing function while the other fields provide ways to
 // statically declare state of the platform.TestCluster before the test
@@ -41,7 +64,7 @@ const (
 type Test struct {
 	Name             string // should be unique
 	Run              func(cluster.TestCluster)
-	NativeFuncs      map[string]func() error
+	NativeFuncs      map[string]NativeFunc
 	UserData         *conf.UserData
 	UserDataV3       *conf.UserData
 	ClusterSize      int
@@ -56,6 +79,10 @@ type Test struct {
 	Architectures    []string // whitelist of machine architectures supported -- defaults to all
 	Flags            []Flag   // special-case options for this test
 
+	// Images are container images built from host binaries and loaded
+	// into every machine before the test function is run.
+	Images []oci.Image
+
 	// FailFast skips any sub-test that occurs after a sub-test has
 	// failed.
 	FailFast bool
@@ -69,11 +96,38 @@ type Test struct {
 	// greater than or equal to EndVersion. This will be ignored if
 	// the name fully matches without globbing.
 	EndVersion semver.Version
+
+	// Fixture names a registered Fixture whose cluster the test runs
+	// against instead of booting its own. UserData, UserDataV3 and
+	// ClusterSize are taken from the fixture, which adds its Flags. Unless
+	// the test is Mutating, it may only set Flags the fixture sets too.
+	Fixture string
+
+	// Mutating tests change their machines, so they get a fresh cluster
+	// booted from their Fixture instead of sharing it.
+	Mutating bool
+}
+
+// Fixture is a cluster shared by the tests naming it. The harness boots
+// it before the first of them runs and destroys it after the last one.
+type Fixture struct {
+	Name        string // should be unique
+	UserData    *conf.UserData
+	UserDataV3  *conf.UserData
+	ClusterSize int
+	Flags       []Flag
+
+	// Serial runs the tests sharing the fixture one at a time instead of
+	// in parallel.
+	Serial bool
 }
 
 // Registered tests live here. Mapping of names to tests.
 var Tests = map[string]*Test{}
 
+// Registered fixtures live here. Mapping of names to fixtures.
+var Fixtures = map[string]*Fixture{}
+
 // Register is usually called in init() functions and is how kola test
 // harnesses knows which tests it can choose from. Panics if existing
 // name is registered
@@ -90,6 +144,51 @@ func Register(t *Test) {
 	Tests[t.Name] = t
 }
 
+// RegisterFixture makes a fixture available to tests. Like Register, it is
+// usually called in init() functions and panics if the name is taken.
+func RegisterFixture(f *Fixture) {
+	if _, ok := Fixtures[f.Name]; ok {
+		panic(fmt.Sprintf("fixture %v already registered", f.Name))
+	}
+	Fixtures[f.Name] = f
+}
+
+// WithFixture returns a copy of t with the cluster settings of its
+// fixture, or t itself if it has none.
+func (t *Test) WithFixture() (*Test, error) {
+	if t.Fixture == "" {
+		return t, nil
+	}
+	f, ok := Fixtures[t.Fixture]
+	if !ok {
+		return nil, fmt.Errorf("test %v uses unknown fixture %v", t.Name, t.Fixture)
+	}
+	if !t.Mutating {
+		// A shared cluster is booted and checked with the fixture's
+		// flags alone, so the test cannot ask for different ones.
+		for _, flag := range t.Flags {
+			if !f.hasFlag(flag) {
+				return nil, fmt.Errorf("test %v sets flags not set by its fixture %v", t.Name, f.Name)
+			}
+		}
+	}
+	ft := *t
+	ft.UserData = f.UserData
+	ft.UserDataV3 = f.UserDataV3
+	ft.ClusterSize = f.ClusterSize
+	ft.Flags = append(append([]Flag{}, f.Flags...), t.Flags...)
+	return &ft, nil
+}
+
+func (f *Fixture) hasFlag(flag Flag) bool {
+	for _, ff := range f.Flags {
+		if ff == flag {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *Test) HasFlag(flag Flag) bool {
 	for _, f := range t.Flags {
 		if f == flag {
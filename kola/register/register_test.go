@@ -0,0 +1,59 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package register
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flatcar-linux/mantle/platform/conf"
+)
+
+func TestWithFixture(t *testing.T) {
+	RegisterFixture(&Fixture{
+		Name:        "test.fixture",
+		UserData:    conf.Ignition(`{"ignition":{"version":"2.0.0"}}`),
+		ClusterSize: 3,
+		Flags:       []Flag{NoSSHKeyInMetadata},
+	})
+	defer delete(Fixtures, "test.fixture")
+
+	test := &Test{Name: "plain", ClusterSize: 1}
+	got, err := test.WithFixture()
+	require.NoError(t, err)
+	assert.Same(t, test, got)
+
+	_, err = (&Test{Name: "conflict", Fixture: "test.fixture", Flags: []Flag{NoKernelPanicCheck}}).WithFixture()
+	assert.Error(t, err)
+
+	_, err = (&Test{Name: "same", Fixture: "test.fixture", Flags: []Flag{NoSSHKeyInMetadata}}).WithFixture()
+	assert.NoError(t, err)
+
+	test = &Test{Name: "shared", Fixture: "test.fixture", Flags: []Flag{NoKernelPanicCheck}, Mutating: true}
+	got, err = test.WithFixture()
+	require.NoError(t, err)
+	assert.Equal(t, 3, got.ClusterSize)
+	assert.Equal(t, Fixtures["test.fixture"].UserData, got.UserData)
+	assert.True(t, got.HasFlag(NoSSHKeyInMetadata))
+	assert.True(t, got.HasFlag(NoKernelPanicCheck))
+	assert.Equal(t, 0, test.ClusterSize, "original test modified")
+
+	_, err = (&Test{Name: "broken", Fixture: "missing"}).WithFixture()
+	assert.Error(t, err)
+
+	assert.Panics(t, func() { RegisterFixture(&Fixture{Name: "test.fixture"}) })
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shard partitions the tests of a kola run, so that a long suite
+// can be spread across CI workers running "kola run --shard i/n" each.
+//
+// Tests are assigned longest first to the shard with the least total
+// duration so far, using the durations of a previous run when known.
+// Every worker computes the same partition as long as it is given the
+// same tests and durations.
+package shard
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Shard is the part Index of Count, counting from 1.
+type Shard struct {
+	Index int
+	Count int
+}
+
+// Parse parses a shard given as "i/n".
+func Parse(s string) (Shard, error) {
+	var sh Shard
+	var rest string
+	if n, _ := fmt.Sscanf(s, "%d/%d%s", &sh.Index, &sh.Count, &rest); n != 2 {
+		return Shard{}, fmt.Errorf("invalid shard %q, expected i/n", s)
+	}
+	if sh.Count < 1 || sh.Index < 1 || sh.Index > sh.Count {
+		return Shard{}, fmt.Errorf("invalid shard %q, expected 1 <= i <= n", s)
+	}
+	return sh, nil
+}
+
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// Select returns the names assigned to the shard, sorted. Names without
+// a duration are assumed to take the average of the known durations.
+func (s Shard) Select(names []string, durations map[string]time.Duration) []string {
+	var known time.Duration
+	var numKnown int
+	for _, name := range names {
+		if d, ok := durations[name]; ok {
+			known += d
+			numKnown++
+		}
+	}
+	// equal weights make the assignment round-robin by name
+	average := time.Duration(1)
+	if numKnown != 0 && known != 0 {
+		average = known / time.Duration(numKnown)
+	}
+	weight := func(name string) time.Duration {
+		if d, ok := durations[name]; ok {
+			return d
+		}
+		return average
+	}
+
+	sorted := append([]string{}, names...)
+	sort.Slice(sorted, func(i, j int) bool {
+		wi, wj := weight(sorted[i]), weight(sorted[j])
+		if wi != wj {
+			return wi > wj
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	totals := make([]time.Duration, s.Count)
+	var selected []string
+	for _, name := range sorted {
+		least := 0
+		for i := range totals {
+			if totals[i] < totals[least] {
+				least = i
+			}
+		}
+		totals[least] += weight(name)
+		if least == s.Index-1 {
+			selected = append(selected, name)
+		}
+	}
+	sort.Strings(selected)
+	return selected
+}
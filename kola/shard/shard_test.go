@@ -0,0 +1,78 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	sh, err := Parse("2/3")
+	require.NoError(t, err)
+	assert.Equal(t, Shard{Index: 2, Count: 3}, sh)
+	assert.Equal(t, "2/3", sh.String())
+
+	for _, s := range []string{"", "1", "0/2", "3/2", "1/0", "a/b", "1/2/3"} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestSelectPartitions(t *testing.T) {
+	var names []string
+	for i := 0; i < 23; i++ {
+		names = append(names, fmt.Sprintf("test%02d", i))
+	}
+	durations := map[string]time.Duration{
+		"test00": time.Hour,
+		"test05": 10 * time.Minute,
+		"test10": time.Minute,
+	}
+
+	for _, d := range []map[string]time.Duration{nil, durations} {
+		var all []string
+		for i := 1; i <= 4; i++ {
+			sel := Shard{Index: i, Count: 4}.Select(names, d)
+			assert.True(t, sort.StringsAreSorted(sel))
+			all = append(all, sel...)
+		}
+		sort.Strings(all)
+		assert.Equal(t, names, all)
+	}
+}
+
+func TestSelectBalances(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e"}
+	durations := map[string]time.Duration{
+		"a": 60 * time.Minute,
+		"b": 30 * time.Minute,
+		"c": 20 * time.Minute,
+		"d": 10 * time.Minute,
+		// e gets the average of 30 minutes
+	}
+	// a, then b and e in parallel, then c and d on the shorter shard
+	assert.Equal(t, []string{"a", "c"}, Shard{Index: 1, Count: 2}.Select(names, durations))
+	assert.Equal(t, []string{"b", "d", "e"}, Shard{Index: 2, Count: 2}.Select(names, durations))
+
+	// round-robin by name without durations
+	assert.Equal(t, []string{"a", "c", "e"}, Shard{Index: 1, Count: 2}.Select(names, nil))
+	assert.Equal(t, []string{"b", "d"}, Shard{Index: 2, Count: 2}.Select(names, nil))
+}
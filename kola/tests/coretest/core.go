@@ -58,19 +58,19 @@ func init() {
 		Name:        "cl.basic",
 		Run:         LocalTests,
 		ClusterSize: 1,
-		NativeFuncs: map[string]func() error{
-			"CloudConfig":      TestCloudinitCloudConfig,
-			"Script":           TestCloudinitScript,
-			"PortSSH":          TestPortSsh,
-			"DbusPerms":        TestDbusPerms,
-			"Symlink":          TestSymlinkResolvConf,
-			"SymlinkFlatcar":   TestSymlinkFlatcar,
-			"UpdateEngineKeys": TestInstalledUpdateEngineRsaKeys,
-			"ServicesActive":   TestServicesActive,
-			"ReadOnly":         TestReadOnlyFs,
-			"RandomUUID":       TestFsRandomUUID,
-			"Useradd":          TestUseradd,
-			"MachineID":        TestMachineID,
+		NativeFuncs: map[string]register.NativeFunc{
+			"CloudConfig":      register.SimpleNativeFunc(TestCloudinitCloudConfig),
+			"Script":           register.SimpleNativeFunc(TestCloudinitScript),
+			"PortSSH":          register.SimpleNativeFunc(TestPortSsh),
+			"DbusPerms":        register.SimpleNativeFunc(TestDbusPerms),
+			"Symlink":          register.SimpleNativeFunc(TestSymlinkResolvConf),
+			"SymlinkFlatcar":   register.SimpleNativeFunc(TestSymlinkFlatcar),
+			"UpdateEngineKeys": register.SimpleNativeFunc(TestInstalledUpdateEngineRsaKeys),
+			"ServicesActive":   register.SimpleNativeFunc(TestServicesActive),
+			"ReadOnly":         register.SimpleNativeFunc(TestReadOnlyFs),
+			"RandomUUID":       register.SimpleNativeFunc(TestFsRandomUUID),
+			"Useradd":          register.SimpleNativeFunc(TestUseradd),
+			"MachineID":        register.SimpleNativeFunc(TestMachineID),
 		},
 		Distros: []string{"cl"},
 	})
@@ -78,14 +78,14 @@ func init() {
 		Name:        "rhcos.basic",
 		Run:         LocalTests,
 		ClusterSize: 1,
-		NativeFuncs: map[string]func() error{
-			"PortSSH":          TestPortSsh,
-			"DbusPerms":        TestDbusPerms,
-			"ServicesActive":   TestServicesActiveCoreOS,
-			"ServicesDisabled": TestServicesDisabledRHCOS,
-			"ReadOnly":         TestReadOnlyFs,
-			"Useradd":          TestUseradd,
-			"MachineID":        TestMachineID,
+		NativeFuncs: map[string]register.NativeFunc{
+			"PortSSH":          register.SimpleNativeFunc(TestPortSsh),
+			"DbusPerms":        register.SimpleNativeFunc(TestDbusPerms),
+			"ServicesActive":   register.SimpleNativeFunc(TestServicesActiveCoreOS),
+			"ServicesDisabled": register.SimpleNativeFunc(TestServicesDisabledRHCOS),
+			"ReadOnly":         register.SimpleNativeFunc(TestReadOnlyFs),
+			"Useradd":          register.SimpleNativeFunc(TestUseradd),
+			"MachineID":        register.SimpleNativeFunc(TestMachineID),
 		},
 		Distros: []string{"rhcos"},
 	})
@@ -93,13 +93,13 @@ func init() {
 		Name:        "fcos.basic",
 		Run:         LocalTests,
 		ClusterSize: 1,
-		NativeFuncs: map[string]func() error{
-			"PortSSH":        TestPortSsh,
-			"DbusPerms":      TestDbusPerms,
-			"ServicesActive": TestServicesActiveCoreOS,
-			"ReadOnly":       TestReadOnlyFs,
-			"Useradd":        TestUseradd,
-			"MachineID":      TestMachineID,
+		NativeFuncs: map[string]register.NativeFunc{
+			"PortSSH":        register.SimpleNativeFunc(TestPortSsh),
+			"DbusPerms":      register.SimpleNativeFunc(TestDbusPerms),
+			"ServicesActive": register.SimpleNativeFunc(TestServicesActiveCoreOS),
+			"ReadOnly":       register.SimpleNativeFunc(TestReadOnlyFs),
+			"Useradd":        register.SimpleNativeFunc(TestUseradd),
+			"MachineID":      register.SimpleNativeFunc(TestMachineID),
 		},
 		Distros: []string{"fcos"},
 	})
@@ -109,11 +109,11 @@ func init() {
 		Name:        "cl.internet",
 		Run:         InternetTests,
 		ClusterSize: 1,
-		NativeFuncs: map[string]func() error{
-			"UpdateEngine": TestUpdateEngine,
-			"DockerPing":   TestDockerPing,
-			"DockerEcho":   TestDockerEcho,
-			"NTPDate":      TestNTPDate,
+		NativeFuncs: map[string]register.NativeFunc{
+			"UpdateEngine": register.SimpleNativeFunc(TestUpdateEngine),
+			"DockerPing":   register.SimpleNativeFunc(TestDockerPing),
+			"DockerEcho":   register.SimpleNativeFunc(TestDockerEcho),
+			"NTPDate":      register.SimpleNativeFunc(TestNTPDate),
 		},
 		Distros: []string{"cl"},
 	})
@@ -0,0 +1,84 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/flatcar-linux/mantle/kola/cluster"
+	"github.com/flatcar-linux/mantle/kola/oci"
+	"github.com/flatcar-linux/mantle/kola/register"
+)
+
+// registryCluster is implemented by the qemu cluster.
+type registryCluster interface {
+	ImportRegistryImage(path string) error
+}
+
+// mirrorImage doesn't exist on Docker Hub, so pulling it only works
+// through the flight's registry.
+var mirrorImage = oci.Image{
+	Name:     "docker.io/library/kola-registry-mirror",
+	Binaries: []string{"echo"},
+	Cmd:      []string{"echo", "pulled from mirror"},
+}
+
+func init() {
+	register.Register(&register.Test{
+		Run:         dockerRegistryMirror,
+		ClusterSize: 0,
+		Name:        "docker.registry-mirror",
+		Platforms:   []string{"qemu"},
+		Distros:     []string{"cl"},
+	})
+}
+
+// dockerRegistryMirror pulls an image from the flight's registry, which
+// machines use as a Docker Hub mirror without network access.
+func dockerRegistryMirror(c cluster.TestCluster) {
+	rc, ok := c.Cluster.(registryCluster)
+	if !ok {
+		c.Fatal("cluster has no registry")
+	}
+
+	f, err := ioutil.TempFile("", "kola-registry-mirror")
+	if err != nil {
+		c.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	err = c.ImageBuilder.Build(f, &mirrorImage)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		c.Fatalf("building image: %v", err)
+	}
+	// machines only mirror the registries served when they're created
+	if err := rc.ImportRegistryImage(f.Name()); err != nil {
+		c.Fatalf("importing image: %v", err)
+	}
+
+	m, err := c.NewMachine(nil)
+	if err != nil {
+		c.Fatalf("creating machine: %v", err)
+	}
+
+	out := c.MustSSH(m, "docker run --rm "+mirrorImage.Ref())
+	if got := strings.TrimSpace(string(out)); got != "pulled from mirror" {
+		c.Fatalf("unexpected output %q", got)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignition
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/flatcar-linux/mantle/kola/cluster"
+	"github.com/flatcar-linux/mantle/kola/register"
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/conf"
+)
+
+var (
+	contentClient = conf.Ignition(`{
+		  "ignition": {
+		      "version": "2.2.0",
+		      "config": {
+		          "append": [{
+		              "source": "$CONFIG"
+		          }]
+		      },
+		      "security": {
+		          "tls": {
+		              "certificateAuthorities": [{
+		                  "source": "$CA"
+		              }]
+		          }
+		      }
+		  },
+		  "storage": {
+		      "files": [
+			  {
+			      "filesystem": "root",
+			      "path": "/var/resource/http",
+			      "contents": {
+				  "source": "$HTTP",
+				  "verification": {
+				      "hash": "$HASH"
+				  }
+			      },
+			      "mode": 420
+			  },
+			  {
+			      "filesystem": "root",
+			      "path": "/var/resource/tftp",
+			      "contents": {
+				  "source": "$TFTP"
+			      },
+			      "mode": 420
+			  },
+			  {
+			      "filesystem": "root",
+			      "path": "/var/resource/slow",
+			      "contents": {
+				  "source": "$SLOW"
+			      },
+			      "mode": 420
+			  }
+		      ]
+		  }
+	      }`)
+	contentAppended = []byte(`{
+		  "ignition": {
+		      "version": "2.2.0"
+		  },
+		  "storage": {
+		      "files": [
+			  {
+			      "filesystem": "root",
+			      "path": "/var/resource/https",
+			      "contents": {
+				  "source": "data:,kola-https"
+			      },
+			      "mode": 420
+			  }
+		      ]
+		  }
+	      }`)
+	contentFailure = conf.Ignition(`{
+		  "ignition": {
+		      "version": "2.2.0"
+		  },
+		  "storage": {
+		      "files": [
+			  {
+			      "filesystem": "root",
+			      "path": "/var/resource/failure",
+			      "contents": {
+				  "source": "$URL",
+				  "verification": {
+				      "hash": "$HASH"
+				  }
+			      },
+			      "mode": 420
+			  }
+		      ]
+		  }
+	      }`)
+)
+
+// optionsCluster is implemented by the qemu cluster.
+type optionsCluster interface {
+	NewMachineWithOptions(userdata *conf.UserData, options platform.MachineOptions) (platform.Machine, error)
+}
+
+func init() {
+	register.Register(&register.Test{
+		Name:        "coreos.ignition.resource.content",
+		Run:         resourceContent,
+		ClusterSize: 0,
+		Platforms:   []string{"qemu"},
+		Distros:     []string{"cl"},
+	})
+}
+
+// resourceContent fetches resources from the content server of the local
+// flight, which works without network access.
+func resourceContent(c cluster.TestCluster) {
+	c.Run("fetch", resourceContentFetch)
+	c.Run("not-found", func(c cluster.TestCluster) {
+		resourceContentFailure(c, platform.Content{
+			Data:   []byte("kola-missing"),
+			Status: http.StatusNotFound,
+		})
+	})
+	c.Run("wrong-hash", func(c cluster.TestCluster) {
+		resourceContentFailure(c, platform.Content{
+			Data:    []byte("kola-corrupt"),
+			Corrupt: true,
+		})
+	})
+}
+
+func resourceContentFetch(c cluster.TestCluster) {
+	httpContent := platform.Content{Data: []byte("kola-http")}
+
+	userdata := contentClient.
+		Subst("$CONFIG", c.ServeContent("https", "config.ign", platform.Content{
+			Data:        contentAppended,
+			ContentType: "application/vnd.coreos.ignition+json",
+		})).
+		Subst("$CA", dataurl.EncodeBytes(c.ContentCA())).
+		Subst("$HTTP", c.ServeContent("http", "http", httpContent)).
+		Subst("$HASH", httpContent.Hash()).
+		Subst("$TFTP", c.ServeContent("tftp", "tftp", platform.Content{Data: []byte("kola-tftp")})).
+		// well below Ignition's default timeouts
+		Subst("$SLOW", c.ServeContent("http", "slow", platform.Content{
+			Data:  []byte("kola-slow"),
+			Delay: 5 * time.Second,
+		}))
+
+	m, err := c.NewMachine(userdata)
+	if err != nil {
+		c.Fatalf("starting machine: %v", err)
+	}
+
+	checkResources(c, m, map[string]string{
+		"http":  "kola-http",
+		"https": "kola-https",
+		"tftp":  "kola-tftp",
+		"slow":  "kola-slow",
+	})
+}
+
+// resourceContentFailure checks that Ignition fails the boot if content
+// can't be fetched or verified.
+func resourceContentFailure(c cluster.TestCluster, content platform.Content) {
+	userdata := contentFailure.
+		Subst("$URL", c.ServeContent("http", "failure", content)).
+		Subst("$HASH", content.Hash())
+
+	oc, ok := c.Cluster.(optionsCluster)
+	if !ok {
+		c.Fatal("cluster does not support machine options")
+	}
+	m, err := oc.NewMachineWithOptions(userdata, platform.MachineOptions{
+		InteractiveConsole: true,
+		SkipStartMachine:   true,
+	})
+	if err != nil {
+		c.Fatalf("starting machine: %v", err)
+	}
+
+	if _, err := m.(platform.ConsoleMachine).ConsoleExpect(`emergency mode`, 5*time.Minute); err != nil {
+		c.Fatalf("Ignition did not fail: %v", err)
+	}
+}
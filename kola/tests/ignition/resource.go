@@ -101,8 +101,8 @@ func init() {
 		Name:        "coreos.ignition.resource.local",
 		Run:         resourceLocal,
 		ClusterSize: 1,
-		NativeFuncs: map[string]func() error{
-			"Serve": Serve,
+		NativeFuncs: map[string]register.NativeFunc{
+			"Serve": register.SimpleNativeFunc(Serve),
 		},
 		// https://github.com/coreos/bugs/issues/2205
 		// ESX: Currently Ignition does not support static IPs during the initramfs
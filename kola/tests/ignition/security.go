@@ -73,9 +73,9 @@ func init() {
 		Name:        "coreos.ignition.security.tls",
 		Run:         securityTLS,
 		ClusterSize: 1,
-		NativeFuncs: map[string]func() error{
-			"TLSServe":   TLSServe,
-			"TLSServeV3": TLSServeV3,
+		NativeFuncs: map[string]register.NativeFunc{
+			"TLSServe":   register.SimpleNativeFunc(TLSServe),
+			"TLSServeV3": register.SimpleNativeFunc(TLSServeV3),
 		},
 		// ESX: Currently Ignition does not support static IPs during the initramfs
 		// DO: https://github.com/coreos/bugs/issues/2205
@@ -21,10 +21,10 @@ import (
 
 func init() {
 	register.Register(&register.Test{
-		Run:         AuthVerify,
-		ClusterSize: 1,
-		Name:        "coreos.auth.verify",
-		Distros:     []string{"cl", "fcos", "rhcos"},
+		Run:     AuthVerify,
+		Fixture: EmptyFixture,
+		Name:    "coreos.auth.verify",
+		Distros: []string{"cl", "fcos", "rhcos"},
 	})
 }
 
@@ -32,8 +32,7 @@ hostname: "core1"
 write_files:
   - path: "/foo"
     content: bar`),
-		Distros:          []string{"cl"},
-		ExcludePlatforms: []string{"qemu-unpriv"},
+		Distros: []string{"cl"},
 	})
 	register.Register(&register.Test{
 		Run:         CloudInitScript,
@@ -48,8 +47,7 @@ EOF
 chown -R core.core ~core/.ssh
 chmod 700 ~core/.ssh
 chmod 600 ~core/.ssh/authorized_keys`),
-		Distros:          []string{"cl"},
-		ExcludePlatforms: []string{"qemu-unpriv"},
+		Distros: []string{"cl"},
 	})
 }
 
@@ -0,0 +1,122 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"context"
+	"time"
+
+	"github.com/flatcar-linux/mantle/kola/cluster"
+	"github.com/flatcar-linux/mantle/kola/register"
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/conf"
+)
+
+var (
+	// password "kola"
+	consolePasswordConfig = conf.Ignition(`{
+  "ignition": {"version": "2.0.0"},
+  "passwd": {
+    "users": [
+      {
+        "name": "core",
+        "passwordHash": "$6$vZO/oCvDfkEM.hB1$z83CMpMuP7NTEO.x9CfmY5drqYBjh9eVV6WKCOzC5QGMVd2kkax7F.w1hHpFGIOw2lGlMaWz6p9Oc1Yz25Xi31"
+      }
+    ]
+  }
+}`)
+)
+
+// optionsCluster is implemented by the qemu and qemu-unpriv clusters.
+type optionsCluster interface {
+	NewMachineWithOptions(userdata *conf.UserData, options platform.MachineOptions) (platform.Machine, error)
+}
+
+func init() {
+	register.Register(&register.Test{
+		Run:         consoleLogin,
+		ClusterSize: 0,
+		Name:        "cl.console.login",
+		Platforms:   []string{"qemu", "qemu-unpriv"},
+		Distros:     []string{"cl"},
+	})
+	register.Register(&register.Test{
+		Run:         consoleGrubMenu,
+		ClusterSize: 0,
+		Name:        "cl.console.grub",
+		Platforms:   []string{"qemu", "qemu-unpriv"},
+		Distros:     []string{"cl"},
+	})
+}
+
+func newConsoleMachine(c cluster.TestCluster, userdata *conf.UserData, skipStart bool) platform.ConsoleMachine {
+	oc, ok := c.Cluster.(optionsCluster)
+	if !ok {
+		c.Fatal("cluster does not support machine options")
+	}
+	m, err := oc.NewMachineWithOptions(userdata, platform.MachineOptions{
+		InteractiveConsole: true,
+		SkipStartMachine:   skipStart,
+	})
+	if err != nil {
+		c.Fatalf("creating machine: %v", err)
+	}
+	return m.(platform.ConsoleMachine)
+}
+
+func consoleExpect(c cluster.TestCluster, m platform.ConsoleMachine, re string, timeout time.Duration) []string {
+	match, err := m.ConsoleExpect(re, timeout)
+	if err != nil {
+		c.Fatal(err)
+	}
+	return match
+}
+
+func consoleSend(c cluster.TestCluster, m platform.ConsoleMachine, text string) {
+	if err := m.ConsoleSend(text); err != nil {
+		c.Fatal(err)
+	}
+}
+
+// consoleLogin logs in on the serial console getty with a password.
+func consoleLogin(c cluster.TestCluster) {
+	m := newConsoleMachine(c, consolePasswordConfig, false)
+
+	// the prompt was printed during boot and is still buffered
+	consoleExpect(c, m, `login:`, time.Minute)
+	consoleSend(c, m, "core\n")
+	consoleExpect(c, m, `Password:`, 30*time.Second)
+	consoleSend(c, m, "kola\n")
+	consoleExpect(c, m, `\$ `, 30*time.Second)
+	consoleSend(c, m, "echo kola-$((6*7)) $(id -un)\n")
+	match := consoleExpect(c, m, `kola-42 (\w+)`, 30*time.Second)
+	if match[1] != "core" {
+		c.Fatalf("logged in as %q instead of core", match[1])
+	}
+}
+
+// consoleGrubMenu waits for the GRUB menu and boots the default entry
+// without waiting for the menu timeout.
+func consoleGrubMenu(c cluster.TestCluster) {
+	m := newConsoleMachine(c, nil, true)
+
+	consoleExpect(c, m, `Flatcar default`, 2*time.Minute)
+	consoleSend(c, m, "\r")
+	consoleExpect(c, m, `Linux version`, 2*time.Minute)
+
+	if err := platform.CheckMachine(context.TODO(), m); err != nil {
+		c.Fatal(err)
+	}
+}
@@ -24,10 +24,10 @@ import (
 
 func init() {
 	register.Register(&register.Test{
-		Run:         Filesystem,
-		ClusterSize: 1,
-		Name:        "cl.filesystem",
-		Distros:     []string{"cl"},
+		Run:     Filesystem,
+		Fixture: EmptyFixture,
+		Name:    "cl.filesystem",
+		Distros: []string{"cl"},
 	})
 }
 
@@ -0,0 +1,30 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"github.com/flatcar-linux/mantle/kola/register"
+)
+
+// EmptyFixture is a single machine booted without userdata, shared by
+// tests that only inspect the default state of the OS.
+const EmptyFixture = "empty"
+
+func init() {
+	register.RegisterFixture(&register.Fixture{
+		Name:        EmptyFixture,
+		ClusterSize: 1,
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flatcar-linux/mantle/kola/cluster"
+	"github.com/flatcar-linux/mantle/kola/register"
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/local"
+)
+
+// faultCluster is implemented by the qemu cluster.
+type faultCluster interface {
+	AddFault(ip string, peers []string, f local.Fault) error
+	ClearFaults(ip string) error
+	Partition(a, b []string) error
+	ServicesIP() string
+}
+
+func init() {
+	register.Register(&register.Test{
+		Run:         networkFault,
+		ClusterSize: 2,
+		Name:        "cl.network.fault",
+		Platforms:   []string{"qemu"},
+		Distros:     []string{"cl"},
+	})
+}
+
+// pingRTT returns the average round trip time from m to ip, or an error if
+// no reply arrived.
+func pingRTT(c cluster.TestCluster, m platform.Machine, ip string) (time.Duration, error) {
+	out, err := c.SSH(m, "ping -q -c 3 -W 2 "+ip+" | tail -n 1")
+	if err != nil {
+		return 0, fmt.Errorf("pinging %s: %v", ip, err)
+	}
+	// rtt min/avg/max/mdev = 0.263/0.301/0.337/0.030 ms
+	fields := strings.Split(string(out), "/")
+	if len(fields) < 5 {
+		return 0, fmt.Errorf("unexpected ping output: %s", out)
+	}
+	avg, err := strconv.ParseFloat(fields[4], 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing ping output %q: %v", out, err)
+	}
+	return time.Duration(avg * float64(time.Millisecond)), nil
+}
+
+func networkFault(c cluster.TestCluster) {
+	fc, ok := c.Cluster.(faultCluster)
+	if !ok {
+		c.Fatal("cluster has no fault injection support")
+	}
+	m1, m2 := c.Machines()[0], c.Machines()[1]
+
+	c.Run("delay", func(c cluster.TestCluster) {
+		if err := fc.AddFault(m2.IP(), []string{m1.IP()}, local.Fault{Delay: 200 * time.Millisecond}); err != nil {
+			c.Fatal(err)
+		}
+		defer fc.ClearFaults(m2.IP())
+
+		rtt, err := pingRTT(c, m1, m2.IP())
+		if err != nil {
+			c.Fatal(err)
+		}
+		if rtt < 200*time.Millisecond {
+			c.Fatalf("expected a round trip time of at least 200ms, got %v", rtt)
+		}
+	})
+
+	c.Run("partition", func(c cluster.TestCluster) {
+		if err := fc.Partition([]string{m1.IP()}, []string{m2.IP()}); err != nil {
+			c.Fatal(err)
+		}
+		if _, err := pingRTT(c, m1, m2.IP()); err == nil {
+			c.Fatal("ping succeeded across partition")
+		}
+
+		for _, m := range []platform.Machine{m1, m2} {
+			if err := fc.ClearFaults(m.IP()); err != nil {
+				c.Fatal(err)
+			}
+		}
+		if _, err := pingRTT(c, m1, m2.IP()); err != nil {
+			c.Fatalf("partition was not lifted: %v", err)
+		}
+	})
+
+	c.Run("services", func(c cluster.TestCluster) {
+		if err := fc.AddFault(m1.IP(), []string{fc.ServicesIP()}, local.Fault{Partition: true}); err != nil {
+			c.Fatal(err)
+		}
+		defer fc.ClearFaults(m1.IP())
+
+		if _, err := pingRTT(c, m1, fc.ServicesIP()); err == nil {
+			c.Fatal("flight services reachable despite partition")
+		}
+		if _, err := pingRTT(c, m2, fc.ServicesIP()); err != nil {
+			c.Fatalf("fault leaked to other machine: %v", err)
+		}
+	})
+}
@@ -0,0 +1,168 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/flatcar-linux/mantle/kola/cluster"
+	"github.com/flatcar-linux/mantle/kola/register"
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/util"
+)
+
+// qmpCluster is implemented by the qemu and qemu-unpriv clusters.
+type qmpCluster interface {
+	QMP(m platform.Machine) (*platform.QMPClient, error)
+	HotplugDisk(m platform.Machine, id string, disk platform.Disk) error
+}
+
+func init() {
+	register.Register(&register.Test{
+		Run:         qmpHotplugDisk,
+		ClusterSize: 1,
+		Name:        "cl.qemu.hotplug.disk",
+		Platforms:   []string{"qemu", "qemu-unpriv"},
+		Distros:     []string{"cl"},
+	})
+	register.Register(&register.Test{
+		Run:         qmpPauseResume,
+		ClusterSize: 1,
+		Name:        "cl.qemu.pause",
+		Platforms:   []string{"qemu", "qemu-unpriv"},
+		Distros:     []string{"cl"},
+	})
+	register.Register(&register.Test{
+		Run:         qmpLinkDown,
+		ClusterSize: 1,
+		Name:        "cl.qemu.link-down",
+		Platforms:   []string{"qemu", "qemu-unpriv"},
+		Distros:     []string{"cl"},
+	})
+}
+
+func getQMP(c cluster.TestCluster, m platform.Machine) (qmpCluster, *platform.QMPClient) {
+	qc, ok := c.Cluster.(qmpCluster)
+	if !ok {
+		c.Fatal("cluster has no QMP support")
+	}
+	qmp, err := qc.QMP(m)
+	if err != nil {
+		c.Fatalf("connecting to QMP: %v", err)
+	}
+	return qc, qmp
+}
+
+func qmpHotplugDisk(c cluster.TestCluster) {
+	m := c.Machines()[0]
+	qc, qmp := getQMP(c, m)
+
+	disk := platform.Disk{
+		Size:       "100M",
+		DeviceOpts: []string{"serial=hotplug"},
+	}
+	if err := qc.HotplugDisk(m, "hotplug0", disk); err != nil {
+		c.Fatalf("hotplugging disk: %v", err)
+	}
+
+	checkDisk := func(present bool) func() error {
+		return func() error {
+			_, err := c.SSH(m, "test -b /dev/disk/by-id/virtio-hotplug")
+			if present && err != nil {
+				return fmt.Errorf("hotplugged disk did not show up")
+			} else if !present && err == nil {
+				return fmt.Errorf("unplugged disk is still present")
+			}
+			return nil
+		}
+	}
+	if err := util.Retry(10, 3*time.Second, checkDisk(true)); err != nil {
+		c.Fatal(err)
+	}
+
+	c.MustSSH(m, "sudo dd if=/dev/zero of=/dev/disk/by-id/virtio-hotplug bs=1M count=10 oflag=direct")
+	stats, err := qmp.QueryBlockStats()
+	if err != nil {
+		c.Fatalf("querying block stats: %v", err)
+	}
+	var written uint64
+	for _, s := range stats {
+		if s.DeviceID() == "hotplug0" {
+			written = s.Stats.WriteBytes
+		}
+	}
+	if written < 10*1024*1024 {
+		c.Fatalf("expected at least 10M written to the hotplugged disk, got %d", written)
+	}
+
+	if err := qmp.UnplugDisk("hotplug0"); err != nil {
+		c.Fatalf("unplugging disk: %v", err)
+	}
+	if err := util.Retry(10, 3*time.Second, checkDisk(false)); err != nil {
+		c.Fatal(err)
+	}
+}
+
+func qmpPauseResume(c cluster.TestCluster) {
+	m := c.Machines()[0]
+	_, qmp := getQMP(c, m)
+
+	before := c.MustSSH(m, "cat /proc/sys/kernel/random/boot_id")
+
+	if err := qmp.Stop(); err != nil {
+		c.Fatalf("pausing machine: %v", err)
+	}
+	status, err := qmp.Status()
+	if err != nil {
+		c.Fatalf("querying status: %v", err)
+	}
+	if status != "paused" {
+		c.Fatalf("expected machine to be paused, got %q", status)
+	}
+
+	time.Sleep(5 * time.Second)
+
+	if err := qmp.Cont(); err != nil {
+		c.Fatalf("resuming machine: %v", err)
+	}
+	after := c.MustSSH(m, "cat /proc/sys/kernel/random/boot_id")
+	if string(before) != string(after) {
+		c.Fatalf("machine rebooted while paused")
+	}
+}
+
+func qmpLinkDown(c cluster.TestCluster) {
+	m := c.Machines()[0]
+	_, qmp := getQMP(c, m)
+
+	if err := qmp.SetLink(platform.QEMUPrimaryNIC, false); err != nil {
+		c.Fatalf("setting link down: %v", err)
+	}
+	// give networkd time to notice the carrier loss
+	time.Sleep(5 * time.Second)
+	if err := qmp.SetLink(platform.QEMUPrimaryNIC, true); err != nil {
+		c.Fatalf("setting link up: %v", err)
+	}
+
+	err := util.Retry(10, 3*time.Second, func() error {
+		_, _, err := m.SSH("true")
+		return err
+	})
+	if err != nil {
+		c.Fatalf("machine unreachable after link up: %v", err)
+	}
+	c.MustSSH(m, "journalctl -b | grep -q 'Lost carrier'")
+}
@@ -0,0 +1,221 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flatcar-linux/mantle/kola/cluster"
+	"github.com/flatcar-linux/mantle/kola/register"
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/conf"
+	"github.com/flatcar-linux/mantle/platform/local"
+	"github.com/flatcar-linux/mantle/util"
+)
+
+// topologyCluster is implemented by the qemu cluster.
+type topologyCluster interface {
+	AddSegment(opts local.SegmentOptions) (*local.Segment, error)
+	NICs(m platform.Machine) ([]*local.NIC, error)
+	NewMachineWithOptions(userdata *conf.UserData, options platform.MachineOptions) (platform.Machine, error)
+}
+
+func init() {
+	register.Register(&register.Test{
+		Run:         networkTopology,
+		ClusterSize: 0,
+		Name:        "cl.network.topology",
+		Platforms:   []string{"qemu"},
+		Distros:     []string{"cl"},
+	})
+}
+
+func networkTopology(c cluster.TestCluster) {
+	tc, ok := c.Cluster.(topologyCluster)
+	if !ok {
+		c.Fatal("cluster has no network segment support")
+	}
+
+	c.Run("multihome", func(c cluster.TestCluster) { networkMultihome(c, tc) })
+	c.Run("vlan", func(c cluster.TestCluster) { networkVLAN(c, tc) })
+	c.Run("ipv6-only", func(c cluster.TestCluster) { networkIPv6Only(c, tc) })
+	c.Run("bond", func(c cluster.TestCluster) { networkBond(c, tc) })
+}
+
+func addSegment(c cluster.TestCluster, tc topologyCluster, opts local.SegmentOptions) *local.Segment {
+	seg, err := tc.AddSegment(opts)
+	if err != nil {
+		c.Fatalf("adding segment: %v", err)
+	}
+	return seg
+}
+
+func newTopologyMachine(c cluster.TestCluster, tc topologyCluster, options platform.MachineOptions) (platform.Machine, []*local.NIC) {
+	m, err := tc.NewMachineWithOptions(nil, options)
+	if err != nil {
+		c.Fatalf("creating machine: %v", err)
+	}
+	nics, err := tc.NICs(m)
+	if err != nil {
+		c.Fatalf("getting network cards: %v", err)
+	}
+	return m, nics
+}
+
+// nicName returns the name of the network interface of m with the
+// hardware address of nic.
+func nicName(c cluster.TestCluster, m platform.Machine, nic *local.NIC) string {
+	out := c.MustSSH(m, fmt.Sprintf("grep -l %s /sys/class/net/*/address", nic.Interface.HardwareAddr))
+	return strings.Split(string(out), "/")[4]
+}
+
+func waitForAddress(c cluster.TestCluster, m platform.Machine, iface, prefix string) {
+	err := util.Retry(20, 3*time.Second, func() error {
+		out, err := c.SSH(m, "ip -o addr show dev "+iface)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(out), " "+prefix) {
+			return fmt.Errorf("no address %s* on %s: %s", prefix, iface, out)
+		}
+		return nil
+	})
+	if err != nil {
+		c.Fatal(err)
+	}
+}
+
+func networkMultihome(c cluster.TestCluster, tc topologyCluster) {
+	seg := addSegment(c, tc, local.SegmentOptions{IPv4: true})
+	m, nics := newTopologyMachine(c, tc, platform.MachineOptions{
+		NetworkSegments: []string{seg.Name},
+	})
+	if len(nics) != 2 {
+		c.Fatalf("expected 2 network cards, got %d", len(nics))
+	}
+
+	for _, nic := range nics {
+		waitForAddress(c, m, nicName(c, m, nic), nic.Interface.IP().String()+"/")
+	}
+	c.MustSSH(m, "ping -c 1 "+seg.BridgeIf.IP().String())
+}
+
+func networkVLAN(c cluster.TestCluster, tc topologyCluster) {
+	seg := addSegment(c, tc, local.SegmentOptions{IPv4: true, VLAN: 10})
+	m, nics := newTopologyMachine(c, tc, platform.MachineOptions{
+		NetworkSegments: []string{local.TrunkBridge},
+	})
+
+	trunk := nicName(c, m, nics[1])
+	c.MustSSH(m, fmt.Sprintf(`sudo tee /etc/systemd/network/50-trunk.network <<EOF
+[Match]
+Name=%s
+
+[Network]
+VLAN=vlan10
+LinkLocalAddressing=no
+EOF`, trunk))
+	c.MustSSH(m, `sudo tee /etc/systemd/network/50-vlan10.netdev <<EOF
+[NetDev]
+Name=vlan10
+Kind=vlan
+
+[VLAN]
+Id=10
+EOF`)
+	c.MustSSH(m, `sudo tee /etc/systemd/network/50-vlan10.network <<EOF
+[Match]
+Name=vlan10
+
+[Network]
+DHCP=ipv4
+EOF`)
+	c.MustSSH(m, "sudo systemctl restart systemd-networkd")
+
+	// VLAN interfaces get addresses from the dynamic range 10.N.255.0/24
+	ip := seg.BridgeIf.IP().To4()
+	waitForAddress(c, m, "vlan10", fmt.Sprintf("%d.%d.255.", ip[0], ip[1]))
+	c.MustSSH(m, "ping -c 1 -I vlan10 "+ip.String())
+}
+
+func networkIPv6Only(c cluster.TestCluster, tc topologyCluster) {
+	seg := addSegment(c, tc, local.SegmentOptions{IPv6: true})
+	m, nics := newTopologyMachine(c, tc, platform.MachineOptions{
+		PrimarySegment: seg.Name,
+	})
+
+	if nics[0].Interface.IP().To4() != nil {
+		c.Fatalf("expected an IPv6 address, got %s", nics[0].Interface.IP())
+	}
+	waitForAddress(c, m, nicName(c, m, nics[0]), nics[0].Interface.IP().String()+"/")
+	if out := c.MustSSH(m, "ip -4 -o addr show scope global"); len(out) != 0 {
+		c.Fatalf("unexpected IPv4 addresses on IPv6-only segment: %s", out)
+	}
+}
+
+func networkBond(c cluster.TestCluster, tc topologyCluster) {
+	seg := addSegment(c, tc, local.SegmentOptions{IPv4: true})
+	m, nics := newTopologyMachine(c, tc, platform.MachineOptions{
+		NetworkSegments: []string{seg.Name, seg.Name},
+	})
+	if len(nics) != 3 {
+		c.Fatalf("expected 3 network cards, got %d", len(nics))
+	}
+
+	// the bond takes the hardware address of its first port, and with
+	// it the address dnsmasq leases to that port
+	ports := []string{nicName(c, m, nics[1]), nicName(c, m, nics[2])}
+	c.MustSSH(m, fmt.Sprintf(`sudo tee /etc/systemd/network/50-bond0.netdev <<EOF
+[NetDev]
+Name=bond0
+Kind=bond
+MACAddress=%s
+
+[Bond]
+Mode=active-backup
+MIIMonitorSec=100ms
+EOF`, nics[1].Interface.HardwareAddr))
+	c.MustSSH(m, fmt.Sprintf(`sudo tee /etc/systemd/network/50-bond0-ports.network <<EOF
+[Match]
+Name=%s
+
+[Network]
+Bond=bond0
+EOF`, strings.Join(ports, " ")))
+	c.MustSSH(m, `sudo tee /etc/systemd/network/50-bond0.network <<EOF
+[Match]
+Name=bond0
+
+[Network]
+DHCP=ipv4
+EOF`)
+	c.MustSSH(m, "sudo systemctl restart systemd-networkd")
+
+	waitForAddress(c, m, "bond0", nics[1].Interface.IP().String()+"/")
+	gateway := seg.BridgeIf.IP().String()
+	c.MustSSH(m, "ping -c 1 -I bond0 "+gateway)
+
+	// traffic fails over to the second port
+	c.MustSSH(m, "sudo ip link set dev "+ports[0]+" down")
+	err := util.Retry(10, time.Second, func() error {
+		_, err := c.SSH(m, "ping -c 1 -W 1 -I bond0 "+gateway)
+		return err
+	})
+	if err != nil {
+		c.Fatalf("no connectivity after failover: %v", err)
+	}
+}
@@ -25,8 +25,8 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/flatcar-linux/mantle/kola/cluster"
+	"github.com/flatcar-linux/mantle/kola/oci"
 	"github.com/flatcar-linux/mantle/kola/register"
-	tutil "github.com/flatcar-linux/mantle/kola/tests/util"
 	"github.com/flatcar-linux/mantle/lang/worker"
 	"github.com/flatcar-linux/mantle/platform"
 	"github.com/flatcar-linux/mantle/util"
@@ -39,6 +39,10 @@ func init() {
 		ClusterSize: 1,
 		Name:        `podman.base`,
 		Distros:     []string{"rhcos"},
+		Images: []oci.Image{
+			{Name: "localhost/echo", Runtime: "podman", Binaries: []string{"echo"}},
+			{Name: "localhost/ping", Runtime: "podman", Binaries: []string{"sh", "ping"}},
+		},
 	})
 	register.Register(&register.Test{
 		Run:         podmanWorkflow,
@@ -52,6 +56,9 @@ func init() {
 		ClusterSize: 2,
 		Name:        `podman.network`,
 		Distros:     []string{"rhcos"},
+		Images: []oci.Image{
+			{Name: "localhost/ncat", Runtime: "podman", Binaries: []string{"ncat"}},
+		},
 	})
 }
 
@@ -239,8 +246,6 @@ func podmanInfo(c cluster.TestCluster) {
 func podmanResources(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	tutil.GenPodmanScratchContainer(c, m, "echo", []string{"echo"})
-
 	podmanFmt := "sudo podman run --rm %s echo echo 1"
 
 	pCmd := func(arg string) string {
@@ -275,11 +280,6 @@ func podmanNetworkTest(c cluster.TestCluster) {
 	machines := c.Machines()
 	src, dest := machines[0], machines[1]
 
-	c.Log("creating ncat containers")
-
-	tutil.GenPodmanScratchContainer(c, src, "ncat", []string{"ncat"})
-	tutil.GenPodmanScratchContainer(c, dest, "ncat", []string{"ncat"})
-
 	listener := func(ctx context.Context) error {
 		// Will block until a message is recieved
 		out, err := c.SSH(dest,
@@ -342,8 +342,6 @@ func podmanNetworkTest(c cluster.TestCluster) {
 func podmanNetworksReliably(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	tutil.GenPodmanScratchContainer(c, m, "ping", []string{"sh", "ping"})
-
 	output := c.MustSSH(m, `for i in $(seq 1 100); do
 		echo -n "$i: "
 		sudo podman run --rm ping sh -c 'ping -i 0.2 10.88.0.1 -w 1 >/dev/null && echo PASS || echo FAIL'
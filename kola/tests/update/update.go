@@ -37,8 +37,8 @@ func init() {
 		Name:        "cl.update.payload",
 		Run:         payload,
 		ClusterSize: 1,
-		NativeFuncs: map[string]func() error{
-			"Omaha": Serve,
+		NativeFuncs: map[string]register.NativeFunc{
+			"Omaha": register.SimpleNativeFunc(Serve),
 		},
 		Distros: []string{"cl"},
 	})
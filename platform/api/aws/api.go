@@ -46,6 +46,9 @@ type Options struct {
 	AccessKeyID string
 	// SecretKey is the optional secret key to use. It will override all other sources
 	SecretKey string
+	// Endpoint is the optional URL to send all API requests to, for
+	// testing against a fake server
+	Endpoint string
 
 	// AMI is the AWS AMI to launch EC2 instances with.
 	// If it is one of the special strings alpha|beta|stable, it will be resolved
@@ -77,6 +80,10 @@ func New(opts *Options) (*API, error) {
 	} else if opts.CredentialsFile != "" {
 		awsCfg.Credentials = credentials.NewSharedCredentials(opts.CredentialsFile, opts.Profile)
 	}
+	if opts.Endpoint != "" {
+		awsCfg.Endpoint = aws.String(opts.Endpoint)
+		awsCfg.S3ForcePathStyle = aws.Bool(true)
+	}
 
 	sess, err := session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
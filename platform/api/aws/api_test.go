@@ -0,0 +1,183 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/aws/fake"
+	"github.com/flatcar-linux/mantle/platform/inventory"
+	"github.com/flatcar-linux/mantle/platform/inventory/inventorytest"
+)
+
+func newTestAPI(t *testing.T) (*API, *fake.Server) {
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+
+	api, err := New(&Options{
+		Options:            &platform.Options{},
+		Region:             "us-west-2",
+		AccessKeyID:        "AKIDFAKE",
+		SecretKey:          "secret",
+		Endpoint:           server.URL,
+		AMI:                "ami-0123456789abcdef0",
+		InstanceType:       "t3.small",
+		SecurityGroup:      "kola",
+		IAMInstanceProfile: "kola",
+	})
+	require.NoError(t, err)
+	require.NoError(t, api.PreflightCheck())
+	return api, server
+}
+
+func mantleInstance(name string, launched time.Time) ec2.Instance {
+	return ec2.Instance{
+		KeyName:    aws.String(inventorytest.Flight),
+		LaunchTime: aws.Time(launched),
+		Tags: []*ec2.Tag{
+			{Key: aws.String("Name"), Value: aws.String(name)},
+			{Key: aws.String("CreatedBy"), Value: aws.String("mantle")},
+		},
+	}
+}
+
+func TestKeys(t *testing.T) {
+	api, server := newTestAPI(t)
+
+	require.NoError(t, api.AddKey(inventorytest.Flight, "ssh-ed25519 AAAA"))
+	require.Len(t, server.KeyPairs(), 1)
+	assert.Equal(t, inventorytest.Flight, *server.KeyPairs()[0].KeyName)
+	assert.Error(t, api.AddKey(inventorytest.Flight, "ssh-ed25519 AAAA"))
+
+	require.NoError(t, api.DeleteKey(inventorytest.Flight))
+	assert.Empty(t, server.KeyPairs())
+}
+
+func TestCreateInstances(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the instance poll interval")
+	}
+	api, server := newTestAPI(t)
+	server.AddSecurityGroup("kola", securityGroupDescription)
+	require.NoError(t, api.AddKey(inventorytest.Flight, "ssh-ed25519 AAAA"))
+
+	insts, err := api.CreateInstances("kola-1", inventorytest.Flight, "{}", 2)
+	require.NoError(t, err)
+	require.Len(t, insts, 2)
+	for _, inst := range insts {
+		assert.Equal(t, ec2.InstanceStateNameRunning, *inst.State.Name)
+		assert.NotEmpty(t, aws.StringValue(inst.PublicIpAddress))
+		assert.Equal(t, "ami-0123456789abcdef0", *inst.ImageId)
+	}
+
+	server.SetConsoleOutput(*insts[0].InstanceId, "Flatcar Container Linux")
+	out, err := api.GetConsoleOutput(*insts[0].InstanceId)
+	require.NoError(t, err)
+	assert.Equal(t, "Flatcar Container Linux", out)
+
+	require.NoError(t, api.TerminateInstances([]string{*insts[0].InstanceId, *insts[1].InstanceId}))
+	for _, inst := range server.Instances() {
+		assert.Equal(t, ec2.InstanceStateNameTerminated, *inst.State.Name)
+	}
+}
+
+func TestConsoleOutput(t *testing.T) {
+	api, server := newTestAPI(t)
+	id := server.AddInstance(mantleInstance("kola-1", time.Now()))
+
+	out, err := api.GetConsoleOutput(id)
+	require.NoError(t, err)
+	assert.Equal(t, "", out)
+
+	server.SetConsoleOutput(id, "login: ")
+	out, err = api.GetConsoleOutput(id)
+	require.NoError(t, err)
+	assert.Equal(t, "login: ", out)
+
+	_, err = api.GetConsoleOutput("i-missing")
+	assert.Error(t, err)
+}
+
+func TestGC(t *testing.T) {
+	api, server := newTestAPI(t)
+	old := time.Now().Add(-6 * time.Hour)
+	oldID := server.AddInstance(mantleInstance("old", old))
+	newID := server.AddInstance(mantleInstance("new", time.Now()))
+	otherID := server.AddInstance(ec2.Instance{LaunchTime: aws.Time(old)})
+
+	require.NoError(t, api.GC(5*time.Hour))
+
+	states := make(map[string]string)
+	for _, inst := range server.Instances() {
+		states[*inst.InstanceId] = *inst.State.Name
+	}
+	assert.Equal(t, map[string]string{
+		oldID:   ec2.InstanceStateNameTerminated,
+		newID:   ec2.InstanceStateNameRunning,
+		otherID: ec2.InstanceStateNameRunning,
+	}, states)
+}
+
+func TestImages(t *testing.T) {
+	api, server := newTestAPI(t)
+
+	id, err := api.CreateHVMImage("snap-0123", 8, "flatcar-test-hvm", "test image", "x86_64")
+	require.NoError(t, err)
+	again, err := api.CreateHVMImage("snap-0123", 8, "flatcar-test-hvm", "test image", "x86_64")
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+	require.Len(t, server.Images(), 1)
+
+	found, err := api.FindImage("flatcar-test-hvm")
+	require.NoError(t, err)
+	assert.Equal(t, id, found)
+	found, err = api.FindImage("missing")
+	require.NoError(t, err)
+	assert.Equal(t, "", found)
+
+	images, err := api.GetImagesByTag("Name", "flatcar-test-hvm")
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	assert.Equal(t, id, *images[0].ImageId)
+
+	require.NoError(t, api.deregisterImageIfExists("flatcar-test-hvm"))
+	assert.Empty(t, server.Images())
+}
+
+func TestInventory(t *testing.T) {
+	api, server := newTestAPI(t)
+	instID := server.AddInstance(mantleInstance("kola-1", time.Now()))
+	server.AddInstance(ec2.Instance{})
+	groupID := server.AddSecurityGroup("kola", securityGroupDescription)
+	server.AddSecurityGroup("default", "default VPC security group")
+	require.NoError(t, api.AddKey(inventorytest.Flight, "ssh-ed25519 AAAA"))
+	require.NoError(t, api.AddKey("laptop", "ssh-ed25519 BBBB"))
+
+	inventorytest.CheckProvider(t, api, []inventory.Resource{
+		{Cloud: "aws", Kind: inventory.KindInstance, ID: instID, Name: "kola-1", Region: "us-west-2", Owner: fake.Account, Flight: inventorytest.Flight},
+		{Cloud: "aws", Kind: inventory.KindKey, ID: inventorytest.Flight, Name: inventorytest.Flight, Region: "us-west-2", Flight: inventorytest.Flight},
+		{Cloud: "aws", Kind: inventory.KindSecurityGroup, ID: groupID, Name: "kola", Region: "us-west-2", Owner: fake.Account},
+	})
+	require.Len(t, server.KeyPairs(), 1)
+	assert.Equal(t, "laptop", *server.KeyPairs()[0].KeyName)
+	require.Len(t, server.SecurityGroups(), 1)
+}
@@ -0,0 +1,884 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake implements an in-process fake of the subset of the EC2,
+// IAM and STS query APIs used by mantle, for testing without
+// credentials.
+package fake
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	// Account is the account ID that owns all resources on the server.
+	Account = "123456789012"
+
+	ec2Namespace = "http://ec2.amazonaws.com/doc/2016-11-15/"
+	iamNamespace = "https://iam.amazonaws.com/doc/2010-05-08/"
+	stsNamespace = "https://sts.amazonaws.com/doc/2011-06-15/"
+
+	timeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+// Server is a fake AWS API server. All services are served from the
+// same URL and told apart by the service named in the request
+// signature. Instances are created running, with a public IP address,
+// and images are created available.
+type Server struct {
+	*httptest.Server
+
+	mu               sync.Mutex
+	nextID           int
+	instances        map[string]*ec2.Instance
+	reservations     map[string]string
+	consoleOutput    map[string]string
+	keyPairs         map[string]*ec2.KeyPairInfo
+	securityGroups   map[string]*ec2.SecurityGroup
+	subnets          map[string]*ec2.Subnet
+	images           map[string]*ec2.Image
+	instanceProfiles map[string]bool
+}
+
+// NewServer starts a fake server; the caller must Close it.
+func NewServer() *Server {
+	s := &Server{
+		nextID:           1,
+		instances:        make(map[string]*ec2.Instance),
+		reservations:     make(map[string]string),
+		consoleOutput:    make(map[string]string),
+		keyPairs:         make(map[string]*ec2.KeyPairInfo),
+		securityGroups:   make(map[string]*ec2.SecurityGroup),
+		subnets:          make(map[string]*ec2.Subnet),
+		images:           make(map[string]*ec2.Image),
+		instanceProfiles: make(map[string]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *Server) id(prefix string) string {
+	id := fmt.Sprintf("%s-%017x", prefix, s.nextID)
+	s.nextID++
+	return id
+}
+
+// AddInstanceProfile adds an IAM instance profile.
+func (s *Server) AddInstanceProfile(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.instanceProfiles[name] = true
+}
+
+// AddSecurityGroup adds a security group and a subnet in the group's
+// VPC, and returns the group ID.
+func (s *Server) AddSecurityGroup(name, description string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vpc := s.id("vpc")
+	subnet := s.id("subnet")
+	s.subnets[subnet] = &ec2.Subnet{
+		SubnetId: aws.String(subnet),
+		VpcId:    aws.String(vpc),
+	}
+	group := s.id("sg")
+	s.securityGroups[group] = &ec2.SecurityGroup{
+		GroupId:     aws.String(group),
+		GroupName:   aws.String(name),
+		Description: aws.String(description),
+		OwnerId:     aws.String(Account),
+		VpcId:       aws.String(vpc),
+	}
+	return group
+}
+
+// AddInstance adds an instance as if it had been created outside mantle
+// and returns its ID. The instance is running unless inst.State is set.
+func (s *Server) AddInstance(inst ec2.Instance) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst.InstanceId = aws.String(s.id("i"))
+	if inst.State == nil {
+		inst.State = instanceState(ec2.InstanceStateNameRunning)
+	}
+	if inst.LaunchTime == nil {
+		inst.LaunchTime = aws.Time(time.Now())
+	}
+	s.instances[*inst.InstanceId] = &inst
+	s.reservations[*inst.InstanceId] = s.id("r")
+	return *inst.InstanceId
+}
+
+// SetConsoleOutput sets the console output of an instance.
+func (s *Server) SetConsoleOutput(instanceID, output string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.consoleOutput[instanceID] = output
+}
+
+// Instances returns the instances on the server, including terminated
+// ones, ordered by ID.
+func (s *Server) Instances() []ec2.Instance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []ec2.Instance
+	for _, i := range s.instances {
+		ret = append(ret, *i)
+	}
+	sort.Slice(ret, func(i, j int) bool { return *ret[i].InstanceId < *ret[j].InstanceId })
+	return ret
+}
+
+// KeyPairs returns the key pairs on the server, ordered by name.
+func (s *Server) KeyPairs() []ec2.KeyPairInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []ec2.KeyPairInfo
+	for _, k := range s.keyPairs {
+		ret = append(ret, *k)
+	}
+	sort.Slice(ret, func(i, j int) bool { return *ret[i].KeyName < *ret[j].KeyName })
+	return ret
+}
+
+// SecurityGroups returns the security groups on the server, ordered by
+// ID.
+func (s *Server) SecurityGroups() []ec2.SecurityGroup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []ec2.SecurityGroup
+	for _, g := range s.securityGroups {
+		ret = append(ret, *g)
+	}
+	sort.Slice(ret, func(i, j int) bool { return *ret[i].GroupId < *ret[j].GroupId })
+	return ret
+}
+
+// Images returns the registered images on the server, ordered by ID.
+func (s *Server) Images() []ec2.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []ec2.Image
+	for _, i := range s.images {
+		ret = append(ret, *i)
+	}
+	sort.Slice(ret, func(i, j int) bool { return *ret[i].ImageId < *ret[j].ImageId })
+	return ret
+}
+
+func instanceState(name string) *ec2.InstanceState {
+	codes := map[string]int64{
+		ec2.InstanceStateNamePending:      0,
+		ec2.InstanceStateNameRunning:      16,
+		ec2.InstanceStateNameShuttingDown: 32,
+		ec2.InstanceStateNameTerminated:   48,
+		ec2.InstanceStateNameStopping:     64,
+		ec2.InstanceStateNameStopped:      80,
+	}
+	return &ec2.InstanceState{
+		Code: aws.Int64(codes[name]),
+		Name: aws.String(name),
+	}
+}
+
+// apiError is returned by handlers and rendered in the error format of
+// the service being called.
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func errorf(status int, code, format string, args ...interface{}) error {
+	return &apiError{status, code, fmt.Sprintf(format, args...)}
+}
+
+// service returns the service named in the credential scope of the
+// request's SigV4 Authorization header.
+func service(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	i := strings.Index(auth, "Credential=")
+	if i < 0 {
+		return ""
+	}
+	scope := strings.SplitN(auth[i+len("Credential="):], ",", 2)[0]
+	parts := strings.Split(scope, "/")
+	if len(parts) != 5 {
+		return ""
+	}
+	return parts[3]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	action := r.PostForm.Get("Action")
+
+	var handlers map[string]func(form) (interface{}, error)
+	var namespace string
+	svc := service(r)
+	switch svc {
+	case "ec2":
+		handlers = s.ec2Handlers()
+		namespace = ec2Namespace
+	case "iam":
+		handlers = s.iamHandlers()
+		namespace = iamNamespace
+	case "sts":
+		handlers = map[string]func(form) (interface{}, error){
+			"GetCallerIdentity": s.getCallerIdentity,
+		}
+		namespace = stsNamespace
+	}
+
+	var result interface{}
+	err := errorf(http.StatusBadRequest, "InvalidAction", "unsupported action %q for service %q", action, svc)
+	if h, ok := handlers[action]; ok {
+		result, err = h(form(r.PostForm))
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	if err != nil {
+		e, ok := err.(*apiError)
+		if !ok {
+			e = &apiError{http.StatusInternalServerError, "InternalError", err.Error()}
+		}
+		w.WriteHeader(e.status)
+		if svc == "ec2" {
+			fmt.Fprintf(w, "<Response><Errors><Error><Code>%s</Code><Message>%s</Message></Error></Errors><RequestID>fake</RequestID></Response>", escape(e.code), escape(e.message))
+		} else {
+			fmt.Fprintf(w, "<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>%s</Message></Error><RequestId>fake</RequestId></ErrorResponse>", escape(e.code), escape(e.message))
+		}
+		return
+	}
+
+	// EC2 puts the result fields directly in the response element;
+	// the other query services wrap them in a result element.
+	enc := xml.NewEncoder(w)
+	response := xml.StartElement{
+		Name: xml.Name{Local: action + "Response"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: namespace}},
+	}
+	if svc == "ec2" {
+		enc.EncodeElement(result, response)
+		return
+	}
+	enc.EncodeToken(response)
+	enc.EncodeElement(result, xml.StartElement{Name: xml.Name{Local: action + "Result"}})
+	enc.EncodeElement(struct{ RequestId string }{"fake"}, xml.StartElement{Name: xml.Name{Local: "ResponseMetadata"}})
+	enc.EncodeToken(response.End())
+	enc.Flush()
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// form wraps the parameters of a query API request.
+type form map[string][]string
+
+func (f form) get(key string) string {
+	if v := f[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// list returns the values of the numbered parameters prefix.1,
+// prefix.2, ...
+func (f form) list(prefix string) []string {
+	var ret []string
+	for i := 1; ; i++ {
+		key := prefix + "." + strconv.Itoa(i)
+		if _, ok := f[key]; !ok {
+			return ret
+		}
+		ret = append(ret, f.get(key))
+	}
+}
+
+// tags returns the tags in the numbered parameters prefix.N.Key and
+// prefix.N.Value.
+func (f form) tags(prefix string) []*ec2.Tag {
+	var ret []*ec2.Tag
+	for i := 1; ; i++ {
+		key := fmt.Sprintf("%s.%d.Key", prefix, i)
+		if _, ok := f[key]; !ok {
+			return ret
+		}
+		ret = append(ret, &ec2.Tag{
+			Key:   aws.String(f.get(key)),
+			Value: aws.String(f.get(fmt.Sprintf("%s.%d.Value", prefix, i))),
+		})
+	}
+}
+
+// filters returns the request's Filter.N parameters as a map from the
+// filter name to the accepted values.
+func (f form) filters() map[string][]string {
+	ret := make(map[string][]string)
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("Filter.%d", i)
+		name := f.get(prefix + ".Name")
+		if name == "" {
+			return ret
+		}
+		ret[name] = f.list(prefix + ".Value")
+	}
+}
+
+// match reports whether a resource with the given filterable
+// attributes and tags passes all filters. Filter values may contain
+// glob patterns. Filters on unknown attributes match nothing.
+func match(filters map[string][]string, attrs map[string]string, tags []*ec2.Tag) bool {
+	for name, values := range filters {
+		value, ok := attrs[name]
+		if strings.HasPrefix(name, "tag:") {
+			for _, tag := range tags {
+				if aws.StringValue(tag.Key) == name[len("tag:"):] {
+					value, ok = aws.StringValue(tag.Value), true
+				}
+			}
+		}
+		if !ok {
+			return false
+		}
+		matched := false
+		for _, v := range values {
+			if m, _ := path.Match(v, value); m {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func setTags(tags []*ec2.Tag, add []*ec2.Tag) []*ec2.Tag {
+	for _, a := range add {
+		found := false
+		for _, t := range tags {
+			if aws.StringValue(t.Key) == aws.StringValue(a.Key) {
+				t.Value = a.Value
+				found = true
+			}
+		}
+		if !found {
+			tags = append(tags, &ec2.Tag{Key: a.Key, Value: a.Value})
+		}
+	}
+	return tags
+}
+
+func (s *Server) getCallerIdentity(form) (interface{}, error) {
+	return struct {
+		Arn     string
+		UserId  string
+		Account string
+	}{
+		Arn:     "arn:aws:iam::" + Account + ":user/mantle",
+		UserId:  "AIDAFAKE",
+		Account: Account,
+	}, nil
+}
+
+func (s *Server) iamHandlers() map[string]func(form) (interface{}, error) {
+	empty := func(form) (interface{}, error) { return struct{}{}, nil }
+	return map[string]func(form) (interface{}, error){
+		"GetInstanceProfile": func(f form) (interface{}, error) {
+			name := f.get("InstanceProfileName")
+			if !s.instanceProfiles[name] {
+				return nil, errorf(http.StatusNotFound, "NoSuchEntity", "Instance Profile %s cannot be found.", name)
+			}
+			type profile struct {
+				InstanceProfileName string
+				InstanceProfileId   string
+				Arn                 string
+				Path                string
+			}
+			return struct{ InstanceProfile profile }{profile{
+				InstanceProfileName: name,
+				InstanceProfileId:   "AIPAFAKE",
+				Arn:                 "arn:aws:iam::" + Account + ":instance-profile/" + name,
+				Path:                "/",
+			}}, nil
+		},
+		"CreateInstanceProfile": func(f form) (interface{}, error) {
+			s.instanceProfiles[f.get("InstanceProfileName")] = true
+			return struct{}{}, nil
+		},
+		"CreateRole":               empty,
+		"PutRolePolicy":            empty,
+		"AddRoleToInstanceProfile": empty,
+	}
+}
+
+// XML renderings of the EC2 types, which carry no XML struct tags.
+
+type xmlTag struct {
+	Key   string `xml:"key"`
+	Value string `xml:"value"`
+}
+
+func xmlTags(tags []*ec2.Tag) []xmlTag {
+	var ret []xmlTag
+	for _, t := range tags {
+		ret = append(ret, xmlTag{aws.StringValue(t.Key), aws.StringValue(t.Value)})
+	}
+	return ret
+}
+
+type xmlInstance struct {
+	InstanceID string `xml:"instanceId"`
+	ImageID    string `xml:"imageId"`
+	State      struct {
+		Code int64  `xml:"code"`
+		Name string `xml:"name"`
+	} `xml:"instanceState"`
+	KeyName          string   `xml:"keyName,omitempty"`
+	InstanceType     string   `xml:"instanceType"`
+	LaunchTime       string   `xml:"launchTime"`
+	SubnetID         string   `xml:"subnetId,omitempty"`
+	PrivateIPAddress string   `xml:"privateIpAddress,omitempty"`
+	PublicIPAddress  string   `xml:"ipAddress,omitempty"`
+	Tags             []xmlTag `xml:"tagSet>item"`
+}
+
+func toXMLInstance(i *ec2.Instance) xmlInstance {
+	x := xmlInstance{
+		InstanceID:       aws.StringValue(i.InstanceId),
+		ImageID:          aws.StringValue(i.ImageId),
+		KeyName:          aws.StringValue(i.KeyName),
+		InstanceType:     aws.StringValue(i.InstanceType),
+		LaunchTime:       aws.TimeValue(i.LaunchTime).UTC().Format(timeFormat),
+		SubnetID:         aws.StringValue(i.SubnetId),
+		PrivateIPAddress: aws.StringValue(i.PrivateIpAddress),
+		PublicIPAddress:  aws.StringValue(i.PublicIpAddress),
+		Tags:             xmlTags(i.Tags),
+	}
+	x.State.Code = aws.Int64Value(i.State.Code)
+	x.State.Name = aws.StringValue(i.State.Name)
+	return x
+}
+
+type xmlReservation struct {
+	ReservationID string        `xml:"reservationId"`
+	OwnerID       string        `xml:"ownerId"`
+	Instances     []xmlInstance `xml:"instancesSet>item"`
+}
+
+type xmlImage struct {
+	ImageID      string   `xml:"imageId"`
+	Name         string   `xml:"name"`
+	Description  string   `xml:"description,omitempty"`
+	State        string   `xml:"imageState"`
+	OwnerID      string   `xml:"imageOwnerId"`
+	CreationDate string   `xml:"creationDate"`
+	Tags         []xmlTag `xml:"tagSet>item"`
+}
+
+func (s *Server) ec2Handlers() map[string]func(form) (interface{}, error) {
+	ok := struct {
+		Return bool `xml:"return"`
+	}{true}
+	return map[string]func(form) (interface{}, error){
+		"RunInstances":       s.runInstances,
+		"DescribeInstances":  s.describeInstances,
+		"TerminateInstances": s.terminateInstances,
+		"GetConsoleOutput": func(f form) (interface{}, error) {
+			id := f.get("InstanceId")
+			if _, ok := s.instances[id]; !ok {
+				return nil, errorf(http.StatusBadRequest, "InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+			}
+			return struct {
+				InstanceID string `xml:"instanceId"`
+				Timestamp  string `xml:"timestamp"`
+				Output     string `xml:"output"`
+			}{id, time.Now().UTC().Format(timeFormat), base64.StdEncoding.EncodeToString([]byte(s.consoleOutput[id]))}, nil
+		},
+		"CreateTags": func(f form) (interface{}, error) {
+			ids := f.list("ResourceId")
+			for _, id := range ids {
+				if _, ok := s.instances[id]; !ok {
+					if _, ok := s.images[id]; !ok {
+						return nil, errorf(http.StatusBadRequest, "InvalidID", "The ID '%s' is not valid", id)
+					}
+				}
+			}
+			tags := f.tags("Tag")
+			for _, id := range ids {
+				if i, ok := s.instances[id]; ok {
+					i.Tags = setTags(i.Tags, tags)
+				} else {
+					s.images[id].Tags = setTags(s.images[id].Tags, tags)
+				}
+			}
+			return ok, nil
+		},
+		"ImportKeyPair": func(f form) (interface{}, error) {
+			name := f.get("KeyName")
+			if _, ok := s.keyPairs[name]; ok {
+				return nil, errorf(http.StatusBadRequest, "InvalidKeyPair.Duplicate", "The keypair '%s' already exists.", name)
+			}
+			material, err := base64.StdEncoding.DecodeString(f.get("PublicKeyMaterial"))
+			if err != nil || len(material) == 0 {
+				return nil, errorf(http.StatusBadRequest, "InvalidKey.Format", "Key is not in valid OpenSSH public key format")
+			}
+			k := &ec2.KeyPairInfo{
+				KeyName:        aws.String(name),
+				KeyFingerprint: aws.String(fmt.Sprintf("%x", len(material))),
+			}
+			s.keyPairs[name] = k
+			return struct {
+				KeyName        string `xml:"keyName"`
+				KeyFingerprint string `xml:"keyFingerprint"`
+			}{*k.KeyName, *k.KeyFingerprint}, nil
+		},
+		"DeleteKeyPair": func(f form) (interface{}, error) {
+			// Like EC2, deleting a missing key pair succeeds.
+			delete(s.keyPairs, f.get("KeyName"))
+			return ok, nil
+		},
+		"DescribeKeyPairs": func(f form) (interface{}, error) {
+			type item struct {
+				KeyName        string `xml:"keyName"`
+				KeyFingerprint string `xml:"keyFingerprint"`
+			}
+			names := f.list("KeyName")
+			filters := f.filters()
+			var ret struct {
+				Keys []item `xml:"keySet>item"`
+			}
+			for _, k := range s.keyPairs {
+				if len(names) > 0 && !contains(names, *k.KeyName) {
+					continue
+				}
+				if !match(filters, map[string]string{"key-name": *k.KeyName}, nil) {
+					continue
+				}
+				ret.Keys = append(ret.Keys, item{*k.KeyName, *k.KeyFingerprint})
+			}
+			sort.Slice(ret.Keys, func(i, j int) bool { return ret.Keys[i].KeyName < ret.Keys[j].KeyName })
+			return ret, nil
+		},
+		"DescribeSecurityGroups": func(f form) (interface{}, error) {
+			type item struct {
+				OwnerID     string `xml:"ownerId"`
+				GroupID     string `xml:"groupId"`
+				GroupName   string `xml:"groupName"`
+				Description string `xml:"groupDescription"`
+				VpcID       string `xml:"vpcId"`
+			}
+			ids := f.list("GroupId")
+			filters := f.filters()
+			var ret struct {
+				Groups []item `xml:"securityGroupInfo>item"`
+			}
+			for _, g := range s.securityGroups {
+				if len(ids) > 0 && !contains(ids, *g.GroupId) {
+					continue
+				}
+				if !match(filters, map[string]string{
+					"group-id":    *g.GroupId,
+					"group-name":  *g.GroupName,
+					"description": *g.Description,
+					"vpc-id":      *g.VpcId,
+				}, g.Tags) {
+					continue
+				}
+				ret.Groups = append(ret.Groups, item{*g.OwnerId, *g.GroupId, *g.GroupName, *g.Description, *g.VpcId})
+			}
+			sort.Slice(ret.Groups, func(i, j int) bool { return ret.Groups[i].GroupID < ret.Groups[j].GroupID })
+			return ret, nil
+		},
+		"DeleteSecurityGroup": func(f form) (interface{}, error) {
+			id := f.get("GroupId")
+			if _, ok := s.securityGroups[id]; !ok {
+				return nil, errorf(http.StatusBadRequest, "InvalidGroup.NotFound", "The security group '%s' does not exist", id)
+			}
+			for _, i := range s.instances {
+				if aws.StringValue(i.State.Name) == ec2.InstanceStateNameTerminated {
+					continue
+				}
+				for _, g := range i.SecurityGroups {
+					if aws.StringValue(g.GroupId) == id {
+						return nil, errorf(http.StatusBadRequest, "DependencyViolation", "resource %s has a dependent object", id)
+					}
+				}
+			}
+			delete(s.securityGroups, id)
+			return ok, nil
+		},
+		"DescribeSubnets": func(f form) (interface{}, error) {
+			type item struct {
+				SubnetID string `xml:"subnetId"`
+				VpcID    string `xml:"vpcId"`
+			}
+			filters := f.filters()
+			var ret struct {
+				Subnets []item `xml:"subnetSet>item"`
+			}
+			for _, sn := range s.subnets {
+				if match(filters, map[string]string{"subnet-id": *sn.SubnetId, "vpc-id": *sn.VpcId}, nil) {
+					ret.Subnets = append(ret.Subnets, item{*sn.SubnetId, *sn.VpcId})
+				}
+			}
+			sort.Slice(ret.Subnets, func(i, j int) bool { return ret.Subnets[i].SubnetID < ret.Subnets[j].SubnetID })
+			return ret, nil
+		},
+		"RegisterImage": func(f form) (interface{}, error) {
+			name := f.get("Name")
+			for _, i := range s.images {
+				if *i.Name == name {
+					return nil, errorf(http.StatusBadRequest, "InvalidAMIName.Duplicate", "AMI name %s is already in use by AMI %s", name, *i.ImageId)
+				}
+			}
+			i := &ec2.Image{
+				ImageId:      aws.String(s.id("ami")),
+				Name:         aws.String(name),
+				Description:  aws.String(f.get("Description")),
+				State:        aws.String(ec2.ImageStateAvailable),
+				OwnerId:      aws.String(Account),
+				CreationDate: aws.String(time.Now().UTC().Format(timeFormat)),
+			}
+			s.images[*i.ImageId] = i
+			return struct {
+				ImageID string `xml:"imageId"`
+			}{*i.ImageId}, nil
+		},
+		"DescribeImages": func(f form) (interface{}, error) {
+			ids := f.list("ImageId")
+			for _, id := range ids {
+				if _, ok := s.images[id]; !ok {
+					return nil, errorf(http.StatusBadRequest, "InvalidAMIID.NotFound", "The image id '[%s]' does not exist", id)
+				}
+			}
+			filters := f.filters()
+			var ret struct {
+				Images []xmlImage `xml:"imagesSet>item"`
+			}
+			for _, i := range s.images {
+				if len(ids) > 0 && !contains(ids, *i.ImageId) {
+					continue
+				}
+				if !match(filters, map[string]string{
+					"image-id": *i.ImageId,
+					"name":     *i.Name,
+					"state":    *i.State,
+				}, i.Tags) {
+					continue
+				}
+				ret.Images = append(ret.Images, xmlImage{
+					ImageID:      *i.ImageId,
+					Name:         *i.Name,
+					Description:  aws.StringValue(i.Description),
+					State:        *i.State,
+					OwnerID:      *i.OwnerId,
+					CreationDate: *i.CreationDate,
+					Tags:         xmlTags(i.Tags),
+				})
+			}
+			sort.Slice(ret.Images, func(i, j int) bool { return ret.Images[i].ImageID < ret.Images[j].ImageID })
+			return ret, nil
+		},
+		"DeregisterImage": func(f form) (interface{}, error) {
+			id := f.get("ImageId")
+			if _, ok := s.images[id]; !ok {
+				return nil, errorf(http.StatusBadRequest, "InvalidAMIID.NotFound", "The image id '[%s]' does not exist", id)
+			}
+			delete(s.images, id)
+			return ok, nil
+		},
+	}
+}
+
+func (s *Server) runInstances(f form) (interface{}, error) {
+	count, err := strconv.Atoi(f.get("MaxCount"))
+	if err != nil || count < 1 {
+		return nil, errorf(http.StatusBadRequest, "InvalidParameterValue", "invalid MaxCount %q", f.get("MaxCount"))
+	}
+	image := f.get("ImageId")
+	if image == "" {
+		return nil, errorf(http.StatusBadRequest, "MissingParameter", "The request must contain the parameter ImageId")
+	}
+	if key := f.get("KeyName"); key != "" {
+		if _, ok := s.keyPairs[key]; !ok {
+			return nil, errorf(http.StatusBadRequest, "InvalidKeyPair.NotFound", "The key pair '%s' does not exist", key)
+		}
+	}
+	if profile := f.get("IamInstanceProfile.Name"); profile != "" && !s.instanceProfiles[profile] {
+		return nil, errorf(http.StatusBadRequest, "InvalidParameterValue", "Value (%s) for parameter iamInstanceProfile.name is invalid. Invalid IAM Instance Profile name", profile)
+	}
+	subnet := f.get("SubnetId")
+	if _, ok := s.subnets[subnet]; subnet != "" && !ok {
+		return nil, errorf(http.StatusBadRequest, "InvalidSubnetID.NotFound", "The subnet ID '%s' does not exist", subnet)
+	}
+	var groups []*ec2.GroupIdentifier
+	for _, g := range f.list("SecurityGroupId") {
+		if _, ok := s.securityGroups[g]; !ok {
+			return nil, errorf(http.StatusBadRequest, "InvalidGroup.NotFound", "The security group '%s' does not exist", g)
+		}
+		groups = append(groups, &ec2.GroupIdentifier{GroupId: aws.String(g)})
+	}
+	var tags []*ec2.Tag
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("TagSpecification.%d", i)
+		resourceType := f.get(prefix + ".ResourceType")
+		if resourceType == "" {
+			break
+		}
+		if resourceType == ec2.ResourceTypeInstance {
+			tags = setTags(tags, f.tags(prefix+".Tag"))
+		}
+	}
+
+	res := xmlReservation{
+		ReservationID: s.id("r"),
+		OwnerID:       Account,
+	}
+	for n := 0; n < count; n++ {
+		seq := s.nextID
+		inst := &ec2.Instance{
+			InstanceId:       aws.String(s.id("i")),
+			ImageId:          aws.String(image),
+			InstanceType:     aws.String(f.get("InstanceType")),
+			LaunchTime:       aws.Time(time.Now()),
+			SubnetId:         aws.String(subnet),
+			SecurityGroups:   groups,
+			State:            instanceState(ec2.InstanceStateNameRunning),
+			PrivateIpAddress: aws.String(fmt.Sprintf("10.0.%d.%d", seq/256%256, seq%256)),
+			PublicIpAddress:  aws.String(fmt.Sprintf("198.51.%d.%d", seq/256%256, seq%256)),
+			Tags:             setTags(nil, tags),
+		}
+		if key := f.get("KeyName"); key != "" {
+			inst.KeyName = aws.String(key)
+		}
+		s.instances[*inst.InstanceId] = inst
+		s.reservations[*inst.InstanceId] = res.ReservationID
+		res.Instances = append(res.Instances, toXMLInstance(inst))
+	}
+	return res, nil
+}
+
+func (s *Server) describeInstances(f form) (interface{}, error) {
+	ids := f.list("InstanceId")
+	for _, id := range ids {
+		if _, ok := s.instances[id]; !ok {
+			return nil, errorf(http.StatusBadRequest, "InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+		}
+	}
+	filters := f.filters()
+
+	var insts []*ec2.Instance
+	for _, i := range s.instances {
+		if len(ids) > 0 && !contains(ids, *i.InstanceId) {
+			continue
+		}
+		if !match(filters, map[string]string{
+			"instance-id":         *i.InstanceId,
+			"instance-state-name": *i.State.Name,
+			"key-name":            aws.StringValue(i.KeyName),
+		}, i.Tags) {
+			continue
+		}
+		insts = append(insts, i)
+	}
+	sort.Slice(insts, func(i, j int) bool { return *insts[i].InstanceId < *insts[j].InstanceId })
+
+	var ret struct {
+		Reservations []*xmlReservation `xml:"reservationSet>item"`
+	}
+	byID := make(map[string]*xmlReservation)
+	for _, i := range insts {
+		rid := s.reservations[*i.InstanceId]
+		res, ok := byID[rid]
+		if !ok {
+			res = &xmlReservation{ReservationID: rid, OwnerID: Account}
+			byID[rid] = res
+			ret.Reservations = append(ret.Reservations, res)
+		}
+		res.Instances = append(res.Instances, toXMLInstance(i))
+	}
+	return ret, nil
+}
+
+func (s *Server) terminateInstances(f form) (interface{}, error) {
+	type item struct {
+		InstanceID    string `xml:"instanceId"`
+		PreviousState struct {
+			Code int64  `xml:"code"`
+			Name string `xml:"name"`
+		} `xml:"previousState"`
+		CurrentState struct {
+			Code int64  `xml:"code"`
+			Name string `xml:"name"`
+		} `xml:"currentState"`
+	}
+	ids := f.list("InstanceId")
+	for _, id := range ids {
+		if _, ok := s.instances[id]; !ok {
+			return nil, errorf(http.StatusBadRequest, "InvalidInstanceID.NotFound", "The instance ID '%s' does not exist", id)
+		}
+	}
+	var ret struct {
+		Instances []item `xml:"instancesSet>item"`
+	}
+	for _, id := range ids {
+		i := s.instances[id]
+		var it item
+		it.InstanceID = id
+		it.PreviousState.Code = *i.State.Code
+		it.PreviousState.Name = *i.State.Name
+		i.State = instanceState(ec2.InstanceStateNameTerminated)
+		it.CurrentState.Code = *i.State.Code
+		it.CurrentState.Name = *i.State.Name
+		ret.Instances = append(ret.Instances, it)
+	}
+	return ret, nil
+}
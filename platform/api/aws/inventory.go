@@ -0,0 +1,133 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/flatcar-linux/mantle/platform/inventory"
+)
+
+const securityGroupDescription = "mantle security group for testing"
+
+// ListResources lists the EC2 instances, key pairs and security groups
+// created by mantle in the API's region.
+func (a *API) ListResources(ctx context.Context) ([]inventory.Resource, error) {
+	var ret []inventory.Resource
+
+	err := a.ec2.DescribeInstancesPagesWithContext(ctx, &ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:CreatedBy"),
+				Values: aws.StringSlice([]string{"mantle"}),
+			},
+		},
+	}, func(page *ec2.DescribeInstancesOutput, last bool) bool {
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				if instance.State != nil {
+					switch *instance.State.Name {
+					case ec2.InstanceStateNameTerminated, ec2.InstanceStateNameShuttingDown:
+						continue
+					}
+				}
+				r := inventory.Resource{
+					Cloud:   "aws",
+					Kind:    inventory.KindInstance,
+					ID:      aws.StringValue(instance.InstanceId),
+					Region:  a.opts.Region,
+					Owner:   aws.StringValue(reservation.OwnerId),
+					Flight:  inventory.FlightName(aws.StringValue(instance.KeyName)),
+					Created: aws.TimeValue(instance.LaunchTime),
+				}
+				for _, tag := range instance.Tags {
+					if aws.StringValue(tag.Key) == "Name" {
+						r.Name = aws.StringValue(tag.Value)
+					}
+				}
+				ret = append(ret, r)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing instances: %v", err)
+	}
+
+	keys, err := a.ec2.DescribeKeyPairsWithContext(ctx, &ec2.DescribeKeyPairsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("error describing key pairs: %v", err)
+	}
+	for _, key := range keys.KeyPairs {
+		name := aws.StringValue(key.KeyName)
+		flight := inventory.FlightName(name)
+		if flight == "" {
+			continue
+		}
+		ret = append(ret, inventory.Resource{
+			Cloud:  "aws",
+			Kind:   inventory.KindKey,
+			ID:     name,
+			Name:   name,
+			Region: a.opts.Region,
+			Flight: flight,
+		})
+	}
+
+	groups, err := a.ec2.DescribeSecurityGroupsWithContext(ctx, &ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("description"),
+				Values: aws.StringSlice([]string{securityGroupDescription}),
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error describing security groups: %v", err)
+	}
+	for _, group := range groups.SecurityGroups {
+		ret = append(ret, inventory.Resource{
+			Cloud:  "aws",
+			Kind:   inventory.KindSecurityGroup,
+			ID:     aws.StringValue(group.GroupId),
+			Name:   aws.StringValue(group.GroupName),
+			Region: a.opts.Region,
+			Owner:  aws.StringValue(group.OwnerId),
+		})
+	}
+
+	return ret, nil
+}
+
+// DeleteResource deletes a resource returned by ListResources.
+func (a *API) DeleteResource(ctx context.Context, r inventory.Resource) error {
+	switch r.Kind {
+	case inventory.KindInstance:
+		return a.TerminateInstances([]string{r.ID})
+	case inventory.KindKey:
+		return a.DeleteKey(r.ID)
+	case inventory.KindSecurityGroup:
+		_, err := a.ec2.DeleteSecurityGroupWithContext(ctx, &ec2.DeleteSecurityGroupInput{
+			GroupId: aws.String(r.ID),
+		})
+		return err
+	default:
+		return fmt.Errorf("unsupported resource kind %q", r.Kind)
+	}
+}
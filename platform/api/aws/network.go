@@ -56,7 +56,7 @@ func (a *API) createSecurityGroup(name string) (string, error) {
 	}
 	sg, err := a.ec2.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
 		GroupName:   aws.String(name),
-		Description: aws.String("mantle security group for testing"),
+		Description: aws.String(securityGroupDescription),
 		VpcId:       aws.String(vpcId),
 	})
 	if err != nil {
@@ -0,0 +1,69 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flatcar-linux/mantle/platform/inventory"
+)
+
+// ListResources lists the resource groups created by kola. Everything
+// kola creates in Azure, including instances, images and blobs, lives
+// in one of these groups and is deleted with it.
+func (a *API) ListResources(ctx context.Context) ([]inventory.Resource, error) {
+	groups, err := a.ListResourceGroups("")
+	if err != nil {
+		return nil, fmt.Errorf("listing resource groups: %v", err)
+	}
+
+	var ret []inventory.Resource
+	for _, group := range *groups.Value {
+		if group.Name == nil || !strings.HasPrefix(*group.Name, "kola-cluster") {
+			continue
+		}
+		r := inventory.Resource{
+			Cloud: "azure",
+			Kind:  inventory.KindResourceGroup,
+			ID:    *group.Name,
+			Name:  *group.Name,
+			Owner: a.opts.SubscriptionName,
+		}
+		if group.Location != nil {
+			r.Region = *group.Location
+		}
+		if createdAt, ok := group.Tags["createdAt"]; ok && createdAt != nil {
+			r.Created, err = time.Parse(time.RFC3339, *createdAt)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing time: %v", err)
+			}
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+// DeleteResource deletes a resource returned by ListResources.
+func (a *API) DeleteResource(ctx context.Context, r inventory.Resource) error {
+	switch r.Kind {
+	case inventory.KindResourceGroup:
+		return a.TerminateResourceGroup(r.ID)
+	default:
+		return fmt.Errorf("unsupported resource kind %q", r.Kind)
+	}
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/flatcar-linux/mantle/auth"
 	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/inventory"
 	"github.com/flatcar-linux/mantle/util"
 )
 
@@ -42,6 +43,8 @@ type Options struct {
 	Profile string
 	// Personal access token (overrides config profile)
 	AccessToken string
+	// API endpoint URL, for testing against a fake server
+	Endpoint string
 
 	// Region slug (e.g. "sfo2")
 	Region string
@@ -77,14 +80,20 @@ func New(opts *Options) (*API, error) {
 	}
 
 	ctx := context.TODO()
-	client := godo.NewClient(oauth2.NewClient(ctx, &tokenSource{opts.AccessToken}))
+	var clientOpts []godo.ClientOpt
+	if opts.Endpoint != "" {
+		clientOpts = append(clientOpts, godo.SetBaseURL(opts.Endpoint))
+	}
+	client, err := godo.New(oauth2.NewClient(ctx, &tokenSource{opts.AccessToken}), clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %v", err)
+	}
 
 	a := &API{
 		c:    client,
 		opts: opts,
 	}
 
-	var err error
 	a.image, err = a.resolveImage(ctx, opts.Image)
 	if err != nil {
 		return nil, err
@@ -151,7 +160,14 @@ func (a *API) PreflightCheck(ctx context.Context) error {
 	return nil
 }
 
-func (a *API) CreateDroplet(ctx context.Context, name string, sshKeyID int, userdata string) (*godo.Droplet, error) {
+// CreateDroplet creates a droplet, tagging it with flight unless that is
+// empty.
+func (a *API) CreateDroplet(ctx context.Context, name, flight string, sshKeyID int, userdata string) (*godo.Droplet, error) {
+	tags := []string{"mantle"}
+	if flight != "" {
+		tags = append(tags, inventory.FlightTag(flight))
+	}
+
 	var droplet *godo.Droplet
 	var err error
 	// DO frequently gives us 422 errors saying "Please try again". Retry every 10 seconds
@@ -166,7 +182,7 @@ func (a *API) CreateDroplet(ctx context.Context, name string, sshKeyID int, user
 			IPv6:              false,
 			PrivateNetworking: true,
 			UserData:          userdata,
-			Tags:              []string{"mantle"},
+			Tags:              tags,
 		})
 		if err != nil {
 			plog.Errorf("Error creating droplet: %v. Retrying...", err)
@@ -0,0 +1,116 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package do
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/do/fake"
+	"github.com/flatcar-linux/mantle/platform/inventory"
+	"github.com/flatcar-linux/mantle/platform/inventory/inventorytest"
+)
+
+func newTestAPI(t *testing.T, image string) (*API, *fake.Server) {
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+	server.AddImage(godo.Image{Name: "flatcar-test", Regions: []string{"sfo2"}})
+
+	api, err := New(&Options{
+		Options:     &platform.Options{},
+		AccessToken: "token",
+		Endpoint:    server.URL,
+		Region:      "sfo2",
+		Image:       image,
+	})
+	require.NoError(t, err)
+	require.NoError(t, api.PreflightCheck(context.Background()))
+	return api, server
+}
+
+func TestResolveImage(t *testing.T) {
+	api, server := newTestAPI(t, "flatcar-test")
+	assert.Equal(t, server.Images()[0].ID, api.image.ID)
+
+	api, _ = newTestAPI(t, "beta")
+	assert.Equal(t, "coreos-beta", api.image.Slug)
+
+	_, err := New(&Options{
+		Options:     &platform.Options{},
+		AccessToken: "token",
+		Endpoint:    api.opts.Endpoint,
+		Region:      "nyc1",
+		Image:       "flatcar-test",
+	})
+	assert.Error(t, err)
+}
+
+func TestKeys(t *testing.T) {
+	ctx := context.Background()
+	api, server := newTestAPI(t, "")
+
+	id, err := api.AddKey(ctx, inventorytest.Flight, "ssh-ed25519 AAAA")
+	require.NoError(t, err)
+	keys, err := api.ListKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, inventorytest.Flight, keys[0].Name)
+
+	require.NoError(t, api.DeleteKey(ctx, id))
+	assert.Empty(t, server.Keys())
+	assert.Error(t, api.DeleteKey(ctx, id))
+}
+
+func TestGC(t *testing.T) {
+	api, server := newTestAPI(t, "")
+	old := time.Now().Add(-6 * time.Hour).UTC().Format(time.RFC3339)
+	server.AddDroplet(godo.Droplet{Name: "old", Tags: []string{"mantle"}, Created: old})
+	server.AddDroplet(godo.Droplet{Name: "new", Tags: []string{"mantle"}})
+	server.AddDroplet(godo.Droplet{Name: "other", Created: old})
+
+	require.NoError(t, api.GC(context.Background(), 5*time.Hour))
+
+	var names []string
+	for _, d := range server.Droplets() {
+		names = append(names, d.Name)
+	}
+	assert.Equal(t, []string{"new", "other"}, names)
+}
+
+func TestInventory(t *testing.T) {
+	ctx := context.Background()
+	api, server := newTestAPI(t, "")
+	server.AddDroplet(godo.Droplet{Name: "kola-1", Tags: []string{"mantle", inventory.FlightTag(inventorytest.Flight)}, Region: &godo.Region{Slug: "sfo2"}})
+	server.AddDroplet(godo.Droplet{Name: "other"})
+	_, err := api.AddKey(ctx, inventorytest.Flight, "ssh-ed25519 AAAA")
+	require.NoError(t, err)
+	_, err = api.AddKey(ctx, "laptop", "ssh-ed25519 BBBB")
+	require.NoError(t, err)
+
+	inventorytest.CheckProvider(t, api, []inventory.Resource{
+		{Cloud: "do", Kind: inventory.KindInstance, Name: "kola-1", Region: "sfo2", Flight: inventorytest.Flight},
+		{Cloud: "do", Kind: inventory.KindKey, Name: inventorytest.Flight, Flight: inventorytest.Flight},
+	})
+	require.Len(t, server.Droplets(), 1)
+	assert.Equal(t, "other", server.Droplets()[0].Name)
+	require.Len(t, server.Keys(), 1)
+	assert.Equal(t, "laptop", server.Keys()[0].Name)
+}
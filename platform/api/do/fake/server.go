@@ -0,0 +1,376 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake implements an in-process fake of the subset of the
+// DigitalOcean API used by mantle, for testing without credentials.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// Server is a fake DigitalOcean API server. Resources are created
+// ready to use: droplets are active, images available and actions
+// completed.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	nextID   int
+	droplets map[int]*godo.Droplet
+	images   map[int]*godo.Image
+	keys     map[int]*godo.Key
+	actions  map[int]*godo.Action
+}
+
+// NewServer starts a fake server; the caller must Close it.
+func NewServer() *Server {
+	s := &Server{
+		nextID:   1,
+		droplets: make(map[int]*godo.Droplet),
+		images:   make(map[int]*godo.Image),
+		keys:     make(map[int]*godo.Key),
+		actions:  make(map[int]*godo.Action),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *Server) id() int {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+// AddDroplet adds a droplet as if it had been created outside mantle
+// and returns its ID.
+func (s *Server) AddDroplet(d godo.Droplet) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d.ID = s.id()
+	if d.Status == "" {
+		d.Status = "active"
+	}
+	if d.Created == "" {
+		d.Created = time.Now().UTC().Format(time.RFC3339)
+	}
+	s.droplets[d.ID] = &d
+	return d.ID
+}
+
+// AddImage adds a user image and returns its ID.
+func (s *Server) AddImage(i godo.Image) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i.ID = s.id()
+	if i.Status == "" {
+		i.Status = "available"
+	}
+	s.images[i.ID] = &i
+	return i.ID
+}
+
+// Droplets returns the droplets on the server, ordered by ID.
+func (s *Server) Droplets() []godo.Droplet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []godo.Droplet
+	for _, d := range s.droplets {
+		ret = append(ret, *d)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+// Images returns the user images on the server, ordered by ID.
+func (s *Server) Images() []godo.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []godo.Image
+	for _, i := range s.images {
+		ret = append(ret, *i)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+// Keys returns the SSH keys on the server, ordered by ID.
+func (s *Server) Keys() []godo.Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []godo.Key
+	for _, k := range s.keys {
+		ret = append(ret, *k)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, map[string]string{
+		"id":      strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_")),
+		"message": fmt.Sprintf(format, args...),
+	})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v2" {
+		writeError(w, http.StatusNotFound, "no such path %q", r.URL.Path)
+		return
+	}
+	parts = parts[1:]
+
+	// The numeric ID is the path element after the collection:
+	// /v2/droplets/{id}, /v2/images/{id}, /v2/account/keys/{id} etc.
+	if parts[0] == "account" && len(parts) > 1 {
+		parts = append([]string{"account/" + parts[1]}, parts[2:]...)
+	}
+	var id int
+	if len(parts) > 1 {
+		var err error
+		if id, err = strconv.Atoi(parts[1]); err != nil {
+			writeError(w, http.StatusNotFound, "bad ID %q", parts[1])
+			return
+		}
+	}
+
+	route := r.Method + " " + parts[0]
+	switch {
+	case route == "GET account" && len(parts) == 1:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"account": godo.Account{Email: "mantle@example.com", Status: "active", DropletLimit: 100},
+		})
+	case route == "GET account/keys" && len(parts) == 1:
+		s.listKeys(w)
+	case route == "POST account/keys" && len(parts) == 1:
+		s.createKey(w, r)
+	case route == "DELETE account/keys" && len(parts) == 2:
+		s.delete(w, s.keys, id)
+	case route == "GET droplets" && len(parts) == 1:
+		s.listDroplets(w, r)
+	case route == "POST droplets" && len(parts) == 1:
+		s.createDroplet(w, r)
+	case route == "GET droplets" && len(parts) == 2:
+		if d, ok := s.droplets[id]; ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"droplet": d})
+		} else {
+			writeError(w, http.StatusNotFound, "droplet %d not found", id)
+		}
+	case route == "DELETE droplets" && len(parts) == 2:
+		s.delete(w, s.droplets, id)
+	case route == "POST droplets" && len(parts) == 3 && parts[2] == "actions":
+		s.dropletAction(w, r, id)
+	case route == "GET actions" && len(parts) == 2:
+		if a, ok := s.actions[id]; ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"action": a})
+		} else {
+			writeError(w, http.StatusNotFound, "action %d not found", id)
+		}
+	case route == "GET images" && len(parts) == 1:
+		var images []*godo.Image
+		for _, i := range s.images {
+			images = append(images, i)
+		}
+		sort.Slice(images, func(i, j int) bool { return images[i].ID < images[j].ID })
+		writeJSON(w, http.StatusOK, map[string]interface{}{"images": images})
+	case route == "POST images" && len(parts) == 1:
+		s.createImage(w, r)
+	case route == "GET images" && len(parts) == 2:
+		if i, ok := s.images[id]; ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"image": i})
+		} else {
+			writeError(w, http.StatusNotFound, "image %d not found", id)
+		}
+	case route == "DELETE images" && len(parts) == 2:
+		s.delete(w, s.images, id)
+	default:
+		writeError(w, http.StatusNotFound, "unsupported request %s %s", r.Method, r.URL.Path)
+	}
+}
+
+func (s *Server) delete(w http.ResponseWriter, m interface{}, id int) {
+	var ok bool
+	switch m := m.(type) {
+	case map[int]*godo.Droplet:
+		if _, ok = m[id]; ok {
+			delete(m, id)
+		}
+	case map[int]*godo.Image:
+		if _, ok = m[id]; ok {
+			delete(m, id)
+		}
+	case map[int]*godo.Key:
+		if _, ok = m[id]; ok {
+			delete(m, id)
+		}
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "resource %d not found", id)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listDroplets(w http.ResponseWriter, r *http.Request) {
+	tag := r.URL.Query().Get("tag_name")
+	droplets := []*godo.Droplet{}
+	for _, d := range s.droplets {
+		if tag != "" && !contains(d.Tags, tag) {
+			continue
+		}
+		droplets = append(droplets, d)
+	}
+	sort.Slice(droplets, func(i, j int) bool { return droplets[i].ID < droplets[j].ID })
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"droplets": droplets,
+		"meta":     map[string]int{"total": len(droplets)},
+	})
+}
+
+func (s *Server) createDroplet(w http.ResponseWriter, r *http.Request) {
+	var req godo.DropletCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	id := s.id()
+	d := &godo.Droplet{
+		ID:       id,
+		Name:     req.Name,
+		Status:   "active",
+		Created:  time.Now().UTC().Format(time.RFC3339),
+		Region:   &godo.Region{Slug: req.Region},
+		SizeSlug: req.Size,
+		Tags:     req.Tags,
+		Networks: &godo.Networks{
+			V4: []godo.NetworkV4{
+				{IPAddress: fmt.Sprintf("10.0.%d.%d", id/256, id%256), Type: "private"},
+				{IPAddress: fmt.Sprintf("192.0.2.%d", id%256), Type: "public"},
+			},
+		},
+	}
+	s.droplets[id] = d
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"droplet": d})
+}
+
+func (s *Server) dropletAction(w http.ResponseWriter, r *http.Request, dropletID int) {
+	d, ok := s.droplets[dropletID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "droplet %d not found", dropletID)
+		return
+	}
+	var req godo.ActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if req["type"] != "snapshot" {
+		writeError(w, http.StatusUnprocessableEntity, "unsupported action %v", req["type"])
+		return
+	}
+	name, _ := req["name"].(string)
+	image := &godo.Image{
+		ID:      s.id(),
+		Name:    name,
+		Type:    "snapshot",
+		Status:  "available",
+		Created: time.Now().UTC().Format(time.RFC3339),
+	}
+	if d.Region != nil {
+		image.Regions = []string{d.Region.Slug}
+	}
+	s.images[image.ID] = image
+	action := &godo.Action{
+		ID:           s.id(),
+		Status:       "completed",
+		Type:         "snapshot",
+		ResourceID:   dropletID,
+		ResourceType: "droplet",
+	}
+	s.actions[action.ID] = action
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"action": action})
+}
+
+func (s *Server) createImage(w http.ResponseWriter, r *http.Request) {
+	var req godo.CustomImageCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	image := &godo.Image{
+		ID:           s.id(),
+		Name:         req.Name,
+		Type:         "custom",
+		Distribution: req.Distribution,
+		Regions:      []string{req.Region},
+		Status:       "available",
+		Created:      time.Now().UTC().Format(time.RFC3339),
+		Tags:         req.Tags,
+	}
+	s.images[image.ID] = image
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"image": image})
+}
+
+func (s *Server) listKeys(w http.ResponseWriter) {
+	keys := []*godo.Key{}
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"ssh_keys": keys})
+}
+
+func (s *Server) createKey(w http.ResponseWriter, r *http.Request) {
+	var req godo.KeyCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	key := &godo.Key{
+		ID:        s.id(),
+		Name:      req.Name,
+		PublicKey: req.PublicKey,
+	}
+	s.keys[key.ID] = key
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"ssh_key": key})
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
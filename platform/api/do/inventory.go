@@ -0,0 +1,92 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package do
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/flatcar-linux/mantle/platform/inventory"
+)
+
+// ListResources lists the droplets tagged by mantle and the SSH keys
+// named after kola flights.
+func (a *API) ListResources(ctx context.Context) ([]inventory.Resource, error) {
+	var ret []inventory.Resource
+
+	droplets, err := a.listDropletsWithTag(ctx, "mantle")
+	if err != nil {
+		return nil, fmt.Errorf("listing droplets: %v", err)
+	}
+	for _, droplet := range droplets {
+		if droplet.Status == "archive" {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, droplet.Created)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse %q: %v", droplet.Created, err)
+		}
+		r := inventory.Resource{
+			Cloud:   "do",
+			Kind:    inventory.KindInstance,
+			ID:      strconv.Itoa(droplet.ID),
+			Name:    droplet.Name,
+			Flight:  inventory.TaggedFlight(droplet.Tags),
+			Created: created,
+		}
+		if droplet.Region != nil {
+			r.Region = droplet.Region.Slug
+		}
+		ret = append(ret, r)
+	}
+
+	keys, err := a.ListKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing keys: %v", err)
+	}
+	for _, key := range keys {
+		flight := inventory.FlightName(key.Name)
+		if flight == "" {
+			continue
+		}
+		ret = append(ret, inventory.Resource{
+			Cloud:  "do",
+			Kind:   inventory.KindKey,
+			ID:     strconv.Itoa(key.ID),
+			Name:   key.Name,
+			Flight: flight,
+		})
+	}
+
+	return ret, nil
+}
+
+// DeleteResource deletes a resource returned by ListResources.
+func (a *API) DeleteResource(ctx context.Context, r inventory.Resource) error {
+	id, err := strconv.Atoi(r.ID)
+	if err != nil {
+		return fmt.Errorf("bad ID %q: %v", r.ID, err)
+	}
+	switch r.Kind {
+	case inventory.KindInstance:
+		return a.DeleteDroplet(ctx, id)
+	case inventory.KindKey:
+		return a.DeleteKey(ctx, id)
+	default:
+		return fmt.Errorf("unsupported resource kind %q", r.Kind)
+	}
+}
@@ -51,10 +51,27 @@ type Options struct {
 	// Profile name
 	Profile string
 
-	Server                 string
-	User                   string
-	Password               string
-	BaseVMName             string
+	Server   string
+	User     string
+	Password string
+
+	// vCenter inventory paths to place VMs in. Empty values select the
+	// only object of the kind, as on a single ESXi host. Without a
+	// ResourcePool, the root pool of Cluster is used.
+	Datacenter   string
+	Cluster      string
+	ResourcePool string
+	Datastore    string
+	Folder       string
+	Network      string
+	// PrivateNetwork, if set, is attached as a second NIC that carries
+	// the private static IP.
+	PrivateNetwork string
+
+	BaseVMName string
+	// BaseSnapshot is the snapshot of the base VM to create linked
+	// clones from. Without it, VMs are full clones.
+	BaseSnapshot           string
 	OvaPath                string
 	FirstStaticIp          string
 	FirstStaticIpPrivate   string
@@ -92,11 +109,13 @@ type ovfFileItem struct {
 }
 
 type serverResources struct {
-	finder       *find.Finder
-	datacenter   *object.Datacenter
-	resourcePool *object.ResourcePool
-	datastore    *object.Datastore
-	network      object.NetworkReference
+	finder         *find.Finder
+	datacenter     *object.Datacenter
+	resourcePool   *object.ResourcePool
+	datastore      *object.Datastore
+	folder         *object.Folder
+	network        object.NetworkReference
+	privateNetwork object.NetworkReference
 }
 
 func (a *API) getMachine(vm *object.VirtualMachine) (*ESXMachine, error) {
@@ -174,6 +193,27 @@ func New(opts *Options) (*API, error) {
 		if opts.StaticSubnetSize == 0 {
 			opts.StaticSubnetSize = profile.StaticSubnetSize
 		}
+		if opts.Datacenter == "" {
+			opts.Datacenter = profile.Datacenter
+		}
+		if opts.Cluster == "" {
+			opts.Cluster = profile.Cluster
+		}
+		if opts.ResourcePool == "" {
+			opts.ResourcePool = profile.ResourcePool
+		}
+		if opts.Datastore == "" {
+			opts.Datastore = profile.Datastore
+		}
+		if opts.Folder == "" {
+			opts.Folder = profile.Folder
+		}
+		if opts.Network == "" {
+			opts.Network = profile.Network
+		}
+		if opts.PrivateNetwork == "" {
+			opts.PrivateNetwork = profile.PrivateNetwork
+		}
 	}
 
 	esxUrl := fmt.Sprintf("%s:%s@%s", url.QueryEscape(opts.User), url.QueryEscape(opts.Password), opts.Server)
@@ -253,6 +293,18 @@ func (a *API) buildCloneSpec(baseVM *object.VirtualMachine, folder *object.Folde
 		Template: false,
 	}
 
+	if a.options.BaseSnapshot != "" {
+		snapshot, err := baseVM.FindSnapshot(a.ctx, a.options.BaseSnapshot)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't find base VM snapshot: %v", err)
+		}
+		// The delta disk is created on the target datastore with the
+		// rest of the VM, referencing the base disk wherever it is, so
+		// GetConsoleOutput and CleanupDevice find the VM directory.
+		cloneSpec.Snapshot = snapshot
+		cloneSpec.Location.DiskMoveType = string(types.VirtualMachineRelocateDiskMoveOptionsCreateNewChildDiskBacking)
+	}
+
 	return cloneSpec, nil
 }
 
@@ -293,17 +345,39 @@ func (a *API) addSerialPort(vm *object.VirtualMachine) error {
 	return vm.EditDevice(a.ctx, devices.ConnectSerialPort(d, uri, false, ""))
 }
 
+func (a *API) addNetworkDevice(vm *object.VirtualMachine, network object.NetworkReference) error {
+	backing, err := network.EthernetCardBackingInfo(a.ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't get network backing: %v", err)
+	}
+
+	// Match the vmxnet3 card of the Flatcar OVA so that the guest
+	// names the interface predictably.
+	device, err := object.EthernetCardTypes().CreateEthernetCard("vmxnet3", backing)
+	if err != nil {
+		return fmt.Errorf("couldn't create network device: %v", err)
+	}
+
+	return vm.AddDevice(a.ctx, device)
+}
+
+// SeparatePrivateNetwork reports whether VMs get a second network
+// interface for their private address.
+func (a *API) SeparatePrivateNetwork() bool {
+	return a.options.PrivateNetwork != ""
+}
+
 func (a *API) GetConsoleOutput(name string) (string, error) {
-	defaults, err := a.getServerDefaults()
+	resources, err := a.getServerResources()
 	if err != nil {
-		return "", fmt.Errorf("couldn't get server defaults: %v", err)
+		return "", fmt.Errorf("couldn't get server resources: %v", err)
 	}
 
 	uri := fmt.Sprintf("%s/serial.out", name)
 
 	p := soap.DefaultDownload
 
-	f, _, err := defaults.datastore.Download(a.ctx, uri, &p)
+	f, _, err := resources.datastore.Download(a.ctx, uri, &p)
 	if err != nil {
 		return "", fmt.Errorf("couldn't download console logs: %v", err)
 	}
@@ -318,17 +392,17 @@ func (a *API) GetConsoleOutput(name string) (string, error) {
 }
 
 func (a *API) CleanupDevice(name string) error {
-	defaults, err := a.getServerDefaults()
+	resources, err := a.getServerResources()
 	if err != nil {
-		return fmt.Errorf("couldn't get server defaults: %v", err)
+		return fmt.Errorf("couldn't get server resources: %v", err)
 	}
 
-	_, err = defaults.finder.VirtualMachine(a.ctx, name)
+	_, err = resources.finder.VirtualMachine(a.ctx, name)
 	if err == nil {
 		return fmt.Errorf("VM still exists")
 	}
 
-	fm := defaults.datastore.NewFileManager(defaults.datacenter, true)
+	fm := resources.datastore.NewFileManager(resources.datacenter, true)
 
 	// Remove the serial.out file
 	uri := fmt.Sprintf("%s/serial.out", name)
@@ -353,16 +427,12 @@ func (a *API) CreateDevice(name string, conf *conf.Conf, ips *IpPair) (*ESXMachi
 
 	userdata := base64.StdEncoding.EncodeToString(conf.Bytes())
 
-	defaults, err := a.getServerDefaults()
+	resources, err := a.getServerResources()
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get server defaults: %v", err)
+		return nil, fmt.Errorf("couldn't get server resources: %v", err)
 	}
 
-	folders, err := defaults.datacenter.Folders(a.ctx)
-	if err != nil {
-		return nil, fmt.Errorf("getting datacenter folders: %v", err)
-	}
-	folder := folders.VmFolder
+	folder := resources.folder
 
 	var vm *object.VirtualMachine
 	defer func() {
@@ -373,12 +443,12 @@ func (a *API) CreateDevice(name string, conf *conf.Conf, ips *IpPair) (*ESXMachi
 	}()
 	if a.options.OvaPath != "" {
 		plog.Debugf("Uploading image from %q", a.options.OvaPath)
-		arch, cisr, err := a.buildCreateImportSpecRequest(name, a.options.OvaPath, defaults.finder, defaults.network, defaults.resourcePool, defaults.datastore)
+		arch, cisr, err := a.buildCreateImportSpecRequest(name, a.options.OvaPath, resources.finder, resources.network, resources.resourcePool, resources.datastore)
 		if err != nil {
 			return nil, fmt.Errorf("building CreateImportSpecRequest: %v", err)
 		}
 
-		entity, err := a.uploadToResourcePool(arch, defaults.resourcePool, cisr, folder)
+		entity, err := a.uploadToResourcePool(arch, resources.resourcePool, cisr, folder)
 		if err != nil {
 			return nil, fmt.Errorf("uploading disks to ResourcePool: %v", err)
 		}
@@ -397,12 +467,12 @@ func (a *API) CreateDevice(name string, conf *conf.Conf, ips *IpPair) (*ESXMachi
 			return nil, fmt.Errorf("setting guestinfo encoding variable: %v", err)
 		}
 	} else {
-		baseVM, err := defaults.finder.VirtualMachine(a.ctx, a.options.BaseVMName)
+		baseVM, err := resources.finder.VirtualMachine(a.ctx, a.options.BaseVMName)
 		if err != nil {
 			return nil, fmt.Errorf("couldn't find base VM: %v", err)
 		}
 
-		cloneSpec, err := a.buildCloneSpec(baseVM, folder, defaults.network, defaults.resourcePool, defaults.datastore, userdata)
+		cloneSpec, err := a.buildCloneSpec(baseVM, folder, resources.network, resources.resourcePool, resources.datastore, userdata)
 		if err != nil {
 			return nil, fmt.Errorf("failed building clone spec: %v", err)
 		}
@@ -417,7 +487,7 @@ func (a *API) CreateDevice(name string, conf *conf.Conf, ips *IpPair) (*ESXMachi
 			return nil, fmt.Errorf("clone base VM operation failed: %v", err)
 		}
 
-		vm, err = defaults.finder.VirtualMachine(a.ctx, name)
+		vm, err = resources.finder.VirtualMachine(a.ctx, name)
 		if err != nil {
 			return nil, fmt.Errorf("couldn't find cloned VM: %v", err)
 		}
@@ -428,73 +498,19 @@ func (a *API) CreateDevice(name string, conf *conf.Conf, ips *IpPair) (*ESXMachi
 		}
 	}
 
-	if ips != nil {
-		err = a.updateGuestVariable(vm, "guestinfo.dns.server.0", "1.1.1.1")
-		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
-		}
-
-		err = a.updateGuestVariable(vm, "guestinfo.dns.server.1", "1.0.0.1")
-		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
-		}
-
-		err = a.updateGuestVariable(vm, "guestinfo.interface.0.role", "public")
-		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
-		}
-
-		err = a.updateGuestVariable(vm, "guestinfo.interface.0.name", "ens192")
-		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
-		}
-
-		err = a.updateGuestVariable(vm, "guestinfo.interface.0.ip.0.address", fmt.Sprintf("%s/%d", ips.Public, ips.SubnetSize))
-		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
-		}
-
-		err = a.updateGuestVariable(vm, "guestinfo.interface.0.route.0.destination", "0.0.0.0/0")
-		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
-		}
-
-		err = a.updateGuestVariable(vm, "guestinfo.interface.0.route.0.gateway", fmt.Sprintf("%s", ips.PublicGw))
-		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
-		}
-
-		err = a.updateGuestVariable(vm, "guestinfo.interface.0.ip.1.address", fmt.Sprintf("%s/%d", ips.Private, ips.SubnetSize))
-		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
-		}
-
-		err = a.updateGuestVariable(vm, "guestinfo.interface.0.route.1.destination", "10.0.0.0/8")
+	if resources.privateNetwork != nil {
+		plog.Debugf("Adding private network device")
+		err = a.addNetworkDevice(vm, resources.privateNetwork)
 		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
-		}
-
-		err = a.updateGuestVariable(vm, "guestinfo.interface.0.route.1.gateway", fmt.Sprintf("%s", ips.PrivateGw))
-		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
-		}
-
-		// Begin of hack to propagate private IP to metadata because "role" is per interface, not address:
-		err = a.updateGuestVariable(vm, "guestinfo.interface.1.role", "private")
-		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
-		}
-
-		err = a.updateGuestVariable(vm, "guestinfo.interface.1.name", "invalid")
-		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
+			return nil, fmt.Errorf("adding private network device: %v", err)
 		}
+	}
 
-		err = a.updateGuestVariable(vm, "guestinfo.interface.1.ip.0.address", fmt.Sprintf("%s/%d", ips.Private, ips.SubnetSize))
+	if ips != nil {
+		err = a.updateGuestVariables(vm, guestNetworkVariables(guestInterfaces(ips, resources.privateNetwork != nil)))
 		if err != nil {
-			return nil, fmt.Errorf("setting guestinfo variable: %v", err)
+			return nil, fmt.Errorf("setting guestinfo network variables: %v", err)
 		}
-		// End of hack
 	}
 
 	plog.Debugf("Setting memory to 2 GiB")
@@ -531,23 +547,17 @@ func (a *API) CreateBaseDevice(name, ovaPath string) error {
 		return fmt.Errorf("ova path cannot be empty")
 	}
 
-	defaults, err := a.getServerDefaults()
+	resources, err := a.getServerResources()
 	if err != nil {
-		return fmt.Errorf("getting ESX defaults: %v", err)
+		return fmt.Errorf("getting ESX resources: %v", err)
 	}
 
-	arch, cisr, err := a.buildCreateImportSpecRequest(name, ovaPath, defaults.finder, defaults.network, defaults.resourcePool, defaults.datastore)
+	arch, cisr, err := a.buildCreateImportSpecRequest(name, ovaPath, resources.finder, resources.network, resources.resourcePool, resources.datastore)
 	if err != nil {
 		return fmt.Errorf("building CreateImportSpecRequest: %v", err)
 	}
 
-	folders, err := defaults.datacenter.Folders(a.ctx)
-	if err != nil {
-		return fmt.Errorf("getting datacenter folders: %v", err)
-	}
-	folder := folders.VmFolder
-
-	entity, err := a.uploadToResourcePool(arch, defaults.resourcePool, cisr, folder)
+	entity, err := a.uploadToResourcePool(arch, resources.resourcePool, cisr, resources.folder)
 	if err != nil {
 		return fmt.Errorf("uploading disks to ResourcePool: %v", err)
 	}
@@ -559,13 +569,34 @@ func (a *API) CreateBaseDevice(name, ovaPath string) error {
 	return nil
 }
 
+// CreateBaseSnapshot snapshots the powered off base VM name so that it
+// can be used as the parent of linked clones.
+func (a *API) CreateBaseSnapshot(name, snapshot string) error {
+	resources, err := a.getServerResources()
+	if err != nil {
+		return fmt.Errorf("getting ESX resources: %v", err)
+	}
+
+	vm, err := resources.finder.VirtualMachine(a.ctx, name)
+	if err != nil {
+		return fmt.Errorf("couldn't find base VM: %v", err)
+	}
+
+	task, err := vm.CreateSnapshot(a.ctx, snapshot, "mantle linked clone base", false, false)
+	if err != nil {
+		return fmt.Errorf("creating snapshot: %v", err)
+	}
+
+	return task.Wait(a.ctx)
+}
+
 func (a *API) GetDevices(pattern string) ([]string, error) {
-	defaults, err := a.getServerDefaults()
+	resources, err := a.getServerResources()
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get server defaults: %v", err)
+		return nil, fmt.Errorf("couldn't get server resources: %v", err)
 	}
 
-	vms, err := defaults.finder.VirtualMachineList(a.ctx, pattern)
+	vms, err := resources.finder.VirtualMachineList(a.ctx, pattern)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't list VMs: %v", err)
 	}
@@ -579,12 +610,12 @@ func (a *API) GetDevices(pattern string) ([]string, error) {
 }
 
 func (a *API) TerminateDevice(name string) error {
-	defaults, err := a.getServerDefaults()
+	resources, err := a.getServerResources()
 	if err != nil {
-		return fmt.Errorf("couldn't get server defaults: %v", err)
+		return fmt.Errorf("couldn't get server resources: %v", err)
 	}
 
-	vm, err := defaults.finder.VirtualMachine(a.ctx, name)
+	vm, err := resources.finder.VirtualMachine(a.ctx, name)
 	if err != nil {
 		return fmt.Errorf("couldn't find VM: %v", err)
 	}
@@ -646,33 +677,73 @@ func (a *API) buildCreateImportSpecRequest(name string, ovaPath string, finder *
 	return arch, cisr, nil
 }
 
-func (a *API) getServerDefaults() (serverResources, error) {
+// getServerResources looks up the inventory objects selected by the
+// options, falling back to the defaults of a single ESXi host.
+func (a *API) getServerResources() (serverResources, error) {
 	finder := find.NewFinder(a.client.Client, true)
-	datacenter, err := finder.DefaultDatacenter(a.ctx)
+	datacenter, err := finder.DatacenterOrDefault(a.ctx, a.options.Datacenter)
 	if err != nil {
-		return serverResources{}, err
+		return serverResources{}, fmt.Errorf("finding datacenter: %v", err)
 	}
 	finder.SetDatacenter(datacenter)
-	resourcePool, err := finder.DefaultResourcePool(a.ctx)
-	if err != nil {
-		return serverResources{}, err
+
+	var resourcePool *object.ResourcePool
+	if a.options.ResourcePool == "" && a.options.Cluster != "" {
+		cluster, err := finder.ClusterComputeResource(a.ctx, a.options.Cluster)
+		if err != nil {
+			return serverResources{}, fmt.Errorf("finding cluster: %v", err)
+		}
+		resourcePool, err = cluster.ResourcePool(a.ctx)
+		if err != nil {
+			return serverResources{}, fmt.Errorf("getting cluster resource pool: %v", err)
+		}
+	} else {
+		resourcePool, err = finder.ResourcePoolOrDefault(a.ctx, a.options.ResourcePool)
+		if err != nil {
+			return serverResources{}, fmt.Errorf("finding resource pool: %v", err)
+		}
 	}
-	datastore, err := finder.DefaultDatastore(a.ctx)
+
+	datastore, err := finder.DatastoreOrDefault(a.ctx, a.options.Datastore)
 	if err != nil {
-		return serverResources{}, err
+		return serverResources{}, fmt.Errorf("finding datastore: %v", err)
 	}
 
-	defaultNetwork, err := finder.DefaultNetwork(a.ctx)
+	var folder *object.Folder
+	if a.options.Folder != "" {
+		folder, err = finder.Folder(a.ctx, a.options.Folder)
+		if err != nil {
+			return serverResources{}, fmt.Errorf("finding folder: %v", err)
+		}
+	} else {
+		folders, err := datacenter.Folders(a.ctx)
+		if err != nil {
+			return serverResources{}, fmt.Errorf("getting datacenter folders: %v", err)
+		}
+		folder = folders.VmFolder
+	}
+
+	network, err := finder.NetworkOrDefault(a.ctx, a.options.Network)
 	if err != nil {
-		return serverResources{}, err
+		return serverResources{}, fmt.Errorf("finding network: %v", err)
+	}
+
+	var privateNetwork object.NetworkReference
+	if a.options.PrivateNetwork != "" {
+		privateNetwork, err = finder.Network(a.ctx, a.options.PrivateNetwork)
+		if err != nil {
+			return serverResources{}, fmt.Errorf("finding private network: %v", err)
+		}
 	}
 
 	return serverResources{
-		finder:       finder,
-		datacenter:   datacenter,
-		resourcePool: resourcePool,
-		datastore:    datastore,
-		network:      defaultNetwork,
+		finder:         finder,
+		datacenter:     datacenter,
+		resourcePool:   resourcePool,
+		datastore:      datastore,
+		folder:         folder,
+		network:        network,
+		privateNetwork: privateNetwork,
 	}, nil
 }
 
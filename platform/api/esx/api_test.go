@@ -0,0 +1,197 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package esx
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmware/govmomi/simulator"
+	"github.com/vmware/govmomi/vapi/library"
+	"github.com/vmware/govmomi/vapi/rest"
+	_ "github.com/vmware/govmomi/vapi/simulator"
+	"github.com/vmware/govmomi/vim25/types"
+
+	"github.com/flatcar-linux/mantle/platform"
+)
+
+// newTestAPI creates an API for a vcsim server simulating model.
+func newTestAPI(t *testing.T, model *simulator.Model, opts Options) *API {
+	require.NoError(t, model.Create())
+	t.Cleanup(model.Remove)
+	model.Service.TLS = new(tls.Config)
+	model.Service.RegisterEndpoints = true
+	server := model.Service.NewServer()
+	t.Cleanup(server.Close)
+
+	opts.Options = &platform.Options{}
+	opts.Server = server.URL.Host
+	opts.User = server.URL.User.Username()
+	opts.Password, _ = server.URL.User.Password()
+	api, err := New(&opts)
+	require.NoError(t, err)
+	require.NoError(t, api.PreflightCheck())
+	return api
+}
+
+func TestPlacement(t *testing.T) {
+	model := simulator.VPX()
+	model.Datastore = 2
+	api := newTestAPI(t, model, Options{Cluster: "DC0_C0", Network: "VM Network", Datastore: "LocalDS_1"})
+
+	resources, err := api.getServerResources()
+	require.NoError(t, err)
+	pool, err := resources.finder.ResourcePool(api.ctx, "DC0_C0/Resources")
+	require.NoError(t, err)
+	assert.Equal(t, pool.Reference(), resources.resourcePool.Reference())
+	assert.Equal(t, "LocalDS_1", resources.datastore.Name())
+	assert.Equal(t, "/DC0/vm", resources.folder.InventoryPath)
+	assert.Nil(t, resources.privateNetwork)
+
+	// the defaults are ambiguous with several datastores and pools
+	api.options.Datastore = ""
+	_, err = api.getServerResources()
+	assert.Error(t, err)
+	api.options.Datastore = "LocalDS_1"
+	api.options.Cluster = ""
+	_, err = api.getServerResources()
+	assert.Error(t, err)
+}
+
+func TestLinkedClone(t *testing.T) {
+	model := simulator.VPX()
+	model.Datastore = 2
+	api := newTestAPI(t, model, Options{
+		Cluster:      "DC0_C0",
+		Network:      "VM Network",
+		Datastore:    "LocalDS_1",
+		BaseVMName:   "DC0_C0_RP0_VM0",
+		BaseSnapshot: "base",
+	})
+	require.NoError(t, api.CreateBaseSnapshot("DC0_C0_RP0_VM0", "base"))
+
+	resources, err := api.getServerResources()
+	require.NoError(t, err)
+	baseVM, err := resources.finder.VirtualMachine(api.ctx, "DC0_C0_RP0_VM0")
+	require.NoError(t, err)
+	spec, err := api.buildCloneSpec(baseVM, resources.folder, resources.network, resources.resourcePool, resources.datastore, "")
+	require.NoError(t, err)
+	require.NotNil(t, spec.Snapshot)
+	assert.Equal(t, string(types.VirtualMachineRelocateDiskMoveOptionsCreateNewChildDiskBacking), spec.Location.DiskMoveType)
+	require.NotNil(t, spec.Location.Datastore)
+	assert.Equal(t, resources.datastore.Reference(), *spec.Location.Datastore)
+
+	task, err := baseVM.Clone(api.ctx, resources.folder, "kola-1", *spec)
+	require.NoError(t, err)
+	require.NoError(t, task.Wait(api.ctx))
+	_, err = resources.finder.VirtualMachine(api.ctx, "kola-1")
+	assert.NoError(t, err)
+
+	api.options.BaseSnapshot = "missing"
+	_, err = api.buildCloneSpec(baseVM, resources.folder, resources.network, resources.resourcePool, resources.datastore, "")
+	assert.Error(t, err)
+}
+
+func TestPrivateNetwork(t *testing.T) {
+	api := newTestAPI(t, simulator.VPX(), Options{Cluster: "DC0_C0", Network: "VM Network", PrivateNetwork: "DC0_DVPG0"})
+	assert.True(t, api.SeparatePrivateNetwork())
+
+	resources, err := api.getServerResources()
+	require.NoError(t, err)
+	require.NotNil(t, resources.privateNetwork)
+	vm, err := resources.finder.VirtualMachine(api.ctx, "DC0_C0_RP0_VM0")
+	require.NoError(t, err)
+	require.NoError(t, api.addNetworkDevice(vm, resources.privateNetwork))
+
+	devices, err := vm.Device(api.ctx)
+	require.NoError(t, err)
+	cards := devices.SelectByType((*types.VirtualEthernetCard)(nil))
+	require.Len(t, cards, 2)
+	require.IsType(t, &types.VirtualVmxnet3{}, cards[1])
+	backing, ok := cards[1].(types.BaseVirtualEthernetCard).GetVirtualEthernetCard().Backing.(*types.VirtualEthernetCardDistributedVirtualPortBackingInfo)
+	require.True(t, ok, "private NIC not on the distributed port group")
+	assert.Equal(t, resources.privateNetwork.Reference().Value, backing.Port.PortgroupKey)
+}
+
+// writeOVA writes an OVA with a descriptor referencing a single disk.
+func writeOVA(t *testing.T) string {
+	files := []struct{ name, body string }{
+		{"flatcar.ovf", `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1">
+  <References>
+    <File ovf:href="flatcar-disk1.vmdk" ovf:id="file1"/>
+  </References>
+</Envelope>
+`},
+		{"flatcar-disk1.vmdk", "disk"},
+	}
+
+	ovaPath := filepath.Join(t.TempDir(), "flatcar.ova")
+	f, err := os.Create(ovaPath)
+	require.NoError(t, err)
+	defer f.Close()
+	w := tar.NewWriter(f)
+	for _, file := range files {
+		require.NoError(t, w.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.body))}))
+		_, err := w.Write([]byte(file.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return ovaPath
+}
+
+func TestPublishOVA(t *testing.T) {
+	api := newTestAPI(t, simulator.VPX(), Options{Cluster: "DC0_C0", Network: "VM Network"})
+	ovaPath := writeOVA(t)
+
+	require.NoError(t, api.PublishOVA("kola", "flatcar-test", ovaPath))
+
+	ctx := context.Background()
+	rc := rest.NewClient(api.client.Client)
+	require.NoError(t, rc.Login(ctx, simulator.DefaultLogin))
+	m := library.NewManager(rc)
+	item := func() string {
+		libraries, err := m.FindLibrary(ctx, library.Find{Name: "kola"})
+		require.NoError(t, err)
+		require.Len(t, libraries, 1)
+		items, err := m.FindLibraryItems(ctx, library.FindItem{LibraryID: libraries[0], Name: "flatcar-test"})
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		return items[0]
+	}
+
+	id := item()
+	files, err := m.ListLibraryItemFiles(ctx, id)
+	require.NoError(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"flatcar-disk1.vmdk", "flatcar.ovf"}, names)
+
+	// publishing again updates the existing item
+	require.NoError(t, api.PublishOVA("kola", "flatcar-test", ovaPath))
+	assert.Equal(t, id, item())
+
+	assert.Error(t, api.PublishOVA("kola", "broken", filepath.Join(t.TempDir(), "missing.ova")))
+}
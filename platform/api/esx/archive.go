@@ -32,7 +32,8 @@ type archive struct {
 
 type archiveEntry struct {
 	io.Reader
-	f *os.File
+	f    *os.File
+	name string // base name of the matched file
 }
 
 func (t *archiveEntry) Close() error {
@@ -93,7 +94,7 @@ func (t *archive) open(pattern string) (io.ReadCloser, int64, error) {
 		}
 
 		if matched {
-			return &archiveEntry{r, f}, h.Size, nil
+			return &archiveEntry{r, f, path.Base(h.Name)}, h.Size, nil
 		}
 	}
 
@@ -0,0 +1,151 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package esx
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const (
+	// PublicInterface is the guest name of the first VM network
+	// interface, which carries the public address.
+	PublicInterface = "ens192"
+	// PrivateInterface is the guest name of the second VM network
+	// interface, which is added when a private network is configured.
+	PrivateInterface = "ens224"
+)
+
+var dnsServers = []string{"1.1.1.1", "1.0.0.1"}
+
+type guestRoute struct {
+	destination string
+	gateway     string
+}
+
+// guestInterface is the static configuration of one guest network
+// interface, as consumed from the guestinfo.interface.N.* variables.
+type guestInterface struct {
+	name      string
+	role      string
+	addresses []string
+	routes    []guestRoute
+}
+
+// guestInterfaces lays out the static addresses of ips over the guest
+// network interfaces. With separatePrivate the private address is put
+// on its own interface; otherwise both addresses share the public
+// interface and a placeholder interface carries the private role so
+// that it shows up in the guest's metadata.
+func guestInterfaces(ips *IpPair, separatePrivate bool) []guestInterface {
+	public := guestInterface{
+		name:      PublicInterface,
+		role:      "public",
+		addresses: []string{fmt.Sprintf("%s/%d", ips.Public, ips.SubnetSize)},
+		routes:    []guestRoute{{"0.0.0.0/0", ips.PublicGw.String()}},
+	}
+	private := guestInterface{
+		name:      PrivateInterface,
+		role:      "private",
+		addresses: []string{fmt.Sprintf("%s/%d", ips.Private, ips.SubnetSize)},
+		routes:    []guestRoute{{"10.0.0.0/8", ips.PrivateGw.String()}},
+	}
+	if separatePrivate {
+		return []guestInterface{public, private}
+	}
+
+	public.addresses = append(public.addresses, private.addresses...)
+	public.routes = append(public.routes, private.routes...)
+	// "role" is per interface, not per address.
+	private.name = "invalid"
+	private.routes = nil
+	return []guestInterface{public, private}
+}
+
+// guestNetworkVariables renders the guestinfo variables that configure
+// static networking for the given interfaces.
+func guestNetworkVariables(ifaces []guestInterface) map[string]string {
+	vars := make(map[string]string)
+	for i, dns := range dnsServers {
+		vars[fmt.Sprintf("guestinfo.dns.server.%d", i)] = dns
+	}
+	for i, iface := range ifaces {
+		prefix := fmt.Sprintf("guestinfo.interface.%d", i)
+		vars[prefix+".name"] = iface.name
+		vars[prefix+".role"] = iface.role
+		for j, addr := range iface.addresses {
+			vars[fmt.Sprintf("%s.ip.%d.address", prefix, j)] = addr
+		}
+		for j, route := range iface.routes {
+			vars[fmt.Sprintf("%s.route.%d.destination", prefix, j)] = route.destination
+			vars[fmt.Sprintf("%s.route.%d.gateway", prefix, j)] = route.gateway
+		}
+	}
+	return vars
+}
+
+// NetworkdConfig renders systemd-networkd units equivalent to the
+// guestinfo static network configuration, keyed by file name, for
+// Ignition configs which don't go through cloud-init.
+func NetworkdConfig(ips *IpPair, separatePrivate bool) map[string]string {
+	ret := make(map[string]string)
+	for i, iface := range guestInterfaces(ips, separatePrivate) {
+		if iface.name == "invalid" {
+			continue
+		}
+		unit := fmt.Sprintf("[Match]\nVirtualization=vmware\nName=%s\n\n[Network]\nDHCP=no\n", iface.name)
+		if i == 0 {
+			for _, dns := range dnsServers {
+				unit += fmt.Sprintf("DNS=%s\n", dns)
+			}
+		}
+		for _, addr := range iface.addresses {
+			unit += fmt.Sprintf("\n[Address]\nAddress=%s\n", addr)
+		}
+		for _, route := range iface.routes {
+			unit += fmt.Sprintf("\n[Route]\nDestination=%s\nGateway=%s\n", route.destination, route.gateway)
+		}
+		ret[fmt.Sprintf("/etc/systemd/network/%02d-vmware.network", i)] = unit
+	}
+	return ret
+}
+
+func (a *API) updateGuestVariables(vm *object.VirtualMachine, vars map[string]string) error {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var config []types.BaseOptionValue
+	for _, key := range keys {
+		config = append(config, &types.OptionValue{
+			Key:   key,
+			Value: vars[key],
+		})
+	}
+
+	task, err := vm.Reconfigure(a.ctx, types.VirtualMachineConfigSpec{
+		ExtraConfig: config,
+	})
+	if err != nil {
+		return err
+	}
+
+	return task.Wait(a.ctx)
+}
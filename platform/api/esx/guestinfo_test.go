@@ -0,0 +1,112 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package esx
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testIPs = IpPair{
+	Public:     net.ParseIP("198.51.100.10"),
+	Private:    net.ParseIP("10.1.0.10"),
+	PublicGw:   net.ParseIP("198.51.100.1"),
+	PrivateGw:  net.ParseIP("10.1.0.1"),
+	SubnetSize: 24,
+}
+
+func TestGuestNetworkVariablesShared(t *testing.T) {
+	vars := guestNetworkVariables(guestInterfaces(&testIPs, false))
+	assert.Equal(t, map[string]string{
+		"guestinfo.dns.server.0":                    "1.1.1.1",
+		"guestinfo.dns.server.1":                    "1.0.0.1",
+		"guestinfo.interface.0.name":                "ens192",
+		"guestinfo.interface.0.role":                "public",
+		"guestinfo.interface.0.ip.0.address":        "198.51.100.10/24",
+		"guestinfo.interface.0.ip.1.address":        "10.1.0.10/24",
+		"guestinfo.interface.0.route.0.destination": "0.0.0.0/0",
+		"guestinfo.interface.0.route.0.gateway":     "198.51.100.1",
+		"guestinfo.interface.0.route.1.destination": "10.0.0.0/8",
+		"guestinfo.interface.0.route.1.gateway":     "10.1.0.1",
+		"guestinfo.interface.1.name":                "invalid",
+		"guestinfo.interface.1.role":                "private",
+		"guestinfo.interface.1.ip.0.address":        "10.1.0.10/24",
+	}, vars)
+}
+
+func TestGuestNetworkVariablesSeparate(t *testing.T) {
+	vars := guestNetworkVariables(guestInterfaces(&testIPs, true))
+	assert.Equal(t, map[string]string{
+		"guestinfo.dns.server.0":                    "1.1.1.1",
+		"guestinfo.dns.server.1":                    "1.0.0.1",
+		"guestinfo.interface.0.name":                "ens192",
+		"guestinfo.interface.0.role":                "public",
+		"guestinfo.interface.0.ip.0.address":        "198.51.100.10/24",
+		"guestinfo.interface.0.route.0.destination": "0.0.0.0/0",
+		"guestinfo.interface.0.route.0.gateway":     "198.51.100.1",
+		"guestinfo.interface.1.name":                "ens224",
+		"guestinfo.interface.1.role":                "private",
+		"guestinfo.interface.1.ip.0.address":        "10.1.0.10/24",
+		"guestinfo.interface.1.route.0.destination": "10.0.0.0/8",
+		"guestinfo.interface.1.route.0.gateway":     "10.1.0.1",
+	}, vars)
+}
+
+func TestNetworkdConfig(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"/etc/systemd/network/00-vmware.network": `[Match]
+Virtualization=vmware
+Name=ens192
+
+[Network]
+DHCP=no
+DNS=1.1.1.1
+DNS=1.0.0.1
+
+[Address]
+Address=198.51.100.10/24
+
+[Address]
+Address=10.1.0.10/24
+
+[Route]
+Destination=0.0.0.0/0
+Gateway=198.51.100.1
+
+[Route]
+Destination=10.0.0.0/8
+Gateway=10.1.0.1
+`,
+	}, NetworkdConfig(&testIPs, false))
+
+	units := NetworkdConfig(&testIPs, true)
+	assert.Len(t, units, 2)
+	assert.Equal(t, `[Match]
+Virtualization=vmware
+Name=ens224
+
+[Network]
+DHCP=no
+
+[Address]
+Address=10.1.0.10/24
+
+[Route]
+Destination=10.0.0.0/8
+Gateway=10.1.0.1
+`, units["/etc/systemd/network/01-vmware.network"])
+}
@@ -0,0 +1,181 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package esx
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vapi/library"
+	"github.com/vmware/govmomi/vapi/rest"
+	"github.com/vmware/govmomi/vim25/soap"
+)
+
+// PublishOVA uploads the OVA at ovaPath as the item name of the vCenter
+// content library libraryName, from which VMs can then be deployed. A
+// missing library is created on the selected datastore, and the files of
+// an existing item are replaced.
+func (a *API) PublishOVA(libraryName, name, ovaPath string) error {
+	resources, err := a.getServerResources()
+	if err != nil {
+		return fmt.Errorf("getting ESX resources: %v", err)
+	}
+
+	rc := rest.NewClient(a.client.Client)
+	err = rc.Login(a.ctx, url.UserPassword(a.options.User, a.options.Password))
+	if err != nil {
+		return fmt.Errorf("logging in to vCenter REST API: %v", err)
+	}
+	defer rc.Logout(a.ctx)
+
+	m := library.NewManager(rc)
+	libraryID, err := a.libraryID(m, libraryName, resources.datastore)
+	if err != nil {
+		return err
+	}
+	itemID, err := a.libraryItemID(m, libraryID, name)
+	if err != nil {
+		return err
+	}
+
+	session, err := m.CreateLibraryItemUpdateSession(a.ctx, library.Session{
+		LibraryItemID: itemID,
+	})
+	if err != nil {
+		return fmt.Errorf("creating library update session: %v", err)
+	}
+
+	err = a.uploadLibraryFiles(m, session, &archive{ovaPath})
+	if err != nil {
+		_ = m.CancelLibraryItemUpdateSession(a.ctx, session)
+		return err
+	}
+
+	err = m.CompleteLibraryItemUpdateSession(a.ctx, session)
+	if err != nil {
+		return fmt.Errorf("completing library update session: %v", err)
+	}
+	return nil
+}
+
+// libraryID returns the ID of the local content library name, creating it
+// on datastore if it doesn't exist.
+func (a *API) libraryID(m *library.Manager, name string, datastore *object.Datastore) (string, error) {
+	ids, err := m.FindLibrary(a.ctx, library.Find{Name: name})
+	if err != nil {
+		return "", fmt.Errorf("finding content library: %v", err)
+	}
+	switch len(ids) {
+	case 0:
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("found %d content libraries named %q", len(ids), name)
+	}
+
+	plog.Infof("Creating content library %q", name)
+	id, err := m.CreateLibrary(a.ctx, library.Library{
+		Name: name,
+		Type: "LOCAL",
+		Storage: []library.StorageBackings{{
+			DatastoreID: datastore.Reference().Value,
+			Type:        "DATASTORE",
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating content library: %v", err)
+	}
+	return id, nil
+}
+
+// libraryItemID returns the ID of the OVF item name in the library,
+// creating it if it doesn't exist.
+func (a *API) libraryItemID(m *library.Manager, libraryID, name string) (string, error) {
+	ids, err := m.FindLibraryItems(a.ctx, library.FindItem{
+		LibraryID: libraryID,
+		Name:      name,
+	})
+	if err != nil {
+		return "", fmt.Errorf("finding library item: %v", err)
+	}
+	if len(ids) > 0 {
+		return ids[0], nil
+	}
+
+	id, err := m.CreateLibraryItem(a.ctx, library.Item{
+		LibraryID: libraryID,
+		Name:      name,
+		Type:      library.ItemTypeOVF,
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating library item: %v", err)
+	}
+	return id, nil
+}
+
+// uploadLibraryFiles pushes the OVF descriptor of arch and the files it
+// references in an update session.
+func (a *API) uploadLibraryFiles(m *library.Manager, session string, arch *archive) error {
+	envelope, err := arch.readEnvelope("*.ovf")
+	if err != nil {
+		return fmt.Errorf("reading envelope: %v", err)
+	}
+
+	patterns := []string{"*.ovf"}
+	for _, ref := range envelope.References {
+		patterns = append(patterns, ref.Href)
+	}
+	for _, pattern := range patterns {
+		if err := a.uploadLibraryFile(m, session, arch, pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *API) uploadLibraryFile(m *library.Manager, session string, arch *archive, pattern string) error {
+	r, size, err := arch.open(pattern)
+	if err != nil {
+		return fmt.Errorf("opening %s in OVA: %v", pattern, err)
+	}
+	defer r.Close()
+	name := r.(*archiveEntry).name
+
+	update, err := m.AddLibraryItemFile(a.ctx, session, library.UpdateFile{
+		Name:       name,
+		SourceType: "PUSH",
+		Size:       size,
+	})
+	if err != nil {
+		return fmt.Errorf("adding library file %s: %v", name, err)
+	}
+
+	u, err := url.Parse(update.UploadEndpoint.URI)
+	if err != nil {
+		return fmt.Errorf("parsing upload URL of %s: %v", name, err)
+	}
+	p := soap.DefaultUpload
+	p.Headers = map[string]string{
+		"vmware-api-session-id": session,
+	}
+	p.ContentLength = size
+
+	plog.Infof("Uploading %s to content library", name)
+	if err := m.Upload(a.ctx, r, u, &p); err != nil {
+		return fmt.Errorf("uploading %s: %v", name, err)
+	}
+	return nil
+}
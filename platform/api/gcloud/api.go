@@ -42,6 +42,9 @@ type Options struct {
 	Network     string
 	JSONKeyFile string
 	ServiceAuth bool
+	// Endpoint is the compute API root URL, for testing against a
+	// fake server. Requests to it are not authenticated.
+	Endpoint string
 	*platform.Options
 }
 
@@ -70,7 +73,9 @@ func New(opts *Options) (*API, error) {
 		err    error
 	)
 
-	if opts.ServiceAuth {
+	if opts.Endpoint != "" {
+		client = http.DefaultClient
+	} else if opts.ServiceAuth {
 		client = auth.GoogleServiceClient()
 	} else if opts.JSONKeyFile != "" {
 		b, err := ioutil.ReadFile(opts.JSONKeyFile)
@@ -90,6 +95,9 @@ func New(opts *Options) (*API, error) {
 	if err != nil {
 		return nil, err
 	}
+	if opts.Endpoint != "" {
+		capi.BasePath = strings.TrimSuffix(opts.Endpoint, "/") + "/projects/"
+	}
 
 	api := &API{
 		client:  client,
@@ -0,0 +1,152 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/gcloud/fake"
+	"github.com/flatcar-linux/mantle/platform/inventory"
+	"github.com/flatcar-linux/mantle/platform/inventory/inventorytest"
+)
+
+const (
+	project = "mantle-test"
+	zone    = "us-central1-a"
+)
+
+func newTestAPI(t *testing.T) (*API, *fake.Server) {
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+
+	api, err := New(&Options{
+		Image:       "flatcar",
+		Project:     project,
+		Zone:        zone,
+		MachineType: "n1-standard-1",
+		DiskType:    "pd-ssd",
+		Network:     "default",
+		Endpoint:    server.URL,
+		Options:     &platform.Options{BaseName: "kola"},
+	})
+	require.NoError(t, err)
+	return api, server
+}
+
+func mantleMetadata() *compute.Metadata {
+	mantle := "mantle"
+	return &compute.Metadata{
+		Items: []*compute.MetadataItems{{Key: "created-by", Value: &mantle}},
+	}
+}
+
+func TestInstances(t *testing.T) {
+	api, server := newTestAPI(t)
+
+	inst, err := api.CreateInstance("#cloud-config", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "RUNNING", inst.Status)
+	intIP, extIP := InstanceIPs(inst)
+	assert.NotEmpty(t, intIP)
+	assert.NotEmpty(t, extIP)
+	assert.True(t, createdByMantle(inst))
+
+	server.SetSerialPortOutput(project, zone, inst.Name, "login:")
+	out, err := api.GetConsoleOutput(inst.Name)
+	require.NoError(t, err)
+	assert.Equal(t, "login:", out)
+
+	server.AddInstance(project, zone, compute.Instance{Name: "other"})
+	list, err := api.ListInstances("kola-")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, inst.Name, list[0].Name)
+
+	require.NoError(t, api.TerminateInstance(inst.Name))
+	require.Len(t, server.Instances(), 1)
+	assert.Error(t, api.TerminateInstance(inst.Name))
+}
+
+func TestGC(t *testing.T) {
+	api, server := newTestAPI(t)
+	old := time.Now().Add(-6 * time.Hour).UTC().Format(time.RFC3339)
+	server.AddInstance(project, zone, compute.Instance{Name: "old", Metadata: mantleMetadata(), CreationTimestamp: old})
+	server.AddInstance(project, zone, compute.Instance{Name: "new", Metadata: mantleMetadata()})
+	server.AddInstance(project, zone, compute.Instance{Name: "stopped", Metadata: mantleMetadata(), CreationTimestamp: old, Status: "TERMINATED"})
+	server.AddInstance(project, zone, compute.Instance{Name: "other", CreationTimestamp: old})
+
+	require.NoError(t, api.GC(5*time.Hour))
+
+	var names []string
+	for _, inst := range server.Instances() {
+		names = append(names, inst.Name)
+	}
+	assert.Equal(t, []string{"new", "other", "stopped"}, names)
+}
+
+func TestImages(t *testing.T) {
+	api, server := newTestAPI(t)
+	spec := &ImageSpec{
+		Name:        "flatcar-1",
+		SourceImage: "https://storage.googleapis.com/bucket/flatcar.tar.gz",
+		Licenses:    []string{"flatcar"},
+	}
+
+	_, pending, err := api.CreateImage(spec, false)
+	require.NoError(t, err)
+	require.NoError(t, pending.Wait())
+	_, _, err = api.CreateImage(spec, false)
+	assert.Error(t, err)
+	_, pending, err = api.CreateImage(spec, true)
+	require.NoError(t, err)
+	require.NoError(t, pending.Wait())
+
+	images, err := api.ListImages(context.Background(), "flatcar-")
+	require.NoError(t, err)
+	require.Len(t, images, 1)
+	assert.Equal(t, []string{server.URL + "/projects/" + project + "/global/licenses/flatcar"}, images[0].Licenses)
+	pending, err = api.GetPendingForImage(images[0])
+	require.NoError(t, err)
+	require.NoError(t, pending.Wait())
+
+	pending, err = api.DeprecateImage("flatcar-1", DeprecationStateDeprecated, "")
+	require.NoError(t, err)
+	require.NoError(t, pending.Wait())
+	assert.Equal(t, "DEPRECATED", server.Images()[0].Deprecated.State)
+
+	pending, err = api.DeleteImage("flatcar-1")
+	require.NoError(t, err)
+	require.NoError(t, pending.Wait())
+	assert.Empty(t, server.Images())
+}
+
+func TestInventory(t *testing.T) {
+	api, server := newTestAPI(t)
+	server.AddInstance(project, zone, compute.Instance{Name: "kola-1", Metadata: mantleMetadata()})
+	server.AddInstance(project, zone, compute.Instance{Name: "other"})
+
+	inventorytest.CheckProvider(t, api, []inventory.Resource{
+		{Cloud: "gcloud", Kind: inventory.KindInstance, ID: "kola-1", Name: "kola-1", Region: zone, Owner: project},
+	})
+	require.Len(t, server.Instances(), 1)
+	assert.Equal(t, "other", server.Instances()[0].Name)
+}
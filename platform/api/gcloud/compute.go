@@ -180,6 +180,20 @@ func InstanceIPs(inst *compute.Instance) (intIP, extIP string) {
 	return
 }
 
+// createdByMantle checks metadata because our vendored Go binding
+// doesn't support labels.
+func createdByMantle(instance *compute.Instance) bool {
+	if instance.Metadata == nil {
+		return false
+	}
+	for _, item := range instance.Metadata.Items {
+		if item.Key == "created-by" && item.Value != nil && *item.Value == "mantle" {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *API) gcInstances(gracePeriod time.Duration) error {
 	threshold := time.Now().Add(-gracePeriod)
 
@@ -188,19 +202,7 @@ func (a *API) gcInstances(gracePeriod time.Duration) error {
 		return err
 	}
 	for _, instance := range list.Items {
-		// check metadata because our vendored Go binding
-		// doesn't support labels
-		if instance.Metadata == nil {
-			continue
-		}
-		isMantle := false
-		for _, item := range instance.Metadata.Items {
-			if item.Key == "created-by" && item.Value != nil && *item.Value == "mantle" {
-				isMantle = true
-				break
-			}
-		}
-		if !isMantle {
+		if !createdByMantle(instance) {
 			continue
 		}
 
@@ -0,0 +1,346 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake implements an in-process fake of the subset of the
+// Google Compute Engine API used by mantle, for testing without
+// credentials.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// Server is a fake GCE API server. Operations complete immediately.
+// Pass its URL as the API endpoint.
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	nextID     uint64
+	instances  map[string]*compute.Instance
+	images     map[string]*compute.Image
+	operations map[string]*compute.Operation
+	serial     map[string]string
+}
+
+// NewServer starts a fake server; the caller must Close it.
+func NewServer() *Server {
+	s := &Server{
+		nextID:     1,
+		instances:  make(map[string]*compute.Instance),
+		images:     make(map[string]*compute.Image),
+		operations: make(map[string]*compute.Operation),
+		serial:     make(map[string]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *Server) id() uint64 {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+func (s *Server) selfLink(path string) string {
+	return s.URL + "/projects/" + path
+}
+
+// AddInstance adds an instance as if it had been created outside
+// mantle.
+func (s *Server) AddInstance(project, zone string, inst compute.Instance) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inst.Id = s.id()
+	inst.Zone = zone
+	inst.SelfLink = s.selfLink(fmt.Sprintf("%s/zones/%s/instances/%s", project, zone, inst.Name))
+	if inst.Status == "" {
+		inst.Status = "RUNNING"
+	}
+	if inst.CreationTimestamp == "" {
+		inst.CreationTimestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+	s.instances[project+"/"+zone+"/"+inst.Name] = &inst
+}
+
+// SetSerialPortOutput sets the console output of an instance.
+func (s *Server) SetSerialPortOutput(project, zone, name, output string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serial[project+"/"+zone+"/"+name] = output
+}
+
+// Instances returns the instances on the server, ordered by name.
+func (s *Server) Instances() []compute.Instance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []compute.Instance
+	for _, inst := range s.instances {
+		ret = append(ret, *inst)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// Images returns the images on the server, ordered by name.
+func (s *Server) Images() []compute.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []compute.Image
+	for _, image := range s.images {
+		ret = append(ret, *image)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, reason, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": msg,
+			"errors": []map[string]string{
+				{"reason": reason, "message": msg},
+			},
+		},
+	})
+}
+
+// operation records a completed operation on a resource.
+func (s *Server) operation(project, zone, opType, target string, targetID uint64) *compute.Operation {
+	op := &compute.Operation{
+		Id:            s.id(),
+		OperationType: opType,
+		Status:        "DONE",
+		TargetLink:    s.selfLink(target),
+		TargetId:      targetID,
+		Progress:      100,
+		Kind:          "compute#operation",
+	}
+	op.Name = fmt.Sprintf("operation-%d", op.Id)
+	if zone != "" {
+		op.Zone = zone
+		s.operations[project+"/"+zone+"/"+op.Name] = op
+	} else {
+		s.operations[project+"/"+op.Name] = op
+	}
+	return op
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 || parts[0] != "projects" {
+		writeError(w, http.StatusNotFound, "notFound", "no such path %q", r.URL.Path)
+		return
+	}
+	project := parts[1]
+
+	switch {
+	case parts[2] == "zones" && len(parts) >= 5 && parts[4] == "instances":
+		s.serveInstances(w, r, project, parts[3], parts[5:])
+	case parts[2] == "zones" && len(parts) == 6 && parts[4] == "operations" && r.Method == "GET":
+		if op, ok := s.operations[project+"/"+parts[3]+"/"+parts[5]]; ok {
+			writeJSON(w, http.StatusOK, op)
+		} else {
+			writeError(w, http.StatusNotFound, "notFound", "operation %s not found", parts[5])
+		}
+	case parts[2] == "global" && parts[3] == "images":
+		s.serveImages(w, r, project, parts[4:])
+	case parts[2] == "global" && parts[3] == "operations" && len(parts) == 5 && r.Method == "GET":
+		if op, ok := s.operations[project+"/"+parts[4]]; ok {
+			writeJSON(w, http.StatusOK, op)
+		} else {
+			writeError(w, http.StatusNotFound, "notFound", "operation %s not found", parts[4])
+		}
+	case parts[2] == "global" && parts[3] == "operations" && len(parts) == 4 && r.Method == "GET":
+		s.listGlobalOperations(w, r, project)
+	case parts[2] == "global" && parts[3] == "licenses" && len(parts) == 5 && r.Method == "GET":
+		writeJSON(w, http.StatusOK, &compute.License{
+			Name:     parts[4],
+			SelfLink: s.selfLink(project + "/global/licenses/" + parts[4]),
+		})
+	default:
+		writeError(w, http.StatusNotFound, "notFound", "unsupported request %s %s", r.Method, r.URL.Path)
+	}
+}
+
+func (s *Server) serveInstances(w http.ResponseWriter, r *http.Request, project, zone string, rest []string) {
+	prefix := project + "/" + zone + "/"
+	switch {
+	case len(rest) == 0 && r.Method == "GET":
+		list := &compute.InstanceList{Items: []*compute.Instance{}}
+		for key, inst := range s.instances {
+			if strings.HasPrefix(key, prefix) {
+				list.Items = append(list.Items, inst)
+			}
+		}
+		sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+		writeJSON(w, http.StatusOK, list)
+	case len(rest) == 0 && r.Method == "POST":
+		var inst compute.Instance
+		if err := json.NewDecoder(r.Body).Decode(&inst); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "%v", err)
+			return
+		}
+		if _, ok := s.instances[prefix+inst.Name]; ok {
+			writeError(w, http.StatusConflict, "alreadyExists", "instance %s already exists", inst.Name)
+			return
+		}
+		inst.Id = s.id()
+		inst.Zone = zone
+		inst.Status = "RUNNING"
+		inst.CreationTimestamp = time.Now().UTC().Format(time.RFC3339)
+		inst.SelfLink = s.selfLink(prefix + "instances/" + inst.Name)
+		for i, iface := range inst.NetworkInterfaces {
+			iface.NetworkIP = fmt.Sprintf("10.0.%d.%d", inst.Id/256, inst.Id%256)
+			for _, ac := range iface.AccessConfigs {
+				ac.NatIP = fmt.Sprintf("192.0.2.%d", (inst.Id+uint64(i))%256)
+			}
+		}
+		s.instances[prefix+inst.Name] = &inst
+		writeJSON(w, http.StatusOK, s.operation(project, zone, "insert", prefix+"instances/"+inst.Name, inst.Id))
+	case len(rest) >= 1:
+		inst, ok := s.instances[prefix+rest[0]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "notFound", "instance %s not found", rest[0])
+			return
+		}
+		switch {
+		case len(rest) == 1 && r.Method == "GET":
+			writeJSON(w, http.StatusOK, inst)
+		case len(rest) == 1 && r.Method == "DELETE":
+			delete(s.instances, prefix+rest[0])
+			writeJSON(w, http.StatusOK, s.operation(project, zone, "delete", prefix+"instances/"+rest[0], inst.Id))
+		case len(rest) == 2 && rest[1] == "serialPort" && r.Method == "GET":
+			writeJSON(w, http.StatusOK, &compute.SerialPortOutput{
+				Contents: s.serial[prefix+rest[0]],
+				SelfLink: inst.SelfLink + "/serialPort",
+			})
+		default:
+			writeError(w, http.StatusNotFound, "notFound", "unsupported request %s %s", r.Method, r.URL.Path)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "notFound", "unsupported request %s %s", r.Method, r.URL.Path)
+	}
+}
+
+// filterRegexp matches the only filter mantle uses on images.
+var filterRegexp = regexp.MustCompile(`^name eq (.*)$`)
+
+func (s *Server) serveImages(w http.ResponseWriter, r *http.Request, project string, rest []string) {
+	prefix := project + "/"
+	switch {
+	case len(rest) == 0 && r.Method == "GET":
+		var name *regexp.Regexp
+		if m := filterRegexp.FindStringSubmatch(r.URL.Query().Get("filter")); m != nil {
+			var err error
+			if name, err = regexp.Compile(m[1]); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid", "bad filter: %v", err)
+				return
+			}
+		}
+		list := &compute.ImageList{Items: []*compute.Image{}}
+		for key, image := range s.images {
+			if strings.HasPrefix(key, prefix) && (name == nil || name.MatchString(image.Name)) {
+				list.Items = append(list.Items, image)
+			}
+		}
+		sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+		writeJSON(w, http.StatusOK, list)
+	case len(rest) == 0 && r.Method == "POST":
+		var image compute.Image
+		if err := json.NewDecoder(r.Body).Decode(&image); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid", "%v", err)
+			return
+		}
+		if _, ok := s.images[prefix+image.Name]; ok {
+			writeError(w, http.StatusConflict, "alreadyExists", "image %s already exists", image.Name)
+			return
+		}
+		image.Id = s.id()
+		image.Status = "READY"
+		image.CreationTimestamp = time.Now().UTC().Format(time.RFC3339)
+		image.SelfLink = s.selfLink(prefix + "global/images/" + image.Name)
+		s.images[prefix+image.Name] = &image
+		writeJSON(w, http.StatusOK, s.operation(project, "", "insert", prefix+"global/images/"+image.Name, image.Id))
+	case len(rest) >= 1:
+		image, ok := s.images[prefix+rest[0]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "notFound", "image %s not found", rest[0])
+			return
+		}
+		target := prefix + "global/images/" + rest[0]
+		switch {
+		case len(rest) == 1 && r.Method == "GET":
+			writeJSON(w, http.StatusOK, image)
+		case len(rest) == 1 && r.Method == "DELETE":
+			delete(s.images, prefix+rest[0])
+			writeJSON(w, http.StatusOK, s.operation(project, "", "delete", target, image.Id))
+		case len(rest) == 2 && rest[1] == "deprecate" && r.Method == "POST":
+			var status compute.DeprecationStatus
+			if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid", "%v", err)
+				return
+			}
+			image.Deprecated = &status
+			writeJSON(w, http.StatusOK, s.operation(project, "", "deprecate", target, image.Id))
+		default:
+			writeError(w, http.StatusNotFound, "notFound", "unsupported request %s %s", r.Method, r.URL.Path)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "notFound", "unsupported request %s %s", r.Method, r.URL.Path)
+	}
+}
+
+// opFilterRegexp matches the filter mantle uses to find image inserts.
+var opFilterRegexp = regexp.MustCompile(`^\(targetId eq (\d+)\) \(operationType eq (\w+)\)$`)
+
+func (s *Server) listGlobalOperations(w http.ResponseWriter, r *http.Request, project string) {
+	var targetID, opType string
+	if m := opFilterRegexp.FindStringSubmatch(r.URL.Query().Get("filter")); m != nil {
+		targetID, opType = m[1], m[2]
+	}
+	list := &compute.OperationList{Items: []*compute.Operation{}}
+	for key, op := range s.operations {
+		if !strings.HasPrefix(key, project+"/") || op.Zone != "" {
+			continue
+		}
+		if targetID != "" && (fmt.Sprint(op.TargetId) != targetID || op.OperationType != opType) {
+			continue
+		}
+		list.Items = append(list.Items, op)
+	}
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Id < list.Items[j].Id })
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcloud
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+
+	"github.com/flatcar-linux/mantle/platform/inventory"
+)
+
+// ListResources lists the instances created by mantle in the API's
+// project and zone.
+func (a *API) ListResources(ctx context.Context) ([]inventory.Resource, error) {
+	var ret []inventory.Resource
+	err := a.compute.Instances.List(a.options.Project, a.options.Zone).Pages(ctx, func(list *compute.InstanceList) error {
+		for _, instance := range list.Items {
+			if !createdByMantle(instance) || instance.Status == "TERMINATED" {
+				continue
+			}
+			created, err := time.Parse(time.RFC3339, instance.CreationTimestamp)
+			if err != nil {
+				return fmt.Errorf("couldn't parse %q: %v", instance.CreationTimestamp, err)
+			}
+			ret = append(ret, inventory.Resource{
+				Cloud:   "gcloud",
+				Kind:    inventory.KindInstance,
+				ID:      instance.Name,
+				Name:    instance.Name,
+				Region:  a.options.Zone,
+				Owner:   a.options.Project,
+				Created: created,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing instances: %v", err)
+	}
+	return ret, nil
+}
+
+// DeleteResource deletes a resource returned by ListResources.
+func (a *API) DeleteResource(ctx context.Context, r inventory.Resource) error {
+	switch r.Kind {
+	case inventory.KindInstance:
+		return a.TerminateInstance(r.ID)
+	default:
+		return fmt.Errorf("unsupported resource kind %q", r.Kind)
+	}
+}
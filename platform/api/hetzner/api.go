@@ -0,0 +1,510 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar-linux/mantle/auth"
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/util"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar-linux/mantle", "platform/api/hetzner")
+)
+
+// mantleSelector selects the resources labelled by mantleLabels.
+const mantleSelector = "created-by=mantle"
+
+func mantleLabels() map[string]string {
+	return map[string]string{"created-by": "mantle"}
+}
+
+// flightLabel names the kola flight a server belongs to.
+const flightLabel = "mantle-flight"
+
+// flightLabels returns mantleLabels plus the flightLabel of flight,
+// unless that is empty.
+func flightLabels(flight string) map[string]string {
+	labels := mantleLabels()
+	if flight != "" {
+		labels[flightLabel] = flight
+	}
+	return labels
+}
+
+type Options struct {
+	*platform.Options
+
+	// Config file. Defaults to $HOME/.config/hetzner.json.
+	ConfigPath string
+	// Profile name
+	Profile string
+	// Project API token (overrides config profile)
+	Token string
+	// API endpoint URL, for testing against a fake server
+	Endpoint string
+
+	// Location name (e.g. "fsn1")
+	Location string
+	// Server type name (e.g. "cx22")
+	ServerType string
+	// Numeric image ID or snapshot description
+	Image string
+	// Private network name or numeric ID to attach servers to.  If
+	// unset, servers have only a public address.
+	Network string
+}
+
+type API struct {
+	c       *client
+	opts    *Options
+	image   string
+	network int64
+
+	// interval is how often asynchronous actions are polled.
+	interval time.Duration
+	// rescueExec runs a shell command in the rescue system of a server.
+	rescueExec func(ip string, signer ssh.Signer, cmd string) ([]byte, error)
+}
+
+func New(opts *Options) (*API, error) {
+	if opts.Token == "" {
+		profiles, err := auth.ReadHetznerConfig(opts.ConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read Hetzner config: %v", err)
+		}
+
+		if opts.Profile == "" {
+			opts.Profile = "default"
+		}
+		profile, ok := profiles[opts.Profile]
+		if !ok {
+			return nil, fmt.Errorf("no such profile %q", opts.Profile)
+		}
+		opts.Token = profile.Token
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+
+	a := &API{
+		c: &client{
+			http:     &http.Client{Timeout: time.Minute},
+			endpoint: endpoint,
+			token:    opts.Token,
+		},
+		opts:       opts,
+		interval:   5 * time.Second,
+		rescueExec: sshExec,
+	}
+
+	ctx := context.TODO()
+	if opts.Image != "" {
+		var err error
+		a.image, err = a.resolveImage(ctx, opts.Image)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.Network != "" {
+		network, err := a.getNetwork(ctx, opts.Network)
+		if err != nil {
+			return nil, err
+		}
+		a.network = network.ID
+	}
+
+	return a, nil
+}
+
+func (a *API) resolveImage(ctx context.Context, imageSpec string) (string, error) {
+	// try numeric image ID first
+	if _, err := strconv.ParseInt(imageSpec, 10, 64); err == nil {
+		return imageSpec, nil
+	}
+
+	image, err := a.FindSnapshot(ctx, imageSpec)
+	if err != nil {
+		return "", fmt.Errorf("couldn't resolve image %q: %v", imageSpec, err)
+	}
+	return strconv.FormatInt(image.ID, 10), nil
+}
+
+func (a *API) getNetwork(ctx context.Context, networkSpec string) (*Network, error) {
+	if id, err := strconv.ParseInt(networkSpec, 10, 64); err == nil {
+		var resp struct {
+			Network Network `json:"network"`
+		}
+		if err := a.c.do(ctx, http.MethodGet, fmt.Sprintf("/networks/%d", id), nil, nil, &resp); err != nil {
+			return nil, fmt.Errorf("getting network %d: %v", id, err)
+		}
+		return &resp.Network, nil
+	}
+
+	var resp struct {
+		Networks []Network `json:"networks"`
+	}
+	query := url.Values{"name": {networkSpec}}
+	if err := a.c.do(ctx, http.MethodGet, "/networks", query, nil, &resp); err != nil {
+		return nil, fmt.Errorf("listing networks: %v", err)
+	}
+	if len(resp.Networks) != 1 {
+		return nil, fmt.Errorf("couldn't find network %q", networkSpec)
+	}
+	return &resp.Networks[0], nil
+}
+
+// PreflightCheck checks that the token is valid and the location
+// exists.
+func (a *API) PreflightCheck(ctx context.Context) error {
+	var resp struct {
+		Locations []Location `json:"locations"`
+	}
+	var query url.Values
+	if a.opts.Location != "" {
+		query = url.Values{"name": {a.opts.Location}}
+	}
+	if err := a.c.do(ctx, http.MethodGet, "/locations", query, nil, &resp); err != nil {
+		return fmt.Errorf("querying locations: %v", err)
+	}
+	if a.opts.Location != "" && len(resp.Locations) == 0 {
+		return fmt.Errorf("no such location %q", a.opts.Location)
+	}
+	return nil
+}
+
+type createServerRequest struct {
+	Name             string            `json:"name"`
+	ServerType       string            `json:"server_type"`
+	Image            string            `json:"image"`
+	Location         string            `json:"location,omitempty"`
+	SSHKeys          []int64           `json:"ssh_keys,omitempty"`
+	UserData         string            `json:"user_data,omitempty"`
+	Labels           map[string]string `json:"labels"`
+	StartAfterCreate bool              `json:"start_after_create"`
+	Networks         []int64           `json:"networks,omitempty"`
+}
+
+type createServerResponse struct {
+	Server Server `json:"server"`
+	Action Action `json:"action"`
+}
+
+// CreateServer creates a server of flight from the configured image
+// with the given userdata, and waits until it is running.  flight may
+// be empty and sshKeyID may be 0.
+func (a *API) CreateServer(ctx context.Context, name, flight string, sshKeyID int64, userdata string) (*Server, error) {
+	if a.image == "" {
+		return nil, fmt.Errorf("no image specified")
+	}
+	req := createServerRequest{
+		Name:             name,
+		ServerType:       a.opts.ServerType,
+		Image:            a.image,
+		Location:         a.opts.Location,
+		UserData:         userdata,
+		Labels:           flightLabels(flight),
+		StartAfterCreate: true,
+	}
+	if sshKeyID != 0 {
+		req.SSHKeys = []int64{sshKeyID}
+	}
+	if a.network != 0 {
+		req.Networks = []int64{a.network}
+	}
+	return a.createServer(ctx, req, "running")
+}
+
+func (a *API) createServer(ctx context.Context, req createServerRequest, status string) (*Server, error) {
+	var resp createServerResponse
+	// Hetzner reports temporary capacity shortages and locked
+	// resources as errors.  Retry every 10 seconds for up to 5 min
+	err := util.RetryConditional(5*6, 10*time.Second, shouldRetry, func() error {
+		err := a.c.do(ctx, http.MethodPost, "/servers", nil, req, &resp)
+		if err != nil {
+			plog.Errorf("Error creating server: %v. Retrying...", err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create server: %v", err)
+	}
+	serverID := resp.Server.ID
+
+	if err := a.waitForAction(ctx, resp.Action.ID, 5*time.Minute); err != nil {
+		a.DeleteServer(ctx, serverID)
+		return nil, fmt.Errorf("creating server: %v", err)
+	}
+
+	var server *Server
+	err = util.WaitUntilReady(5*time.Minute, a.interval, func() (bool, error) {
+		var err error
+		// update server in closure
+		server, err = a.GetServer(ctx, serverID)
+		if err != nil {
+			return false, err
+		}
+		return server.Status == status, nil
+	})
+	if err != nil {
+		a.DeleteServer(ctx, serverID)
+		return nil, fmt.Errorf("waiting for server to be %s: %v", status, err)
+	}
+
+	return server, nil
+}
+
+func (a *API) GetServer(ctx context.Context, serverID int64) (*Server, error) {
+	var resp struct {
+		Server Server `json:"server"`
+	}
+	if err := a.c.do(ctx, http.MethodGet, fmt.Sprintf("/servers/%d", serverID), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Server, nil
+}
+
+func (a *API) DeleteServer(ctx context.Context, serverID int64) error {
+	if err := a.c.do(ctx, http.MethodDelete, fmt.Sprintf("/servers/%d", serverID), nil, nil, nil); err != nil {
+		return fmt.Errorf("deleting server %d: %v", serverID, err)
+	}
+	return nil
+}
+
+type serverList struct {
+	pagination
+	Servers []Server `json:"servers"`
+}
+
+func (a *API) listServers(ctx context.Context, labelSelector string) ([]Server, error) {
+	var ret []Server
+	query := url.Values{"label_selector": {labelSelector}}
+	err := a.c.list(ctx, "/servers", query, func() page {
+		return &serverList{}
+	}, func(p page) {
+		ret = append(ret, p.(*serverList).Servers...)
+	})
+	return ret, err
+}
+
+// serverAction runs an action on a server and waits for it to finish.
+// If out is not nil, the response is decoded into it as well.
+func (a *API) serverAction(ctx context.Context, serverID int64, command string, body, out interface{}, timeout time.Duration) error {
+	var resp struct {
+		Action Action `json:"action"`
+	}
+	path := fmt.Sprintf("/servers/%d/actions/%s", serverID, command)
+	if body == nil {
+		body = struct{}{}
+	}
+	if err := a.c.do(ctx, http.MethodPost, path, nil, body, &multi{&resp, out}); err != nil {
+		return fmt.Errorf("%s server %d: %v", command, serverID, err)
+	}
+	return a.waitForAction(ctx, resp.Action.ID, timeout)
+}
+
+func (a *API) waitForAction(ctx context.Context, actionID int64, timeout time.Duration) error {
+	return util.WaitUntilReady(timeout, a.interval, func() (bool, error) {
+		var resp struct {
+			Action Action `json:"action"`
+		}
+		if err := a.c.do(ctx, http.MethodGet, fmt.Sprintf("/actions/%d", actionID), nil, nil, &resp); err != nil {
+			return false, err
+		}
+		switch resp.Action.Status {
+		case "running":
+			return false, nil
+		case "success":
+			return true, nil
+		default:
+			if resp.Action.Error != nil {
+				return false, fmt.Errorf("action %s failed: %s", resp.Action.Command, resp.Action.Error.Message)
+			}
+			return false, fmt.Errorf("action %s failed", resp.Action.Command)
+		}
+	})
+}
+
+// CreateSnapshot creates a snapshot of a server's disk and waits until
+// it is available.
+func (a *API) CreateSnapshot(ctx context.Context, serverID int64, description string) (*Image, error) {
+	var resp struct {
+		Image Image `json:"image"`
+	}
+	body := map[string]interface{}{
+		"type":        "snapshot",
+		"description": description,
+		"labels":      mantleLabels(),
+	}
+	if err := a.serverAction(ctx, serverID, "create_image", body, &resp, 30*time.Minute); err != nil {
+		return nil, err
+	}
+	return a.GetImage(ctx, resp.Image.ID)
+}
+
+// RequestConsole returns the URL and password of a VNC console over
+// WebSocket for the server.  Hetzner Cloud provides no other access to
+// the console.
+func (a *API) RequestConsole(ctx context.Context, serverID int64) (string, string, error) {
+	var resp struct {
+		WSSURL   string `json:"wss_url"`
+		Password string `json:"password"`
+	}
+	if err := a.serverAction(ctx, serverID, "request_console", nil, &resp, time.Minute); err != nil {
+		return "", "", err
+	}
+	return resp.WSSURL, resp.Password, nil
+}
+
+func (a *API) GetImage(ctx context.Context, imageID int64) (*Image, error) {
+	var resp struct {
+		Image Image `json:"image"`
+	}
+	if err := a.c.do(ctx, http.MethodGet, fmt.Sprintf("/images/%d", imageID), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Image, nil
+}
+
+type imageList struct {
+	pagination
+	Images []Image `json:"images"`
+}
+
+// ListSnapshots lists the snapshots in the project.
+func (a *API) ListSnapshots(ctx context.Context) ([]Image, error) {
+	var ret []Image
+	query := url.Values{"type": {"snapshot"}}
+	err := a.c.list(ctx, "/images", query, func() page {
+		return &imageList{}
+	}, func(p page) {
+		ret = append(ret, p.(*imageList).Images...)
+	})
+	return ret, err
+}
+
+// FindSnapshot finds the snapshot with the given description.
+func (a *API) FindSnapshot(ctx context.Context, description string) (*Image, error) {
+	images, err := a.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var ret *Image
+	for _, image := range images {
+		image := image
+		if image.Description != description {
+			continue
+		}
+		if ret != nil {
+			return nil, fmt.Errorf("found multiple snapshots named %q", description)
+		}
+		ret = &image
+	}
+	if ret == nil {
+		return nil, fmt.Errorf("couldn't find snapshot %q", description)
+	}
+	return ret, nil
+}
+
+func (a *API) DeleteImage(ctx context.Context, imageID int64) error {
+	if err := a.c.do(ctx, http.MethodDelete, fmt.Sprintf("/images/%d", imageID), nil, nil, nil); err != nil {
+		return fmt.Errorf("deleting image %d: %v", imageID, err)
+	}
+	return nil
+}
+
+func (a *API) AddKey(ctx context.Context, name, key string) (int64, error) {
+	var resp struct {
+		SSHKey SSHKey `json:"ssh_key"`
+	}
+	body := map[string]interface{}{
+		"name":       name,
+		"public_key": key,
+		"labels":     mantleLabels(),
+	}
+	if err := a.c.do(ctx, http.MethodPost, "/ssh_keys", nil, body, &resp); err != nil {
+		return 0, fmt.Errorf("couldn't create SSH key: %v", err)
+	}
+	return resp.SSHKey.ID, nil
+}
+
+func (a *API) DeleteKey(ctx context.Context, keyID int64) error {
+	if err := a.c.do(ctx, http.MethodDelete, fmt.Sprintf("/ssh_keys/%d", keyID), nil, nil, nil); err != nil {
+		return fmt.Errorf("couldn't delete SSH key: %v", err)
+	}
+	return nil
+}
+
+type sshKeyList struct {
+	pagination
+	SSHKeys []SSHKey `json:"ssh_keys"`
+}
+
+func (a *API) ListKeys(ctx context.Context) ([]SSHKey, error) {
+	var ret []SSHKey
+	err := a.c.list(ctx, "/ssh_keys", nil, func() page {
+		return &sshKeyList{}
+	}, func(p page) {
+		ret = append(ret, p.(*sshKeyList).SSHKeys...)
+	})
+	return ret, err
+}
+
+// GC deletes servers labelled by mantle that were created more than
+// gracePeriod ago.
+func (a *API) GC(ctx context.Context, gracePeriod time.Duration) error {
+	threshold := time.Now().Add(-gracePeriod)
+
+	servers, err := a.listServers(ctx, mantleSelector)
+	if err != nil {
+		return fmt.Errorf("listing servers: %v", err)
+	}
+	for _, server := range servers {
+		if server.Status == "deleting" || server.Created.After(threshold) {
+			continue
+		}
+
+		if err := a.DeleteServer(ctx, server.ID); err != nil {
+			return fmt.Errorf("couldn't delete server %d: %v", server.ID, err)
+		}
+	}
+	return nil
+}
+
+// shouldRetry returns if the error is from Hetzner and we should retry
+// the request which generated it
+func shouldRetry(err error) bool {
+	e, ok := err.(*Error)
+	if !ok {
+		return false
+	}
+	switch e.Code {
+	case "resource_unavailable", "locked", "conflict", "rate_limit_exceeded":
+		return true
+	}
+	return e.StatusCode >= 500
+}
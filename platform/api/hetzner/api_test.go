@@ -0,0 +1,257 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/hetzner/fake"
+	"github.com/flatcar-linux/mantle/platform/inventory"
+	"github.com/flatcar-linux/mantle/platform/inventory/inventorytest"
+)
+
+// newTestAPI creates an API for a fake server, after seeding it with
+// setup if not nil.
+func newTestAPI(t *testing.T, opts Options, setup func(*fake.Server)) (*API, *fake.Server) {
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+	if setup != nil {
+		setup(server)
+	}
+
+	opts.Options = &platform.Options{}
+	opts.Token = "token"
+	opts.Endpoint = server.URL
+	if opts.Location == "" {
+		opts.Location = "fsn1"
+	}
+	if opts.ServerType == "" {
+		opts.ServerType = "cx22"
+	}
+	api, err := New(&opts)
+	require.NoError(t, err)
+	api.interval = time.Millisecond
+	require.NoError(t, api.PreflightCheck(context.Background()))
+	return api, server
+}
+
+func addSnapshot(s *fake.Server) {
+	s.AddImage(fake.Image{Description: "flatcar-test"})
+}
+
+func TestResolveImage(t *testing.T) {
+	api, server := newTestAPI(t, Options{Image: "flatcar-test"}, addSnapshot)
+	assert.Equal(t, strconv.FormatInt(server.Images()[0].ID, 10), api.image)
+
+	api, _ = newTestAPI(t, Options{Image: "1234"}, nil)
+	assert.Equal(t, "1234", api.image)
+
+	_, err := New(&Options{
+		Options:  &platform.Options{},
+		Token:    "token",
+		Endpoint: api.opts.Endpoint,
+		Image:    "missing",
+	})
+	assert.Error(t, err)
+}
+
+func TestPreflightCheck(t *testing.T) {
+	api, _ := newTestAPI(t, Options{}, nil)
+	api.opts.Location = "mars1"
+	assert.Error(t, api.PreflightCheck(context.Background()))
+
+	api.c.token = ""
+	err := api.PreflightCheck(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unauthorized")
+}
+
+func TestCreateServer(t *testing.T) {
+	ctx := context.Background()
+	api, server := newTestAPI(t, Options{Image: "flatcar-test", Network: "kola"}, func(s *fake.Server) {
+		addSnapshot(s)
+		s.AddNetwork("kola")
+	})
+
+	keyID, err := api.AddKey(ctx, inventorytest.Flight, "ssh-ed25519 AAAA")
+	require.NoError(t, err)
+	s, err := api.CreateServer(ctx, "kola-1", inventorytest.Flight, keyID, `{"ignition": {"version": "2.0.0"}}`)
+	require.NoError(t, err)
+	assert.Equal(t, "running", s.Status)
+	assert.NotEmpty(t, s.PublicNet.IPv4.IP)
+	require.Len(t, s.PrivateNet, 1)
+	assert.NotEmpty(t, s.PrivateNet[0].IP)
+	assert.Equal(t, "fsn1", s.Datacenter.Location.Name)
+
+	require.Len(t, server.Servers(), 1)
+	fs := server.Servers()[0]
+	assert.Equal(t, api.image, fs.Image)
+	assert.Equal(t, "cx22", fs.ServerType.Name)
+	assert.Equal(t, `{"ignition": {"version": "2.0.0"}}`, fs.UserData)
+	assert.Equal(t, []int64{keyID}, fs.SSHKeys)
+	assert.Equal(t, flightLabels(inventorytest.Flight), fs.Labels)
+
+	_, err = api.CreateServer(ctx, "kola-1", "", 0, "")
+	assert.Error(t, err, "duplicate name")
+
+	require.NoError(t, api.DeleteServer(ctx, s.ID))
+	assert.Empty(t, server.Servers())
+	err = api.DeleteServer(ctx, s.ID)
+	assert.Error(t, err)
+
+	_, err = api.GetServer(ctx, s.ID)
+	assert.True(t, IsNotFound(err))
+}
+
+func TestCreateServerWithoutImage(t *testing.T) {
+	api, server := newTestAPI(t, Options{}, nil)
+	_, err := api.CreateServer(context.Background(), "kola-1", "", 0, "")
+	assert.Error(t, err)
+	assert.Empty(t, server.Servers())
+}
+
+func TestKeys(t *testing.T) {
+	ctx := context.Background()
+	api, server := newTestAPI(t, Options{}, nil)
+
+	id, err := api.AddKey(ctx, inventorytest.Flight, "ssh-ed25519 AAAA")
+	require.NoError(t, err)
+	keys, err := api.ListKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, inventorytest.Flight, keys[0].Name)
+	assert.Equal(t, mantleLabels(), keys[0].Labels)
+
+	require.NoError(t, api.DeleteKey(ctx, id))
+	assert.Empty(t, server.Keys())
+	assert.Error(t, api.DeleteKey(ctx, id))
+
+	// more than one page
+	for i := 0; i < 120; i++ {
+		_, err := api.AddKey(ctx, fmt.Sprintf("key-%d", i), fmt.Sprintf("ssh-ed25519 %d", i))
+		require.NoError(t, err)
+	}
+	keys, err = api.ListKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 120)
+	assert.Equal(t, "key-119", keys[119].Name)
+}
+
+func TestUploadImage(t *testing.T) {
+	ctx := context.Background()
+	api, server := newTestAPI(t, Options{}, nil)
+
+	var cmds []string
+	api.rescueExec = func(ip string, signer ssh.Signer, cmd string) ([]byte, error) {
+		servers := server.Servers()
+		require.Len(t, servers, 1)
+		assert.Equal(t, servers[0].PublicNet.IPv4.IP, ip)
+		assert.True(t, servers[0].RescueEnabled)
+		assert.Equal(t, "running", servers[0].Status)
+		keys := server.Keys()
+		require.Len(t, keys, 1)
+		assert.Equal(t, string(ssh.MarshalAuthorizedKey(signer.PublicKey())), keys[0].PublicKey)
+		assert.Equal(t, keys[0].Name, inventory.FlightName(keys[0].Name))
+		assert.Equal(t, keys[0].Name, servers[0].Labels[flightLabel])
+		cmds = append(cmds, cmd)
+		return nil, nil
+	}
+
+	url := "https://example.com/flatcar_production_hetzner_image.bin.bz2"
+	image, err := api.UploadImage(ctx, "flatcar-test", url)
+	require.NoError(t, err)
+	assert.Equal(t, "flatcar-test", image.Description)
+	assert.Equal(t, "snapshot", image.Type)
+	assert.Equal(t, "available", image.Status)
+	assert.Equal(t, []string{"true", writeImageCommand(url)}, cmds)
+
+	// the temporary server and key are gone
+	assert.Empty(t, server.Servers())
+	assert.Empty(t, server.Keys())
+
+	found, err := api.FindSnapshot(ctx, "flatcar-test")
+	require.NoError(t, err)
+	assert.Equal(t, image.ID, found.ID)
+
+	require.NoError(t, api.DeleteImage(ctx, image.ID))
+	assert.Empty(t, server.Images())
+}
+
+func TestWriteImageCommand(t *testing.T) {
+	assert.Equal(t, "set -o pipefail; curl -fsSL 'https://example.com/a.bin.xz' | xz -dc | dd of=/dev/sda bs=4M conv=fsync status=none",
+		writeImageCommand("https://example.com/a.bin.xz"))
+	assert.Equal(t, `set -o pipefail; curl -fsSL 'https://example.com/it'\''s.bin' | cat | dd of=/dev/sda bs=4M conv=fsync status=none`,
+		writeImageCommand("https://example.com/it's.bin"))
+}
+
+func TestRequestConsole(t *testing.T) {
+	api, server := newTestAPI(t, Options{}, nil)
+	id := server.AddServer(fake.Instance{Name: "kola-1"})
+
+	url, password, err := api.RequestConsole(context.Background(), id)
+	require.NoError(t, err)
+	assert.Contains(t, url, "wss://")
+	assert.NotEmpty(t, password)
+}
+
+func TestGC(t *testing.T) {
+	api, server := newTestAPI(t, Options{}, nil)
+	old := time.Now().Add(-6 * time.Hour)
+	server.AddServer(fake.Instance{Name: "old", Labels: mantleLabels(), Created: old})
+	server.AddServer(fake.Instance{Name: "new", Labels: mantleLabels()})
+	server.AddServer(fake.Instance{Name: "other", Created: old})
+
+	require.NoError(t, api.GC(context.Background(), 5*time.Hour))
+
+	var names []string
+	for _, s := range server.Servers() {
+		names = append(names, s.Name)
+	}
+	assert.Equal(t, []string{"new", "other"}, names)
+}
+
+func TestInventory(t *testing.T) {
+	ctx := context.Background()
+	api, server := newTestAPI(t, Options{}, nil)
+	server.AddServer(fake.Instance{
+		Name:       "kola-1",
+		Labels:     flightLabels(inventorytest.Flight),
+		Datacenter: fake.Datacenter{Location: fake.Location{Name: "nbg1"}},
+	})
+	server.AddServer(fake.Instance{Name: "other"})
+	_, err := api.AddKey(ctx, inventorytest.Flight, "ssh-ed25519 AAAA")
+	require.NoError(t, err)
+	_, err = api.AddKey(ctx, "laptop", "ssh-ed25519 BBBB")
+	require.NoError(t, err)
+
+	rs := inventorytest.CheckProvider(t, api, []inventory.Resource{
+		{Cloud: "hetzner", Kind: inventory.KindInstance, Name: "kola-1", Region: "nbg1", Flight: inventorytest.Flight},
+		{Cloud: "hetzner", Kind: inventory.KindKey, Name: inventorytest.Flight, Flight: inventorytest.Flight},
+	})
+	assert.False(t, rs[0].Created.IsZero())
+	require.Len(t, server.Servers(), 1)
+	assert.Equal(t, "other", server.Servers()[0].Name)
+	require.Len(t, server.Keys(), 1)
+	assert.Equal(t, "laptop", server.Keys()[0].Name)
+}
@@ -0,0 +1,244 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEndpoint is the base URL of the Hetzner Cloud API.
+const DefaultEndpoint = "https://api.hetzner.cloud/v1"
+
+// There is no Hetzner Cloud client among our dependencies, so this is a
+// minimal one covering the resources mantle uses.  See
+// https://docs.hetzner.cloud/ for the API reference.
+
+type Server struct {
+	ID         int64              `json:"id"`
+	Name       string             `json:"name"`
+	Status     string             `json:"status"`
+	Created    time.Time          `json:"created"`
+	PublicNet  ServerPublicNet    `json:"public_net"`
+	PrivateNet []ServerPrivateNet `json:"private_net"`
+	ServerType ServerType         `json:"server_type"`
+	Datacenter Datacenter         `json:"datacenter"`
+	Image      *Image             `json:"image"`
+	Labels     map[string]string  `json:"labels"`
+}
+
+type ServerPublicNet struct {
+	IPv4 struct {
+		IP string `json:"ip"`
+	} `json:"ipv4"`
+	IPv6 struct {
+		IP string `json:"ip"`
+	} `json:"ipv6"`
+}
+
+type ServerPrivateNet struct {
+	Network int64  `json:"network"`
+	IP      string `json:"ip"`
+}
+
+type ServerType struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Architecture string `json:"architecture"`
+}
+
+type Datacenter struct {
+	Name     string   `json:"name"`
+	Location Location `json:"location"`
+}
+
+type Location struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// Image is a system image or a snapshot.  Snapshots have no name and
+// are identified by their description.
+type Image struct {
+	ID           int64             `json:"id"`
+	Type         string            `json:"type"`
+	Status       string            `json:"status"`
+	Name         string            `json:"name"`
+	Description  string            `json:"description"`
+	Architecture string            `json:"architecture"`
+	Created      time.Time         `json:"created"`
+	Labels       map[string]string `json:"labels"`
+}
+
+type SSHKey struct {
+	ID          int64             `json:"id"`
+	Name        string            `json:"name"`
+	Fingerprint string            `json:"fingerprint"`
+	PublicKey   string            `json:"public_key"`
+	Labels      map[string]string `json:"labels"`
+}
+
+type Network struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	IPRange string `json:"ip_range"`
+}
+
+// Action is an asynchronous operation on one or more resources.
+type Action struct {
+	ID       int64  `json:"id"`
+	Command  string `json:"command"`
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+	Error    *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Error is an error returned by the Hetzner Cloud API.
+type Error struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%s, HTTP %d)", e.Message, e.Code, e.StatusCode)
+}
+
+// IsNotFound returns whether err is a Hetzner Cloud API not_found error.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == "not_found"
+}
+
+// pagination is embedded in the response types of collections.
+type pagination struct {
+	Meta struct {
+		Pagination struct {
+			NextPage *int `json:"next_page"`
+		} `json:"pagination"`
+	} `json:"meta"`
+}
+
+func (p *pagination) nextPage() *int {
+	return p.Meta.Pagination.NextPage
+}
+
+type page interface {
+	nextPage() *int
+}
+
+type client struct {
+	http     *http.Client
+	endpoint string
+	token    string
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out, if it is not nil.
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	u := strings.TrimRight(c.endpoint, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var errResp struct {
+			Error Error `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error.Code == "" {
+			return fmt.Errorf("%s %s: HTTP %d", method, path, resp.StatusCode)
+		}
+		errResp.Error.StatusCode = resp.StatusCode
+		return &errResp.Error
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// list fetches every page of a collection.  Each page is decoded into
+// a fresh value from newPage and then passed to collect.
+func (c *client) list(ctx context.Context, path string, query url.Values, newPage func() page, collect func(page)) error {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("per_page", "50")
+	for page := 1; ; {
+		q.Set("page", strconv.Itoa(page))
+		out := newPage()
+		if err := c.do(ctx, http.MethodGet, path, q, nil, out); err != nil {
+			return err
+		}
+		collect(out)
+		next := out.nextPage()
+		if next == nil || *next <= page {
+			return nil
+		}
+		page = *next
+	}
+}
+
+// multi decodes the same response into each of its non-nil values.
+type multi []interface{}
+
+func (m multi) UnmarshalJSON(b []byte) error {
+	for _, v := range m {
+		if v == nil {
+			continue
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
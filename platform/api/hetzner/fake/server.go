@@ -0,0 +1,623 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake implements an in-process fake of the subset of the
+// Hetzner Cloud API used by mantle, for testing without credentials.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Instance is a Hetzner Cloud server.
+type Instance struct {
+	ID         int64             `json:"id"`
+	Name       string            `json:"name"`
+	Status     string            `json:"status"`
+	Created    time.Time         `json:"created"`
+	PublicNet  PublicNet         `json:"public_net"`
+	PrivateNet []PrivateNet      `json:"private_net"`
+	ServerType ServerType        `json:"server_type"`
+	Datacenter Datacenter        `json:"datacenter"`
+	Image      string            `json:"-"`
+	Labels     map[string]string `json:"labels"`
+	// Image, UserData and SSHKeys are as requested at creation and
+	// aren't returned by the API, but can be inspected by tests.
+	UserData      string  `json:"-"`
+	SSHKeys       []int64 `json:"-"`
+	RescueEnabled bool    `json:"rescue_enabled"`
+}
+
+type PublicNet struct {
+	IPv4 struct {
+		IP string `json:"ip"`
+	} `json:"ipv4"`
+}
+
+type PrivateNet struct {
+	Network int64  `json:"network"`
+	IP      string `json:"ip"`
+}
+
+type ServerType struct {
+	Name string `json:"name"`
+}
+
+type Datacenter struct {
+	Name     string   `json:"name"`
+	Location Location `json:"location"`
+}
+
+type Location struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type Image struct {
+	ID          int64             `json:"id"`
+	Type        string            `json:"type"`
+	Status      string            `json:"status"`
+	Name        string            `json:"name,omitempty"`
+	Description string            `json:"description"`
+	Created     time.Time         `json:"created"`
+	Labels      map[string]string `json:"labels"`
+	CreatedFrom int64             `json:"-"`
+}
+
+type SSHKey struct {
+	ID        int64             `json:"id"`
+	Name      string            `json:"name"`
+	PublicKey string            `json:"public_key"`
+	Labels    map[string]string `json:"labels"`
+}
+
+type Network struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	IPRange string `json:"ip_range"`
+}
+
+type Action struct {
+	ID       int64  `json:"id"`
+	Command  string `json:"command"`
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+}
+
+// Locations are the locations known to the server.
+var Locations = []Location{
+	{ID: 1, Name: "fsn1"},
+	{ID: 2, Name: "nbg1"},
+	{ID: 3, Name: "hel1"},
+}
+
+// Server is a fake Hetzner Cloud API server. Actions complete
+// immediately, so resources are ready as soon as they are created.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	nextID   int64
+	servers  map[int64]*Instance
+	images   map[int64]*Image
+	keys     map[int64]*SSHKey
+	networks map[int64]*Network
+	actions  map[int64]*Action
+}
+
+// NewServer starts a fake server; the caller must Close it.
+func NewServer() *Server {
+	s := &Server{
+		nextID:   1,
+		servers:  make(map[int64]*Instance),
+		images:   make(map[int64]*Image),
+		keys:     make(map[int64]*SSHKey),
+		networks: make(map[int64]*Network),
+		actions:  make(map[int64]*Action),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *Server) id() int64 {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+// AddServer adds a server as if it had been created outside mantle
+// and returns its ID.
+func (s *Server) AddServer(i Instance) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i.ID = s.id()
+	if i.Status == "" {
+		i.Status = "running"
+	}
+	if i.Created.IsZero() {
+		i.Created = time.Now().UTC()
+	}
+	s.servers[i.ID] = &i
+	return i.ID
+}
+
+// AddImage adds an image and returns its ID.
+func (s *Server) AddImage(i Image) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i.ID = s.id()
+	if i.Type == "" {
+		i.Type = "snapshot"
+	}
+	if i.Status == "" {
+		i.Status = "available"
+	}
+	if i.Created.IsZero() {
+		i.Created = time.Now().UTC()
+	}
+	s.images[i.ID] = &i
+	return i.ID
+}
+
+// AddNetwork adds a private network and returns its ID.
+func (s *Server) AddNetwork(name string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := &Network{ID: s.id(), Name: name, IPRange: "10.0.0.0/16"}
+	s.networks[n.ID] = n
+	return n.ID
+}
+
+// Servers returns the servers, ordered by ID.
+func (s *Server) Servers() []Instance {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []Instance
+	for _, i := range s.servers {
+		ret = append(ret, *i)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+// Images returns the images, ordered by ID.
+func (s *Server) Images() []Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []Image
+	for _, i := range s.images {
+		ret = append(ret, *i)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+// Keys returns the SSH keys, ordered by ID.
+func (s *Server) Keys() []SSHKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []SSHKey
+	for _, k := range s.keys {
+		ret = append(ret, *k)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, format string, args ...interface{}) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{
+			"code":    code,
+			"message": fmt.Sprintf(format, args...),
+		},
+	})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "unable to authenticate")
+		return
+	}
+
+	// The numeric ID is the path element after the collection:
+	// /servers/{id}, /servers/{id}/actions/{command} etc.
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var id int64
+	if len(parts) > 1 {
+		var err error
+		if id, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			writeError(w, http.StatusNotFound, "not_found", "bad ID %q", parts[1])
+			return
+		}
+	}
+
+	route := r.Method + " " + parts[0]
+	switch {
+	case route == "GET locations" && len(parts) == 1:
+		s.listLocations(w, r)
+	case route == "GET networks" && len(parts) == 1:
+		s.listNetworks(w, r)
+	case route == "GET networks" && len(parts) == 2:
+		if n, ok := s.networks[id]; ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"network": n})
+		} else {
+			writeError(w, http.StatusNotFound, "not_found", "network %d not found", id)
+		}
+	case route == "GET servers" && len(parts) == 1:
+		s.listServers(w, r)
+	case route == "POST servers" && len(parts) == 1:
+		s.createServer(w, r)
+	case route == "GET servers" && len(parts) == 2:
+		if i, ok := s.servers[id]; ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"server": i})
+		} else {
+			writeError(w, http.StatusNotFound, "not_found", "server %d not found", id)
+		}
+	case route == "DELETE servers" && len(parts) == 2:
+		if _, ok := s.servers[id]; !ok {
+			writeError(w, http.StatusNotFound, "not_found", "server %d not found", id)
+			return
+		}
+		delete(s.servers, id)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"action": s.action("delete_server")})
+	case route == "POST servers" && len(parts) == 4 && parts[2] == "actions":
+		s.serverAction(w, r, id, parts[3])
+	case route == "GET actions" && len(parts) == 2:
+		if a, ok := s.actions[id]; ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"action": a})
+		} else {
+			writeError(w, http.StatusNotFound, "not_found", "action %d not found", id)
+		}
+	case route == "GET images" && len(parts) == 1:
+		s.listImages(w, r)
+	case route == "GET images" && len(parts) == 2:
+		if i, ok := s.images[id]; ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"image": i})
+		} else {
+			writeError(w, http.StatusNotFound, "not_found", "image %d not found", id)
+		}
+	case route == "DELETE images" && len(parts) == 2:
+		if _, ok := s.images[id]; !ok {
+			writeError(w, http.StatusNotFound, "not_found", "image %d not found", id)
+			return
+		}
+		delete(s.images, id)
+		w.WriteHeader(http.StatusNoContent)
+	case route == "GET ssh_keys" && len(parts) == 1:
+		s.listKeys(w, r)
+	case route == "POST ssh_keys" && len(parts) == 1:
+		s.createKey(w, r)
+	case route == "DELETE ssh_keys" && len(parts) == 2:
+		if _, ok := s.keys[id]; !ok {
+			writeError(w, http.StatusNotFound, "not_found", "SSH key %d not found", id)
+			return
+		}
+		delete(s.keys, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "unsupported request %s %s", r.Method, r.URL.Path)
+	}
+}
+
+// action records a completed action.
+func (s *Server) action(command string) *Action {
+	a := &Action{
+		ID:       s.id(),
+		Command:  command,
+		Status:   "success",
+		Progress: 100,
+	}
+	s.actions[a.ID] = a
+	return a
+}
+
+// paginate writes the page of items requested by r under the
+// collection key, with the pagination metadata.
+func paginate(w http.ResponseWriter, r *http.Request, key string, items []interface{}) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 {
+		perPage = 25
+	}
+
+	lo := (page - 1) * perPage
+	if lo > len(items) {
+		lo = len(items)
+	}
+	hi := lo + perPage
+	var nextPage interface{}
+	if hi < len(items) {
+		nextPage = page + 1
+	} else {
+		hi = len(items)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		key: items[lo:hi],
+		"meta": map[string]interface{}{
+			"pagination": map[string]interface{}{
+				"page":          page,
+				"per_page":      perPage,
+				"next_page":     nextPage,
+				"total_entries": len(items),
+			},
+		},
+	})
+}
+
+// matchLabels implements the subset of label selectors of the form
+// "key=value,key2" that mantle uses.
+func matchLabels(selector string, labels map[string]string) bool {
+	if selector == "" {
+		return true
+	}
+	for _, term := range strings.Split(selector, ",") {
+		kv := strings.SplitN(term, "=", 2)
+		v, ok := labels[kv[0]]
+		if !ok || (len(kv) == 2 && v != kv[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) listLocations(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	locations := []Location{}
+	for _, l := range Locations {
+		if name == "" || l.Name == name {
+			locations = append(locations, l)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"locations": locations})
+}
+
+func (s *Server) listNetworks(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	networks := []*Network{}
+	for _, n := range s.networks {
+		if name == "" || n.Name == name {
+			networks = append(networks, n)
+		}
+	}
+	sort.Slice(networks, func(i, j int) bool { return networks[i].ID < networks[j].ID })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"networks": networks})
+}
+
+func (s *Server) listServers(w http.ResponseWriter, r *http.Request) {
+	selector := r.URL.Query().Get("label_selector")
+	var ids []int64
+	for id, i := range s.servers {
+		if matchLabels(selector, i.Labels) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	items := []interface{}{}
+	for _, id := range ids {
+		items = append(items, s.servers[id])
+	}
+	paginate(w, r, "servers", items)
+}
+
+func (s *Server) createServer(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name             string            `json:"name"`
+		ServerType       string            `json:"server_type"`
+		Image            string            `json:"image"`
+		Location         string            `json:"location"`
+		SSHKeys          []int64           `json:"ssh_keys"`
+		UserData         string            `json:"user_data"`
+		Labels           map[string]string `json:"labels"`
+		StartAfterCreate *bool             `json:"start_after_create"`
+		Networks         []int64           `json:"networks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "json_error", "%v", err)
+		return
+	}
+	if req.Name == "" || req.ServerType == "" || req.Image == "" {
+		writeError(w, http.StatusBadRequest, "invalid_input", "name, server_type and image are required")
+		return
+	}
+	for _, i := range s.servers {
+		if i.Name == req.Name {
+			writeError(w, http.StatusConflict, "uniqueness_error", "server name %q is already used", req.Name)
+			return
+		}
+	}
+	if imageID, err := strconv.ParseInt(req.Image, 10, 64); err == nil {
+		if _, ok := s.images[imageID]; !ok {
+			writeError(w, http.StatusBadRequest, "invalid_input", "image %d not found", imageID)
+			return
+		}
+	}
+	for _, keyID := range req.SSHKeys {
+		if _, ok := s.keys[keyID]; !ok {
+			writeError(w, http.StatusBadRequest, "invalid_input", "SSH key %d not found", keyID)
+			return
+		}
+	}
+	location := Locations[0]
+	if req.Location != "" {
+		location = Location{}
+		for _, l := range Locations {
+			if l.Name == req.Location {
+				location = l
+			}
+		}
+		if location.Name == "" {
+			writeError(w, http.StatusBadRequest, "invalid_input", "location %q not found", req.Location)
+			return
+		}
+	}
+
+	id := s.id()
+	i := &Instance{
+		ID:         id,
+		Name:       req.Name,
+		Status:     "running",
+		Created:    time.Now().UTC(),
+		ServerType: ServerType{Name: req.ServerType},
+		Datacenter: Datacenter{Name: location.Name + "-dc14", Location: location},
+		Image:      req.Image,
+		Labels:     req.Labels,
+		UserData:   req.UserData,
+		SSHKeys:    req.SSHKeys,
+	}
+	if req.StartAfterCreate != nil && !*req.StartAfterCreate {
+		i.Status = "off"
+	}
+	i.PublicNet.IPv4.IP = fmt.Sprintf("192.0.2.%d", id%256)
+	for _, networkID := range req.Networks {
+		if _, ok := s.networks[networkID]; !ok {
+			writeError(w, http.StatusBadRequest, "invalid_input", "network %d not found", networkID)
+			return
+		}
+		i.PrivateNet = append(i.PrivateNet, PrivateNet{
+			Network: networkID,
+			IP:      fmt.Sprintf("10.0.%d.%d", id/256, id%256),
+		})
+	}
+	s.servers[id] = i
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"server":        i,
+		"action":        s.action("create_server"),
+		"next_actions":  []interface{}{},
+		"root_password": nil,
+	})
+}
+
+func (s *Server) serverAction(w http.ResponseWriter, r *http.Request, id int64, command string) {
+	i, ok := s.servers[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "server %d not found", id)
+		return
+	}
+	var req struct {
+		Type        string            `json:"type"`
+		Description string            `json:"description"`
+		Labels      map[string]string `json:"labels"`
+		SSHKeys     []int64           `json:"ssh_keys"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "json_error", "%v", err)
+		return
+	}
+
+	resp := map[string]interface{}{}
+	switch command {
+	case "poweron":
+		i.Status = "running"
+	case "poweroff", "shutdown":
+		i.Status = "off"
+	case "enable_rescue":
+		i.RescueEnabled = true
+		resp["root_password"] = "rescue"
+	case "create_image":
+		image := &Image{
+			ID:          s.id(),
+			Type:        req.Type,
+			Status:      "available",
+			Description: req.Description,
+			Created:     time.Now().UTC(),
+			Labels:      req.Labels,
+			CreatedFrom: id,
+		}
+		if image.Type == "" {
+			image.Type = "snapshot"
+		}
+		s.images[image.ID] = image
+		resp["image"] = image
+	case "request_console":
+		resp["wss_url"] = fmt.Sprintf("wss://console.example.com/?server_id=%d", id)
+		resp["password"] = "vnc"
+	default:
+		writeError(w, http.StatusNotFound, "not_found", "unsupported action %q", command)
+		return
+	}
+	resp["action"] = s.action(command)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) listImages(w http.ResponseWriter, r *http.Request) {
+	typ := r.URL.Query().Get("type")
+	var ids []int64
+	for id, i := range s.images {
+		if typ == "" || i.Type == typ {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	items := []interface{}{}
+	for _, id := range ids {
+		items = append(items, s.images[id])
+	}
+	paginate(w, r, "images", items)
+}
+
+func (s *Server) listKeys(w http.ResponseWriter, r *http.Request) {
+	var ids []int64
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	items := []interface{}{}
+	for _, id := range ids {
+		items = append(items, s.keys[id])
+	}
+	paginate(w, r, "ssh_keys", items)
+}
+
+func (s *Server) createKey(w http.ResponseWriter, r *http.Request) {
+	var req SSHKey
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "json_error", "%v", err)
+		return
+	}
+	for _, k := range s.keys {
+		if k.Name == req.Name || k.PublicKey == req.PublicKey {
+			writeError(w, http.StatusConflict, "uniqueness_error", "SSH key not unique")
+			return
+		}
+	}
+	key := &SSHKey{
+		ID:        s.id(),
+		Name:      req.Name,
+		PublicKey: req.PublicKey,
+		Labels:    req.Labels,
+	}
+	s.keys[key.ID] = key
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"ssh_key": key})
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/flatcar-linux/mantle/platform/inventory"
+)
+
+// ListResources lists the servers labelled by mantle, with the flight
+// of their flightLabel, and the SSH keys named after kola flights.
+func (a *API) ListResources(ctx context.Context) ([]inventory.Resource, error) {
+	var ret []inventory.Resource
+
+	servers, err := a.listServers(ctx, mantleSelector)
+	if err != nil {
+		return nil, fmt.Errorf("listing servers: %v", err)
+	}
+	for _, server := range servers {
+		if server.Status == "deleting" {
+			continue
+		}
+		ret = append(ret, inventory.Resource{
+			Cloud:   "hetzner",
+			Kind:    inventory.KindInstance,
+			ID:      strconv.FormatInt(server.ID, 10),
+			Name:    server.Name,
+			Region:  server.Datacenter.Location.Name,
+			Flight:  inventory.FlightName(server.Labels[flightLabel]),
+			Created: server.Created,
+		})
+	}
+
+	keys, err := a.ListKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing keys: %v", err)
+	}
+	for _, key := range keys {
+		flight := inventory.FlightName(key.Name)
+		if flight == "" {
+			continue
+		}
+		ret = append(ret, inventory.Resource{
+			Cloud:  "hetzner",
+			Kind:   inventory.KindKey,
+			ID:     strconv.FormatInt(key.ID, 10),
+			Name:   key.Name,
+			Flight: flight,
+		})
+	}
+
+	return ret, nil
+}
+
+// DeleteResource deletes a resource returned by ListResources.
+func (a *API) DeleteResource(ctx context.Context, r inventory.Resource) error {
+	id, err := strconv.ParseInt(r.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad ID %q: %v", r.ID, err)
+	}
+	switch r.Kind {
+	case inventory.KindInstance:
+		return a.DeleteServer(ctx, id)
+	case inventory.KindKey:
+		return a.DeleteKey(ctx, id)
+	default:
+		return fmt.Errorf("unsupported resource kind %q", r.Kind)
+	}
+}
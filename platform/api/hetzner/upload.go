@@ -0,0 +1,158 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar-linux/mantle/util"
+)
+
+// uploadBaseImage is the system image of the temporary server used by
+// UploadImage.  It is never booted, but a server can't be created
+// without an image.
+const uploadBaseImage = "debian-12"
+
+// UploadImage creates a snapshot from a raw disk image at imageURL,
+// which may be compressed with bzip2, xz or gzip.  Hetzner Cloud can't
+// import images, so a temporary server is booted into the rescue
+// system, the image is written over its disk and the disk is
+// snapshotted.  The snapshot is described by name.  The temporary key
+// and server are named and labelled like the resources of a flight, so
+// that a key left behind by an interrupted upload is an orphan for
+// 'ore gc' once the server is gone.
+func (a *API) UploadImage(ctx context.Context, name, imageURL string) (*Image, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpName := fmt.Sprintf("mantle-upload-%s", uuid.New())
+
+	keyID, err := a.AddKey(ctx, tmpName, string(ssh.MarshalAuthorizedKey(sshPub)))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := a.DeleteKey(ctx, keyID); err != nil {
+			plog.Errorf("Error deleting key %v: %v", keyID, err)
+		}
+	}()
+
+	plog.Infof("Creating temporary server %v", tmpName)
+	server, err := a.createServer(ctx, createServerRequest{
+		Name:       tmpName,
+		ServerType: a.opts.ServerType,
+		Image:      uploadBaseImage,
+		Location:   a.opts.Location,
+		SSHKeys:    []int64{keyID},
+		Labels:     flightLabels(tmpName),
+	}, "off")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := a.DeleteServer(ctx, server.ID); err != nil {
+			plog.Errorf("Error deleting server %v: %v", server.ID, err)
+		}
+	}()
+
+	rescue := map[string]interface{}{
+		"type":     "linux64",
+		"ssh_keys": []int64{keyID},
+	}
+	if err := a.serverAction(ctx, server.ID, "enable_rescue", rescue, nil, 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if err := a.serverAction(ctx, server.ID, "poweron", nil, nil, 5*time.Minute); err != nil {
+		return nil, err
+	}
+
+	ip := server.PublicNet.IPv4.IP
+	plog.Infof("Waiting for rescue system on %v", ip)
+	err = util.Retry(60, a.interval, func() error {
+		_, err := a.rescueExec(ip, signer, "true")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to rescue system: %v", err)
+	}
+
+	plog.Infof("Writing %v to disk", imageURL)
+	if out, err := a.rescueExec(ip, signer, writeImageCommand(imageURL)); err != nil {
+		return nil, fmt.Errorf("writing image: %v: %s", err, out)
+	}
+
+	if err := a.serverAction(ctx, server.ID, "poweroff", nil, nil, 5*time.Minute); err != nil {
+		return nil, err
+	}
+
+	plog.Infof("Creating snapshot %v", name)
+	return a.CreateSnapshot(ctx, server.ID, name)
+}
+
+// writeImageCommand returns the rescue system shell command writing
+// the image at imageURL to the server's disk.
+func writeImageCommand(imageURL string) string {
+	decompress := "cat"
+	switch {
+	case strings.HasSuffix(imageURL, ".bz2"):
+		decompress = "bzip2 -dc"
+	case strings.HasSuffix(imageURL, ".xz"):
+		decompress = "xz -dc"
+	case strings.HasSuffix(imageURL, ".gz"):
+		decompress = "gzip -dc"
+	}
+	quoted := "'" + strings.ReplaceAll(imageURL, "'", `'\''`) + "'"
+	return fmt.Sprintf("set -o pipefail; curl -fsSL %s | %s | dd of=/dev/sda bs=4M conv=fsync status=none", quoted, decompress)
+}
+
+func sshExec(ip string, signer ssh.Signer, cmd string) ([]byte, error) {
+	client, err := ssh.Dial("tcp", net.JoinHostPort(ip, "22"), &ssh.ClientConfig{
+		User:            "root",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         30 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	return session.CombinedOutput(cmd)
+}
@@ -0,0 +1,328 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package libvirt manages networks, storage volumes and domains of a
+// libvirt daemon through virsh, so that anyone with access to libvirtd
+// can run machines without being root.
+package libvirt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/system/exec"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar-linux/mantle", "platform/api/libvirt")
+)
+
+type Options struct {
+	*platform.Options
+
+	// URI of the libvirt daemon, e.g. "qemu:///system".
+	URI string
+	// StoragePool holds the base image and per-machine overlays.
+	StoragePool string
+	// Network is an existing network to attach machines to. If empty,
+	// each cluster gets its own NAT network.
+	Network string
+	// DiskImage is the path of the image to boot.
+	DiskImage string
+	// Memory of each machine in MiB.
+	Memory int
+	// CPUs of each machine.
+	CPUs int
+}
+
+type API struct {
+	opts *Options
+}
+
+// New checks that virsh can reach the libvirt daemon.
+func New(opts *Options) (*API, error) {
+	a := &API{opts: opts}
+	if _, err := a.virsh("version"); err != nil {
+		return nil, fmt.Errorf("connecting to libvirt: %v", err)
+	}
+	return a, nil
+}
+
+// Options returns the options the API was created with.
+func (a *API) Options() *Options {
+	return a.opts
+}
+
+// virsh runs a virsh command and returns its standard output.
+func (a *API) virsh(args ...string) ([]byte, error) {
+	if a.opts.URI != "" {
+		args = append([]string{"--connect", a.opts.URI}, args...)
+	}
+	plog.Debugf("virsh %s", strings.Join(args, " "))
+
+	cmd := exec.Command("virsh", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("virsh %s: %v: %s", args[0], err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// define runs a virsh command that reads an XML description from a file.
+func (a *API) define(command, xml string, args ...string) error {
+	f, err := ioutil.TempFile("", "mantle-libvirt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(xml); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	_, err = a.virsh(append([]string{command, f.Name()}, args...)...)
+	return err
+}
+
+// CreateNetwork defines and starts a NAT network with DHCP on subnet, a
+// /24 network address such as 192.168.100.0.
+func (a *API) CreateNetwork(name string, subnet net.IP) error {
+	xml, err := networkXML(name, subnet)
+	if err != nil {
+		return err
+	}
+	if err := a.define("net-define", xml); err != nil {
+		return err
+	}
+	if _, err := a.virsh("net-start", name); err != nil {
+		a.virsh("net-undefine", name)
+		return err
+	}
+	return nil
+}
+
+// DeleteNetwork stops and removes a network.
+func (a *API) DeleteNetwork(name string) error {
+	if _, err := a.virsh("net-destroy", name); err != nil {
+		plog.Warningf("stopping network %s: %v", name, err)
+	}
+	_, err := a.virsh("net-undefine", name)
+	return err
+}
+
+// UploadVolume creates a volume in the storage pool with the contents of
+// path and returns its path.
+func (a *API) UploadVolume(name, path, format string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := a.virsh("vol-create-as", a.opts.StoragePool, name,
+		fmt.Sprint(info.Size()), "--format", format); err != nil {
+		return "", err
+	}
+	if _, err := a.virsh("vol-upload", "--pool", a.opts.StoragePool, name, path); err != nil {
+		a.DeleteVolume(name)
+		return "", err
+	}
+	return a.VolumePath(name)
+}
+
+// CreateOverlay creates a qcow2 volume backed by the volume base.
+func (a *API) CreateOverlay(name, base, baseFormat string) (string, error) {
+	basePath, err := a.VolumePath(base)
+	if err != nil {
+		return "", err
+	}
+	capacity, err := a.volumeCapacity(base)
+	if err != nil {
+		return "", err
+	}
+	if _, err := a.virsh("vol-create-as", a.opts.StoragePool, name, capacity,
+		"--format", "qcow2", "--backing-vol", basePath, "--backing-vol-format", baseFormat); err != nil {
+		return "", err
+	}
+	return a.VolumePath(name)
+}
+
+func (a *API) volumeCapacity(name string) (string, error) {
+	out, err := a.virsh("vol-info", "--bytes", "--pool", a.opts.StoragePool, name)
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "Capacity:" {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("no capacity for volume %s", name)
+}
+
+// VolumePath returns the path of a volume in the storage pool.
+func (a *API) VolumePath(name string) (string, error) {
+	out, err := a.virsh("vol-path", "--pool", a.opts.StoragePool, name)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// DeleteVolume removes a volume from the storage pool.
+func (a *API) DeleteVolume(name string) error {
+	_, err := a.virsh("vol-delete", "--pool", a.opts.StoragePool, name)
+	return err
+}
+
+// ListVolumes returns the names of the volumes in the storage pool.
+func (a *API) ListVolumes() ([]string, error) {
+	out, err := a.virsh("vol-list", "--pool", a.opts.StoragePool, "--name")
+	if err != nil {
+		return nil, err
+	}
+	return names(out), nil
+}
+
+// VolumeInfo returns the path, modification time and backing store of a
+// volume in the storage pool. It fails for pools that aren't file based,
+// which don't record when a volume was last written.
+func (a *API) VolumeInfo(name string) (*VolumeInfo, error) {
+	out, err := a.virsh("vol-dumpxml", "--pool", a.opts.StoragePool, name)
+	if err != nil {
+		return nil, err
+	}
+	return parseVolumeInfo(out)
+}
+
+// CreateDomain defines a domain and starts it paused, so that a console
+// can be attached before it runs.
+func (a *API) CreateDomain(d *Domain) error {
+	xml, err := d.XML()
+	if err != nil {
+		return err
+	}
+	if err := a.define("define", xml); err != nil {
+		return err
+	}
+	if _, err := a.virsh("start", "--paused", d.Name); err != nil {
+		a.virsh("undefine", d.Name)
+		return err
+	}
+	return nil
+}
+
+// ResumeDomain resumes a paused domain.
+func (a *API) ResumeDomain(name string) error {
+	_, err := a.virsh("resume", name)
+	return err
+}
+
+// DeleteDomain stops and removes a domain.
+func (a *API) DeleteDomain(name string) error {
+	if _, err := a.virsh("destroy", name); err != nil {
+		plog.Debugf("stopping domain %s: %v", name, err)
+	}
+	_, err := a.virsh("undefine", "--nvram", name)
+	return err
+}
+
+// ListDomains returns the names of all defined domains.
+func (a *API) ListDomains() ([]string, error) {
+	out, err := a.virsh("list", "--all", "--name")
+	if err != nil {
+		return nil, err
+	}
+	return names(out), nil
+}
+
+// DomainInfo returns the creation time, networks and disks of a domain.
+func (a *API) DomainInfo(name string) (*DomainInfo, error) {
+	out, err := a.virsh("dumpxml", "--inactive", name)
+	if err != nil {
+		return nil, err
+	}
+	return parseDomainInfo(out)
+}
+
+// ListNetworks returns the names of all defined networks.
+func (a *API) ListNetworks() ([]string, error) {
+	out, err := a.virsh("net-list", "--all", "--name")
+	if err != nil {
+		return nil, err
+	}
+	return names(out), nil
+}
+
+// NetworkCreated returns the creation time of a network, which is zero
+// for networks not created by mantle.
+func (a *API) NetworkCreated(name string) (time.Time, error) {
+	out, err := a.virsh("net-dumpxml", "--inactive", name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseNetworkCreated(out)
+}
+
+// DomainAddress returns the IPv4 address the network's DHCP server leased
+// to a domain.
+func (a *API) DomainAddress(name string) (string, error) {
+	out, err := a.virsh("domifaddr", name, "--source", "lease")
+	if err != nil {
+		return "", err
+	}
+	return parseDomIfAddr(out)
+}
+
+func names(out []byte) []string {
+	var l []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if name := strings.TrimSpace(scanner.Text()); name != "" {
+			l = append(l, name)
+		}
+	}
+	return l
+}
+
+// parseDomIfAddr returns the first IPv4 address in the table printed by
+// virsh domifaddr, which lists one address per line as the last column.
+func parseDomIfAddr(out []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 || fields[2] != "ipv4" {
+			continue
+		}
+		ip, _, err := net.ParseCIDR(fields[3])
+		if err != nil {
+			return "", fmt.Errorf("parsing address %q: %v", fields[3], err)
+		}
+		return ip.String(), nil
+	}
+	return "", fmt.Errorf("no IPv4 address leased yet")
+}
@@ -0,0 +1,201 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libvirt
+
+import (
+	"encoding/xml"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDomIfAddr(t *testing.T) {
+	out := ` Name       MAC address          Protocol     Address
+-------------------------------------------------------------------------------
+ vnet0      52:54:00:4b:73:5f    ipv6         fe80::5054:ff:fe4b:735f/64
+ vnet0      52:54:00:4b:73:5f    ipv4         192.168.122.45/24
+`
+	addr, err := parseDomIfAddr([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr != "192.168.122.45" {
+		t.Errorf("expected 192.168.122.45, got %s", addr)
+	}
+
+	empty := ` Name       MAC address          Protocol     Address
+-------------------------------------------------------------------------------
+`
+	if _, err := parseDomIfAddr([]byte(empty)); err == nil {
+		t.Errorf("expected error without a lease")
+	}
+}
+
+func TestNames(t *testing.T) {
+	l := names([]byte("kola-a\n\nkola-b\n \n"))
+	if len(l) != 2 || l[0] != "kola-a" || l[1] != "kola-b" {
+		t.Errorf("unexpected names %q", l)
+	}
+}
+
+func TestNetworkXML(t *testing.T) {
+	xml, err := networkXML("kola-net", net.ParseIP("192.168.150.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"<name>kola-net</name>",
+		"address='192.168.150.1'",
+		"start='192.168.150.2' end='192.168.150.254'",
+	} {
+		if !strings.Contains(xml, s) {
+			t.Errorf("network XML lacks %q:\n%s", s, xml)
+		}
+	}
+
+	created, err := parseNetworkCreated([]byte(xml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(created) > time.Minute {
+		t.Errorf("unexpected creation time %v", created)
+	}
+
+	if _, err := networkXML("kola-net", net.ParseIP("fd00::")); err == nil {
+		t.Errorf("expected error for IPv6 subnet")
+	}
+}
+
+func TestDomainXML(t *testing.T) {
+	d := &Domain{
+		Name:     "kola-vm",
+		UUID:     "6d7fd1a8-5b0a-4c85-9f4e-bd5c8f2a0f1e",
+		Board:    "arm64-usr",
+		Memory:   1024,
+		CPUs:     2,
+		Disk:     "/var/lib/libvirt/images/kola-vm.qcow2",
+		Ignition: "/var/lib/libvirt/images/kola-vm.ign",
+		Network:  "kola-net",
+	}
+	xml, err := d.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"<os firmware='efi'>",
+		"arch='aarch64' machine='virt'",
+		"<gic version='host'/>",
+		"<source network='kola-net'/>",
+		"file=/var/lib/libvirt/images/kola-vm.ign",
+	} {
+		if !strings.Contains(xml, s) {
+			t.Errorf("domain XML lacks %q:\n%s", s, xml)
+		}
+	}
+
+	info, err := parseDomainInfo([]byte(xml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(info.Created) > time.Minute || len(info.Networks) != 1 || info.Networks[0] != "kola-net" ||
+		len(info.Disks) != 1 || info.Disks[0] != "/var/lib/libvirt/images/kola-vm.qcow2" {
+		t.Errorf("unexpected domain info %+v", info)
+	}
+
+	d.Board = "riscv-usr"
+	if _, err := d.XML(); err == nil {
+		t.Errorf("expected error for unsupported board")
+	}
+}
+
+func TestDomainXMLEscaping(t *testing.T) {
+	created := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	d := &Domain{
+		Name:     "kola-<vm>&'x'",
+		UUID:     "6d7fd1a8-5b0a-4c85-9f4e-bd5c8f2a0f1e",
+		Board:    "amd64-usr",
+		Memory:   1024,
+		CPUs:     2,
+		Disk:     "/images/it's.qcow2",
+		Ignition: "/images/a,b.ign",
+		Network:  "kola-net",
+		Created:  created,
+	}
+	data, err := d.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed struct {
+		Name string `xml:"name"`
+		Disk struct {
+			File string `xml:"file,attr"`
+		} `xml:"devices>disk>source"`
+		Args []struct {
+			Value string `xml:"value,attr"`
+		} `xml:"commandline>arg"`
+	}
+	if err := xml.Unmarshal([]byte(data), &parsed); err != nil {
+		t.Fatalf("invalid domain XML: %v\n%s", err, data)
+	}
+	if parsed.Name != d.Name || parsed.Disk.File != d.Disk {
+		t.Errorf("values changed by escaping: %+v", parsed)
+	}
+	if len(parsed.Args) != 2 || parsed.Args[1].Value != "name=opt/org.flatcar-linux/config,file=/images/a,,b.ign" {
+		t.Errorf("unexpected qemu arguments %+v", parsed.Args)
+	}
+
+	info, err := parseDomainInfo([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Created.Equal(created) {
+		t.Errorf("expected creation time %v, got %v", created, info.Created)
+	}
+}
+
+func TestParseVolumeInfo(t *testing.T) {
+	out := `<volume type='file'>
+  <name>kola-vm.qcow2</name>
+  <target>
+    <path>/var/lib/libvirt/images/kola-vm.qcow2</path>
+    <timestamps>
+      <atime>1622548800.5</atime>
+      <mtime>1622548800.250000000</mtime>
+      <ctime>1622548800.250000000</ctime>
+    </timestamps>
+  </target>
+  <backingStore>
+    <path>/var/lib/libvirt/images/kola-base</path>
+    <format type='qcow2'/>
+  </backingStore>
+</volume>
+`
+	info, err := parseVolumeInfo([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Unix(1622548800, 250000000); !info.Modified.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, info.Modified)
+	}
+	if info.Path != "/var/lib/libvirt/images/kola-vm.qcow2" || info.Backing != "/var/lib/libvirt/images/kola-base" {
+		t.Errorf("unexpected volume info %+v", info)
+	}
+
+	if _, err := parseVolumeInfo([]byte("<volume><name>v</name></volume>")); err == nil {
+		t.Errorf("expected error without timestamps")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libvirt
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/flatcar-linux/mantle/system/exec"
+)
+
+// Console captures the serial console of a domain with virsh console.
+type Console struct {
+	cmd    *exec.ExecCmd
+	master *os.File
+	done   chan struct{}
+}
+
+// openPty allocates a pseudo terminal, since virsh console refuses to run
+// without one.
+func openPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd := int(master.Fd())
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("getting pty number: %v", err)
+	}
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("unlocking pty: %v", err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// AttachConsole starts copying the console of a domain to w.
+func (a *API) AttachConsole(name string, w io.Writer) (*Console, error) {
+	master, slave, err := openPty()
+	if err != nil {
+		return nil, err
+	}
+	defer slave.Close()
+
+	args := []string{"console", "--force", name}
+	if a.opts.URI != "" {
+		args = append([]string{"--connect", a.opts.URI}, args...)
+	}
+	cmd := exec.Command("virsh", args...)
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+	}
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	c := &Console{
+		cmd:    cmd,
+		master: master,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		// reading fails with EIO once virsh exits
+		io.Copy(w, master)
+		close(c.done)
+	}()
+	return c, nil
+}
+
+// Close stops the capture and waits for the remaining output.
+func (c *Console) Close() {
+	c.cmd.Kill()
+	<-c.done
+	c.master.Close()
+}
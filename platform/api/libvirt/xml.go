@@ -0,0 +1,285 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libvirt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	// metadataNamespace qualifies the metadata mantle stores in domains.
+	metadataNamespace = "https://github.com/flatcar-linux/mantle"
+	// createdRecord is a DNS TXT record holding the creation time of a
+	// network, as networks only gained metadata in recent libvirt.
+	createdRecord = "mantle-created"
+)
+
+var (
+	// funcs escape values for XML text and quoted attributes. Every
+	// value in the templates must go through xml.
+	funcs = template.FuncMap{
+		"xml": func(v interface{}) (string, error) {
+			var buf bytes.Buffer
+			err := xml.EscapeText(&buf, []byte(fmt.Sprint(v)))
+			return buf.String(), err
+		},
+		// qemu separates suboptions with commas and reads ",," as
+		// a literal comma.
+		"qemuopt": func(s string) string {
+			return strings.Replace(s, ",", ",,", -1)
+		},
+	}
+
+	networkTemplate = template.Must(template.New("network").Funcs(funcs).Parse(`<network>
+  <name>{{xml .Name}}</name>
+  <forward mode='nat'/>
+  <dns>
+    <txt name='{{xml .CreatedRecord}}' value='{{xml .Created}}'/>
+  </dns>
+  <ip address='{{xml .Gateway}}' netmask='255.255.255.0'>
+    <dhcp>
+      <range start='{{xml .Start}}' end='{{xml .End}}'/>
+    </dhcp>
+  </ip>
+</network>
+`))
+
+	domainTemplate = template.Must(template.New("domain").Funcs(funcs).Parse(`<domain type='kvm' xmlns:qemu='http://libvirt.org/schemas/domain/qemu/1.0'>
+  <name>{{xml .Name}}</name>
+  <uuid>{{xml .UUID}}</uuid>
+  <metadata>
+    <mantle:instance xmlns:mantle='{{xml .Namespace}}'>
+      <mantle:created>{{xml .Created}}</mantle:created>
+    </mantle:instance>
+  </metadata>
+  <memory unit='MiB'>{{xml .Memory}}</memory>
+  <vcpu>{{xml .CPUs}}</vcpu>
+  <os{{if .EFI}} firmware='efi'{{end}}>
+    <type arch='{{xml .Arch}}' machine='{{xml .Machine}}'>hvm</type>
+  </os>
+  <features>
+    <acpi/>
+{{- if eq .Arch "aarch64"}}
+    <gic version='host'/>
+{{- end}}
+  </features>
+  <cpu mode='host-passthrough'/>
+  <on_reboot>restart</on_reboot>
+  <devices>
+    <disk type='file' device='disk'>
+      <driver name='qemu' type='qcow2'/>
+      <source file='{{xml .Disk}}'/>
+      <target dev='vda' bus='virtio'/>
+      <serial>primary-disk</serial>
+    </disk>
+    <interface type='network'>
+      <source network='{{xml .Network}}'/>
+      <model type='virtio'/>
+    </interface>
+    <serial type='pty'>
+      <target port='0'/>
+    </serial>
+    <console type='pty'/>
+    <rng model='virtio'>
+      <backend model='random'>/dev/urandom</backend>
+    </rng>
+  </devices>
+  <qemu:commandline>
+    <qemu:arg value='-fw_cfg'/>
+    <qemu:arg value='name=opt/org.flatcar-linux/config,file={{xml (qemuopt .Ignition)}}'/>
+  </qemu:commandline>
+</domain>
+`))
+)
+
+// Domain describes a machine booting a Container Linux disk with an
+// Ignition config passed through fw_cfg.
+type Domain struct {
+	Name     string
+	UUID     string
+	Board    string
+	Memory   int
+	CPUs     int
+	Disk     string
+	Ignition string
+	Network  string
+	// Created is recorded in the domain metadata for garbage
+	// collection. It defaults to the current time.
+	Created time.Time
+}
+
+// XML returns the libvirt domain description.
+func (d *Domain) XML() (string, error) {
+	params := struct {
+		*Domain
+		Arch      string
+		Machine   string
+		EFI       bool
+		Namespace string
+		Created   string
+	}{Domain: d, Namespace: metadataNamespace}
+	created := d.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	params.Created = created.UTC().Format(time.RFC3339)
+	switch d.Board {
+	case "amd64-usr":
+		params.Arch, params.Machine = "x86_64", "q35"
+	case "arm64-usr":
+		params.Arch, params.Machine, params.EFI = "aarch64", "virt", true
+	default:
+		return "", fmt.Errorf("unsupported board %q", d.Board)
+	}
+
+	var buf bytes.Buffer
+	if err := domainTemplate.Execute(&buf, params); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func networkXML(name string, subnet net.IP) (string, error) {
+	ip := subnet.To4()
+	if ip == nil {
+		return "", fmt.Errorf("%s is not an IPv4 address", subnet)
+	}
+	host := func(n byte) string {
+		return net.IPv4(ip[0], ip[1], ip[2], n).String()
+	}
+
+	var buf bytes.Buffer
+	err := networkTemplate.Execute(&buf, map[string]string{
+		"Name":          name,
+		"Gateway":       host(1),
+		"Start":         host(2),
+		"End":           host(254),
+		"CreatedRecord": createdRecord,
+		"Created":       time.Now().UTC().Format(time.RFC3339),
+	})
+	return buf.String(), err
+}
+
+// parseNetworkCreated returns the creation time of a network, which is
+// zero for networks not created by mantle.
+func parseNetworkCreated(data []byte) (time.Time, error) {
+	var n struct {
+		Records []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"dns>txt"`
+	}
+	if err := xml.Unmarshal(data, &n); err != nil {
+		return time.Time{}, fmt.Errorf("parsing network XML: %v", err)
+	}
+	for _, r := range n.Records {
+		if r.Name == createdRecord {
+			return time.Parse(time.RFC3339, r.Value)
+		}
+	}
+	return time.Time{}, nil
+}
+
+// DomainInfo is what the API reads back from a domain description.
+type DomainInfo struct {
+	// Created is zero for domains not created by mantle.
+	Created time.Time
+	// Networks the domain is attached to.
+	Networks []string
+	// Disks are the paths of the files backing the domain's disks.
+	Disks []string
+}
+
+func parseDomainInfo(data []byte) (*DomainInfo, error) {
+	var d struct {
+		Created    string `xml:"metadata>instance>created"`
+		Interfaces []struct {
+			Type   string `xml:"type,attr"`
+			Source struct {
+				Network string `xml:"network,attr"`
+			} `xml:"source"`
+		} `xml:"devices>interface"`
+		Disks []struct {
+			Source struct {
+				File string `xml:"file,attr"`
+			} `xml:"source"`
+		} `xml:"devices>disk"`
+	}
+	if err := xml.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("parsing domain XML: %v", err)
+	}
+	var info DomainInfo
+	if d.Created != "" {
+		created, err := time.Parse(time.RFC3339, d.Created)
+		if err != nil {
+			return nil, fmt.Errorf("parsing domain creation time: %v", err)
+		}
+		info.Created = created
+	}
+	for _, i := range d.Interfaces {
+		if i.Type == "network" {
+			info.Networks = append(info.Networks, i.Source.Network)
+		}
+	}
+	for _, disk := range d.Disks {
+		if disk.Source.File != "" {
+			info.Disks = append(info.Disks, disk.Source.File)
+		}
+	}
+	return &info, nil
+}
+
+// VolumeInfo is what the API reads back from a volume description.
+type VolumeInfo struct {
+	// Path of the volume.
+	Path string
+	// Modified is when the volume was last written.
+	Modified time.Time
+	// Backing is the path of the volume's backing store, if any.
+	Backing string
+}
+
+// parseVolumeInfo requires a modification time, which file based pools
+// report as seconds since the epoch with a fraction.
+func parseVolumeInfo(data []byte) (*VolumeInfo, error) {
+	var v struct {
+		Path    string `xml:"target>path"`
+		Mtime   string `xml:"target>timestamps>mtime"`
+		Backing string `xml:"backingStore>path"`
+	}
+	if err := xml.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("parsing volume XML: %v", err)
+	}
+	if v.Mtime == "" {
+		return nil, fmt.Errorf("volume has no modification time")
+	}
+	f, err := strconv.ParseFloat(v.Mtime, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parsing volume modification time: %v", err)
+	}
+	sec := int64(f)
+	return &VolumeInfo{
+		Path:     v.Path,
+		Modified: time.Unix(sec, int64((f-float64(sec))*1e9)),
+		Backing:  v.Backing,
+	}, nil
+}
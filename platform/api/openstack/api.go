@@ -64,6 +64,9 @@ type Options struct {
 	Domain string
 	// Floating IP Pool
 	FloatingIPPool string
+	// Identity endpoint URL overriding the profile's auth_url, for
+	// testing against a fake server
+	Endpoint string
 }
 
 type Server struct {
@@ -96,6 +99,10 @@ func New(opts *Options) (*API, error) {
 		opts.Domain = profile.Domain
 	}
 
+	if opts.Endpoint != "" {
+		profile.AuthURL = opts.Endpoint
+	}
+
 	osOpts := gophercloud.AuthOptions{
 		IdentityEndpoint: profile.AuthURL,
 		TenantID:         profile.TenantID,
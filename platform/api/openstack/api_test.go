@@ -0,0 +1,216 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openstack
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flatcar-linux/mantle/auth"
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/openstack/fake"
+	"github.com/flatcar-linux/mantle/platform/inventory"
+	"github.com/flatcar-linux/mantle/platform/inventory/inventorytest"
+)
+
+// newTestAPI creates an API against a fake server, which is seeded by
+// setup before the API resolves its options.
+func newTestAPI(t *testing.T, opts Options, setup func(*fake.Server)) (*API, *fake.Server, error) {
+	server := fake.NewServer()
+	t.Cleanup(server.Close)
+	if setup != nil {
+		setup(server)
+	}
+
+	config, err := json.Marshal(map[string]auth.OpenStackProfile{
+		"default": {
+			AuthURL:  "http://keystone.invalid/",
+			TenantID: fake.Project,
+			Username: "kola",
+			Password: "password",
+			Domain:   "default",
+			Region:   fake.Region,
+		},
+	})
+	require.NoError(t, err)
+	opts.ConfigPath = filepath.Join(t.TempDir(), "openstack.json")
+	require.NoError(t, ioutil.WriteFile(opts.ConfigPath, config, 0600))
+	opts.Options = &platform.Options{}
+	opts.Endpoint = server.URL
+
+	api, err := New(&opts)
+	if err != nil {
+		return nil, server, err
+	}
+	require.NoError(t, api.PreflightCheck())
+	return api, server, nil
+}
+
+func mantleServer(name string, created time.Time) servers.Server {
+	return servers.Server{
+		Name:     name,
+		KeyName:  inventorytest.Flight,
+		Created:  created,
+		Metadata: map[string]string{"CreatedBy": "mantle"},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	var flavor, image, network string
+	api, _, err := newTestAPI(t, Options{
+		Flavor:  "m1.small",
+		Image:   "flatcar",
+		Network: "private",
+	}, func(s *fake.Server) {
+		flavor = s.AddFlavor("m1.small")
+		image = s.AddImage("flatcar")
+		network = s.AddNetwork("private")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, flavor, api.opts.Flavor)
+	assert.Equal(t, image, api.opts.Image)
+	assert.Equal(t, network, api.opts.Network)
+	assert.Equal(t, fake.Region, api.opts.Region)
+
+	_, _, err = newTestAPI(t, Options{Image: "flatcar"}, nil)
+	assert.Error(t, err)
+}
+
+func TestCreateServer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the server poll interval")
+	}
+	api, server, err := newTestAPI(t, Options{
+		Flavor:         "m1.small",
+		Image:          "flatcar",
+		FloatingIPPool: "public",
+	}, func(s *fake.Server) {
+		s.AddFlavor("m1.small")
+		s.AddImage("flatcar")
+		s.AddNetwork("private")
+	})
+	require.NoError(t, err)
+	require.NoError(t, api.AddKey(inventorytest.Flight, "ssh-ed25519 AAAA"))
+
+	srv, err := api.CreateServer("kola-1", inventorytest.Flight, "{}")
+	require.NoError(t, err)
+	assert.Equal(t, "ACTIVE", srv.Server.Status)
+	assert.Equal(t, "mantle", srv.Server.Metadata["CreatedBy"])
+	require.NotNil(t, srv.FloatingIP)
+	assert.Equal(t, srv.FloatingIP.IP, srv.Server.AccessIPv4)
+	require.Len(t, server.SecurityGroups(), 1)
+	assert.Equal(t, "kola", server.SecurityGroups()[0].Name)
+
+	require.NoError(t, api.DeleteServer(srv.Server.ID))
+	assert.Empty(t, server.Servers())
+	assert.Zero(t, server.FloatingIPs())
+}
+
+func TestConsoleOutput(t *testing.T) {
+	api, server, err := newTestAPI(t, Options{}, nil)
+	require.NoError(t, err)
+	id := server.AddServer(mantleServer("kola-1", time.Now()))
+	server.SetConsoleOutput(id, "login: ")
+
+	out, err := api.GetConsoleOutput(id)
+	require.NoError(t, err)
+	assert.Equal(t, "login: ", out)
+
+	_, err = api.GetConsoleOutput("missing")
+	assert.Error(t, err)
+}
+
+func TestKeys(t *testing.T) {
+	api, server, err := newTestAPI(t, Options{}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, api.AddKey(inventorytest.Flight, "ssh-ed25519 AAAA"))
+	require.Len(t, server.KeyPairs(), 1)
+	assert.Equal(t, "ssh-ed25519 AAAA", server.KeyPairs()[0].PublicKey)
+	assert.Error(t, api.AddKey(inventorytest.Flight, "ssh-ed25519 AAAA"))
+
+	require.NoError(t, api.DeleteKey(inventorytest.Flight))
+	assert.Empty(t, server.KeyPairs())
+	assert.Error(t, api.DeleteKey(inventorytest.Flight))
+}
+
+func TestImages(t *testing.T) {
+	api, server, err := newTestAPI(t, Options{}, nil)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "image.qcow2")
+	require.NoError(t, ioutil.WriteFile(path, []byte("QFI\xfb"), 0644))
+
+	id, err := api.UploadImage("flatcar-test", path)
+	require.NoError(t, err)
+	require.Len(t, server.Images(), 1)
+	assert.Equal(t, []string{"mantle"}, server.Images()[0].Tags)
+	assert.Equal(t, []byte("QFI\xfb"), server.ImageData(id))
+
+	resolved, err := api.ResolveImage("flatcar-test")
+	require.NoError(t, err)
+	assert.Equal(t, id, resolved)
+
+	_, err = api.UploadImage("missing", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+	assert.Len(t, server.Images(), 1)
+
+	require.NoError(t, api.DeleteImage(id))
+	assert.Empty(t, server.Images())
+}
+
+func TestGC(t *testing.T) {
+	api, server, err := newTestAPI(t, Options{}, nil)
+	require.NoError(t, err)
+	old := time.Now().Add(-6 * time.Hour)
+	server.AddServer(mantleServer("old", old))
+	server.AddServer(mantleServer("new", time.Now()))
+	server.AddServer(servers.Server{Name: "other", Created: old})
+
+	require.NoError(t, api.GC(5*time.Hour))
+
+	var names []string
+	for _, srv := range server.Servers() {
+		names = append(names, srv.Name)
+	}
+	assert.Equal(t, []string{"new", "other"}, names)
+}
+
+func TestInventory(t *testing.T) {
+	api, server, err := newTestAPI(t, Options{}, func(s *fake.Server) {
+		s.AddImage("flatcar-test", "mantle")
+		s.AddImage("release")
+	})
+	require.NoError(t, err)
+	id := server.AddServer(mantleServer("kola-1", time.Now()))
+	server.AddServer(servers.Server{Name: "other"})
+	require.NoError(t, api.AddKey(inventorytest.Flight, "ssh-ed25519 AAAA"))
+	require.NoError(t, api.AddKey("laptop", "ssh-ed25519 BBBB"))
+
+	inventorytest.CheckProvider(t, api, []inventory.Resource{
+		{Cloud: "openstack", Kind: inventory.KindInstance, ID: id, Name: "kola-1", Region: fake.Region, Owner: fake.Project, Flight: inventorytest.Flight},
+		{Cloud: "openstack", Kind: inventory.KindImage, Name: "flatcar-test", Region: fake.Region, Owner: fake.Project},
+		{Cloud: "openstack", Kind: inventory.KindKey, ID: inventorytest.Flight, Name: inventorytest.Flight, Region: fake.Region, Owner: fake.User, Flight: inventorytest.Flight},
+	})
+	require.Len(t, server.Servers(), 1)
+	require.Len(t, server.Images(), 1)
+	require.Len(t, server.KeyPairs(), 1)
+}
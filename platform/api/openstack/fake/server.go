@@ -0,0 +1,725 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake implements an in-process fake of the subset of the
+// OpenStack identity, compute, image and network APIs used by mantle,
+// for testing without credentials.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+)
+
+const (
+	// Project is the project that owns all resources on the server.
+	Project = "fake-project"
+	// User is the user that owns all key pairs on the server.
+	User = "fake-user"
+	// Region is the region of all endpoints in the service catalog.
+	Region = "RegionOne"
+
+	token = "fake-token"
+)
+
+// floatingIP is a nova-network floating IP.
+type floatingIP struct {
+	ID         string `json:"id"`
+	IP         string `json:"ip"`
+	Pool       string `json:"pool"`
+	InstanceID string `json:"instance_id"`
+}
+
+// Server is a fake OpenStack cloud. Its URL is the identity endpoint;
+// the compute, image and network services are served below it as
+// listed in the service catalog. Servers are created ACTIVE.
+type Server struct {
+	*httptest.Server
+
+	mu             sync.Mutex
+	nextID         int
+	servers        map[string]*servers.Server
+	consoleOutput  map[string]string
+	flavors        map[string]*flavors.Flavor
+	images         map[string]*images.Image
+	imageData      map[string][]byte
+	networks       map[string]*networks.Network
+	securityGroups map[string]*groups.SecGroup
+	keyPairs       map[string]*keypairs.KeyPair
+	floatingIPs    map[string]*floatingIP
+}
+
+// NewServer starts a fake server; the caller must Close it.
+func NewServer() *Server {
+	s := &Server{
+		nextID:         1,
+		servers:        make(map[string]*servers.Server),
+		consoleOutput:  make(map[string]string),
+		flavors:        make(map[string]*flavors.Flavor),
+		images:         make(map[string]*images.Image),
+		imageData:      make(map[string][]byte),
+		networks:       make(map[string]*networks.Network),
+		securityGroups: make(map[string]*groups.SecGroup),
+		keyPairs:       make(map[string]*keypairs.KeyPair),
+		floatingIPs:    make(map[string]*floatingIP),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *Server) id() string {
+	id := fmt.Sprintf("00000000-0000-0000-0000-%012x", s.nextID)
+	s.nextID++
+	return id
+}
+
+// AddFlavor adds an instance flavor and returns its ID.
+func (s *Server) AddFlavor(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := &flavors.Flavor{ID: s.id(), Name: name, RAM: 2048, VCPUs: 1, Disk: 10, IsPublic: true}
+	s.flavors[f.ID] = f
+	return f.ID
+}
+
+// AddImage adds an active image and returns its ID.
+func (s *Server) AddImage(name string, tags ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	i := &images.Image{
+		ID:              s.id(),
+		Name:            name,
+		Status:          images.ImageStatusActive,
+		Tags:            tags,
+		ContainerFormat: "bare",
+		DiskFormat:      "qcow2",
+		Owner:           Project,
+		Visibility:      images.ImageVisibilityPrivate,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	s.images[i.ID] = i
+	return i.ID
+}
+
+// AddNetwork adds a network and returns its ID.
+func (s *Server) AddNetwork(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := &networks.Network{ID: s.id(), Name: name, Status: "ACTIVE", AdminStateUp: true, TenantID: Project, ProjectID: Project}
+	s.networks[n.ID] = n
+	return n.ID
+}
+
+// AddServer adds a server as if it had been created outside mantle and
+// returns its ID. The server is ACTIVE unless srv.Status is set.
+func (s *Server) AddServer(srv servers.Server) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	srv.ID = s.id()
+	if srv.Status == "" {
+		srv.Status = "ACTIVE"
+	}
+	if srv.Created.IsZero() {
+		srv.Created = time.Now().UTC()
+	}
+	if srv.TenantID == "" {
+		srv.TenantID = Project
+	}
+	s.servers[srv.ID] = &srv
+	return srv.ID
+}
+
+// SetConsoleOutput sets the console output of a server.
+func (s *Server) SetConsoleOutput(serverID, output string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.consoleOutput[serverID] = output
+}
+
+// Servers returns the servers on the server, ordered by ID.
+func (s *Server) Servers() []servers.Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []servers.Server
+	for _, srv := range s.servers {
+		ret = append(ret, *srv)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+// Images returns the images on the server, ordered by ID.
+func (s *Server) Images() []images.Image {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []images.Image
+	for _, i := range s.images {
+		ret = append(ret, *i)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+// ImageData returns the uploaded data of an image.
+func (s *Server) ImageData(id string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.imageData[id]
+}
+
+// KeyPairs returns the key pairs on the server, ordered by name.
+func (s *Server) KeyPairs() []keypairs.KeyPair {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []keypairs.KeyPair
+	for _, k := range s.keyPairs {
+		ret = append(ret, *k)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// SecurityGroups returns the security groups on the server, ordered by
+// ID.
+func (s *Server) SecurityGroups() []groups.SecGroup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []groups.SecGroup
+	for _, g := range s.securityGroups {
+		ret = append(ret, *g)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+// FloatingIPs returns the number of allocated floating IPs.
+func (s *Server) FloatingIPs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.floatingIPs)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if v != nil {
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	name := strings.ReplaceAll(http.StatusText(status), " ", "")
+	writeJSON(w, status, map[string]interface{}{
+		strings.ToLower(name[:1]) + name[1:]: map[string]interface{}{
+			"code":    status,
+			"message": fmt.Sprintf(format, args...),
+		},
+	})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: %v", err)
+		return false
+	}
+	return true
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := strings.Trim(r.URL.Path, "/")
+	switch {
+	case p == "" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"versions": map[string]interface{}{
+				"values": []interface{}{map[string]interface{}{
+					"id":     "v3.14",
+					"status": "stable",
+					"links":  []interface{}{map[string]string{"rel": "self", "href": s.URL + "/v3/"}},
+				}},
+			},
+		})
+		return
+	case p == "v3/auth/tokens" && r.Method == "POST":
+		s.issueToken(w)
+		return
+	}
+
+	if r.Header.Get("X-Auth-Token") != token {
+		writeError(w, http.StatusUnauthorized, "the request you have made requires authentication")
+		return
+	}
+
+	parts := strings.Split(p, "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == "compute" && parts[1] == "v2.1":
+		s.serveCompute(w, r, parts[2:])
+	case len(parts) >= 2 && parts[0] == "image" && parts[1] == "v2":
+		s.serveImage(w, r, parts[2:])
+	case len(parts) >= 2 && parts[0] == "network" && parts[1] == "v2.0":
+		s.serveNetwork(w, r, parts[2:])
+	default:
+		writeError(w, http.StatusNotFound, "no such path %q", r.URL.Path)
+	}
+}
+
+func (s *Server) issueToken(w http.ResponseWriter) {
+	entry := func(typ, name, path string) interface{} {
+		return map[string]interface{}{
+			"id":   name,
+			"type": typ,
+			"name": name,
+			"endpoints": []interface{}{map[string]string{
+				"id":        name + "-public",
+				"interface": "public",
+				"region":    Region,
+				"region_id": Region,
+				"url":       s.URL + path,
+			}},
+		}
+	}
+	w.Header().Set("X-Subject-Token", token)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"token": map[string]interface{}{
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			"user":       map[string]string{"id": User, "name": User},
+			"project":    map[string]string{"id": Project, "name": Project},
+			"catalog": []interface{}{
+				entry("compute", "nova", "/compute/v2.1/"),
+				entry("image", "glance", "/image/"),
+				entry("network", "neutron", "/network/"),
+			},
+		},
+	})
+}
+
+func (s *Server) serveCompute(w http.ResponseWriter, r *http.Request, parts []string) {
+	route := r.Method + " " + strings.Join(parts, "/")
+	if len(parts) > 1 && parts[1] != "detail" {
+		parts[1] = "{id}"
+	}
+	switch r.Method + " " + strings.Join(parts, "/") {
+	case "GET servers/detail":
+		var list []*servers.Server
+		for _, srv := range s.servers {
+			list = append(list, srv)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		writeJSON(w, http.StatusOK, map[string]interface{}{"servers": list})
+	case "POST servers":
+		s.createServer(w, r)
+	case "GET servers/{id}":
+		id := strings.Split(route, "/")[1]
+		if srv, ok := s.servers[id]; ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"server": srv})
+		} else {
+			writeError(w, http.StatusNotFound, "instance %s could not be found", id)
+		}
+	case "DELETE servers/{id}":
+		id := strings.Split(route, "/")[1]
+		if _, ok := s.servers[id]; !ok {
+			writeError(w, http.StatusNotFound, "instance %s could not be found", id)
+			return
+		}
+		delete(s.servers, id)
+		delete(s.consoleOutput, id)
+		writeJSON(w, http.StatusNoContent, nil)
+	case "POST servers/{id}/action":
+		s.serverAction(w, r, strings.Split(route, "/")[1])
+	case "GET flavors/detail":
+		var list []*flavors.Flavor
+		for _, f := range s.flavors {
+			list = append(list, f)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		writeJSON(w, http.StatusOK, map[string]interface{}{"flavors": list})
+	case "GET images/detail":
+		var list []interface{}
+		for _, i := range s.sortedImages(nil) {
+			list = append(list, map[string]interface{}{
+				"id":       i.ID,
+				"name":     i.Name,
+				"status":   strings.ToUpper(string(i.Status)),
+				"created":  i.CreatedAt.Format(time.RFC3339),
+				"updated":  i.UpdatedAt.Format(time.RFC3339),
+				"progress": 100,
+				"metadata": map[string]string{},
+			})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"images": list})
+	case "GET os-keypairs":
+		var list []interface{}
+		var names []string
+		for name := range s.keyPairs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			list = append(list, map[string]interface{}{"keypair": s.keyPairs[name]})
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keypairs": list})
+	case "POST os-keypairs":
+		var req struct {
+			KeyPair keypairs.KeyPair `json:"keypair"`
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if _, ok := s.keyPairs[req.KeyPair.Name]; ok {
+			writeError(w, http.StatusConflict, "key pair '%s' already exists", req.KeyPair.Name)
+			return
+		}
+		k := &keypairs.KeyPair{
+			Name:        req.KeyPair.Name,
+			PublicKey:   req.KeyPair.PublicKey,
+			Fingerprint: fmt.Sprintf("%x", len(req.KeyPair.PublicKey)),
+			UserID:      User,
+		}
+		s.keyPairs[k.Name] = k
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keypair": k})
+	case "DELETE os-keypairs/{id}":
+		name := strings.Split(route, "/")[1]
+		if _, ok := s.keyPairs[name]; !ok {
+			writeError(w, http.StatusNotFound, "keypair %s not found", name)
+			return
+		}
+		delete(s.keyPairs, name)
+		writeJSON(w, http.StatusAccepted, nil)
+	case "GET os-floating-ips":
+		var list []*floatingIP
+		for _, f := range s.floatingIPs {
+			list = append(list, f)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		writeJSON(w, http.StatusOK, map[string]interface{}{"floating_ips": list})
+	case "POST os-floating-ips":
+		var req struct {
+			Pool string `json:"pool"`
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+		n := len(s.floatingIPs) + 1
+		f := &floatingIP{ID: s.id(), IP: fmt.Sprintf("203.0.113.%d", n), Pool: req.Pool}
+		s.floatingIPs[f.ID] = f
+		writeJSON(w, http.StatusOK, map[string]interface{}{"floating_ip": f})
+	case "DELETE os-floating-ips/{id}":
+		id := strings.Split(route, "/")[1]
+		if _, ok := s.floatingIPs[id]; !ok {
+			writeError(w, http.StatusNotFound, "floating ip %s not found", id)
+			return
+		}
+		delete(s.floatingIPs, id)
+		writeJSON(w, http.StatusAccepted, nil)
+	default:
+		writeError(w, http.StatusNotFound, "unsupported request %s %s", r.Method, r.URL.Path)
+	}
+}
+
+func (s *Server) createServer(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Server struct {
+			Name           string            `json:"name"`
+			FlavorRef      string            `json:"flavorRef"`
+			ImageRef       string            `json:"imageRef"`
+			Metadata       map[string]string `json:"metadata"`
+			KeyName        string            `json:"key_name"`
+			SecurityGroups []struct {
+				Name string `json:"name"`
+			} `json:"security_groups"`
+			Networks []struct {
+				UUID string `json:"uuid"`
+			} `json:"networks"`
+		} `json:"server"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if _, ok := s.flavors[req.Server.FlavorRef]; !ok {
+		writeError(w, http.StatusBadRequest, "flavor %s could not be found", req.Server.FlavorRef)
+		return
+	}
+	if _, ok := s.images[req.Server.ImageRef]; !ok {
+		writeError(w, http.StatusBadRequest, "image %s could not be found", req.Server.ImageRef)
+		return
+	}
+	if _, ok := s.keyPairs[req.Server.KeyName]; req.Server.KeyName != "" && !ok {
+		writeError(w, http.StatusBadRequest, "invalid key_name provided")
+		return
+	}
+	var sgs []map[string]interface{}
+	for _, sg := range req.Server.SecurityGroups {
+		if _, ok := s.securityGroups[sg.Name]; !ok {
+			writeError(w, http.StatusBadRequest, "security group %s not found", sg.Name)
+			return
+		}
+		sgs = append(sgs, map[string]interface{}{"name": sg.Name})
+	}
+	addresses := make(map[string]interface{})
+	for _, n := range req.Server.Networks {
+		network, ok := s.networks[n.UUID]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "network %s could not be found", n.UUID)
+			return
+		}
+		addresses[network.Name] = []interface{}{map[string]interface{}{
+			"addr":            fmt.Sprintf("10.0.0.%d", len(s.servers)+2),
+			"version":         4,
+			"OS-EXT-IPS:type": "fixed",
+		}}
+	}
+
+	now := time.Now().UTC()
+	srv := &servers.Server{
+		ID:             s.id(),
+		TenantID:       Project,
+		UserID:         User,
+		Name:           req.Server.Name,
+		Created:        now,
+		Updated:        now,
+		Status:         "ACTIVE",
+		Progress:       100,
+		Flavor:         map[string]interface{}{"id": req.Server.FlavorRef},
+		Addresses:      addresses,
+		Metadata:       req.Server.Metadata,
+		KeyName:        req.Server.KeyName,
+		SecurityGroups: sgs,
+	}
+	s.servers[srv.ID] = srv
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"server": srv})
+}
+
+func (s *Server) serverAction(w http.ResponseWriter, r *http.Request, id string) {
+	srv, ok := s.servers[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "instance %s could not be found", id)
+		return
+	}
+	var req struct {
+		ConsoleOutput *struct{} `json:"os-getConsoleOutput"`
+		AddFloatingIP *struct {
+			Address string `json:"address"`
+		} `json:"addFloatingIp"`
+		RemoveFloatingIP *struct {
+			Address string `json:"address"`
+		} `json:"removeFloatingIp"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	findIP := func(address string) *floatingIP {
+		for _, f := range s.floatingIPs {
+			if f.IP == address {
+				return f
+			}
+		}
+		return nil
+	}
+	switch {
+	case req.ConsoleOutput != nil:
+		writeJSON(w, http.StatusOK, map[string]string{"output": s.consoleOutput[id]})
+	case req.AddFloatingIP != nil:
+		f := findIP(req.AddFloatingIP.Address)
+		if f == nil {
+			writeError(w, http.StatusNotFound, "floating ip %s not found", req.AddFloatingIP.Address)
+			return
+		}
+		f.InstanceID = id
+		srv.AccessIPv4 = f.IP
+		writeJSON(w, http.StatusAccepted, nil)
+	case req.RemoveFloatingIP != nil:
+		f := findIP(req.RemoveFloatingIP.Address)
+		if f == nil || f.InstanceID != id {
+			writeError(w, http.StatusConflict, "floating ip %s is not associated with instance %s", req.RemoveFloatingIP.Address, id)
+			return
+		}
+		f.InstanceID = ""
+		srv.AccessIPv4 = ""
+		writeJSON(w, http.StatusAccepted, nil)
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported server action")
+	}
+}
+
+// sortedImages returns the images carrying all of the given tags,
+// ordered by ID.
+func (s *Server) sortedImages(tags []string) []*images.Image {
+	var ret []*images.Image
+outer:
+	for _, i := range s.images {
+		for _, tag := range tags {
+			found := false
+			for _, t := range i.Tags {
+				found = found || t == tag
+			}
+			if !found {
+				continue outer
+			}
+		}
+		ret = append(ret, i)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+func (s *Server) serveImage(w http.ResponseWriter, r *http.Request, parts []string) {
+	var id string
+	if len(parts) > 1 {
+		id = parts[1]
+		parts[1] = "{id}"
+	}
+	switch r.Method + " " + strings.Join(parts, "/") {
+	case "GET images":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"images": s.sortedImages(r.URL.Query()["tag"]),
+		})
+	case "POST images":
+		var req struct {
+			Name            string   `json:"name"`
+			ContainerFormat string   `json:"container_format"`
+			DiskFormat      string   `json:"disk_format"`
+			Tags            []string `json:"tags"`
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+		now := time.Now().UTC()
+		i := &images.Image{
+			ID:              s.id(),
+			Name:            req.Name,
+			Status:          images.ImageStatusQueued,
+			Tags:            req.Tags,
+			ContainerFormat: req.ContainerFormat,
+			DiskFormat:      req.DiskFormat,
+			Owner:           Project,
+			Visibility:      images.ImageVisibilityPrivate,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+		s.images[i.ID] = i
+		writeJSON(w, http.StatusCreated, i)
+	case "GET images/{id}":
+		if i, ok := s.images[id]; ok {
+			writeJSON(w, http.StatusOK, i)
+		} else {
+			writeError(w, http.StatusNotFound, "no image found with ID %s", id)
+		}
+	case "DELETE images/{id}":
+		if _, ok := s.images[id]; !ok {
+			writeError(w, http.StatusNotFound, "no image found with ID %s", id)
+			return
+		}
+		delete(s.images, id)
+		delete(s.imageData, id)
+		writeJSON(w, http.StatusNoContent, nil)
+	case "PUT images/{id}/file":
+		i, ok := s.images[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "no image found with ID %s", id)
+			return
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "reading image data: %v", err)
+			return
+		}
+		s.imageData[id] = data
+		i.SizeBytes = int64(len(data))
+		i.Status = images.ImageStatusActive
+		writeJSON(w, http.StatusNoContent, nil)
+	default:
+		writeError(w, http.StatusNotFound, "unsupported request %s %s", r.Method, r.URL.Path)
+	}
+}
+
+func (s *Server) serveNetwork(w http.ResponseWriter, r *http.Request, parts []string) {
+	var id string
+	if len(parts) > 1 {
+		id = parts[1]
+		parts[1] = "{id}"
+	}
+	switch r.Method + " " + strings.Join(parts, "/") {
+	case "GET networks":
+		var list []*networks.Network
+		for _, n := range s.networks {
+			list = append(list, n)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		writeJSON(w, http.StatusOK, map[string]interface{}{"networks": list})
+	case "GET security-groups":
+		name := r.URL.Query().Get("name")
+		list := []*groups.SecGroup{}
+		for _, g := range s.securityGroups {
+			if name == "" || g.Name == name {
+				list = append(list, g)
+			}
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		writeJSON(w, http.StatusOK, map[string]interface{}{"security_groups": list})
+	case "POST security-groups":
+		var req struct {
+			SecGroup struct {
+				Name string `json:"name"`
+			} `json:"security_group"`
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+		g := &groups.SecGroup{ID: s.id(), Name: req.SecGroup.Name, TenantID: Project, ProjectID: Project}
+		s.securityGroups[g.ID] = g
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"security_group": g})
+	case "DELETE security-groups/{id}":
+		if _, ok := s.securityGroups[id]; !ok {
+			writeError(w, http.StatusNotFound, "security group %s does not exist", id)
+			return
+		}
+		delete(s.securityGroups, id)
+		writeJSON(w, http.StatusNoContent, nil)
+	case "POST security-group-rules":
+		var req struct {
+			Rule map[string]interface{} `json:"security_group_rule"`
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+		groupID, _ := req.Rule["security_group_id"].(string)
+		if _, ok := s.securityGroups[groupID]; !ok {
+			writeError(w, http.StatusNotFound, "security group %s does not exist", groupID)
+			return
+		}
+		req.Rule["id"] = s.id()
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"security_group_rule": req.Rule})
+	default:
+		writeError(w, http.StatusNotFound, "unsupported request %s %s", r.Method, r.URL.Path)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/keypairs"
+	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
+
+	"github.com/flatcar-linux/mantle/platform/inventory"
+)
+
+// ListResources lists the servers and images created by mantle and the
+// key pairs named after kola flights.
+func (a *API) ListResources(ctx context.Context) ([]inventory.Resource, error) {
+	var ret []inventory.Resource
+
+	servers, err := a.listServersWithMetadata(map[string]string{
+		"CreatedBy": "mantle",
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range servers {
+		if strings.Contains(server.Status, "DELETED") {
+			continue
+		}
+		ret = append(ret, inventory.Resource{
+			Cloud:   "openstack",
+			Kind:    inventory.KindInstance,
+			ID:      server.ID,
+			Name:    server.Name,
+			Region:  a.opts.Region,
+			Owner:   server.TenantID,
+			Flight:  inventory.FlightName(server.KeyName),
+			Created: server.Created,
+		})
+	}
+
+	pages, err := unwrapPages(images.List(a.imageClient, images.ListOpts{
+		Tags: []string{"mantle"},
+	}), true)
+	if err != nil {
+		return nil, fmt.Errorf("images: %v", err)
+	}
+	imgs, err := images.ExtractImages(pages)
+	if err != nil {
+		return nil, fmt.Errorf("extracting images: %v", err)
+	}
+	for _, image := range imgs {
+		ret = append(ret, inventory.Resource{
+			Cloud:   "openstack",
+			Kind:    inventory.KindImage,
+			ID:      image.ID,
+			Name:    image.Name,
+			Region:  a.opts.Region,
+			Owner:   image.Owner,
+			Created: image.CreatedAt,
+		})
+	}
+
+	pages, err = unwrapPages(keypairs.List(a.computeClient), true)
+	if err != nil {
+		return nil, fmt.Errorf("keypairs: %v", err)
+	}
+	keys, err := keypairs.ExtractKeyPairs(pages)
+	if err != nil {
+		return nil, fmt.Errorf("extracting keypairs: %v", err)
+	}
+	for _, key := range keys {
+		flight := inventory.FlightName(key.Name)
+		if flight == "" {
+			continue
+		}
+		ret = append(ret, inventory.Resource{
+			Cloud:  "openstack",
+			Kind:   inventory.KindKey,
+			ID:     key.Name,
+			Name:   key.Name,
+			Region: a.opts.Region,
+			Owner:  key.UserID,
+			Flight: flight,
+		})
+	}
+
+	return ret, nil
+}
+
+// DeleteResource deletes a resource returned by ListResources.
+func (a *API) DeleteResource(ctx context.Context, r inventory.Resource) error {
+	switch r.Kind {
+	case inventory.KindInstance:
+		return a.DeleteServer(r.ID)
+	case inventory.KindImage:
+		return a.DeleteImage(r.ID)
+	case inventory.KindKey:
+		return a.DeleteKey(r.ID)
+	default:
+		return fmt.Errorf("unsupported resource kind %q", r.Kind)
+	}
+}
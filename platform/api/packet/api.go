@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"strings"
 	"time"
 
@@ -36,6 +37,7 @@ import (
 	"github.com/flatcar-linux/mantle/platform"
 	"github.com/flatcar-linux/mantle/platform/api/gcloud"
 	"github.com/flatcar-linux/mantle/platform/conf"
+	"github.com/flatcar-linux/mantle/platform/inventory"
 	"github.com/flatcar-linux/mantle/storage"
 	"github.com/flatcar-linux/mantle/util"
 )
@@ -83,6 +85,8 @@ type Options struct {
 	ApiKey string
 	// Project UUID (overrides config profile)
 	Project string
+	// API endpoint URL, for testing against a fake server
+	Endpoint string
 
 	// Packet location code
 	Facility string
@@ -157,16 +161,28 @@ func New(opts *Options) (*API, error) {
 		opts.ImageURL = defaultImageURL[opts.Board]
 	}
 
-	gapi, err := gcloud.New(opts.GSOptions)
-	if err != nil {
-		return nil, fmt.Errorf("connecting to Google Storage: %v", err)
-	}
-	bucket, err := storage.NewBucket(gapi.Client(), opts.StorageURL)
-	if err != nil {
-		return nil, fmt.Errorf("connecting to Google Storage bucket: %v", err)
+	// Without a storage URL the API can manage existing devices and
+	// keys, but can't create devices.
+	var bucket *storage.Bucket
+	if opts.StorageURL != "" {
+		gapi, err := gcloud.New(opts.GSOptions)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to Google Storage: %v", err)
+		}
+		bucket, err = storage.NewBucket(gapi.Client(), opts.StorageURL)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to Google Storage bucket: %v", err)
+		}
 	}
 
 	client := packngo.NewClientWithAuth("github.com/flatcar-linux/mantle", opts.ApiKey, nil)
+	if opts.Endpoint != "" {
+		u, err := url.Parse(opts.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("parsing endpoint: %v", err)
+		}
+		client.BaseURL = u
+	}
 
 	return &API{
 		c:      client,
@@ -184,7 +200,8 @@ func (a *API) PreflightCheck() error {
 }
 
 // console is optional, and is closed on error or when the device is deleted.
-func (a *API) CreateDevice(hostname string, conf *conf.Conf, console Console) (*packngo.Device, error) {
+// The device is tagged with flight unless that is empty.
+func (a *API) CreateDevice(hostname, flight string, conf *conf.Conf, console Console) (*packngo.Device, error) {
 	consoleStarted := false
 	defer func() {
 		if console != nil && !consoleStarted {
@@ -212,7 +229,7 @@ func (a *API) CreateDevice(hostname string, conf *conf.Conf, console Console) (*
 	}
 	defer a.bucket.Delete(context.TODO(), ipxeScriptName)
 
-	device, err := a.createDevice(hostname, ipxeScriptURL)
+	device, err := a.createDevice(hostname, flight, ipxeScriptURL)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create device: %v", err)
 	}
@@ -452,6 +469,9 @@ func (a *API) uploadObject(hostname, contentType string, data []byte) (string, s
 	if hostname == "" {
 		hostname = "mantle"
 	}
+	if a.bucket == nil {
+		return "", "", fmt.Errorf("no storage URL configured for uploads")
+	}
 	b := make([]byte, 5)
 	rand.Read(b)
 	name := fmt.Sprintf("%s-%x", hostname, b)
@@ -478,7 +498,11 @@ boot`, a.opts.InstallerImageKernelURL, userdataURL, linuxConsole[a.opts.Board],
 }
 
 // device creation seems a bit flaky, so try a few times
-func (a *API) createDevice(hostname, ipxeScriptURL string) (device *packngo.Device, err error) {
+func (a *API) createDevice(hostname, flight, ipxeScriptURL string) (device *packngo.Device, err error) {
+	tags := []string{"mantle"}
+	if flight != "" {
+		tags = append(tags, inventory.FlightTag(flight))
+	}
 	for tries := apiRetries; tries >= 0; tries-- {
 		var response *packngo.Response
 		device, response, err = a.c.Devices.Create(&packngo.DeviceCreateRequest{
@@ -489,7 +513,7 @@ func (a *API) createDevice(hostname, ipxeScriptURL string) (device *packngo.Devi
 			Hostname:      hostname,
 			OS:            "custom_ipxe",
 			IPXEScriptURL: ipxeScriptURL,
-			Tags:          []string{"mantle"},
+			Tags:          tags,
 		})
 		if err == nil || response.StatusCode != 500 {
 			return
@@ -0,0 +1,131 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/packethost/packngo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/packet/fake"
+	"github.com/flatcar-linux/mantle/platform/conf"
+	"github.com/flatcar-linux/mantle/platform/inventory"
+	"github.com/flatcar-linux/mantle/platform/inventory/inventorytest"
+)
+
+const project = "11111111-2222-3333-4444-555555555555"
+
+func newTestAPI(t *testing.T) (*API, *fake.Server) {
+	server := fake.NewServer(project)
+	t.Cleanup(server.Close)
+
+	api, err := New(&Options{
+		Options:  &platform.Options{Board: "amd64-usr"},
+		ApiKey:   "key",
+		Project:  project,
+		Endpoint: server.URL,
+		Facility: "sv15",
+	})
+	require.NoError(t, err)
+	require.NoError(t, api.PreflightCheck())
+	return api, server
+}
+
+func TestPreflightCheck(t *testing.T) {
+	api, _ := newTestAPI(t)
+	api.opts.Project = "66666666-7777-8888-9999-000000000000"
+	assert.Error(t, api.PreflightCheck())
+}
+
+func TestCreateDevice(t *testing.T) {
+	api, server := newTestAPI(t)
+
+	// without a storage bucket, userdata can't be uploaded
+	userdata, err := conf.Empty().Render("")
+	require.NoError(t, err)
+	_, err = api.CreateDevice("kola-1", inventorytest.Flight, userdata, nil)
+	assert.Error(t, err)
+	assert.Empty(t, server.Devices())
+
+	device, err := api.createDevice("kola-1", inventorytest.Flight, "http://example.com/ipxe")
+	require.NoError(t, err)
+	assert.Equal(t, "kola-1", device.Hostname)
+	assert.Equal(t, []string{"mantle", inventory.FlightTag(inventorytest.Flight)}, device.Tags)
+	assert.NotEmpty(t, api.GetDeviceAddress(device, 4, true))
+
+	require.NoError(t, api.DeleteDevice(device.ID))
+	assert.Empty(t, server.Devices())
+	assert.Error(t, api.DeleteDevice(device.ID))
+}
+
+func TestKeys(t *testing.T) {
+	api, server := newTestAPI(t)
+
+	id, err := api.AddKey(inventorytest.Flight, "ssh-ed25519 AAAA")
+	require.NoError(t, err)
+	keys, err := api.ListKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, inventorytest.Flight, keys[0].Label)
+
+	require.NoError(t, api.DeleteKey(id))
+	assert.Empty(t, server.Keys())
+}
+
+func TestGC(t *testing.T) {
+	api, server := newTestAPI(t)
+	old := time.Now().Add(-6 * time.Hour).UTC().Format(time.RFC3339)
+	add := func(d packngo.Device) {
+		server.AddDevice(project, d)
+	}
+	add(packngo.Device{DeviceRaw: packngo.DeviceRaw{Hostname: "old", Tags: []string{"mantle"}, Created: old}})
+	add(packngo.Device{DeviceRaw: packngo.DeviceRaw{Hostname: "new", Tags: []string{"mantle"}}})
+	add(packngo.Device{DeviceRaw: packngo.DeviceRaw{Hostname: "locked", Tags: []string{"mantle"}, Created: old, Locked: true}})
+	add(packngo.Device{DeviceRaw: packngo.DeviceRaw{Hostname: "provisioning", Tags: []string{"mantle"}, Created: old, State: "provisioning"}})
+	add(packngo.Device{DeviceRaw: packngo.DeviceRaw{Hostname: "other", Created: old}})
+
+	require.NoError(t, api.GC(5*time.Hour))
+
+	var names []string
+	for _, d := range server.Devices() {
+		names = append(names, d.Hostname)
+	}
+	assert.Equal(t, []string{"new", "locked", "provisioning", "other"}, names)
+}
+
+func TestInventory(t *testing.T) {
+	api, server := newTestAPI(t)
+	server.AddDevice(project, packngo.Device{DeviceRaw: packngo.DeviceRaw{
+		Hostname: "kola-1",
+		Tags:     []string{"mantle", inventory.FlightTag(inventorytest.Flight)},
+		Facility: &packngo.Facility{Code: "sv15"},
+	}})
+	_, err := api.AddKey(inventorytest.Flight, "ssh-ed25519 AAAA")
+	require.NoError(t, err)
+	_, err = api.AddKey("laptop", "ssh-ed25519 BBBB")
+	require.NoError(t, err)
+
+	rs := inventorytest.CheckProvider(t, api, []inventory.Resource{
+		{Cloud: "packet", Kind: inventory.KindInstance, Name: "kola-1", Region: "sv15", Owner: project, Flight: inventorytest.Flight},
+		{Cloud: "packet", Kind: inventory.KindKey, Name: inventorytest.Flight, Flight: inventorytest.Flight},
+	})
+	assert.False(t, rs[1].Created.IsZero())
+	assert.Empty(t, server.Devices())
+	require.Len(t, server.Keys(), 1)
+}
@@ -0,0 +1,226 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake implements an in-process fake of the subset of the
+// Packet API used by mantle, for testing without credentials.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/packethost/packngo"
+)
+
+// Server is a fake Packet API server. Devices become active as soon as
+// they are created.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	nextID   int
+	projects map[string]bool
+	devices  map[string]*packngo.Device
+	keys     map[string]*packngo.SSHKey
+}
+
+// NewServer starts a fake server knowing the given project IDs; the
+// caller must Close it.
+func NewServer(projects ...string) *Server {
+	s := &Server{
+		nextID:   1,
+		projects: make(map[string]bool),
+		devices:  make(map[string]*packngo.Device),
+		keys:     make(map[string]*packngo.SSHKey),
+	}
+	for _, p := range projects {
+		s.projects[p] = true
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+func (s *Server) id() string {
+	id := fmt.Sprintf("00000000-0000-0000-0000-%012d", s.nextID)
+	s.nextID++
+	return id
+}
+
+// AddDevice adds a device to a project as if it had been created
+// outside mantle and returns its ID.
+func (s *Server) AddDevice(project string, d packngo.Device) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d.ID = s.id()
+	d.Project = &packngo.Project{ID: project}
+	if d.State == "" {
+		d.State = "active"
+	}
+	if d.Created == "" {
+		d.Created = time.Now().UTC().Format(time.RFC3339)
+	}
+	s.devices[d.ID] = &d
+	return d.ID
+}
+
+// Devices returns the devices on the server, ordered by ID.
+func (s *Server) Devices() []packngo.Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []packngo.Device
+	for _, d := range s.devices {
+		ret = append(ret, *d)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+// Keys returns the SSH keys on the server, ordered by ID.
+func (s *Server) Keys() []packngo.SSHKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []packngo.SSHKey
+	for _, k := range s.keys {
+		ret = append(ret, *k)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, map[string][]string{
+		"errors": {fmt.Sprintf(format, args...)},
+	})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "projects":
+		if !s.projects[parts[1]] {
+			writeError(w, http.StatusNotFound, "project %s not found", parts[1])
+			return
+		}
+		writeJSON(w, http.StatusOK, packngo.Project{ID: parts[1], Name: "mantle"})
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "projects" && parts[2] == "devices":
+		s.listDevices(w, parts[1])
+	case r.Method == "POST" && len(parts) == 3 && parts[0] == "projects" && parts[2] == "devices":
+		s.createDevice(w, r, parts[1])
+	case r.Method == "GET" && len(parts) == 2 && parts[0] == "devices":
+		if d, ok := s.devices[parts[1]]; ok {
+			writeJSON(w, http.StatusOK, d)
+		} else {
+			writeError(w, http.StatusNotFound, "device %s not found", parts[1])
+		}
+	case r.Method == "DELETE" && len(parts) == 2 && parts[0] == "devices":
+		if _, ok := s.devices[parts[1]]; !ok {
+			writeError(w, http.StatusNotFound, "device %s not found", parts[1])
+			return
+		}
+		delete(s.devices, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "GET" && len(parts) == 1 && parts[0] == "ssh-keys":
+		keys := []*packngo.SSHKey{}
+		for _, k := range s.keys {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ssh_keys": keys})
+	case r.Method == "POST" && len(parts) == 1 && parts[0] == "ssh-keys":
+		var req packngo.SSHKeyCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+		key := &packngo.SSHKey{
+			ID:      s.id(),
+			Label:   req.Label,
+			Key:     req.Key,
+			Created: time.Now().UTC().Format(time.RFC3339),
+		}
+		s.keys[key.ID] = key
+		writeJSON(w, http.StatusCreated, key)
+	case r.Method == "DELETE" && len(parts) == 2 && parts[0] == "ssh-keys":
+		if _, ok := s.keys[parts[1]]; !ok {
+			writeError(w, http.StatusNotFound, "key %s not found", parts[1])
+			return
+		}
+		delete(s.keys, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "unsupported request %s %s", r.Method, r.URL.Path)
+	}
+}
+
+func (s *Server) listDevices(w http.ResponseWriter, project string) {
+	if !s.projects[project] {
+		writeError(w, http.StatusNotFound, "project %s not found", project)
+		return
+	}
+	devices := []*packngo.Device{}
+	for _, d := range s.devices {
+		if d.Project != nil && d.Project.ID == project {
+			devices = append(devices, d)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"devices": devices,
+		"meta":    map[string]int{"total": len(devices)},
+	})
+}
+
+func (s *Server) createDevice(w http.ResponseWriter, r *http.Request, project string) {
+	if !s.projects[project] {
+		writeError(w, http.StatusNotFound, "project %s not found", project)
+		return
+	}
+	var req packngo.DeviceCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	d := &packngo.Device{}
+	d.ID = s.id()
+	d.Hostname = req.Hostname
+	d.State = "active"
+	d.Created = time.Now().UTC().Format(time.RFC3339)
+	d.Tags = req.Tags
+	d.Project = &packngo.Project{ID: project}
+	if len(req.Facility) > 0 {
+		d.Facility = &packngo.Facility{Code: req.Facility[0]}
+	}
+	n := s.nextID % 256
+	d.Network = []*packngo.IPAddressAssignment{
+		{IpAddressCommon: packngo.IpAddressCommon{Address: fmt.Sprintf("192.0.2.%d", n), AddressFamily: 4, Public: true, Management: true}},
+		{IpAddressCommon: packngo.IpAddressCommon{Address: fmt.Sprintf("10.0.0.%d", n), AddressFamily: 4, Management: true}},
+	}
+	s.devices[d.ID] = d
+	writeJSON(w, http.StatusCreated, d)
+}
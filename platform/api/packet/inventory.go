@@ -0,0 +1,112 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/packethost/packngo"
+
+	"github.com/flatcar-linux/mantle/platform/inventory"
+)
+
+// ListResources lists the devices tagged by mantle in the API's project
+// and the SSH keys named after kola flights.
+func (a *API) ListResources(ctx context.Context) ([]inventory.Resource, error) {
+	var ret []inventory.Resource
+
+	page := packngo.ListOptions{
+		Page:    1,
+		PerPage: 1000,
+	}
+	for {
+		devices, _, err := a.c.Devices.List(a.opts.Project, &page)
+		if err != nil {
+			return nil, fmt.Errorf("listing devices: %v", err)
+		}
+		for _, device := range devices {
+			tagged := false
+			for _, tag := range device.Tags {
+				if tag == "mantle" {
+					tagged = true
+					break
+				}
+			}
+			if !tagged {
+				continue
+			}
+			created, err := time.Parse(time.RFC3339, device.Created)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't parse %q: %v", device.Created, err)
+			}
+			r := inventory.Resource{
+				Cloud:   "packet",
+				Kind:    inventory.KindInstance,
+				ID:      device.ID,
+				Name:    device.Hostname,
+				Owner:   a.opts.Project,
+				Flight:  inventory.TaggedFlight(device.Tags),
+				Created: created,
+			}
+			if device.Facility != nil {
+				r.Region = device.Facility.Code
+			}
+			ret = append(ret, r)
+		}
+		if len(devices) < page.PerPage {
+			break
+		}
+		page.Page += 1
+	}
+
+	keys, err := a.ListKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		flight := inventory.FlightName(key.Label)
+		if flight == "" {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, key.Created)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse %q: %v", key.Created, err)
+		}
+		ret = append(ret, inventory.Resource{
+			Cloud:   "packet",
+			Kind:    inventory.KindKey,
+			ID:      key.ID,
+			Name:    key.Label,
+			Flight:  flight,
+			Created: created,
+		})
+	}
+
+	return ret, nil
+}
+
+// DeleteResource deletes a resource returned by ListResources.
+func (a *API) DeleteResource(ctx context.Context, r inventory.Resource) error {
+	switch r.Kind {
+	case inventory.KindInstance:
+		return a.DeleteDevice(r.ID)
+	case inventory.KindKey:
+		return a.DeleteKey(r.ID)
+	default:
+		return fmt.Errorf("unsupported resource kind %q", r.Kind)
+	}
+}
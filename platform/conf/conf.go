@@ -896,6 +896,12 @@ func (c *Conf) IsIgnition() bool {
 	return c.ignitionV1 != nil || c.ignitionV2 != nil || c.ignitionV21 != nil || c.ignitionV22 != nil || c.ignitionV23 != nil || c.ignitionV3 != nil
 }
 
+// CanAddFiles reports whether AddFile can be used, which needs an
+// Ignition config or a cloud-config.
+func (c *Conf) CanAddFiles() bool {
+	return c.IsIgnition() || c.cloudconfig != nil
+}
+
 func (c *Conf) IsEmpty() bool {
 	return !c.IsIgnition() && c.cloudconfig == nil && c.script == ""
 }
@@ -59,3 +59,28 @@ func TestConfCopyKey(t *testing.T) {
 		}
 	}
 }
+
+func TestConfCanAddFiles(t *testing.T) {
+	for i, tt := range []struct {
+		userdata *UserData
+		files    bool
+	}{
+		{Ignition(`{ "ignition": { "version": "2.2.0" } }`), true},
+		{CloudConfig("#cloud-config"), true},
+		{Script("#!/bin/bash\ntrue"), false},
+		{Empty(), false},
+	} {
+		conf, err := tt.userdata.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+		if conf.CanAddFiles() != tt.files {
+			t.Errorf("config %d: expected CanAddFiles %v", i, tt.files)
+			continue
+		}
+		if tt.files {
+			conf.AddFile("/etc/kola", "root", "test", 0644)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// consoleEscape detaches AttachConsole from the console, like telnet's ^].
+const consoleEscape = 0x1d
+
+// ConsoleMachine is implemented by machines created with
+// MachineOptions.InteractiveConsole.
+type ConsoleMachine interface {
+	Machine
+
+	// SerialConsole returns the machine's interactive serial console.
+	SerialConsole() (*SerialConsole, error)
+
+	// ConsoleExpect waits up to timeout for the serial console to print
+	// something matching the regular expression re. It returns the match
+	// followed by its subexpressions.
+	ConsoleExpect(re string, timeout time.Duration) ([]string, error)
+
+	// ConsoleSend types text on the serial console.
+	ConsoleSend(text string) error
+}
+
+// SerialConsole is a bidirectional connection to the serial port of a
+// machine. All output since the connection was established is buffered
+// until consumed by Expect.
+type SerialConsole struct {
+	conn net.Conn
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	err     error
+	updated chan struct{}
+
+	// non-nil while attached to a terminal
+	attached io.Writer
+}
+
+// NewSerialConsole connects to the serial console socket at path.
+func NewSerialConsole(path string) (*SerialConsole, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to serial console %s: %v", path, err)
+	}
+
+	s := &SerialConsole{
+		conn:    conn,
+		updated: make(chan struct{}, 1),
+	}
+	go s.read()
+	return s, nil
+}
+
+func (s *SerialConsole) read() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.conn.Read(buf)
+		s.mu.Lock()
+		s.buf.Write(buf[:n])
+		if s.attached != nil {
+			s.attached.Write(buf[:n])
+		}
+		if err != nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+
+		select {
+		case s.updated <- struct{}{}:
+		default:
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Expect waits up to timeout for the console output to match re. Output up
+// to the end of the match is consumed, so subsequent calls only look at
+// newer output. It returns the match followed by its subexpressions.
+func (s *SerialConsole) Expect(re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		loc := re.FindSubmatchIndex(s.buf.Bytes())
+		if loc != nil {
+			data := s.buf.Bytes()
+			match := make([]string, len(loc)/2)
+			for i := range match {
+				if loc[2*i] >= 0 {
+					match[i] = string(data[loc[2*i]:loc[2*i+1]])
+				}
+			}
+			s.buf.Next(loc[1])
+			s.mu.Unlock()
+			return match, nil
+		}
+		err := s.err
+		s.mu.Unlock()
+
+		if err != nil {
+			return nil, fmt.Errorf("waiting for %q on serial console: %v", re, err)
+		}
+
+		select {
+		case <-s.updated:
+		case <-deadline:
+			return nil, fmt.Errorf("timed out waiting for %q on serial console", re)
+		}
+	}
+}
+
+// Send writes text to the console.
+func (s *SerialConsole) Send(text string) error {
+	if _, err := io.WriteString(s.conn, text); err != nil {
+		return fmt.Errorf("writing to serial console: %v", err)
+	}
+	return nil
+}
+
+// Close disconnects from the console.
+func (s *SerialConsole) Close() error {
+	return s.conn.Close()
+}
+
+// AttachConsole connects os.Stdin and os.Stdout to the serial console s
+// until ^] is typed or the console is closed. Buffered output is printed
+// first, so the console can be attached after the machine has booted
+// without losing its boot messages.
+func AttachConsole(s *SerialConsole) error {
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		tstate, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer terminal.Restore(fd, tstate)
+	}
+
+	s.mu.Lock()
+	os.Stdout.Write(s.buf.Bytes())
+	s.buf.Reset()
+	s.attached = os.Stdout
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.attached = nil
+		s.mu.Unlock()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Connected to serial console, escape character is '^]'.\r\n")
+
+	input := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if i := bytes.IndexByte(buf[:n], consoleEscape); i >= 0 {
+				s.conn.Write(buf[:i])
+				input <- nil
+				return
+			}
+			if _, werr := s.conn.Write(buf[:n]); werr != nil {
+				input <- werr
+				return
+			}
+			if err != nil {
+				input <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case err := <-input:
+			if err == io.EOF {
+				err = nil
+			}
+			return err
+		case <-s.updated:
+			s.mu.Lock()
+			s.buf.Reset()
+			err := s.err
+			s.mu.Unlock()
+			if err != nil {
+				return nil
+			}
+		}
+	}
+}
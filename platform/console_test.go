@@ -0,0 +1,82 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestSerialConsoleExpect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "console-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "console.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// a fake getty that greets with a prompt and echoes each line
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprint(conn, "Booting...\r\nlocalhost login: ")
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			fmt.Fprintf(conn, "got %s\r\n", scanner.Text())
+		}
+	}()
+
+	s, err := NewSerialConsole(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.Expect(regexp.MustCompile(`login: `), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send("core\n"); err != nil {
+		t.Fatal(err)
+	}
+	match, err := s.Expect(regexp.MustCompile(`got (\w+)`), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(match) != 2 || match[1] != "core" {
+		t.Errorf("unexpected match %q", match)
+	}
+
+	// consumed output must not match again
+	if _, err := s.Expect(regexp.MustCompile(`login: `), 100*time.Millisecond); err == nil {
+		t.Errorf("matched consumed output")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"time"
+)
+
+// Content is a resource served to the machines of a ContentCluster, e.g.
+// a file or an Ignition config referenced by another config.
+type Content struct {
+	Data        []byte
+	ContentType string
+
+	// Status makes HTTP requests fail with the given status code, such
+	// as http.StatusNotFound. The content is missing over TFTP.
+	Status int
+
+	// Delay postpones HTTP responses.
+	Delay time.Duration
+
+	// Corrupt serves the data with its first byte changed, so that it
+	// no longer matches Hash.
+	Corrupt bool
+}
+
+// Hash returns the Ignition verification hash of the data.
+func (c Content) Hash() string {
+	sum := sha512.Sum512(c.Data)
+	return "sha512-" + hex.EncodeToString(sum[:])
+}
+
+// Served returns the data as it is sent to machines.
+func (c Content) Served() []byte {
+	if !c.Corrupt || len(c.Data) == 0 {
+		return c.Data
+	}
+	data := append([]byte{}, c.Data...)
+	data[0] ^= 0xff
+	return data
+}
+
+// ContentCluster is implemented by clusters whose machines can fetch
+// resources from a server run by mantle, without external network
+// access.
+type ContentCluster interface {
+	Cluster
+
+	// ServeContent makes content available under name, replacing
+	// anything served under that name before.
+	ServeContent(name string, content Content) error
+
+	// ContentURL returns the URL of name for the scheme "http",
+	// "https" or "tftp".
+	ContentURL(scheme, name string) (string, error)
+
+	// ContentCA returns the PEM encoded certificate of the CA that
+	// signed the certificate of the HTTPS server.
+	ContentCA() []byte
+}
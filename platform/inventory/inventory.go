@@ -0,0 +1,219 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inventory provides a cloud-independent view of the resources
+// that mantle tools create, and a policy for garbage collecting them.
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+var plog = capnslog.NewPackageLogger("github.com/flatcar-linux/mantle", "platform/inventory")
+
+// Kind is the type of a cloud resource.
+type Kind string
+
+const (
+	KindInstance      Kind = "instance"
+	KindImage         Kind = "image"
+	KindSnapshot      Kind = "snapshot"
+	KindKey           Kind = "key"
+	KindSecurityGroup Kind = "security-group"
+	KindBlob          Kind = "blob"
+	KindResourceGroup Kind = "resource-group"
+)
+
+// deleteOrder is the order in which kinds are deleted, so that
+// instances go away before the keys, groups and images they use.
+var deleteOrder = []Kind{
+	KindInstance,
+	KindResourceGroup,
+	KindKey,
+	KindSecurityGroup,
+	KindImage,
+	KindSnapshot,
+	KindBlob,
+}
+
+// Resource is a single mantle-created resource in some cloud.
+type Resource struct {
+	Cloud  string
+	Kind   Kind
+	ID     string
+	Name   string
+	Region string
+	// Owner is the account, project or tenant owning the resource.
+	Owner string
+	// Flight is the name of the kola flight that created the resource,
+	// if it can be determined.
+	Flight string
+	// Created is the zero time if the cloud doesn't report it.
+	Created time.Time
+}
+
+// Age returns how long ago the resource was created, or zero if unknown.
+func (r Resource) Age(now time.Time) time.Duration {
+	if r.Created.IsZero() {
+		return 0
+	}
+	return now.Sub(r.Created)
+}
+
+func (r Resource) String() string {
+	return fmt.Sprintf("%s/%s/%s", r.Cloud, r.Kind, r.ID)
+}
+
+// Provider lists and deletes the resources of a single cloud.
+type Provider interface {
+	ListResources(ctx context.Context) ([]Resource, error)
+	DeleteResource(ctx context.Context, r Resource) error
+}
+
+var flightRegexp = regexp.MustCompile(`^[a-z0-9-]+-[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// FlightName returns the kola flight name embedded in a resource name,
+// such as an SSH key named after its flight, or "" if there is none.
+func FlightName(name string) string {
+	name = strings.TrimSuffix(name, "-fake")
+	if flightRegexp.MatchString(name) {
+		return name
+	}
+	return ""
+}
+
+const flightTagPrefix = "mantle-flight:"
+
+// FlightTag returns the tag marking the instances of a flight on clouds
+// where instances don't carry the name of the flight's SSH key.
+func FlightTag(flight string) string {
+	return flightTagPrefix + flight
+}
+
+// TaggedFlight returns the flight named by a FlightTag among tags, or ""
+// if there is none.
+func TaggedFlight(tags []string) string {
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, flightTagPrefix) {
+			return FlightName(strings.TrimPrefix(tag, flightTagPrefix))
+		}
+	}
+	return ""
+}
+
+// Collect lists the resources of all providers. A failing provider
+// doesn't prevent the others from being listed; the resources found
+// are returned together with an error naming the failed clouds.
+func Collect(ctx context.Context, providers map[string]Provider) ([]Resource, error) {
+	var clouds []string
+	for cloud := range providers {
+		clouds = append(clouds, cloud)
+	}
+	sort.Strings(clouds)
+
+	var all []Resource
+	var failed []string
+	for _, cloud := range clouds {
+		rs, err := providers[cloud].ListResources(ctx)
+		if err != nil {
+			plog.Errorf("listing %s resources: %v", cloud, err)
+			failed = append(failed, cloud)
+			continue
+		}
+		all = append(all, rs...)
+	}
+	Sort(all)
+
+	if len(failed) > 0 {
+		return all, fmt.Errorf("failed listing resources in: %s", strings.Join(failed, ", "))
+	}
+	return all, nil
+}
+
+// Sort orders resources by cloud, kind, creation time and ID.
+func Sort(rs []Resource) {
+	sort.SliceStable(rs, func(i, j int) bool {
+		a, b := rs[i], rs[j]
+		if a.Cloud != b.Cloud {
+			return a.Cloud < b.Cloud
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if !a.Created.Equal(b.Created) {
+			return a.Created.Before(b.Created)
+		}
+		return a.ID < b.ID
+	})
+}
+
+// Delete deletes resources through their cloud's provider, instances
+// first. Deletion continues past failures; the returned error counts them.
+func Delete(ctx context.Context, providers map[string]Provider, rs []Resource) error {
+	failed := 0
+	for _, kind := range deleteOrder {
+		for _, r := range rs {
+			if r.Kind != kind {
+				continue
+			}
+			p, ok := providers[r.Cloud]
+			if !ok {
+				plog.Errorf("no provider for %v", r)
+				failed++
+				continue
+			}
+			plog.Infof("deleting %v (%s)", r, r.Name)
+			if err := p.DeleteResource(ctx, r); err != nil {
+				plog.Errorf("deleting %v: %v", r, err)
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed deleting %d of %d resources", failed, len(rs))
+	}
+	return nil
+}
+
+// WriteTable writes resources to w as an aligned table.
+func WriteTable(w io.Writer, rs []Resource, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLOUD\tKIND\tID\tNAME\tREGION\tOWNER\tFLIGHT\tAGE")
+	for _, r := range rs {
+		age := "-"
+		if !r.Created.IsZero() {
+			age = r.Age(now).Truncate(time.Minute).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Cloud, r.Kind, r.ID, dash(r.Name), dash(r.Region),
+			dash(r.Owner), dash(r.Flight), age)
+	}
+	return tw.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
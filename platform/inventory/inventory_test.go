@@ -0,0 +1,103 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+const flight = "kola-3f2504e0-4f89-11d3-9a0c-0305e82c3301"
+
+type fakeProvider struct {
+	resources []Resource
+	listErr   error
+	deleted   []string
+}
+
+func (p *fakeProvider) ListResources(ctx context.Context) ([]Resource, error) {
+	return p.resources, p.listErr
+}
+
+func (p *fakeProvider) DeleteResource(ctx context.Context, r Resource) error {
+	p.deleted = append(p.deleted, r.ID)
+	if r.Name == "stuck" {
+		return fmt.Errorf("in use")
+	}
+	return nil
+}
+
+func TestFlightName(t *testing.T) {
+	assert.Equal(t, flight, FlightName(flight))
+	assert.Equal(t, flight, FlightName(flight+"-fake"))
+	assert.Equal(t, "", FlightName("kola-123"))
+	assert.Equal(t, "", FlightName("my-laptop"))
+}
+
+func TestTaggedFlight(t *testing.T) {
+	assert.Equal(t, flight, TaggedFlight([]string{"mantle", FlightTag(flight)}))
+	assert.Equal(t, "", TaggedFlight([]string{"mantle"}))
+	assert.Equal(t, "", TaggedFlight([]string{FlightTag("my-laptop")}))
+}
+
+func TestCollect(t *testing.T) {
+	good := &fakeProvider{resources: []Resource{
+		{Cloud: "aws", Kind: KindKey, ID: "b"},
+		{Cloud: "aws", Kind: KindInstance, ID: "a"},
+	}}
+	bad := &fakeProvider{listErr: fmt.Errorf("no credentials")}
+
+	rs, err := Collect(context.Background(), map[string]Provider{"aws": good, "gcloud": bad})
+	assert.EqualError(t, err, "failed listing resources in: gcloud")
+	require.Len(t, rs, 2)
+	assert.Equal(t, KindInstance, rs[0].Kind)
+	assert.Equal(t, KindKey, rs[1].Kind)
+}
+
+func TestDelete(t *testing.T) {
+	p := &fakeProvider{}
+	rs := []Resource{
+		{Cloud: "do", Kind: KindKey, ID: "key"},
+		{Cloud: "do", Kind: KindImage, ID: "image", Name: "stuck"},
+		{Cloud: "do", Kind: KindInstance, ID: "instance"},
+		{Cloud: "nowhere", Kind: KindInstance, ID: "lost"},
+	}
+	err := Delete(context.Background(), map[string]Provider{"do": p}, rs)
+	assert.EqualError(t, err, "failed deleting 2 of 4 resources")
+	assert.Equal(t, []string{"instance", "key", "image"}, p.deleted)
+}
+
+func TestWriteTable(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteTable(&buf, []Resource{
+		{Cloud: "aws", Kind: KindInstance, ID: "i-1", Name: "kola-1", Owner: "1234", Flight: flight, Created: now.Add(-90 * time.Minute)},
+		{Cloud: "aws", Kind: KindSecurityGroup, ID: "sg-1"},
+	}, now)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"CLOUD", "KIND", "ID", "NAME", "REGION", "OWNER", "FLIGHT", "AGE"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"aws", "instance", "i-1", "kola-1", "-", "1234", flight, "1h30m0s"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"aws", "security-group", "sg-1", "-", "-", "-", "-", "-"}, strings.Fields(lines[2]))
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inventorytest provides helpers for testing the inventory
+// providers of the clouds against their fakes.
+package inventorytest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/flatcar-linux/mantle/platform/inventory"
+)
+
+// Flight is a kola flight name, as used for SSH keys and flight tags.
+const Flight = "kola-3f2504e0-4f89-11d3-9a0c-0305e82c3301"
+
+// CheckProvider lists the resources of p and compares them with want,
+// ignoring the IDs and creation times left empty in want. It then deletes
+// them and checks that p lists nothing else. The resources as listed are
+// returned for further checks.
+func CheckProvider(t *testing.T, p inventory.Provider, want []inventory.Resource) []inventory.Resource {
+	t.Helper()
+	ctx := context.Background()
+
+	rs, err := p.ListResources(ctx)
+	require.NoError(t, err)
+	require.Len(t, rs, len(want))
+	for i, r := range rs {
+		if want[i].ID == "" {
+			r.ID = ""
+		}
+		if want[i].Created.IsZero() {
+			r.Created = time.Time{}
+		}
+		assert.Equal(t, want[i], r)
+	}
+
+	for _, r := range rs {
+		require.NoError(t, p.DeleteResource(ctx, r))
+	}
+	left, err := p.ListResources(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, left)
+	return rs
+}
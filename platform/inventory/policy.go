@@ -0,0 +1,161 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+// Rule selects resources by glob patterns on their fields and decides
+// whether they are garbage. Empty patterns match anything.
+type Rule struct {
+	Cloud  string `json:"cloud,omitempty"`
+	Kind   string `json:"kind,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Owner  string `json:"owner,omitempty"`
+	Flight string `json:"flight,omitempty"`
+
+	// MaxAge is how old a matching resource must be to be garbage,
+	// e.g. "5h". Zero matches resources of any known age.
+	MaxAge Duration `json:"max_age,omitempty"`
+	// Keep protects matching resources from deletion.
+	Keep bool `json:"keep,omitempty"`
+	// Orphans makes matching resources of unknown age garbage when
+	// they belong to a flight that no longer has any instances. It has
+	// no effect on clouds with instances of unknown flight, since live
+	// flights can't be told apart there.
+	Orphans bool `json:"orphans,omitempty"`
+}
+
+// Policy is an ordered list of rules; the first rule matching a
+// resource decides its fate, and unmatched resources are kept.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Duration is a time.Duration that is a string in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// DefaultPolicy collects instances and Azure resource groups older
+// than maxAge, matching what the per-cloud gc commands do.
+func DefaultPolicy(maxAge time.Duration) *Policy {
+	return &Policy{
+		Rules: []Rule{
+			{Kind: string(KindInstance), MaxAge: Duration(maxAge)},
+			{Kind: string(KindResourceGroup), MaxAge: Duration(maxAge)},
+		},
+	}
+}
+
+// LoadPolicy reads a JSON policy file.
+func LoadPolicy(filename string) (*Policy, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var p Policy
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("parsing policy %s: %v", filename, err)
+	}
+	for i, r := range p.Rules {
+		for _, pattern := range []string{r.Cloud, r.Kind, r.Name, r.Owner, r.Flight} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("policy %s rule %d: bad pattern %q: %v", filename, i, pattern, err)
+			}
+		}
+	}
+	return &p, nil
+}
+
+func (rule *Rule) matches(r Resource) bool {
+	for _, m := range []struct{ pattern, value string }{
+		{rule.Cloud, r.Cloud},
+		{rule.Kind, string(r.Kind)},
+		{rule.Name, r.Name},
+		{rule.Owner, r.Owner},
+		{rule.Flight, r.Flight},
+	} {
+		if m.pattern == "" {
+			continue
+		}
+		if ok, _ := path.Match(m.pattern, m.value); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Garbage returns the resources the policy selects for deletion.
+// The full inventory is needed to tell which flights are still alive.
+func (p *Policy) Garbage(rs []Resource, now time.Time) []Resource {
+	live := make(map[string]bool)
+	blind := make(map[string]bool) // clouds with instances of unknown flight
+	for _, r := range rs {
+		if r.Kind != KindInstance {
+			continue
+		}
+		if r.Flight == "" {
+			blind[r.Cloud] = true
+		} else {
+			live[r.Cloud+"/"+r.Flight] = true
+		}
+	}
+
+	var garbage []Resource
+	for _, r := range rs {
+		for i := range p.Rules {
+			rule := &p.Rules[i]
+			if !rule.matches(r) {
+				continue
+			}
+			switch {
+			case rule.Keep:
+			case r.Created.IsZero():
+				if rule.Orphans && r.Flight != "" && !blind[r.Cloud] && !live[r.Cloud+"/"+r.Flight] {
+					garbage = append(garbage, r)
+				}
+			case r.Age(now) >= time.Duration(rule.MaxAge):
+				garbage = append(garbage, r)
+			}
+			break
+		}
+	}
+	return garbage
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inventory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ids(rs []Resource) []string {
+	var ret []string
+	for _, r := range rs {
+		ret = append(ret, r.ID)
+	}
+	return ret
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	rs := []Resource{
+		{Cloud: "aws", Kind: KindInstance, ID: "old", Created: now.Add(-6 * time.Hour)},
+		{Cloud: "aws", Kind: KindInstance, ID: "new", Created: now.Add(-time.Hour)},
+		{Cloud: "azure", Kind: KindResourceGroup, ID: "rg", Created: now.Add(-5 * time.Hour)},
+		{Cloud: "aws", Kind: KindImage, ID: "image", Created: now.Add(-100 * time.Hour)},
+		{Cloud: "aws", Kind: KindKey, ID: "key"},
+	}
+	assert.Equal(t, []string{"old", "rg"}, ids(DefaultPolicy(5*time.Hour).Garbage(rs, now)))
+}
+
+func TestPolicyRules(t *testing.T) {
+	p := &Policy{Rules: []Rule{
+		{Name: "release-*", Keep: true},
+		{Cloud: "aws", Kind: "key", Orphans: true},
+		{Kind: "image", MaxAge: Duration(24 * time.Hour)},
+		{Owner: "ci", MaxAge: Duration(time.Hour)},
+	}}
+	rs := []Resource{
+		{Cloud: "aws", Kind: KindImage, ID: "release", Name: "release-1", Created: now.Add(-1000 * time.Hour)},
+		{Cloud: "aws", Kind: KindImage, ID: "image-old", Created: now.Add(-25 * time.Hour)},
+		{Cloud: "aws", Kind: KindImage, ID: "image-new", Created: now.Add(-2 * time.Hour)},
+		{Cloud: "aws", Kind: KindKey, ID: "key-live", Flight: flight},
+		{Cloud: "aws", Kind: KindKey, ID: "key-orphan", Flight: "kola-other"},
+		{Cloud: "aws", Kind: KindKey, ID: "key-anon"},
+		{Cloud: "aws", Kind: KindInstance, ID: "instance", Flight: flight, Owner: "me", Created: now.Add(-2 * time.Hour)},
+		{Cloud: "gcloud", Kind: KindInstance, ID: "ci", Owner: "ci", Created: now.Add(-2 * time.Hour)},
+	}
+	assert.Equal(t, []string{"image-old", "key-orphan", "ci"}, ids(p.Garbage(rs, now)))
+}
+
+func TestPolicyOrphansUnknownFlight(t *testing.T) {
+	p := &Policy{Rules: []Rule{
+		{Kind: "key", Orphans: true},
+	}}
+	rs := []Resource{
+		{Cloud: "do", Kind: KindKey, ID: "do-key", Flight: flight},
+		{Cloud: "do", Kind: KindInstance, ID: "do-instance", Created: now.Add(-time.Hour)},
+		{Cloud: "aws", Kind: KindKey, ID: "aws-key", Flight: flight},
+	}
+	assert.Equal(t, []string{"aws-key"}, ids(p.Garbage(rs, now)))
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inventory")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	good := filepath.Join(dir, "good.json")
+	require.NoError(t, ioutil.WriteFile(good, []byte(`{"rules": [
+		{"name": "release-*", "keep": true},
+		{"kind": "instance", "max_age": "5h"}
+	]}`), 0644))
+	p, err := LoadPolicy(good)
+	require.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Name: "release-*", Keep: true},
+		{Kind: "instance", MaxAge: Duration(5 * time.Hour)},
+	}, p.Rules)
+
+	for name, body := range map[string]string{
+		"duration.json": `{"rules": [{"max_age": "5 days"}]}`,
+		"unknown.json":  `{"rules": [{"age": "5h"}]}`,
+		"pattern.json":  `{"rules": [{"name": "["}]}`,
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(body), 0644))
+		_, err := LoadPolicy(path)
+		assert.Error(t, err, name)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netns"
@@ -29,6 +30,7 @@ import (
 	"github.com/flatcar-linux/mantle/lang/destructor"
 	"github.com/flatcar-linux/mantle/network"
 	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/conf"
 	"github.com/flatcar-linux/mantle/system/exec"
 	"github.com/flatcar-linux/mantle/system/ns"
 )
@@ -36,8 +38,13 @@ import (
 type LocalCluster struct {
 	destructor.MultiDestructor
 	*platform.BaseCluster
-	flight      *LocalFlight
-	OmahaServer OmahaWrapper
+	flight        *LocalFlight
+	OmahaServer   OmahaWrapper
+	ContentServer *ContentServer
+
+	mu     sync.Mutex
+	taps   map[string]string // machine IP to tap device
+	faults map[string]int    // tap device to number of faults
 }
 
 func (lc *LocalCluster) NewCommand(name string, arg ...string) exec.Cmd {
@@ -93,6 +100,53 @@ func (lc *LocalCluster) GetOmahaHostPort() (string, error) {
 	return net.JoinHostPort(lc.hostIP(), port), nil
 }
 
+// PXEURL returns the URL of a file of the flight's PXE server as seen
+// from the machines.
+func (lc *LocalCluster) PXEURL(name string) string {
+	host := net.JoinHostPort(lc.hostIP(), strconv.Itoa(lc.flight.PXEServer.Port()))
+	return fmt.Sprintf("http://%s/%s", host, name)
+}
+
+// ServeContent implements platform.ContentCluster.
+func (lc *LocalCluster) ServeContent(name string, content platform.Content) error {
+	return lc.ContentServer.Serve(name, content)
+}
+
+// ContentURL implements platform.ContentCluster.
+func (lc *LocalCluster) ContentURL(scheme, name string) (string, error) {
+	return lc.ContentServer.URL(scheme, name)
+}
+
+// ContentCA implements platform.ContentCluster.
+func (lc *LocalCluster) ContentCA() []byte {
+	return lc.ContentServer.CA
+}
+
+// RegistryAddr returns the address of the flight's registry as seen from
+// the machines.
+func (lc *LocalCluster) RegistryAddr() string {
+	return net.JoinHostPort(lc.hostIP(), strconv.Itoa(lc.flight.Registry.Port()))
+}
+
+// ImportRegistryImage adds the images at path to the flight's registry,
+// see Registry.Import. Only machines created afterwards use the registry
+// as a mirror for registries it didn't serve before.
+func (lc *LocalCluster) ImportRegistryImage(path string) error {
+	return lc.flight.Registry.Import(path)
+}
+
+// AddRegistryMirror configures the container runtimes of a machine to
+// pull images from the flight's registry, if it serves any. Configs which
+// can't carry files, such as scripts, are left alone.
+func (lc *LocalCluster) AddRegistryMirror(c *conf.Conf) {
+	if !c.CanAddFiles() {
+		return
+	}
+	for path, contents := range lc.flight.Registry.MirrorFiles(lc.RegistryAddr()) {
+		c.AddFile(path, "root", contents, 0644)
+	}
+}
+
 func (lc *LocalCluster) NewTap(bridge string) (*TunTap, error) {
 	nsExit, err := ns.Enter(lc.flight.nshandle)
 	if err != nil {
@@ -123,6 +177,128 @@ func (lc *LocalCluster) NewTap(bridge string) (*TunTap, error) {
 	return tap, nil
 }
 
+// NIC describes a network card of a machine.
+type NIC struct {
+	// Segment is the name of the segment the card is attached to, or
+	// TrunkBridge.
+	Segment string
+	// Interface holds the addresses assigned to the card. Cards on
+	// TrunkBridge only have a hardware address; VLAN interfaces on them
+	// get their addresses from the dynamic range of the VLAN segments.
+	Interface *Interface
+}
+
+// AddSegment creates a network segment for the cluster. It is removed
+// when the cluster is destroyed.
+func (lc *LocalCluster) AddSegment(opts SegmentOptions) (*Segment, error) {
+	nsExit, err := ns.Enter(lc.flight.nshandle)
+	if err != nil {
+		return nil, err
+	}
+	defer nsExit()
+
+	seg, err := lc.flight.Dnsmasq.AddSegment(opts)
+	if err != nil {
+		return nil, fmt.Errorf("adding segment: %v", err)
+	}
+	lc.AddDestructor(&segmentDestructor{lc.flight, seg})
+	return seg, nil
+}
+
+type segmentDestructor struct {
+	flight  *LocalFlight
+	segment *Segment
+}
+
+func (sd *segmentDestructor) Destroy() {
+	nsExit, err := ns.Enter(sd.flight.nshandle)
+	if err != nil {
+		plog.Errorf("Entering network namespace: %v", err)
+		return
+	}
+	defer nsExit()
+	if err := sd.flight.Dnsmasq.RemoveSegment(sd.segment); err != nil {
+		plog.Errorf("Removing segment %s: %v", sd.segment.Name, err)
+	}
+}
+
+// NewNIC allocates the addresses of a network card on the named segment
+// and creates the tap device backing it. Cards on TrunkBridge carry all
+// VLAN segments tagged.
+func (lc *LocalCluster) NewNIC(segment string) (*NIC, *TunTap, error) {
+	if segment == TrunkBridge {
+		// only the hardware address is used, the br0 lease stays unused
+		netif := lc.flight.Dnsmasq.GetInterface("br0")
+		tap, err := lc.NewTrunkTap()
+		if err != nil {
+			return nil, nil, err
+		}
+		return &NIC{Segment: segment, Interface: &Interface{HardwareAddr: netif.HardwareAddr}}, tap, nil
+	}
+
+	seg, err := lc.flight.Dnsmasq.Segment(segment)
+	if err != nil {
+		return nil, nil, err
+	}
+	if seg.Options.VLAN != 0 {
+		return nil, nil, fmt.Errorf("segment %s is a VLAN, attach to %s instead", segment, TrunkBridge)
+	}
+	netif := lc.flight.Dnsmasq.GetInterface(segment)
+	tap, err := lc.NewTap(seg.BridgeName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lc.mu.Lock()
+	if lc.taps == nil {
+		lc.taps = make(map[string]string)
+	}
+	lc.taps[netif.IP().String()] = tap.Attrs().Name
+	lc.mu.Unlock()
+
+	return &NIC{Segment: segment, Interface: netif}, tap, nil
+}
+
+// ReleaseNICs forgets the network cards of a destroyed machine, along
+// with the faults added for them, as their tap devices are gone.
+func (lc *LocalCluster) ReleaseNICs(nics []*NIC) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	for _, nic := range nics {
+		// cards on TrunkBridge have no address
+		if len(nic.Interface.DHCPv4) == 0 && len(nic.Interface.DHCPv6) == 0 {
+			continue
+		}
+		ip := nic.Interface.IP().String()
+		if tap, ok := lc.taps[ip]; ok {
+			delete(lc.faults, tap)
+			delete(lc.taps, ip)
+		}
+	}
+}
+
+// NewTrunkTap creates a tap device on TrunkBridge which carries the VLAN
+// segments existing at the time of the call.
+func (lc *LocalCluster) NewTrunkTap() (*TunTap, error) {
+	tap, err := lc.NewTap(TrunkBridge)
+	if err != nil {
+		return nil, err
+	}
+
+	nsExit, err := ns.Enter(lc.flight.nshandle)
+	if err != nil {
+		return nil, err
+	}
+	defer nsExit()
+
+	for _, seg := range lc.flight.Dnsmasq.VLANSegments() {
+		if err := netlink.BridgeVlanAdd(tap, seg.Options.VLAN, false, false, false, true); err != nil {
+			return nil, fmt.Errorf("adding VLAN %d to tap: %v", seg.Options.VLAN, err)
+		}
+	}
+	return tap, nil
+}
+
 func (lc *LocalCluster) GetNsHandle() netns.NsHandle {
 	return lc.flight.nshandle
 }
@@ -0,0 +1,250 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flatcar-linux/mantle/platform"
+)
+
+// ContentServer serves platform.Content to the machines of a cluster over
+// HTTP and HTTPS, and over TFTP through dnsmasq.
+type ContentServer struct {
+	// CA is the PEM encoded certificate that signed the HTTPS
+	// certificate.
+	CA []byte
+
+	ip       net.IP
+	tftpRoot string
+	tftpDir  string
+
+	mu      sync.Mutex
+	content map[string]platform.Content
+
+	http      *http.Server
+	https     *http.Server
+	httpAddr  net.Addr
+	httpsAddr net.Addr
+}
+
+// NewContentServer starts serving content on ip in the current network
+// namespace. TFTP content is written to dir below tftpRoot.
+func NewContentServer(ip net.IP, httpPort, httpsPort int, tftpRoot, dir string) (*ContentServer, error) {
+	cs := &ContentServer{
+		ip:       ip,
+		tftpRoot: tftpRoot,
+		tftpDir:  dir,
+		content:  make(map[string]platform.Content),
+	}
+
+	ca, cert, err := newContentCertificates(ip)
+	if err != nil {
+		return nil, fmt.Errorf("creating certificates: %v", err)
+	}
+	cs.CA = ca
+
+	if err := os.MkdirAll(filepath.Join(tftpRoot, dir), 0755); err != nil {
+		return nil, err
+	}
+
+	httpListener, err := net.Listen("tcp", net.JoinHostPort(ip.String(), fmt.Sprint(httpPort)))
+	if err != nil {
+		return nil, err
+	}
+	httpsListener, err := net.Listen("tcp", net.JoinHostPort(ip.String(), fmt.Sprint(httpsPort)))
+	if err != nil {
+		httpListener.Close()
+		return nil, err
+	}
+	cs.httpAddr = httpListener.Addr()
+	cs.httpsAddr = httpsListener.Addr()
+
+	cs.http = &http.Server{Handler: cs}
+	cs.https = &http.Server{
+		Handler: cs,
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		},
+	}
+	go cs.http.Serve(httpListener)
+	go cs.https.Serve(tls.NewListener(httpsListener, cs.https.TLSConfig))
+
+	return cs, nil
+}
+
+// newContentCertificates creates a CA and a certificate for ip signed by
+// it.
+func newContentCertificates(ip net.IP) ([]byte, tls.Certificate, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, tls.Certificate{}, err
+	}
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(7 * 24 * time.Hour)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kola content CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, tls.Certificate{}, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, tls.Certificate{}, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: ip.String()},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{ip},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, tls.Certificate{}, err
+	}
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	cert := tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+	return ca, cert, nil
+}
+
+// cleanName normalizes name to a relative slash separated path.
+func cleanName(name string) (string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "", fmt.Errorf("empty content name")
+	}
+	return name, nil
+}
+
+// Serve makes content available under name.
+func (cs *ContentServer) Serve(name string, content platform.Content) error {
+	name, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.content[name] = content
+
+	tftpPath := filepath.Join(cs.tftpRoot, cs.tftpDir, filepath.FromSlash(name))
+	if content.Status != 0 {
+		if err := os.Remove(tftpPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(tftpPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(tftpPath, content.Served(), 0644)
+}
+
+// URL returns the URL of name for the scheme "http", "https" or "tftp".
+func (cs *ContentServer) URL(scheme, name string) (string, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	switch scheme {
+	case "http":
+		return fmt.Sprintf("http://%s/%s", cs.httpAddr, name), nil
+	case "https":
+		return fmt.Sprintf("https://%s/%s", cs.httpsAddr, name), nil
+	case "tftp":
+		return fmt.Sprintf("tftp://%s/%s/%s", cs.ip, cs.tftpDir, name), nil
+	default:
+		return "", fmt.Errorf("unsupported scheme %q", scheme)
+	}
+}
+
+func (cs *ContentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, err := cleanName(r.URL.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	cs.mu.Lock()
+	content, ok := cs.content[name]
+	cs.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if content.Delay > 0 {
+		select {
+		case <-time.After(content.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if content.Status != 0 {
+		http.Error(w, http.StatusText(content.Status), content.Status)
+		return
+	}
+	if content.ContentType != "" {
+		w.Header().Set("Content-Type", content.ContentType)
+	}
+	w.Write(content.Served())
+}
+
+func (cs *ContentServer) Destroy() {
+	if err := cs.http.Close(); err != nil {
+		plog.Errorf("Error stopping content HTTP server: %v", err)
+	}
+	if err := cs.https.Close(); err != nil {
+		plog.Errorf("Error stopping content HTTPS server: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(cs.tftpRoot, cs.tftpDir)); err != nil {
+		plog.Errorf("Error removing TFTP content: %v", err)
+	}
+}
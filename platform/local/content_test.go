@@ -0,0 +1,114 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flatcar-linux/mantle/platform"
+)
+
+func TestContentServer(t *testing.T) {
+	tftpRoot := t.TempDir()
+	cs, err := NewContentServer(net.IPv4(127, 0, 0, 1), 0, 0, tftpRoot, "content-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Destroy()
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(cs.CA) {
+		t.Fatal("invalid CA certificate")
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+
+	get := func(scheme, name string) (int, string) {
+		url, err := cs.URL(scheme, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(data)
+	}
+
+	if err := cs.Serve("/dir/file", platform.Content{Data: []byte("kola")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, scheme := range []string{"http", "https"} {
+		if status, data := get(scheme, "dir/file"); status != http.StatusOK || data != "kola" {
+			t.Errorf("%s: unexpected response %d %q", scheme, status, data)
+		}
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(tftpRoot, "content-test", "dir", "file")); err != nil || string(data) != "kola" {
+		t.Errorf("unexpected TFTP content %q: %v", data, err)
+	}
+	if url, _ := cs.URL("tftp", "dir/file"); url != "tftp://127.0.0.1/content-test/dir/file" {
+		t.Errorf("unexpected TFTP URL %s", url)
+	}
+
+	if status, _ := get("http", "missing"); status != http.StatusNotFound {
+		t.Errorf("expected 404 for missing content, got %d", status)
+	}
+
+	if err := cs.Serve("dir/file", platform.Content{Data: []byte("kola"), Status: http.StatusInternalServerError}); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := get("http", "dir/file"); status != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", status)
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(tftpRoot, "content-test", "dir", "file")); err == nil {
+		t.Errorf("failing content still served over TFTP")
+	}
+
+	corrupt := platform.Content{Data: []byte("kola"), Corrupt: true}
+	if err := cs.Serve("corrupt", corrupt); err != nil {
+		t.Fatal(err)
+	}
+	if _, data := get("http", "corrupt"); data == "kola" || (platform.Content{Data: []byte(data)}).Hash() == corrupt.Hash() {
+		t.Errorf("corrupt content served intact")
+	}
+
+	if err := cs.Serve("slow", platform.Content{Data: []byte("kola"), Delay: 200 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	get("http", "slow")
+	if time.Since(start) < 200*time.Millisecond {
+		t.Errorf("slow content not delayed")
+	}
+
+	if _, err := cs.URL("ftp", "dir/file"); err == nil {
+		t.Errorf("expected error for unsupported scheme")
+	}
+}
@@ -16,12 +16,18 @@
 package local
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"text/template"
 
 	"github.com/coreos/go-iptables/iptables"
@@ -51,26 +57,82 @@ type Interface struct {
 	//SLAAC net.IPAddr
 }
 
+// IP returns the IPv4 address of the interface, or its IPv6 address on
+// IPv6-only segments.
+func (i *Interface) IP() net.IP {
+	if len(i.DHCPv4) != 0 {
+		return i.DHCPv4[0].IP
+	}
+	return i.DHCPv6[0].IP
+}
+
+// SegmentOptions describes a network segment.
+type SegmentOptions struct {
+	// IPv4 enables DHCPv4 on the segment.
+	IPv4 bool
+	// IPv6 enables router advertisements and DHCPv6 on the segment.
+	IPv6 bool
+	// VLAN carries the segment as a tagged VLAN on TrunkBridge instead
+	// of a bridge of its own.
+	VLAN uint16
+}
+
 type Segment struct {
+	// Name is the interface dnsmasq serves the segment on, the bridge
+	// or the VLAN interface on TrunkBridge.
+	Name string
+	// BridgeName is the bridge machines attach to.
 	BridgeName string
 	BridgeIf   *Interface
 	Interfaces []*Interface
+	Options    SegmentOptions
+	index      byte
 	nextIf     int
+}
+
+// Default reports whether seg is br0, which every flight has. It keeps
+// its SLAAC addresses, while added segments use DHCPv6 with the static
+// addresses of Interfaces and dynamic ranges for unknown hosts.
+func (seg *Segment) Default() bool {
+	return seg.index == 0 && seg.Options.VLAN == 0
+}
+
+// DynamicIPv4 returns the range of IPv4 addresses handed out to unknown
+// hosts, such as VLAN interfaces configured in machines. It does not
+// overlap with Interfaces.
+func (seg *Segment) DynamicIPv4() string {
+	return fmt.Sprintf("10.%d.255.1,10.%d.255.254", seg.index, seg.index)
+}
+
+// DynamicIPv6 is like DynamicIPv4 for IPv6 addresses.
+func (seg *Segment) DynamicIPv6() string {
+	return fmt.Sprintf("fd%02x::ff:1,fd%02x::ff:ffff", seg.index, seg.index)
+}
+
+type Dnsmasq struct {
+	Segments []*Segment
+	// TFTPRoot is served to iPXE clients, which are told to boot
+	// boot.ipxe from it. Empty disables network booting.
+	TFTPRoot string
 	// Listener holds the unique TCP socket
 	// created to ensure uniqueness of IP
 	// it has to be closed once the kola instance
 	// has terminated
 	Listener net.Listener
-}
 
-type Dnsmasq struct {
-	Segments []*Segment
-	dnsmasq  *exec.ExecCmd
+	mu      sync.Mutex
+	dnsmasq *exec.ExecCmd
+	// hostsDir holds a file with the dhcp-host entries of each added
+	// segment, which dnsmasq reads again on SIGHUP.
+	hostsDir string
 }
 
 const (
 	numInterfaces = 500 // affects dnsmasq startup time
-	numSegments   = 1
+	maxSegments   = 256
+
+	// TrunkBridge carries the VLAN segments of a flight.
+	TrunkBridge = "trunk"
 
 	debugConfig = `
 log-queries
@@ -100,8 +162,15 @@ enable-ra
 dhcp-option=option:ntp-server,0.0.0.0
 dhcp-option=option6:ntp-server,[::]
 
+{{if .TFTPRoot}}
+enable-tftp
+tftp-root={{.TFTPRoot}}
+dhcp-match=set:ipxe,175
+dhcp-boot=tag:ipxe,boot.ipxe
+{{end}}
+
 {{range .Segments}}
-domain={{.BridgeName}}.local
+domain={{.Name}}.local
 
 {{range .BridgeIf.DHCPv4}}
 dhcp-range={{.IP}},static
@@ -116,22 +185,42 @@ dhcp-host={{.HardwareAddr}}{{template "ips" .DHCPv4}}{{template "ips" .DHCPv6}}
 {{end}}
 {{end}}
 
+# ranges of the segments AddSegment may create
+{{range .Slots}}
+{{range .BridgeIf.DHCPv4}}
+dhcp-range={{.IP}},static
+{{end}}
+dhcp-range={{.DynamicIPv4}},1h
+
+{{range .BridgeIf.DHCPv6}}
+dhcp-range={{.IP}},static,64
+{{end}}
+dhcp-range={{.DynamicIPv6}},64,1h
+{{end}}
+
+dhcp-hostsdir={{.HostsDir}}
+
 {{define "ips"}}{{range .}}{{printf ",%s" .IP}}{{end}}{{end}}
 `
 )
 
 var plog = capnslog.NewPackageLogger("github.com/flatcar-linux/mantle", "platform/local")
 
-func newInterface(s byte, i uint16) *Interface {
-	return &Interface{
+func newInterface(s byte, i uint16, opts SegmentOptions) *Interface {
+	in := &Interface{
 		HardwareAddr: net.HardwareAddr{0x02, s, 0, 0, byte(i / 256), byte(i % 256)},
-		DHCPv4: []net.IPNet{{
+	}
+	if opts.IPv4 {
+		in.DHCPv4 = []net.IPNet{{
 			IP:   net.IP{10, s, byte(i / 256), byte(i % 256)},
-			Mask: net.CIDRMask(16, 32)}},
-		DHCPv6: []net.IPNet{{
+			Mask: net.CIDRMask(16, 32)}}
+	}
+	if opts.IPv6 {
+		in.DHCPv6 = []net.IPNet{{
 			IP:   net.IP{0xfd, s, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, byte(i / 256), byte(i % 256)},
-			Mask: net.CIDRMask(64, 128)}},
+			Mask: net.CIDRMask(64, 128)}}
 	}
+	return in
 }
 
 // configureNAT creates and append a NAT rule
@@ -215,45 +304,120 @@ func setupLink(l netlink.Link, addr string, add bool) error {
 	return nil
 }
 
-func newSegment(s byte) (*Segment, error) {
+// segmentName returns the name of the interface serving segment s.
+func segmentName(s byte, opts SegmentOptions) string {
+	if opts.VLAN != 0 {
+		return fmt.Sprintf("%s.%d", TrunkBridge, opts.VLAN)
+	}
+	return fmt.Sprintf("br%d", s)
+}
+
+func newSegment(s byte, opts SegmentOptions) (*Segment, error) {
 	seg := &Segment{
+		Name:       segmentName(s, opts),
 		BridgeName: fmt.Sprintf("br%d", s),
-		BridgeIf:   newInterface(s, 1),
+		BridgeIf:   newInterface(s, 1, opts),
+		Options:    opts,
+		index:      s,
 	}
 
 	for i := uint16(2); i < 2+numInterfaces; i++ {
-		seg.Interfaces = append(seg.Interfaces, newInterface(s, i))
+		seg.Interfaces = append(seg.Interfaces, newInterface(s, i, opts))
 	}
 
-	br := netlink.Bridge{
-		LinkAttrs: netlink.LinkAttrs{
-			Name:         seg.BridgeName,
-			HardwareAddr: seg.BridgeIf.HardwareAddr,
-		},
-	}
-
-	if err := netlink.LinkAdd(&br); err != nil {
-		return nil, fmt.Errorf("LinkAdd() failed: %v", err)
+	var link netlink.Link
+	if opts.VLAN != 0 {
+		trunk, err := trunkBridge()
+		if err != nil {
+			return nil, err
+		}
+		seg.BridgeName = TrunkBridge
+		link = &netlink.Vlan{
+			LinkAttrs: netlink.LinkAttrs{
+				Name:         seg.Name,
+				ParentIndex:  trunk.Attrs().Index,
+				HardwareAddr: seg.BridgeIf.HardwareAddr,
+			},
+			VlanId: int(opts.VLAN),
+		}
+		if err := netlink.LinkAdd(link); err != nil {
+			return nil, fmt.Errorf("LinkAdd() failed: %v", err)
+		}
+		// let the bridge itself receive the tagged frames
+		if err := netlink.BridgeVlanAdd(trunk, opts.VLAN, false, false, true, false); err != nil {
+			return nil, fmt.Errorf("BridgeVlanAdd() failed: %v", err)
+		}
+	} else {
+		link = &netlink.Bridge{
+			LinkAttrs: netlink.LinkAttrs{
+				Name:         seg.BridgeName,
+				HardwareAddr: seg.BridgeIf.HardwareAddr,
+			},
+		}
+		if err := netlink.LinkAdd(link); err != nil {
+			return nil, fmt.Errorf("LinkAdd() failed: %v", err)
+		}
 	}
 
 	for _, addr := range seg.BridgeIf.DHCPv4 {
 		nladdr := netlink.Addr{IPNet: &addr}
-		if err := netlink.AddrAdd(&br, &nladdr); err != nil {
+		if err := netlink.AddrAdd(link, &nladdr); err != nil {
 			return nil, fmt.Errorf("DHCPv4 AddrAdd() failed: %v", err)
 		}
 	}
 
 	for _, addr := range seg.BridgeIf.DHCPv6 {
 		nladdr := netlink.Addr{IPNet: &addr}
-		if err := netlink.AddrAdd(&br, &nladdr); err != nil {
+		if err := netlink.AddrAdd(link, &nladdr); err != nil {
 			return nil, fmt.Errorf("DHCPv6 AddrAdd() failed: %v", err)
 		}
 	}
 
-	if err := netlink.LinkSetUp(&br); err != nil {
+	if err := netlink.LinkSetUp(link); err != nil {
 		return nil, fmt.Errorf("LinkSetUp() failed: %v", err)
 	}
 
+	return seg, nil
+}
+
+// trunkBridge returns the VLAN filtering bridge carrying the VLAN
+// segments, creating it if needed.
+func trunkBridge() (netlink.Link, error) {
+	if link, err := netlink.LinkByName(TrunkBridge); err == nil {
+		return link, nil
+	}
+	filtering := true
+	br := &netlink.Bridge{
+		LinkAttrs:     netlink.LinkAttrs{Name: TrunkBridge},
+		VlanFiltering: &filtering,
+	}
+	if err := netlink.LinkAdd(br); err != nil {
+		return nil, fmt.Errorf("LinkAdd() failed: %v", err)
+	}
+	if err := netlink.LinkSetUp(br); err != nil {
+		return nil, fmt.Errorf("LinkSetUp() failed: %v", err)
+	}
+	return netlink.LinkByName(TrunkBridge)
+}
+
+// removeSegment deletes the interface of a segment.
+func removeSegment(seg *Segment) error {
+	link, err := netlink.LinkByName(seg.Name)
+	if err != nil {
+		return err
+	}
+	if seg.Options.VLAN != 0 {
+		if trunk, err := netlink.LinkByName(TrunkBridge); err == nil {
+			netlink.BridgeVlanDel(trunk, seg.Options.VLAN, false, false, true, false)
+		}
+	}
+	return netlink.LinkDel(link)
+}
+
+// setupUplink connects the namespace to the root network namespace through
+// a veth pair and NATs outgoing traffic. It returns the listener that
+// reserves the address range of the pair.
+func setupUplink() (net.Listener, error) {
 	// we first create an unique virtual ethernet pair in the root network namespace
 	// we use linux network random port attribution to assert the uniqueness of the IP range in order to avoid IP
 	// range clashes
@@ -330,9 +494,6 @@ func newSegment(s byte) (*Segment, error) {
 		return nil, fmt.Errorf("unable to exit root namespace: %w", err)
 	}
 
-	// keep the created listener for destroying later
-	seg.Listener = listener
-
 	peer0 := strings.Split(pair[0], "|")
 	peer1 := strings.Split(pair[1], "|")
 
@@ -424,17 +585,20 @@ func newSegment(s byte) (*Segment, error) {
 		return nil, fmt.Errorf("unable to exit root namespace: %w", err)
 	}
 
-	return seg, nil
+	return listener, nil
 }
 
-func NewDnsmasq() (*Dnsmasq, error) {
-	dm := &Dnsmasq{}
-	for s := byte(0); s < numSegments; s++ {
-		seg, err := newSegment(s)
-		if err != nil {
-			return nil, fmt.Errorf("Network setup failed: %v", err)
-		}
-		dm.Segments = append(dm.Segments, seg)
+func NewDnsmasq(tftpRoot string) (*Dnsmasq, error) {
+	dm := &Dnsmasq{TFTPRoot: tftpRoot}
+	seg, err := newSegment(0, SegmentOptions{IPv4: true, IPv6: true})
+	if err != nil {
+		return nil, fmt.Errorf("Network setup failed: %v", err)
+	}
+	dm.Segments = append(dm.Segments, seg)
+
+	dm.Listener, err = setupUplink()
+	if err != nil {
+		return nil, fmt.Errorf("Network setup failed: %v", err)
 	}
 
 	// setup lo
@@ -447,21 +611,62 @@ func NewDnsmasq() (*Dnsmasq, error) {
 		return nil, fmt.Errorf("Network loopback setup failed: %v", err)
 	}
 
+	dm.hostsDir, err = ioutil.TempDir("", "mantle-dnsmasq")
+	if err != nil {
+		dm.Listener.Close()
+		return nil, err
+	}
+
+	if err := dm.start(); err != nil {
+		dm.Listener.Close()
+		os.RemoveAll(dm.hostsDir)
+		return nil, err
+	}
+	return dm, nil
+}
+
+// configData is what the dnsmasq configuration is generated from.
+type configData struct {
+	*Dnsmasq
+	// Slots holds a segment for every index AddSegment may use.
+	Slots    []*Segment
+	HostsDir string
+}
+
+// newConfigData declares the DHCP ranges of all segments AddSegment may
+// create up front, so that dnsmasq keeps running while segments come and
+// go. A range only applies to an interface with an address in it, so the
+// ranges of missing segments and of address families a segment lacks are
+// ignored.
+func newConfigData(dm *Dnsmasq) *configData {
+	data := &configData{Dnsmasq: dm, HostsDir: dm.hostsDir}
+	for s := 1; s < maxSegments; s++ {
+		data.Slots = append(data.Slots, &Segment{
+			BridgeIf: newInterface(byte(s), 1, SegmentOptions{IPv4: true, IPv6: true}),
+			index:    byte(s),
+		})
+	}
+	return data
+}
+
+// start runs dnsmasq with the configuration of the default segment and
+// the ranges of all segments AddSegment may create.
+func (dm *Dnsmasq) start() error {
 	dm.dnsmasq = exec.Command("dnsmasq", "--conf-file=-")
 	cfg, err := dm.dnsmasq.StdinPipe()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	out, err := dm.dnsmasq.StdoutPipe()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	dm.dnsmasq.Stderr = dm.dnsmasq.Stdout
 	go util.LogFrom(capnslog.INFO, out)
 
 	if err = dm.dnsmasq.Start(); err != nil {
 		cfg.Close()
-		return nil, err
+		return err
 	}
 
 	plog.Debugf("dnsmasq PID (manual cleanup needed if --remove=false): %v", dm.dnsmasq.Pid())
@@ -476,19 +681,148 @@ func NewDnsmasq() (*Dnsmasq, error) {
 			template.New("dnsmasq").Parse(quietConfig + commonConfig))
 	}
 
-	if err = configTemplate.Execute(cfg, dm); err != nil {
+	if err = configTemplate.Execute(cfg, newConfigData(dm)); err != nil {
 		cfg.Close()
-		dm.Destroy()
-		return nil, err
+		dm.dnsmasq.Kill()
+		return err
 	}
 	cfg.Close()
 
-	return dm, nil
+	return nil
+}
+
+// hostsPath returns the file holding the dhcp-host entries of seg.
+func (dm *Dnsmasq) hostsPath(seg *Segment) string {
+	return filepath.Join(dm.hostsDir, seg.Name)
+}
+
+// hostsEntries returns the dhcp-host entries of the interfaces of an
+// added segment.
+func hostsEntries(seg *Segment) []byte {
+	var buf bytes.Buffer
+	for _, in := range seg.Interfaces {
+		buf.WriteString(in.HardwareAddr.String())
+		for _, addr := range in.DHCPv4 {
+			fmt.Fprintf(&buf, ",%s", addr.IP)
+		}
+		for _, addr := range in.DHCPv6 {
+			fmt.Fprintf(&buf, ",[%s]", addr.IP)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+// writeHosts makes dnsmasq serve the interfaces of seg.
+func (dm *Dnsmasq) writeHosts(seg *Segment) error {
+	// dnsmasq ignores dot files, so it never reads a partial file
+	tmp := filepath.Join(dm.hostsDir, "."+seg.Name)
+	if err := ioutil.WriteFile(tmp, hostsEntries(seg), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dm.hostsPath(seg)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return dm.reload()
+}
+
+// reload makes dnsmasq read the dhcp-host entries of the segments again.
+// Unlike a restart, it leaves DHCP, DNS and TFTP of the other segments
+// alone.
+func (dm *Dnsmasq) reload() error {
+	return dm.dnsmasq.Process.Signal(syscall.SIGHUP)
+}
+
+// AddSegment creates a new segment and serves it. It must be called in the
+// network namespace of dnsmasq.
+func (dm *Dnsmasq) AddSegment(opts SegmentOptions) (*Segment, error) {
+	if !opts.IPv4 && !opts.IPv6 {
+		return nil, fmt.Errorf("segment needs IPv4 or IPv6")
+	}
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	used := make(map[byte]bool)
+	for _, seg := range dm.Segments {
+		used[seg.index] = true
+		if opts.VLAN != 0 && seg.Options.VLAN == opts.VLAN {
+			return nil, fmt.Errorf("VLAN %d already exists", opts.VLAN)
+		}
+	}
+	s := 0
+	for s < maxSegments && used[byte(s)] {
+		s++
+	}
+	if s == maxSegments {
+		return nil, fmt.Errorf("too many segments")
+	}
+
+	seg, err := newSegment(byte(s), opts)
+	if err != nil {
+		removeSegment(&Segment{Name: segmentName(byte(s), opts), Options: opts})
+		return nil, err
+	}
+	if err := dm.writeHosts(seg); err != nil {
+		removeSegment(seg)
+		return nil, fmt.Errorf("serving segment %s: %v", seg.Name, err)
+	}
+	dm.Segments = append(dm.Segments, seg)
+	return seg, nil
+}
+
+// RemoveSegment stops serving a segment created by AddSegment and deletes
+// it. It must be called in the network namespace of dnsmasq.
+func (dm *Dnsmasq) RemoveSegment(seg *Segment) error {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	for i, s := range dm.Segments {
+		if s == seg {
+			dm.Segments = append(dm.Segments[:i], dm.Segments[i+1:]...)
+			break
+		}
+	}
+	if err := os.Remove(dm.hostsPath(seg)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := dm.reload(); err != nil {
+		return err
+	}
+	return removeSegment(seg)
+}
+
+// Segment returns the segment served on the named interface.
+func (dm *Dnsmasq) Segment(name string) (*Segment, error) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	for _, seg := range dm.Segments {
+		if seg.Name == name {
+			return seg, nil
+		}
+	}
+	return nil, fmt.Errorf("no segment %s", name)
+}
+
+// VLANSegments returns the segments carried on TrunkBridge.
+func (dm *Dnsmasq) VLANSegments() []*Segment {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	var segs []*Segment
+	for _, seg := range dm.Segments {
+		if seg.Options.VLAN != 0 {
+			segs = append(segs, seg)
+		}
+	}
+	return segs
 }
 
 func (dm *Dnsmasq) GetInterface(bridge string) (in *Interface) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
 	for _, seg := range dm.Segments {
-		if bridge == seg.BridgeName {
+		if bridge == seg.Name {
 			if seg.nextIf >= len(seg.Interfaces) {
 				panic("Not enough interfaces!")
 			}
@@ -505,9 +839,11 @@ func (dm *Dnsmasq) Destroy() {
 		plog.Errorf("Error killing dnsmasq: %v", err)
 	}
 
-	for _, seg := range dm.Segments {
-		if err := seg.Listener.Close(); err != nil {
-			plog.Errorf("unable to close segment listener: %v", err)
-		}
+	if err := dm.Listener.Close(); err != nil {
+		plog.Errorf("unable to close segment listener: %v", err)
+	}
+
+	if err := os.RemoveAll(dm.hostsDir); err != nil {
+		plog.Errorf("unable to remove dnsmasq hosts: %v", err)
 	}
 }
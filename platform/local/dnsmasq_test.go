@@ -17,8 +17,10 @@
 package local
 
 import (
+	"bytes"
 	"net"
 	"testing"
+	"text/template"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -61,3 +63,70 @@ func TestGenerateVethPair(t *testing.T) {
 		assert.ErrorIs(t, err, ErrIncorrectSeed)
 	})
 }
+
+func TestNewInterface(t *testing.T) {
+	in := newInterface(3, 258, SegmentOptions{IPv4: true, IPv6: true})
+	assert.Equal(t, "02:03:00:00:01:02", in.HardwareAddr.String())
+	assert.Equal(t, "10.3.1.2", in.IP().String())
+	require.Len(t, in.DHCPv6, 1)
+	assert.Equal(t, "fd03::102", in.DHCPv6[0].IP.String())
+
+	in = newInterface(4, 2, SegmentOptions{IPv6: true})
+	assert.Empty(t, in.DHCPv4)
+	assert.Equal(t, "fd04::2", in.IP().String())
+}
+
+func TestSegmentName(t *testing.T) {
+	assert.Equal(t, "br2", segmentName(2, SegmentOptions{IPv4: true}))
+	assert.Equal(t, "trunk.10", segmentName(2, SegmentOptions{IPv4: true, VLAN: 10}))
+}
+
+func newTestSegment(s byte, name string, opts SegmentOptions) *Segment {
+	return &Segment{
+		Name:       name,
+		BridgeIf:   newInterface(s, 1, opts),
+		Interfaces: []*Interface{newInterface(s, 2, opts)},
+		Options:    opts,
+		index:      s,
+	}
+}
+
+func TestConfigTemplate(t *testing.T) {
+	dm := &Dnsmasq{
+		Segments: []*Segment{
+			newTestSegment(0, "br0", SegmentOptions{IPv4: true, IPv6: true}),
+		},
+		hostsDir: "/tmp/mantle-dnsmasq",
+	}
+
+	var buf bytes.Buffer
+	tmpl := template.Must(template.New("dnsmasq").Parse(commonConfig))
+	require.NoError(t, tmpl.Execute(&buf, newConfigData(dm)))
+	cfg := buf.String()
+
+	for _, line := range []string{
+		"domain=br0.local",
+		"dhcp-range=10.0.0.1,static",
+		"dhcp-range=fd00::1,ra-names,slaac",
+		"dhcp-host=02:00:00:00:00:02,10.0.0.2,fd00::2",
+		"dhcp-range=10.1.0.1,static",
+		"dhcp-range=10.1.255.1,10.1.255.254,1h",
+		"dhcp-range=fd01::1,static,64",
+		"dhcp-range=fd01::ff:1,fd01::ff:ffff,64,1h",
+		"dhcp-range=10.255.255.1,10.255.255.254,1h",
+		"dhcp-hostsdir=/tmp/mantle-dnsmasq",
+	} {
+		assert.Contains(t, cfg, line+"\n")
+	}
+	// br0 has no dynamic ranges
+	assert.NotContains(t, cfg, "10.0.255.")
+	assert.NotContains(t, cfg, "fd00::ff:")
+	assert.NotContains(t, cfg, "enable-tftp")
+}
+
+func TestHostsEntries(t *testing.T) {
+	assert.Equal(t, "02:01:00:00:00:02,[fd01::2]\n",
+		string(hostsEntries(newTestSegment(1, "br1", SegmentOptions{IPv6: true}))))
+	assert.Equal(t, "02:02:00:00:00:02,10.2.0.2,[fd02::2]\n",
+		string(hostsEntries(newTestSegment(2, "trunk.10", SegmentOptions{IPv4: true, IPv6: true, VLAN: 10}))))
+}
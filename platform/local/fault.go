@@ -0,0 +1,198 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault describes degraded network conditions, emulated with tc netem.
+type Fault struct {
+	// Delay is added to every packet, varied by up to Jitter.
+	Delay  time.Duration
+	Jitter time.Duration
+	// Loss is the percentage of dropped packets.
+	Loss float64
+	// Rate limits the bandwidth in bits per second, 0 is unlimited.
+	Rate uint64
+	// Partition drops all packets.
+	Partition bool
+}
+
+// maxFaults is how many faults a machine can have at a time.
+const maxFaults = 1000
+
+// netemArgs returns the tc arguments configuring netem for f.
+func netemArgs(f Fault) []string {
+	args := []string{"netem"}
+	if f.Delay != 0 {
+		args = append(args, "delay", fmt.Sprintf("%dus", f.Delay.Microseconds()))
+		if f.Jitter != 0 {
+			args = append(args, fmt.Sprintf("%dus", f.Jitter.Microseconds()))
+		}
+	}
+	loss := f.Loss
+	if f.Partition {
+		loss = 100
+	}
+	if loss != 0 {
+		args = append(args, "loss", strconv.FormatFloat(loss, 'f', -1, 64)+"%")
+	}
+	return args
+}
+
+// faultCommands returns the tc invocations adding f as class number class
+// to the egress of tap, i.e. to the traffic the machine behind tap
+// receives, for packets sent by peers. No peers match all IP packets, with
+// filters matched after those of faults with peers and before those of
+// earlier faults without peers. Class 1 is the unrestricted default class
+// set up with the first fault, which also keeps SSH connections to the
+// machine and IPv6 neighbor discovery out of the faults so that tests
+// retain control over it. ARP is never matched. Classes range from 2 to
+// maxFaults+1.
+func faultCommands(tap string, class int, peers []net.IP, f Fault) [][]string {
+	var cmds [][]string
+	if class == 2 {
+		cmds = append(cmds,
+			[]string{"qdisc", "replace", "dev", tap, "root", "handle", "1:", "htb", "default", "1"},
+			[]string{"class", "add", "dev", tap, "parent", "1:", "classid", "1:1", "htb", "rate", "100gbit"},
+			[]string{"filter", "add", "dev", tap, "parent", "1:", "protocol", "ip", "prio", "1", "u32", "match", "ip", "dport", "22", "0xffff", "flowid", "1:1"},
+			[]string{"filter", "add", "dev", tap, "parent", "1:", "protocol", "ipv6", "prio", "2", "u32", "match", "ip6", "dport", "22", "0xffff", "flowid", "1:1"})
+		// router and neighbor solicitations and advertisements, with
+		// the ICMPv6 type right after the fixed header
+		for _, typ := range []string{"133", "134", "135", "136"} {
+			cmds = append(cmds, []string{"filter", "add", "dev", tap, "parent", "1:", "protocol", "ipv6", "prio", "2", "u32", "match", "ip6", "protocol", "58", "0xff", "match", "u8", typ, "0xff", "at", "40", "flowid", "1:1"})
+		}
+	}
+
+	classid := fmt.Sprintf("1:%d", class)
+	rate := "100gbit"
+	if f.Rate != 0 {
+		rate = fmt.Sprintf("%dbit", f.Rate)
+	}
+	cmds = append(cmds,
+		[]string{"class", "add", "dev", tap, "parent", "1:", "classid", classid, "htb", "rate", rate},
+		append([]string{"qdisc", "add", "dev", tap, "parent", classid, "handle", fmt.Sprintf("%d:", class)}, netemArgs(f)...))
+
+	if len(peers) == 0 {
+		// only one matchall filter fits each priority
+		prio := 5 + 2*(maxFaults+1-class)
+		cmds = append(cmds,
+			[]string{"filter", "add", "dev", tap, "parent", "1:", "protocol", "ip", "prio", strconv.Itoa(prio), "matchall", "flowid", classid},
+			[]string{"filter", "add", "dev", tap, "parent", "1:", "protocol", "ipv6", "prio", strconv.Itoa(prio + 1), "matchall", "flowid", classid})
+	}
+	for _, peer := range peers {
+		if peer.To4() != nil {
+			cmds = append(cmds, []string{"filter", "add", "dev", tap, "parent", "1:", "protocol", "ip", "prio", "3", "u32", "match", "ip", "src", peer.String() + "/32", "flowid", classid})
+		} else {
+			cmds = append(cmds, []string{"filter", "add", "dev", tap, "parent", "1:", "protocol", "ipv6", "prio", "4", "u32", "match", "ip6", "src", peer.String() + "/128", "flowid", classid})
+		}
+	}
+	return cmds
+}
+
+// ServicesIP returns the address machines reach the flight services on,
+// such as etcd, Omaha, NTP and the content server.
+func (lc *LocalCluster) ServicesIP() string {
+	return lc.hostIP()
+}
+
+func (lc *LocalCluster) tc(args ...string) error {
+	out, err := lc.NewCommand("tc", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("tc %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return nil
+}
+
+// AddFault degrades the traffic the machine with the address ip receives
+// from peers, which are machine addresses or ServicesIP. Empty peers
+// degrade all traffic not matched by a fault with peers, taking over from
+// earlier faults without peers. SSH connections to the machine are never
+// degraded.
+// Faults only act on the receiving side, so partitioning two machines
+// takes a fault on each; traffic toward the flight services cannot be
+// degraded, but faults on their replies stall connections the same way.
+func (lc *LocalCluster) AddFault(ip string, peers []string, f Fault) error {
+	var peerIPs []net.IP
+	for _, peer := range peers {
+		peerIP := net.ParseIP(peer)
+		if peerIP == nil {
+			return fmt.Errorf("invalid peer address %q", peer)
+		}
+		peerIPs = append(peerIPs, peerIP)
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	tap, ok := lc.taps[ip]
+	if !ok {
+		return fmt.Errorf("no machine with address %s", ip)
+	}
+	if lc.faults == nil {
+		lc.faults = make(map[string]int)
+	}
+	if lc.faults[tap] == maxFaults {
+		return fmt.Errorf("too many faults for %s", ip)
+	}
+
+	for _, args := range faultCommands(tap, lc.faults[tap]+2, peerIPs, f) {
+		if err := lc.tc(args...); err != nil {
+			return err
+		}
+	}
+	lc.faults[tap]++
+	return nil
+}
+
+// ClearFaults lifts all faults added for the machine with the address ip.
+func (lc *LocalCluster) ClearFaults(ip string) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	tap, ok := lc.taps[ip]
+	if !ok {
+		return fmt.Errorf("no machine with address %s", ip)
+	}
+	if lc.faults[tap] == 0 {
+		return nil
+	}
+	if err := lc.tc("qdisc", "del", "dev", tap, "root"); err != nil {
+		return err
+	}
+	delete(lc.faults, tap)
+	return nil
+}
+
+// Partition cuts the traffic between the machines with the addresses in a
+// and those in b.
+func (lc *LocalCluster) Partition(a, b []string) error {
+	for _, ip := range a {
+		if err := lc.AddFault(ip, b, Fault{Partition: true}); err != nil {
+			return err
+		}
+	}
+	for _, ip := range b {
+		if err := lc.AddFault(ip, a, Fault{Partition: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
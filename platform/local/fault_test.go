@@ -0,0 +1,93 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetemArgs(t *testing.T) {
+	assert.Equal(t, []string{"netem"}, netemArgs(Fault{}))
+	assert.Equal(t, []string{"netem", "delay", "100000us", "20000us", "loss", "2.5%"},
+		netemArgs(Fault{Delay: 100 * time.Millisecond, Jitter: 20 * time.Millisecond, Loss: 2.5}))
+	assert.Equal(t, []string{"netem", "loss", "100%"},
+		netemArgs(Fault{Loss: 10, Partition: true}))
+}
+
+func TestFaultCommands(t *testing.T) {
+	join := func(cmds [][]string) []string {
+		var lines []string
+		for _, cmd := range cmds {
+			lines = append(lines, strings.Join(cmd, " "))
+		}
+		return lines
+	}
+
+	cmds := faultCommands("tap0", 2, []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("fd00::2")}, Fault{Rate: 1000000, Partition: true})
+	assert.Equal(t, []string{
+		"qdisc replace dev tap0 root handle 1: htb default 1",
+		"class add dev tap0 parent 1: classid 1:1 htb rate 100gbit",
+		"filter add dev tap0 parent 1: protocol ip prio 1 u32 match ip dport 22 0xffff flowid 1:1",
+		"filter add dev tap0 parent 1: protocol ipv6 prio 2 u32 match ip6 dport 22 0xffff flowid 1:1",
+		"filter add dev tap0 parent 1: protocol ipv6 prio 2 u32 match ip6 protocol 58 0xff match u8 133 0xff at 40 flowid 1:1",
+		"filter add dev tap0 parent 1: protocol ipv6 prio 2 u32 match ip6 protocol 58 0xff match u8 134 0xff at 40 flowid 1:1",
+		"filter add dev tap0 parent 1: protocol ipv6 prio 2 u32 match ip6 protocol 58 0xff match u8 135 0xff at 40 flowid 1:1",
+		"filter add dev tap0 parent 1: protocol ipv6 prio 2 u32 match ip6 protocol 58 0xff match u8 136 0xff at 40 flowid 1:1",
+		"class add dev tap0 parent 1: classid 1:2 htb rate 1000000bit",
+		"qdisc add dev tap0 parent 1:2 handle 2: netem loss 100%",
+		"filter add dev tap0 parent 1: protocol ip prio 3 u32 match ip src 10.0.0.2/32 flowid 1:2",
+		"filter add dev tap0 parent 1: protocol ipv6 prio 4 u32 match ip6 src fd00::2/128 flowid 1:2",
+	}, join(cmds))
+
+	cmds = faultCommands("tap0", 3, nil, Fault{Delay: time.Millisecond})
+	assert.Equal(t, []string{
+		"class add dev tap0 parent 1: classid 1:3 htb rate 100gbit",
+		"qdisc add dev tap0 parent 1:3 handle 3: netem delay 1000us",
+		"filter add dev tap0 parent 1: protocol ip prio 2001 matchall flowid 1:3",
+		"filter add dev tap0 parent 1: protocol ipv6 prio 2002 matchall flowid 1:3",
+	}, join(cmds))
+
+	// a second fault without peers is matched before the first one
+	cmds = faultCommands("tap0", 4, nil, Fault{Loss: 50})
+	assert.Equal(t, []string{
+		"class add dev tap0 parent 1: classid 1:4 htb rate 100gbit",
+		"qdisc add dev tap0 parent 1:4 handle 4: netem loss 50%",
+		"filter add dev tap0 parent 1: protocol ip prio 1999 matchall flowid 1:4",
+		"filter add dev tap0 parent 1: protocol ipv6 prio 2000 matchall flowid 1:4",
+	}, join(cmds))
+
+	// the last fault still comes after those with peers
+	cmds = faultCommands("tap0", maxFaults+1, nil, Fault{Loss: 50})
+	assert.Contains(t, join(cmds), fmt.Sprintf("filter add dev tap0 parent 1: protocol ip prio 5 matchall flowid 1:%d", maxFaults+1))
+}
+
+func TestReleaseNICs(t *testing.T) {
+	nic := &NIC{Segment: "br0", Interface: newInterface(0, 2, SegmentOptions{IPv4: true})}
+	trunk := &NIC{Segment: TrunkBridge, Interface: &Interface{HardwareAddr: nic.Interface.HardwareAddr}}
+	lc := &LocalCluster{
+		taps:   map[string]string{"10.0.0.2": "tap0", "10.0.0.3": "tap1"},
+		faults: map[string]int{"tap0": 1, "tap1": 2},
+	}
+	lc.ReleaseNICs([]*NIC{nic, trunk})
+	assert.Equal(t, map[string]string{"10.0.0.3": "tap1"}, lc.taps)
+	assert.Equal(t, map[string]int{"tap1": 2}, lc.faults)
+	assert.Error(t, lc.AddFault("10.0.0.2", nil, Fault{Partition: true}))
+}
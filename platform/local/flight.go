@@ -17,6 +17,7 @@ package local
 
 import (
 	"fmt"
+	"net"
 	"sync/atomic"
 
 	"github.com/coreos/go-omaha/omaha"
@@ -37,6 +38,8 @@ type LocalFlight struct {
 	destructor.MultiDestructor
 	*platform.BaseFlight
 	Dnsmasq    *Dnsmasq
+	PXEServer  *PXEServer
+	Registry   *Registry
 	SimpleEtcd *SimpleEtcd
 	NTPServer  *ntp.Server
 	nshandle   netns.NsHandle
@@ -64,7 +67,8 @@ func NewLocalFlight(opts *platform.Options, platformName platform.Name) (*LocalF
 	lf.AddDestructor(lf.BaseFlight)
 	lf.AddCloser(&lf.nshandle)
 
-	// dnsmasq and etcd must be launched in the new namespace
+	// dnsmasq, etcd, the PXE server and the registry must be launched in
+	// the new namespace
 	nsExit, err := ns.Enter(lf.nshandle)
 	if err != nil {
 		lf.Destroy()
@@ -72,13 +76,27 @@ func NewLocalFlight(opts *platform.Options, platformName platform.Name) (*LocalF
 	}
 	defer nsExit()
 
-	lf.Dnsmasq, err = NewDnsmasq()
+	lf.PXEServer, err = NewPXEServer(lf.newListenPort())
+	if err != nil {
+		lf.Destroy()
+		return nil, fmt.Errorf("creating new PXE server failed: %v", err)
+	}
+	lf.AddDestructor(lf.PXEServer)
+
+	lf.Dnsmasq, err = NewDnsmasq(lf.PXEServer.Dir)
 	if err != nil {
 		lf.Destroy()
 		return nil, fmt.Errorf("creating new dnsmasq failed: %v", err)
 	}
 	lf.AddDestructor(lf.Dnsmasq)
 
+	lf.Registry, err = NewRegistry(lf.newListenPort())
+	if err != nil {
+		lf.Destroy()
+		return nil, fmt.Errorf("creating new registry failed: %v", err)
+	}
+	lf.AddDestructor(lf.Registry)
+
 	lf.SimpleEtcd, err = NewSimpleEtcd()
 	if err != nil {
 		lf.Destroy()
@@ -110,7 +128,7 @@ func (lf *LocalFlight) NewCluster(rconf *platform.RuntimeConfig) (*LocalCluster,
 	}
 	lc.AddDestructor(lc.BaseCluster)
 
-	// Omaha server must be launched in the new namespace
+	// Omaha and content servers must be launched in the new namespace
 	nsExit, err := ns.Enter(lf.nshandle)
 	if err != nil {
 		lc.Destroy()
@@ -127,6 +145,13 @@ func (lf *LocalFlight) NewCluster(rconf *platform.RuntimeConfig) (*LocalCluster,
 	lc.AddDestructor(lc.OmahaServer)
 	go lc.OmahaServer.Serve()
 
+	lc.ContentServer, err = NewContentServer(net.ParseIP(lc.hostIP()), lf.newListenPort(), lf.newListenPort(), lf.PXEServer.Dir, "content-"+lc.Name())
+	if err != nil {
+		lc.Destroy()
+		return nil, fmt.Errorf("creating new content server failed: %v", err)
+	}
+	lc.AddDestructor(lc.ContentServer)
+
 	// does not lf.AddCluster() since we are not the top-level object
 
 	return lc, nil
@@ -0,0 +1,114 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bootScript is handed out over TFTP to iPXE clients. It chains to the
+// script of the booting machine on the HTTP server, so that everything
+// else is transferred over HTTP.
+const bootScript = `#!ipxe
+chain http://${next-server}:%d/${mac:hexhyp}.ipxe
+`
+
+// PXEServer serves network boot files to the machines of a flight. Its
+// directory is the TFTP root of dnsmasq and is also served over HTTP.
+type PXEServer struct {
+	Dir      string
+	listener net.Listener
+	server   *http.Server
+}
+
+// NewPXEServer creates the boot directory and starts serving it over HTTP
+// on port in the current network namespace.
+func NewPXEServer(port int) (*PXEServer, error) {
+	dir, err := ioutil.TempDir("", "mantle-pxe")
+	if err != nil {
+		return nil, err
+	}
+	// dnsmasq drops its privileges before serving TFTP
+	if err := os.Chmod(dir, 0755); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	ps := &PXEServer{
+		Dir:      dir,
+		listener: listener,
+		server:   &http.Server{Handler: http.FileServer(http.Dir(dir))},
+	}
+	if err := ps.WriteFile("boot.ipxe", []byte(fmt.Sprintf(bootScript, ps.Port()))); err != nil {
+		ps.Destroy()
+		return nil, err
+	}
+	go ps.server.Serve(listener)
+
+	return ps, nil
+}
+
+// Port returns the HTTP port of the server.
+func (ps *PXEServer) Port() int {
+	return ps.listener.Addr().(*net.TCPAddr).Port
+}
+
+// AddFile makes the file at path available as name.
+func (ps *PXEServer) AddFile(name, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	return os.Symlink(path, filepath.Join(ps.Dir, name))
+}
+
+// WriteFile makes data available as name.
+func (ps *PXEServer) WriteFile(name string, data []byte) error {
+	return ioutil.WriteFile(filepath.Join(ps.Dir, name), data, 0644)
+}
+
+// SetBootScript sets the iPXE script run by the machine with the hardware
+// address mac.
+func (ps *PXEServer) SetBootScript(mac net.HardwareAddr, script string) error {
+	return ps.WriteFile(bootScriptName(mac), []byte(script))
+}
+
+func bootScriptName(mac net.HardwareAddr) string {
+	return strings.Replace(mac.String(), ":", "-", -1) + ".ipxe"
+}
+
+func (ps *PXEServer) Destroy() {
+	if err := ps.server.Close(); err != nil {
+		plog.Errorf("Error stopping PXE server: %v", err)
+	}
+	if err := os.RemoveAll(ps.Dir); err != nil {
+		plog.Errorf("Error removing PXE directory: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPXEServer(t *testing.T) {
+	ps, err := NewPXEServer(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Destroy()
+
+	get := func(name string) string {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/%s", ps.Port(), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: %s", name, resp.Status)
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// boot.ipxe must be readable from the TFTP root and point at the
+	// HTTP server
+	data, err := ioutil.ReadFile(filepath.Join(ps.Dir, "boot.ipxe"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), fmt.Sprintf(":%d/${mac:hexhyp}.ipxe", ps.Port())) {
+		t.Errorf("unexpected boot.ipxe:\n%s", data)
+	}
+
+	mac, _ := net.ParseMAC("02:00:00:00:00:02")
+	if err := ps.SetBootScript(mac, "#!ipxe\nboot\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("02-00-00-00-00-02.ipxe"); got != "#!ipxe\nboot\n" {
+		t.Errorf("unexpected boot script %q", got)
+	}
+
+	kernel := filepath.Join(t.TempDir(), "vmlinuz")
+	if err := ioutil.WriteFile(kernel, []byte("kernel"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.AddFile("flatcar_production_pxe.vmlinuz", kernel); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("flatcar_production_pxe.vmlinuz"); got != "kernel" {
+		t.Errorf("unexpected kernel %q", got)
+	}
+
+	if err := ps.AddFile("missing", filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
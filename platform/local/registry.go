@@ -0,0 +1,676 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	mediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerList   = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerV2     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerConfig = "application/vnd.docker.container.image.v1+json"
+	mediaTypeDockerLayer  = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+
+	// annotations naming images in OCI layouts
+	annotationImageName = "io.containerd.image.name"
+	annotationRefName   = "org.opencontainers.image.ref.name"
+)
+
+// descriptor references a blob in OCI indexes and manifests.
+type descriptor struct {
+	MediaType   string            `json:"mediaType,omitempty"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// manifest covers the fields of image indexes and manifests, OCI or
+// Docker, needed to find the blobs they reference.
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        *descriptor  `json:"config,omitempty"`
+	Layers        []descriptor `json:"layers,omitempty"`
+	Manifests     []descriptor `json:"manifests,omitempty"`
+}
+
+// dockerArchiveImage is an entry of manifest.json in `docker save` archives.
+type dockerArchiveImage struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// Registry is a read-only OCI distribution registry serving images
+// imported from OCI layouts and `docker save` archives, so that machines
+// can pull container images without network access.
+type Registry struct {
+	Dir      string
+	listener net.Listener
+	server   *http.Server
+
+	mu         sync.RWMutex
+	tags       map[string]map[string]string // repository to tag to manifest digest
+	mediaTypes map[string]string            // manifest digest to media type
+}
+
+// NewRegistry starts serving an empty registry on port in the current
+// network namespace.
+func NewRegistry(port int) (*Registry, error) {
+	dir, err := ioutil.TempDir("", "mantle-registry")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	r := &Registry{
+		Dir:        dir,
+		listener:   listener,
+		tags:       make(map[string]map[string]string),
+		mediaTypes: make(map[string]string),
+	}
+	r.server = &http.Server{Handler: r}
+	go r.server.Serve(listener)
+
+	return r, nil
+}
+
+// Port returns the HTTP port of the registry.
+func (r *Registry) Port() int {
+	return r.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Repositories returns the fully qualified names of the served
+// repositories, e.g. docker.io/library/busybox.
+func (r *Registry) Repositories() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var repos []string
+	for repo := range r.tags {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	return repos
+}
+
+// Hosts returns the registries the served repositories belong to.
+func (r *Registry) Hosts() []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, repo := range r.Repositories() {
+		host := strings.SplitN(repo, "/", 2)[0]
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// Import adds the images at path, which is an OCI layout, an extracted
+// `docker save` archive, an image tarball of either kind, or an image
+// cache directory containing any of them.
+func (r *Registry) Import(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return r.importArchive(path)
+	}
+
+	if ok, err := r.importImageDir(path); ok || err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case entry.IsDir():
+			if ok, err := r.importImageDir(filepath.Join(path, name)); err != nil {
+				return err
+			} else if !ok {
+				plog.Debugf("Skipping %s in image cache: no image", name)
+			}
+		case strings.HasSuffix(name, ".tar"), strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+			if err := r.importArchive(filepath.Join(path, name)); err != nil {
+				return err
+			}
+		default:
+			plog.Debugf("Skipping %s in image cache: no image tarball", name)
+		}
+	}
+	return nil
+}
+
+// importImageDir imports dir if it holds an OCI layout or an extracted
+// `docker save` archive.
+func (r *Registry) importImageDir(dir string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		return true, r.importLayout(dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err == nil {
+		return true, r.importDockerArchive(dir)
+	}
+	return false, nil
+}
+
+func (r *Registry) importArchive(path string) error {
+	dir, err := ioutil.TempDir("", "mantle-registry-import")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := extractTar(path, dir); err != nil {
+		return fmt.Errorf("extracting %s: %v", path, err)
+	}
+	if ok, err := r.importImageDir(dir); err != nil {
+		return fmt.Errorf("importing %s: %v", path, err)
+	} else if !ok {
+		return fmt.Errorf("%s is neither an OCI layout nor a docker archive", path)
+	}
+	return nil
+}
+
+// extractTar extracts the regular files and directories of the optionally
+// gzipped tarball at path into dir.
+func extractTar(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var in io.Reader = bufio.NewReader(f)
+	if magic, err := in.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		in = zr
+	}
+
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.Clean("/"+hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.Create(target)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (r *Registry) blobPath(digest string) (string, error) {
+	hash := strings.TrimPrefix(digest, "sha256:")
+	if hash == digest || len(hash) != 2*sha256.Size {
+		return "", fmt.Errorf("unsupported digest %q", digest)
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return filepath.Join(r.Dir, "blobs", "sha256", hash), nil
+}
+
+// addBlob stores the content of in, optionally compressing it, and returns
+// its digest and size.
+func (r *Registry) addBlob(in io.Reader, compress bool) (string, int64, error) {
+	tmp, err := ioutil.TempFile(filepath.Join(r.Dir, "blobs"), "upload")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	counter := &countWriter{}
+	out := io.MultiWriter(tmp, hash, counter)
+	if compress {
+		zw := gzip.NewWriter(out)
+		if _, err := io.Copy(zw, in); err != nil {
+			return "", 0, err
+		}
+		if err := zw.Close(); err != nil {
+			return "", 0, err
+		}
+	} else if _, err := io.Copy(out, in); err != nil {
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	digest := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	path, err := r.blobPath(digest)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+	return digest, counter.n, nil
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// addFile stores the file at path and checks that its digest matches.
+func (r *Registry) addFile(path, digest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	got, _, err := r.addBlob(f, false)
+	if err != nil {
+		return err
+	}
+	if got != digest {
+		return fmt.Errorf("blob %s has digest %s", digest, got)
+	}
+	return nil
+}
+
+// copyLayoutBlobs stores the blob desc of the OCI layout in dir and,
+// for indexes and manifests, all blobs they reference.
+func (r *Registry) copyLayoutBlobs(dir string, desc descriptor) error {
+	hash := strings.TrimPrefix(desc.Digest, "sha256:")
+	path := filepath.Join(dir, "blobs", "sha256", filepath.Base(hash))
+	if err := r.addFile(path, desc.Digest); err != nil {
+		return err
+	}
+
+	switch desc.MediaType {
+	case mediaTypeOCIIndex, mediaTypeDockerList, mediaTypeOCIManifest, mediaTypeDockerV2:
+	default:
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("parsing manifest %s: %v", desc.Digest, err)
+	}
+	r.mu.Lock()
+	r.mediaTypes[desc.Digest] = desc.MediaType
+	r.mu.Unlock()
+
+	children := append([]descriptor{}, m.Manifests...)
+	if m.Config != nil {
+		children = append(children, *m.Config)
+	}
+	children = append(children, m.Layers...)
+	for _, child := range children {
+		if err := r.copyLayoutBlobs(dir, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importLayout imports the images of the OCI layout in dir, named by their
+// io.containerd.image.name or org.opencontainers.image.ref.name
+// annotations.
+func (r *Registry) importLayout(dir string) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return err
+	}
+	var index manifest
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("parsing index.json: %v", err)
+	}
+
+	for _, desc := range index.Manifests {
+		name := desc.Annotations[annotationImageName]
+		if name == "" {
+			name = desc.Annotations[annotationRefName]
+		}
+		if name == "" {
+			plog.Debugf("Skipping unnamed image %s in %s", desc.Digest, dir)
+			continue
+		}
+		repo, tag, err := ParseImageReference(name)
+		if err != nil {
+			return err
+		}
+		if err := r.copyLayoutBlobs(dir, desc); err != nil {
+			return fmt.Errorf("importing %s: %v", name, err)
+		}
+		r.tag(repo, tag, desc.Digest)
+	}
+	return nil
+}
+
+// importDockerArchive imports the images of the extracted `docker save`
+// archive in dir, converting them to schema 2 manifests.
+func (r *Registry) importDockerArchive(dir string) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+	var images []dockerArchiveImage
+	if err := json.Unmarshal(data, &images); err != nil {
+		return fmt.Errorf("parsing manifest.json: %v", err)
+	}
+
+	for _, image := range images {
+		m := manifest{
+			SchemaVersion: 2,
+			MediaType:     mediaTypeDockerV2,
+		}
+
+		f, err := os.Open(filepath.Join(dir, filepath.Clean("/"+image.Config)))
+		if err != nil {
+			return err
+		}
+		digest, size, err := r.addBlob(f, false)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		m.Config = &descriptor{MediaType: mediaTypeDockerConfig, Digest: digest, Size: size}
+
+		for _, layer := range image.Layers {
+			f, err := os.Open(filepath.Join(dir, filepath.Clean("/"+layer)))
+			if err != nil {
+				return err
+			}
+			digest, size, err := r.addBlob(f, true)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			m.Layers = append(m.Layers, descriptor{MediaType: mediaTypeDockerLayer, Digest: digest, Size: size})
+		}
+
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		digest, _, err = r.addBlob(strings.NewReader(string(data)), false)
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.mediaTypes[digest] = mediaTypeDockerV2
+		r.mu.Unlock()
+
+		for _, name := range image.RepoTags {
+			repo, tag, err := ParseImageReference(name)
+			if err != nil {
+				return err
+			}
+			r.tag(repo, tag, digest)
+		}
+	}
+	return nil
+}
+
+func (r *Registry) tag(repo, tag, digest string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tags[repo] == nil {
+		r.tags[repo] = make(map[string]string)
+	}
+	r.tags[repo][tag] = digest
+	plog.Debugf("Registry serves %s:%s as %s", repo, tag, digest)
+}
+
+// ParseImageReference splits an image reference like busybox or
+// quay.io/coreos/etcd:v3.3 into its fully qualified repository and tag,
+// following the Docker conventions for the default registry.
+func ParseImageReference(ref string) (string, string, error) {
+	if ref == "" || strings.Contains(ref, "@") {
+		return "", "", fmt.Errorf("unsupported image reference %q", ref)
+	}
+	repo, tag := ref, "latest"
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		repo, tag = ref[:i], ref[i+1:]
+	}
+
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) == 1 || !(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		repo = "docker.io/" + repo
+		parts = strings.SplitN(repo, "/", 2)
+	}
+	if parts[0] == "docker.io" && !strings.Contains(parts[1], "/") {
+		repo = "docker.io/library/" + parts[1]
+	}
+	if tag == "" {
+		return "", "", fmt.Errorf("empty tag in image reference %q", ref)
+	}
+	return repo, tag, nil
+}
+
+// lookup resolves the repository name requested by a client. Clients using
+// the registry as a docker.io mirror omit the registry host.
+func (r *Registry) lookup(name string) (map[string]string, bool) {
+	if tags, ok := r.tags[name]; ok {
+		return tags, true
+	}
+	tags, ok := r.tags["docker.io/"+name]
+	return tags, ok
+}
+
+// ServeHTTP implements the pull side of the OCI distribution API.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "registry is read-only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if path == req.URL.Path {
+		http.NotFound(w, req)
+		return
+	}
+	if path == "" {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "{}")
+		return
+	}
+
+	var name, kind, ref string
+	for _, k := range []string{"/manifests/", "/blobs/", "/tags/"} {
+		if i := strings.LastIndex(path, k); i > 0 {
+			name, kind, ref = path[:i], strings.Trim(k, "/"), path[i+len(k):]
+			break
+		}
+	}
+
+	r.mu.RLock()
+	tags, ok := r.lookup(name)
+	var digest, mediaType string
+	switch {
+	case !ok:
+	case kind == "manifests" && strings.HasPrefix(ref, "sha256:"):
+		digest = ref
+		mediaType, ok = r.mediaTypes[ref]
+	case kind == "manifests":
+		digest, ok = tags[ref]
+		mediaType = r.mediaTypes[digest]
+	case kind == "blobs":
+		digest = ref
+	case kind == "tags" && ref == "list":
+		var list []string
+		for tag := range tags {
+			list = append(list, tag)
+		}
+		sort.Strings(list)
+		r.mu.RUnlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": name, "tags": list})
+		return
+	default:
+		ok = false
+	}
+	r.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	blob, err := r.blobPath(digest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, err := os.Open(blob)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	w.Header().Set("Docker-Content-Digest", digest)
+	if req.Method == http.MethodGet {
+		io.Copy(w, f)
+	}
+}
+
+func (r *Registry) Destroy() {
+	if err := r.server.Close(); err != nil {
+		plog.Errorf("Error stopping registry: %v", err)
+	}
+	if err := os.RemoveAll(r.Dir); err != nil {
+		plog.Errorf("Error removing registry directory: %v", err)
+	}
+}
+
+// MirrorFiles returns the configuration files, by path, making docker,
+// podman, CRI-O and containerd pull the images of the served registries
+// from the registry reachable at addr. The upstream registries remain as
+// a fallback for images not in the registry.
+func (r *Registry) MirrorFiles(addr string) map[string]string {
+	hosts := r.Hosts()
+	if len(hosts) == 0 {
+		return nil
+	}
+	files := make(map[string]string)
+
+	var registries strings.Builder
+	for _, host := range hosts {
+		fmt.Fprintf(&registries, `[[registry]]
+prefix = "%s"
+location = "%s"
+
+[[registry.mirror]]
+location = "%s/%s"
+insecure = true
+
+`, host, host, addr, host)
+
+		server := "https://" + host
+		if host == "docker.io" {
+			server = "https://registry-1.docker.io"
+		}
+		files["/etc/containerd/certs.d/"+host+"/hosts.toml"] = fmt.Sprintf(`server = "%s"
+
+[host."http://%s/v2/%s"]
+  capabilities = ["pull", "resolve"]
+  override_path = true
+`, server, addr, host)
+
+		// docker only mirrors Docker Hub. The options go on the
+		// command line rather than into daemon.json, which tests
+		// write themselves, and the drop-in sorts first so that
+		// DOCKER_OPTS set by tests take precedence.
+		if host == "docker.io" {
+			files["/etc/systemd/system/docker.service.d/10-kola-mirror.conf"] = fmt.Sprintf(`[Service]
+Environment="DOCKER_OPTS=--registry-mirror=http://%s --insecure-registry=%s"
+`, addr, addr)
+		}
+	}
+	files["/etc/containers/registries.conf.d/50-kola-mirror.conf"] = registries.String()
+
+	return files
+}
@@ -0,0 +1,191 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageReference(t *testing.T) {
+	for _, tt := range []struct {
+		ref, repo, tag string
+	}{
+		{"busybox", "docker.io/library/busybox", "latest"},
+		{"busybox:1.33", "docker.io/library/busybox", "1.33"},
+		{"docker.io/busybox", "docker.io/library/busybox", "latest"},
+		{"calico/node:v3.19", "docker.io/calico/node", "v3.19"},
+		{"quay.io/coreos/etcd:v3.3", "quay.io/coreos/etcd", "v3.3"},
+		{"localhost:5000/test", "localhost:5000/test", "latest"},
+	} {
+		repo, tag, err := ParseImageReference(tt.ref)
+		require.NoError(t, err, tt.ref)
+		assert.Equal(t, tt.repo, repo, tt.ref)
+		assert.Equal(t, tt.tag, tag, tt.ref)
+	}
+
+	for _, ref := range []string{"", "busybox@sha256:1234", "busybox:"} {
+		_, _, err := ParseImageReference(ref)
+		assert.Error(t, err, ref)
+	}
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	r, err := NewRegistry(0)
+	require.NoError(t, err)
+	t.Cleanup(r.Destroy)
+	return r
+}
+
+func get(t *testing.T, srv *httptest.Server, path string) (*http.Response, []byte) {
+	resp, err := http.Get(srv.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, body
+}
+
+func TestRegistryDockerArchive(t *testing.T) {
+	// a `docker save` archive with one layer
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	add := func(name string, data []byte) {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(data)
+		require.NoError(t, err)
+	}
+	config := []byte(`{"architecture":"amd64"}`)
+	add("config.json", config)
+	add("layer/layer.tar", []byte("layer contents"))
+	add("manifest.json", []byte(`[{"Config":"config.json","RepoTags":["busybox:test"],"Layers":["layer/layer.tar"]}]`))
+	require.NoError(t, tw.Close())
+
+	path := filepath.Join(t.TempDir(), "busybox.tar")
+	require.NoError(t, ioutil.WriteFile(path, archive.Bytes(), 0644))
+
+	r := newTestRegistry(t)
+	require.NoError(t, r.Import(path))
+	assert.Equal(t, []string{"docker.io/library/busybox"}, r.Repositories())
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, _ := get(t, srv, "/v2/")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// docker mirrors omit the registry host, podman mirrors include it
+	for _, name := range []string{"library/busybox", "docker.io/library/busybox"} {
+		resp, body := get(t, srv, "/v2/"+name+"/manifests/test")
+		require.Equal(t, http.StatusOK, resp.StatusCode, name)
+		assert.Equal(t, mediaTypeDockerV2, resp.Header.Get("Content-Type"))
+		assert.Equal(t, digestOf(body), resp.Header.Get("Docker-Content-Digest"))
+
+		var m manifest
+		require.NoError(t, json.Unmarshal(body, &m))
+		assert.Equal(t, digestOf(config), m.Config.Digest)
+		require.Len(t, m.Layers, 1)
+
+		resp, blob := get(t, srv, "/v2/"+name+"/blobs/"+m.Layers[0].Digest)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, m.Layers[0].Digest, digestOf(blob))
+		assert.Equal(t, m.Layers[0].Size, int64(len(blob)))
+
+		resp, _ = get(t, srv, "/v2/"+name+"/manifests/"+digestOf(body))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	resp, _ = get(t, srv, "/v2/library/busybox/manifests/missing")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get(t, srv, "/v2/library/alpine/manifests/test")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRegistryOCILayout(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache", "etcd")
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	require.NoError(t, os.MkdirAll(blobs, 0755))
+	writeBlob := func(data []byte) descriptor {
+		digest := digestOf(data)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(blobs, digest[len("sha256:"):]), data, 0644))
+		return descriptor{Digest: digest, Size: int64(len(data))}
+	}
+
+	config := writeBlob([]byte(`{}`))
+	config.MediaType = "application/vnd.oci.image.config.v1+json"
+	layer := writeBlob([]byte("layer"))
+	layer.MediaType = "application/vnd.oci.image.layer.v1.tar"
+	data, err := json.Marshal(manifest{SchemaVersion: 2, MediaType: mediaTypeOCIManifest, Config: &config, Layers: []descriptor{layer}})
+	require.NoError(t, err)
+	desc := writeBlob(data)
+	desc.MediaType = mediaTypeOCIManifest
+	desc.Annotations = map[string]string{annotationImageName: "quay.io/coreos/etcd:v3.3"}
+	data, err = json.Marshal(manifest{SchemaVersion: 2, Manifests: []descriptor{desc}})
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.json"), data, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "..", "README"), nil, 0644))
+
+	r := newTestRegistry(t)
+	require.NoError(t, r.Import(filepath.Dir(dir)))
+	assert.Equal(t, []string{"quay.io/coreos/etcd"}, r.Repositories())
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, body := get(t, srv, "/v2/quay.io/coreos/etcd/manifests/v3.3")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, mediaTypeOCIManifest, resp.Header.Get("Content-Type"))
+	assert.Equal(t, desc.Digest, digestOf(body))
+
+	resp, body = get(t, srv, "/v2/quay.io/coreos/etcd/blobs/"+layer.Digest)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "layer", string(body))
+
+	// only docker.io images are served without registry host
+	resp, _ = get(t, srv, "/v2/coreos/etcd/manifests/v3.3")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRegistryMirrorFiles(t *testing.T) {
+	r := newTestRegistry(t)
+	assert.Empty(t, r.MirrorFiles("10.0.0.1:30001"))
+
+	r.tag("docker.io/library/busybox", "latest", digestOf(nil))
+	r.tag("quay.io/coreos/etcd", "latest", digestOf(nil))
+	files := r.MirrorFiles("10.0.0.1:30001")
+
+	assert.NotContains(t, files, "/etc/docker/daemon.json")
+	assert.Contains(t, files["/etc/systemd/system/docker.service.d/10-kola-mirror.conf"], `--registry-mirror=http://10.0.0.1:30001 --insecure-registry=10.0.0.1:30001`)
+	assert.Contains(t, files["/etc/containers/registries.conf.d/50-kola-mirror.conf"], `location = "10.0.0.1:30001/quay.io"`)
+	assert.Contains(t, files["/etc/containerd/certs.d/docker.io/hosts.toml"], `server = "https://registry-1.docker.io"`)
+	assert.Contains(t, files["/etc/containerd/certs.d/quay.io/hosts.toml"], `[host."http://10.0.0.1:30001/v2/quay.io"]`)
+}
@@ -40,7 +40,7 @@ func (dc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
-	droplet, err := dc.flight.api.CreateDroplet(context.TODO(), dc.vmname(), dc.sshKeyID, conf.String())
+	droplet, err := dc.flight.api.CreateDroplet(context.TODO(), dc.vmname(), dc.flight.Name(), dc.sshKeyID, conf.String())
 	if err != nil {
 		return nil, err
 	}
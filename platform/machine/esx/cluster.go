@@ -51,38 +51,22 @@ func (ec *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		ips := <-ec.flight.ips
 		ipPairMaybe = &ips
 		plog.Debugf("Got static IP addresses %v and %v", ips.Public, ips.Private)
-		networkdConfig := fmt.Sprintf(`[Match]
-Virtualization=vmware
-Name=ens192
-
-[Network]
-DHCP=no
-DNS=1.1.1.1
-DNS=1.0.0.1
-
-[Address]
-Address=%s/%d
-
-[Address]
-Address=%s/%d
-
-[Route]
-Destination=0.0.0.0/0
-Gateway=%s
-
-[Route]
-Destination=10.0.0.0/8
-Gateway=%s
-`, ips.Public, ips.SubnetSize, ips.Private, ips.SubnetSize, ips.PublicGw, ips.PrivateGw)
 		// If no Ignition config is given, Ignition will use the default.ign which activates cloud-init
 		// and cloud-init will use the guestinfo variables to setup the static IPs
 		if conf.IsIgnition() {
-			conf.AddFile("/etc/systemd/network/00-vmware.network", "root", networkdConfig, 0644)
+			for path, unit := range esx.NetworkdConfig(&ips, ec.flight.api.SeparatePrivateNetwork()) {
+				conf.AddFile(path, "root", unit, 0644)
+			}
 		}
 	}
 
+	privateInterface := esx.PublicInterface
+	if ec.flight.api.SeparatePrivateNetwork() {
+		privateInterface = esx.PrivateInterface
+	}
+
 	// This assumes that private IPs are in the form of 10.x.x.x
-	conf.AddSystemdUnit("coreos-metadata.service", `[Unit]
+	conf.AddSystemdUnit("coreos-metadata.service", fmt.Sprintf(`[Unit]
 Description=VMware metadata agent
 After=nss-lookup.target
 After=network-online.target
@@ -92,9 +76,9 @@ Wants=network-online.target
 Type=oneshot
 Environment=OUTPUT=/run/metadata/flatcar
 ExecStart=/usr/bin/mkdir --parent /run/metadata
-ExecStart=/usr/bin/bash -c 'echo "COREOS_CUSTOM_PRIVATE_IPV4=$(ip addr show ens192 | grep "inet 10." | grep -Po "inet \K[\d.]+")\nCOREOS_CUSTOM_PUBLIC_IPV4=$(ip addr show ens192 | grep -v "inet 10." | grep -Po "inet \K[\d.]+")" > ${OUTPUT}'
+ExecStart=/usr/bin/bash -c 'echo "COREOS_CUSTOM_PRIVATE_IPV4=$(ip addr show %s | grep "inet 10." | grep -Po "inet \K[\d.]+")\nCOREOS_CUSTOM_PUBLIC_IPV4=$(ip addr show %s | grep -v "inet 10." | grep -Po "inet \K[\d.]+")" > ${OUTPUT}'
 ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
-`, false)
+`, privateInterface, esx.PublicInterface), false)
 
 	instance, err := ec.flight.api.CreateDevice(ec.vmname(), conf, ipPairMaybe)
 	if err != nil {
@@ -0,0 +1,116 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/conf"
+)
+
+type cluster struct {
+	*platform.BaseCluster
+	flight   *flight
+	sshKeyID int64
+}
+
+func (hc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	conf, err := hc.RenderUserData(userdata, map[string]string{
+		"$public_ipv4":  "${COREOS_CUSTOM_PUBLIC_IPV4}",
+		"$private_ipv4": "${COREOS_CUSTOM_PRIVATE_IPV4}",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The config transpiler doesn't know Hetzner, so provide the
+	// metadata agent.  Servers without a private network report the
+	// public address as the private one, here and in PrivateIP().
+	conf.AddSystemdUnit("coreos-metadata.service", `[Unit]
+Description=Hetzner Cloud metadata agent
+After=nss-lookup.target
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=oneshot
+Environment=OUTPUT=/run/metadata/flatcar
+Environment=METADATA=http://169.254.169.254/hetzner/v1/metadata
+ExecStart=/usr/bin/mkdir --parent /run/metadata
+ExecStart=/usr/bin/bash -c 'public=$(curl -sSf --retry 10 ${METADATA}/public-ipv4); private=$(curl -sSf --retry 10 ${METADATA}/private-networks | grep -Po "ip: \K[\d.]+" | head -n 1); echo "COREOS_CUSTOM_PUBLIC_IPV4=$$public\nCOREOS_CUSTOM_PRIVATE_IPV4=$${private:-$$public}" > ${OUTPUT}'
+ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
+`, false)
+
+	server, err := hc.flight.api.CreateServer(context.TODO(), hc.vmname(), hc.flight.Name(), hc.sshKeyID, conf.String())
+	if err != nil {
+		return nil, err
+	}
+
+	mach := &machine{
+		cluster:  hc,
+		server:   server,
+		publicIP: server.PublicNet.IPv4.IP,
+	}
+	if mach.publicIP == "" {
+		mach.Destroy()
+		return nil, fmt.Errorf("couldn't get public IP address for server")
+	}
+	mach.privateIP = mach.publicIP
+	if len(server.PrivateNet) > 0 {
+		mach.privateIP = server.PrivateNet[0].IP
+	}
+
+	dir := filepath.Join(hc.RuntimeConf().OutputDir, mach.ID())
+	if err := os.Mkdir(dir, 0777); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	confPath := filepath.Join(dir, "user-data")
+	if err := conf.WriteFile(confPath); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if mach.journal, err = platform.NewJournal(dir); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if err := platform.StartMachine(mach, mach.journal); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	hc.AddMach(mach)
+
+	return mach, nil
+}
+
+func (hc *cluster) vmname() string {
+	b := make([]byte, 5)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%x", hc.Name()[0:13], b)
+}
+
+func (hc *cluster) Destroy() {
+	hc.BaseCluster.Destroy()
+	hc.flight.DelCluster(hc)
+}
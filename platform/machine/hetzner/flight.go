@@ -0,0 +1,120 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hetzner
+
+import (
+	"context"
+
+	"github.com/coreos/pkg/capnslog"
+
+	ctplatform "github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/hetzner"
+)
+
+const (
+	Platform platform.Name = "hetzner"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar-linux/mantle", "platform/machine/hetzner")
+)
+
+type flight struct {
+	*platform.BaseFlight
+	api          *hetzner.API
+	sshKeyID     int64
+	fakeSSHKeyID int64
+}
+
+func NewFlight(opts *hetzner.Options) (platform.Flight, error) {
+	api, err := hetzner.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The config transpiler doesn't know Hetzner; the cluster adds
+	// a metadata agent for the custom platform.
+	bf, err := platform.NewBaseFlight(opts.Options, Platform, ctplatform.Custom)
+	if err != nil {
+		return nil, err
+	}
+
+	hf := &flight{
+		BaseFlight: bf,
+		api:        api,
+	}
+
+	keys, err := hf.Keys()
+	if err != nil {
+		hf.Destroy()
+		return nil, err
+	}
+	hf.sshKeyID, err = hf.api.AddKey(context.TODO(), hf.Name(), keys[0].String())
+	if err != nil {
+		hf.Destroy()
+		return nil, err
+	}
+
+	// Without an SSH key, Hetzner generates a root password and mails
+	// it to the project owner.  Create a key that can never
+	// authenticate for clusters that mustn't get the real one.
+	key, err := platform.GenerateFakeKey()
+	if err != nil {
+		hf.Destroy()
+		return nil, err
+	}
+	hf.fakeSSHKeyID, err = hf.api.AddKey(context.TODO(), hf.Name()+"-fake", key)
+	if err != nil {
+		hf.Destroy()
+		return nil, err
+	}
+
+	return hf, nil
+}
+
+func (hf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
+	bc, err := platform.NewBaseCluster(hf.BaseFlight, rconf)
+	if err != nil {
+		return nil, err
+	}
+
+	hc := &cluster{
+		BaseCluster: bc,
+		flight:      hf,
+	}
+	if !rconf.NoSSHKeyInMetadata {
+		hc.sshKeyID = hf.sshKeyID
+	} else {
+		hc.sshKeyID = hf.fakeSSHKeyID
+	}
+
+	hf.AddCluster(hc)
+
+	return hc, nil
+}
+
+func (hf *flight) Destroy() {
+	for _, keyID := range []int64{hf.sshKeyID, hf.fakeSSHKeyID} {
+		if keyID == 0 {
+			continue
+		}
+		if err := hf.api.DeleteKey(context.TODO(), keyID); err != nil {
+			plog.Errorf("Error deleting key %v: %v", keyID, err)
+		}
+	}
+
+	hf.BaseFlight.Destroy()
+}
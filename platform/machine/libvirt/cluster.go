@@ -0,0 +1,177 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libvirt
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pborman/uuid"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/libvirt"
+	"github.com/flatcar-linux/mantle/platform/conf"
+	"github.com/flatcar-linux/mantle/util"
+)
+
+type cluster struct {
+	*platform.BaseCluster
+	flight *flight
+
+	// network is the libvirt network of the cluster, ownNetwork is set
+	// if the cluster created it.
+	network    string
+	ownNetwork bool
+}
+
+// createNetwork gives the cluster a NAT network of its own in a random
+// 192.168.x.0/24 subnet, unless the options name an existing network.
+// libvirt refuses subnets already in use, so a few are tried.
+func (lc *cluster) createNetwork() error {
+	if network := lc.flight.api.Options().Network; network != "" {
+		lc.network = network
+		return nil
+	}
+
+	name := lc.Name()
+	var err error
+	for i := 0; i < 10; i++ {
+		subnet := net.IPv4(192, 168, byte(100+rand.Intn(150)), 0)
+		if err = lc.flight.api.CreateNetwork(name, subnet); err == nil {
+			lc.network = name
+			lc.ownNetwork = true
+			return nil
+		}
+		plog.Debugf("creating network %s on %s: %v", name, subnet, err)
+	}
+	return fmt.Errorf("creating network %s: %v", name, err)
+}
+
+func (lc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	conf, err := lc.RenderUserData(userdata, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+	if !conf.IsIgnition() && !conf.IsEmpty() {
+		return nil, fmt.Errorf("libvirt platform only supports Ignition configs")
+	}
+
+	id := uuid.New()
+	dir := filepath.Join(lc.RuntimeConf().OutputDir, id)
+	if err := os.Mkdir(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	confPath := filepath.Join(dir, "ignition.json")
+	if err := conf.WriteFile(confPath); err != nil {
+		return nil, err
+	}
+
+	api := lc.flight.api
+	lm := &machine{
+		cluster: lc,
+		id:      id,
+		name:    lc.Name() + "-" + id[:8],
+	}
+	lm.disk = lm.name + ".qcow2"
+	lm.ignition = lm.name + "-ignition.json"
+
+	// The config is uploaded to the pool as well, so that qemu running
+	// as another user can read it.
+	ignitionPath, err := api.UploadVolume(lm.ignition, confPath, "raw")
+	if err != nil {
+		lm.ignition = ""
+		lm.Destroy()
+		return nil, err
+	}
+	diskPath, err := api.CreateOverlay(lm.disk, lc.flight.baseVolume, lc.flight.baseFormat)
+	if err != nil {
+		lm.disk = ""
+		lm.Destroy()
+		return nil, err
+	}
+
+	opts := api.Options()
+	err = api.CreateDomain(&libvirt.Domain{
+		Name:     lm.name,
+		UUID:     id,
+		Board:    opts.Board,
+		Memory:   opts.Memory,
+		CPUs:     opts.CPUs,
+		Disk:     diskPath,
+		Ignition: ignitionPath,
+		Network:  lc.network,
+	})
+	if err != nil {
+		lm.Destroy()
+		return nil, err
+	}
+	lm.defined = true
+
+	lm.consoleFile, err = os.Create(filepath.Join(dir, "console.txt"))
+	if err != nil {
+		lm.Destroy()
+		return nil, err
+	}
+	lm.console, err = api.AttachConsole(lm.name, lm.consoleFile)
+	if err != nil {
+		lm.Destroy()
+		return nil, err
+	}
+	if err := api.ResumeDomain(lm.name); err != nil {
+		lm.Destroy()
+		return nil, err
+	}
+
+	err = util.Retry(60, 2*time.Second, func() error {
+		var err error
+		lm.ip, err = api.DomainAddress(lm.name)
+		return err
+	})
+	if err != nil {
+		lm.Destroy()
+		return nil, fmt.Errorf("getting address of %s: %v", lm.name, err)
+	}
+
+	if lm.journal, err = platform.NewJournal(dir); err != nil {
+		lm.Destroy()
+		return nil, err
+	}
+
+	if err := platform.StartMachine(lm, lm.journal); err != nil {
+		lm.Destroy()
+		return nil, err
+	}
+
+	lc.AddMach(lm)
+
+	return lm, nil
+}
+
+func (lc *cluster) Destroy() {
+	lc.BaseCluster.Destroy()
+
+	if lc.ownNetwork {
+		if err := lc.flight.api.DeleteNetwork(lc.network); err != nil {
+			plog.Errorf("Error deleting network %v: %v", lc.network, err)
+		}
+	}
+
+	lc.flight.DelCluster(lc)
+}
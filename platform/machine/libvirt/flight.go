@@ -0,0 +1,124 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libvirt
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/libvirt"
+)
+
+const (
+	Platform platform.Name = "libvirt"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/flatcar-linux/mantle", "platform/machine/libvirt")
+)
+
+type flight struct {
+	*platform.BaseFlight
+	api *libvirt.API
+
+	baseVolume string
+	baseFormat string
+}
+
+// NewFlight uploads the disk image into the storage pool, where each
+// machine gets a qcow2 overlay on top of it.
+func NewFlight(opts *libvirt.Options) (platform.Flight, error) {
+	api, err := libvirt.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bf, err := platform.NewBaseFlight(opts.Options, Platform, "")
+	if err != nil {
+		return nil, err
+	}
+
+	lf := &flight{
+		BaseFlight: bf,
+		api:        api,
+		baseVolume: bf.Name() + "-base",
+	}
+
+	lf.baseFormat, err = imageFormat(opts.DiskImage)
+	if err != nil {
+		lf.Destroy()
+		return nil, err
+	}
+
+	plog.Infof("Uploading %s to storage pool %s", opts.DiskImage, opts.StoragePool)
+	if _, err := api.UploadVolume(lf.baseVolume, opts.DiskImage, lf.baseFormat); err != nil {
+		lf.baseVolume = ""
+		lf.Destroy()
+		return nil, err
+	}
+
+	return lf, nil
+}
+
+// imageFormat tells qcow2 images apart from raw ones.
+func imageFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(f, magic); err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if bytes.Equal(magic, []byte("QFI\xfb")) {
+		return "qcow2", nil
+	}
+	return "raw", nil
+}
+
+func (lf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
+	bc, err := platform.NewBaseCluster(lf.BaseFlight, rconf)
+	if err != nil {
+		return nil, err
+	}
+
+	lc := &cluster{
+		BaseCluster: bc,
+		flight:      lf,
+	}
+	if err := lc.createNetwork(); err != nil {
+		return nil, err
+	}
+
+	lf.AddCluster(lc)
+
+	return lc, nil
+}
+
+func (lf *flight) Destroy() {
+	lf.BaseFlight.Destroy()
+
+	if lf.baseVolume != "" {
+		if err := lf.api.DeleteVolume(lf.baseVolume); err != nil {
+			plog.Errorf("Error deleting volume %v: %v", lf.baseVolume, err)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package libvirt
+
+import (
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/api/libvirt"
+)
+
+type machine struct {
+	cluster *cluster
+	id      string
+	name    string
+	ip      string
+	journal *platform.Journal
+
+	// volumes and domain to clean up
+	disk     string
+	ignition string
+	defined  bool
+
+	console     *libvirt.Console
+	consoleFile *os.File
+	consoleText string
+}
+
+func (lm *machine) ID() string {
+	return lm.id
+}
+
+func (lm *machine) IP() string {
+	return lm.ip
+}
+
+func (lm *machine) PrivateIP() string {
+	return lm.ip
+}
+
+func (lm *machine) RuntimeConf() platform.RuntimeConfig {
+	return lm.cluster.RuntimeConf()
+}
+
+func (lm *machine) SSHClient() (*ssh.Client, error) {
+	return lm.cluster.SSHClient(lm.IP())
+}
+
+func (lm *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return lm.cluster.PasswordSSHClient(lm.IP(), user, password)
+}
+
+func (lm *machine) SSH(cmd string) ([]byte, []byte, error) {
+	return lm.cluster.SSH(lm, cmd)
+}
+
+func (lm *machine) Reboot() error {
+	return platform.RebootMachine(lm, lm.journal)
+}
+
+func (lm *machine) Destroy() {
+	api := lm.cluster.flight.api
+
+	if lm.defined {
+		if err := api.DeleteDomain(lm.name); err != nil {
+			plog.Errorf("Error deleting domain %v: %v", lm.name, err)
+		}
+	}
+	for _, vol := range []string{lm.disk, lm.ignition} {
+		if vol == "" {
+			continue
+		}
+		if err := api.DeleteVolume(vol); err != nil {
+			plog.Errorf("Error deleting volume %v: %v", vol, err)
+		}
+	}
+
+	if lm.journal != nil {
+		lm.journal.Destroy()
+	}
+
+	if lm.console != nil {
+		lm.console.Close()
+	}
+	if lm.consoleFile != nil {
+		lm.consoleFile.Close()
+		if buf, err := ioutil.ReadFile(lm.consoleFile.Name()); err == nil {
+			lm.consoleText = string(buf)
+		} else {
+			plog.Errorf("Error reading console for instance %v: %v", lm.ID(), err)
+		}
+	}
+
+	lm.cluster.DelMach(lm)
+}
+
+func (lm *machine) ConsoleOutput() string {
+	return lm.consoleText
+}
+
+func (lm *machine) JournalOutput() string {
+	if lm.journal == nil {
+		return ""
+	}
+
+	data, err := lm.journal.Read()
+	if err != nil {
+		plog.Errorf("Reading journal for instance %v: %v", lm.ID(), err)
+	}
+	return string(data)
+}
+
+func (lm *machine) Board() string {
+	return lm.cluster.flight.Options().Board
+}
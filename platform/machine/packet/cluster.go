@@ -77,7 +77,7 @@ func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		}
 
 		// CreateDevice unconditionally closes console when done with it
-		device, err = pc.flight.api.CreateDevice(vmname, conf, pcons)
+		device, err = pc.flight.api.CreateDevice(vmname, pc.flight.Name(), conf, pcons)
 		if err != nil {
 			continue // provisioning error
 		}
@@ -16,10 +16,11 @@ package qemu
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/pborman/uuid"
 
@@ -27,6 +28,7 @@ import (
 	"github.com/flatcar-linux/mantle/platform/conf"
 	"github.com/flatcar-linux/mantle/platform/local"
 	"github.com/flatcar-linux/mantle/system/ns"
+	"github.com/flatcar-linux/mantle/util"
 )
 
 // Cluster is a local cluster of QEMU-based virtual machines.
@@ -54,9 +56,23 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 
 	// hacky solution for cloud config ip substitution
 	// NOTE: escaping is not supported
+	primary := options.PrimarySegment
+	if primary == "" {
+		primary = "br0"
+	}
+	if primary == local.TrunkBridge {
+		return nil, fmt.Errorf("primary network card cannot be on %s", local.TrunkBridge)
+	}
+
 	qc.mu.Lock()
-	netif := qc.flight.Dnsmasq.GetInterface("br0")
-	ip := strings.Split(netif.DHCPv4[0].String(), "/")[0]
+	nic, tap, err := qc.NewNIC(primary)
+	if err != nil {
+		qc.mu.Unlock()
+		return nil, err
+	}
+	defer tap.Close()
+	netif := nic.Interface
+	ip := netif.IP().String()
 
 	conf, err := qc.RenderUserData(userdata, map[string]string{
 		"$public_ipv4":  "${COREOS_CUSTOM_PUBLIC_IPV4}",
@@ -68,6 +84,8 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 	}
 	qc.mu.Unlock()
 
+	qc.AddRegistryMirror(conf)
+
 	conf.AddSystemdUnit("coreos-metadata.service", `[Unit]
 Description=QEMU metadata agent
 After=nss-lookup.target
@@ -100,16 +118,34 @@ ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
 		return nil, err
 	}
 
+	// unix socket paths are limited to 108 bytes, which dir may exceed
+	sockDir, err := ioutil.TempDir("", "mantle-qemu-sock")
+	if err != nil {
+		return nil, err
+	}
+
 	qm := &machine{
 		qc:          qc,
 		id:          id,
 		netif:       netif,
+		nics:        []*local.NIC{nic},
 		journal:     journal,
 		consolePath: filepath.Join(dir, "console.txt"),
+		qmpPath:     filepath.Join(sockDir, "qmp.sock"),
+	}
+
+	var bootArgs []string
+	if qc.flight.opts.Boot == BootPXE || qc.flight.opts.Boot == BootPXEInstall {
+		bootArgs, options.AdditionalDisks, err = qc.setupPXEBoot(netif.HardwareAddr, conf, options.AdditionalDisks)
+		if err != nil {
+			os.RemoveAll(sockDir)
+			return nil, err
+		}
 	}
 
-	qmCmd, extraFiles, err := platform.CreateQEMUCommand(qc.flight.opts.Board, qm.id, qc.flight.opts.BIOSImage, qm.consolePath, confPath, qc.flight.diskImagePath, conf.IsIgnition(), options)
+	qmCmd, extraFiles, err := platform.CreateQEMUCommand(qc.flight.opts.Board, qm.id, qc.flight.opts.BIOSImage, qm.consolePath, filepath.Join(sockDir, "console.sock"), qm.qmpPath, confPath, qc.flight.diskImagePath, conf.IsIgnition(), options)
 	if err != nil {
+		os.RemoveAll(sockDir)
 		return nil, err
 	}
 
@@ -120,18 +156,29 @@ ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
 
 	qc.mu.Lock()
 
-	tap, err := qc.NewTap("br0")
-	if err != nil {
-		qc.mu.Unlock()
-		return nil, err
-	}
-	defer tap.Close()
 	fdnum := 3 + len(extraFiles)
 	qmCmd = append(qmCmd, "-netdev", fmt.Sprintf("tap,id=tap,fd=%d", fdnum),
-		"-device", platform.Virtio(qc.flight.opts.Board, "net", "netdev=tap,mac="+qmMac))
+		"-device", platform.Virtio(qc.flight.opts.Board, "net", "netdev=tap,id="+platform.QEMUPrimaryNIC+",mac="+qmMac))
 	fdnum += 1
 	extraFiles = append(extraFiles, tap.File)
 
+	for i, segment := range options.NetworkSegments {
+		nic, tap, err := qc.NewNIC(segment)
+		if err != nil {
+			qc.mu.Unlock()
+			os.RemoveAll(sockDir)
+			return nil, err
+		}
+		defer tap.Close()
+		netdev := fmt.Sprintf("tap%d", i+1)
+		qmCmd = append(qmCmd, "-netdev", fmt.Sprintf("tap,id=%s,fd=%d", netdev, fdnum),
+			"-device", platform.Virtio(qc.flight.opts.Board, "net", "netdev="+netdev+",mac="+nic.Interface.HardwareAddr.String()))
+		fdnum += 1
+		extraFiles = append(extraFiles, tap.File)
+		qm.nics = append(qm.nics, nic)
+	}
+	qmCmd = append(qmCmd, bootArgs...)
+
 	plog.Debugf("NewMachine: %q, %q, %q", qmCmd, qm.IP(), qm.PrivateIP())
 
 	qm.qemu = qm.qc.NewCommand(qmCmd[0], qmCmd[1:]...)
@@ -144,14 +191,29 @@ ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
 	cmd.ExtraFiles = append(cmd.ExtraFiles, extraFiles...)
 
 	if err = qm.qemu.Start(); err != nil {
+		os.RemoveAll(sockDir)
 		return nil, err
 	}
 
 	plog.Debugf("qemu PID (manual cleanup needed if --remove=false): %v", qm.qemu.Pid())
 
-	if err := platform.StartMachine(qm, qm.journal); err != nil {
-		qm.Destroy()
-		return nil, err
+	if options.InteractiveConsole {
+		err := util.Retry(50, 100*time.Millisecond, func() error {
+			var err error
+			qm.serial, err = platform.NewSerialConsole(filepath.Join(sockDir, "console.sock"))
+			return err
+		})
+		if err != nil {
+			qm.Destroy()
+			return nil, err
+		}
+	}
+
+	if !options.SkipStartMachine {
+		if err := platform.StartMachine(qm, qm.journal); err != nil {
+			qm.Destroy()
+			return nil, err
+		}
 	}
 
 	qc.AddMach(qm)
@@ -159,6 +221,64 @@ ExecStartPost=/usr/bin/ln -fs /run/metadata/flatcar /run/metadata/coreos
 	return qm, nil
 }
 
+// QMP returns the QMP client of m, which must be a machine of this cluster.
+func (qc *Cluster) QMP(m platform.Machine) (*platform.QMPClient, error) {
+	qm, ok := m.(*machine)
+	if !ok {
+		return nil, fmt.Errorf("machine %s is not a QEMU machine", m.ID())
+	}
+	return qm.QMP()
+}
+
+// NICs returns the network cards of m, which must be a machine of this
+// cluster, starting with the primary one.
+func (qc *Cluster) NICs(m platform.Machine) ([]*local.NIC, error) {
+	qm, ok := m.(*machine)
+	if !ok {
+		return nil, fmt.Errorf("machine %s is not a QEMU machine", m.ID())
+	}
+	return qm.nics, nil
+}
+
+// HotplugDisk creates disk and attaches it to the running machine m under
+// the device ID id.
+func (qc *Cluster) HotplugDisk(m platform.Machine, id string, disk platform.Disk) error {
+	qmp, err := qc.QMP(m)
+	if err != nil {
+		return err
+	}
+	return qmp.HotplugDisk(qc.flight.opts.Board, id, disk)
+}
+
+// HotplugNIC attaches a network card with the device ID id to the running
+// machine m. The card is connected to the cluster bridge and gets its
+// address from the flight's DHCP server.
+func (qc *Cluster) HotplugNIC(m platform.Machine, id string) error {
+	qmp, err := qc.QMP(m)
+	if err != nil {
+		return err
+	}
+
+	qc.mu.Lock()
+	netif := qc.flight.Dnsmasq.GetInterface("br0")
+	tap, err := qc.NewTap("br0")
+	qc.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// QEMU keeps its own copy of the descriptor
+	defer tap.Close()
+
+	if err := qmp.GetFD(id, tap.File); err != nil {
+		return fmt.Errorf("passing tap device to QEMU: %v", err)
+	}
+	netdev := map[string]interface{}{
+		"type": "tap",
+		"fd":   id,
+	}
+	return qmp.HotplugNIC(qc.flight.opts.Board, id, netdev, netif.HardwareAddr.String())
+}
+
 func (qc *Cluster) Destroy() {
 	qc.LocalCluster.Destroy()
 	qc.flight.DelCluster(qc)
@@ -28,6 +28,19 @@ import (
 
 const (
 	Platform platform.Name = "qemu"
+
+	// BootDisk boots DiskImage.
+	BootDisk = "disk"
+	// BootPXE boots PXEKernel and PXEInitrd from the flight's PXE server
+	// without any disk.
+	BootPXE = "pxe"
+	// BootPXEInstall boots the PXE images, installs InstallImage to a
+	// blank disk with flatcar-install and reboots into it.
+	BootPXEInstall = "pxe-install"
+
+	pxeKernelName    = "flatcar_production_pxe.vmlinuz"
+	pxeInitrdName    = "flatcar_production_pxe_image.cpio.gz"
+	installImageName = "flatcar_production_image.bin.bz2"
 )
 
 // Options contains QEMU-specific options for the flight.
@@ -42,6 +55,20 @@ type Options struct {
 	// Don't modify CL disk images to add console logging
 	UseVanillaImage bool
 
+	// Boot is one of BootDisk, BootPXE or BootPXEInstall.
+	Boot string
+	// PXEKernel and PXEInitrd are the paths of the PXE kernel and
+	// initramfs.
+	PXEKernel string
+	PXEInitrd string
+	// InstallImage is the path of the compressed image installed by
+	// BootPXEInstall.
+	InstallImage string
+
+	// RegistryImages are imported into the registry of the flight,
+	// which machines use as a mirror. See local.Registry.Import.
+	RegistryImages []string
+
 	*platform.Options
 }
 
@@ -69,6 +96,26 @@ func NewFlight(opts *Options) (platform.Flight, error) {
 		diskImagePath: opts.DiskImage,
 	}
 
+	for _, path := range opts.RegistryImages {
+		if err := lf.Registry.Import(path); err != nil {
+			qf.Destroy()
+			return nil, fmt.Errorf("importing registry images: %v", err)
+		}
+	}
+
+	switch opts.Boot {
+	case "", BootDisk:
+	case BootPXE, BootPXEInstall:
+		if err := qf.setupPXE(); err != nil {
+			qf.Destroy()
+			return nil, err
+		}
+		return qf, nil
+	default:
+		qf.Destroy()
+		return nil, fmt.Errorf("unsupported boot mode %q", opts.Boot)
+	}
+
 	if opts.Distribution != "cl" {
 		// don't apply CL-specific mangling
 		opts.UseVanillaImage = true
@@ -103,6 +150,30 @@ func NewFlight(opts *Options) (platform.Flight, error) {
 	return qf, nil
 }
 
+// setupPXE serves the PXE images, and the image to install if needed,
+// from the flight's PXE server.
+func (qf *flight) setupPXE() error {
+	if qf.opts.Board != "amd64-usr" {
+		// the UEFI PXE client of arm64 can't run iPXE scripts
+		return fmt.Errorf("PXE boot is not supported on %s", qf.opts.Board)
+	}
+	qf.diskImagePath = ""
+
+	files := map[string]string{
+		pxeKernelName: qf.opts.PXEKernel,
+		pxeInitrdName: qf.opts.PXEInitrd,
+	}
+	if qf.opts.Boot == BootPXEInstall {
+		files[installImageName] = qf.opts.InstallImage
+	}
+	for name, path := range files {
+		if err := qf.PXEServer.AddFile(name, path); err != nil {
+			return fmt.Errorf("serving %s failed: %v", name, err)
+		}
+	}
+	return nil
+}
+
 // NewCluster creates a Cluster instance, suitable for running virtual
 // machines in QEMU.
 func (qf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, error) {
@@ -15,7 +15,13 @@
 package qemu
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
@@ -29,9 +35,16 @@ type machine struct {
 	id          string
 	qemu        exec.Cmd
 	netif       *local.Interface
+	nics        []*local.NIC
 	journal     *platform.Journal
 	consolePath string
 	console     string
+	qmpPath     string
+
+	qmpLock sync.Mutex
+	qmp     *platform.QMPClient
+
+	serial *platform.SerialConsole
 }
 
 func (m *machine) ID() string {
@@ -39,11 +52,11 @@ func (m *machine) ID() string {
 }
 
 func (m *machine) IP() string {
-	return m.netif.DHCPv4[0].IP.String()
+	return m.netif.IP().String()
 }
 
 func (m *machine) PrivateIP() string {
-	return m.netif.DHCPv4[0].IP.String()
+	return m.netif.IP().String()
 }
 
 func (m *machine) RuntimeConf() platform.RuntimeConfig {
@@ -73,15 +86,71 @@ func (m *machine) Destroy() {
 
 	m.journal.Destroy()
 
+	if m.serial != nil {
+		m.serial.Close()
+	}
+
+	m.qmpLock.Lock()
+	if m.qmp != nil {
+		m.qmp.Close()
+		m.qmp = nil
+	}
+	m.qmpLock.Unlock()
+	os.RemoveAll(filepath.Dir(m.qmpPath))
+
 	if buf, err := ioutil.ReadFile(m.consolePath); err == nil {
 		m.console = string(buf)
 	} else {
 		plog.Errorf("Error reading console for instance %v: %v", m.ID(), err)
 	}
 
+	m.qc.ReleaseNICs(m.nics)
 	m.qc.DelMach(m)
 }
 
+// QMP returns the client for the machine's QMP socket, connecting on first
+// use.
+func (m *machine) QMP() (*platform.QMPClient, error) {
+	m.qmpLock.Lock()
+	defer m.qmpLock.Unlock()
+
+	if m.qmp == nil {
+		qmp, err := platform.NewQMPClient(m.qmpPath)
+		if err != nil {
+			return nil, err
+		}
+		m.qmp = qmp
+	}
+	return m.qmp, nil
+}
+
+func (m *machine) SerialConsole() (*platform.SerialConsole, error) {
+	if m.serial == nil {
+		return nil, fmt.Errorf("machine %s has no interactive console", m.ID())
+	}
+	return m.serial, nil
+}
+
+func (m *machine) ConsoleExpect(re string, timeout time.Duration) ([]string, error) {
+	serial, err := m.SerialConsole()
+	if err != nil {
+		return nil, err
+	}
+	pat, err := regexp.Compile(re)
+	if err != nil {
+		return nil, err
+	}
+	return serial.Expect(pat, timeout)
+}
+
+func (m *machine) ConsoleSend(text string) error {
+	serial, err := m.SerialConsole()
+	if err != nil {
+		return err
+	}
+	return serial.Send(text)
+}
+
 func (m *machine) ConsoleOutput() string {
 	return m.console
 }
@@ -0,0 +1,143 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qemu
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	ignition "github.com/coreos/ignition/config/v2_0/types"
+
+	"github.com/flatcar-linux/mantle/platform"
+	"github.com/flatcar-linux/mantle/platform/conf"
+)
+
+const (
+	// installDiskSize is the size of the blank disk flatcar-install
+	// writes to.
+	installDiskSize = "12G"
+
+	installUnit = `[Unit]
+Description=Install Flatcar Container Linux
+Requires=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+WorkingDirectory=/var/tmp
+ExecStart=/usr/bin/curl --retry 10 --retry-connrefused -fo userdata.ign %s
+ExecStart=/usr/bin/curl --retry 10 --retry-connrefused -fo image.bin.bz2 %s
+ExecStart=/usr/bin/flatcar-install -d /dev/disk/by-id/virtio-primary-disk -f image.bin.bz2 -i userdata.ign
+ExecStart=/usr/bin/systemctl --no-block reboot
+StandardOutput=journal+console
+StandardError=journal+console
+
+[Install]
+RequiredBy=multi-user.target
+`
+)
+
+// pxeName returns the name of a per-machine file on the PXE server.
+func pxeName(mac net.HardwareAddr, suffix string) string {
+	return strings.Replace(mac.String(), ":", "-", -1) + suffix
+}
+
+// ipxeScript boots the PXE images with the Ignition config at configURL.
+// Relative paths are resolved against the URL of the script.
+func ipxeScript(configURL string) string {
+	return fmt.Sprintf(`#!ipxe
+kernel %s initrd=%s flatcar.first_boot=1 ignition.config.url=%s console=ttyS0,115200n8
+initrd %s
+boot
+`, pxeKernelName, pxeInitrdName, configURL, pxeInitrdName)
+}
+
+// installerConfig returns an Ignition config for the PXE system that
+// installs the image at imageURL with the config at userdataURL.
+func installerConfig(userdataURL, imageURL string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(ignition.Config{
+		Ignition: ignition.Ignition{
+			Version: ignition.IgnitionVersion{Major: 2},
+		},
+		Systemd: ignition.Systemd{
+			Units: []ignition.SystemdUnit{
+				{
+					// keep kola from connecting to the installer
+					Name: "sshd.socket",
+					Mask: true,
+				},
+				{
+					Name: "sshd.service",
+					Mask: true,
+				},
+				{
+					Name:     "flatcar-install.service",
+					Enable:   true,
+					Contents: fmt.Sprintf(installUnit, userdataURL, imageURL),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding Ignition config: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// setupPXEBoot publishes the boot script and Ignition configs of a machine
+// on the PXE server. It returns the QEMU arguments to boot it from the
+// network and the disks to attach.
+func (qc *Cluster) setupPXEBoot(mac net.HardwareAddr, userdata *conf.Conf, disks []platform.Disk) ([]string, []platform.Disk, error) {
+	if !userdata.IsIgnition() {
+		return nil, nil, fmt.Errorf("PXE boot requires an Ignition config")
+	}
+	ps := qc.flight.PXEServer
+
+	configName := pxeName(mac, ".ign")
+	if err := ps.WriteFile(configName, userdata.Bytes()); err != nil {
+		return nil, nil, err
+	}
+
+	if qc.flight.opts.Boot == BootPXE {
+		if err := ps.SetBootScript(mac, ipxeScript(qc.PXEURL(configName))); err != nil {
+			return nil, nil, err
+		}
+		return []string{"-boot", "order=n"}, disks, nil
+	}
+
+	installer, err := installerConfig(qc.PXEURL(configName), qc.PXEURL(installImageName))
+	if err != nil {
+		return nil, nil, err
+	}
+	installerName := pxeName(mac, "-installer.ign")
+	if err := ps.WriteFile(installerName, installer); err != nil {
+		return nil, nil, err
+	}
+	if err := ps.SetBootScript(mac, ipxeScript(qc.PXEURL(installerName))); err != nil {
+		return nil, nil, err
+	}
+
+	// install to a blank primary disk and boot from it after the
+	// installer reboots
+	disks = append([]platform.Disk{{
+		Size:       installDiskSize,
+		DeviceOpts: []string{"serial=primary-disk"},
+	}}, disks...)
+	return []string{"-boot", "once=n"}, disks, nil
+}
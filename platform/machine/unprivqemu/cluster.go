@@ -29,6 +29,7 @@ import (
 
 	"github.com/flatcar-linux/mantle/platform"
 	"github.com/flatcar-linux/mantle/platform/conf"
+	"github.com/flatcar-linux/mantle/platform/local"
 	"github.com/flatcar-linux/mantle/system/exec"
 	"github.com/flatcar-linux/mantle/util"
 )
@@ -49,6 +50,11 @@ func (qc *Cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 }
 
 func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platform.MachineOptions) (platform.Machine, error) {
+	if options.PrimarySegment != "" || len(options.NetworkSegments) != 0 {
+		// user mode networking has a single network
+		return nil, fmt.Errorf("network segments require the qemu platform")
+	}
+
 	id := uuid.New()
 
 	dir := filepath.Join(qc.RuntimeConf().OutputDir, id)
@@ -73,9 +79,13 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 		if err := conf.WriteFile(confPath); err != nil {
 			return nil, err
 		}
-	} else if conf.IsEmpty() {
 	} else {
-		return nil, fmt.Errorf("unprivileged qemu only supports Ignition or empty configs")
+		// cloud-config and scripts are read by coreos-cloudinit from a
+		// config drive shared over 9p, which does not require root
+		confPath, err = local.MakeConfigDrive(conf, dir)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	journal, err := platform.NewJournal(dir)
@@ -83,15 +93,23 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 		return nil, err
 	}
 
+	// unix socket paths are limited to 108 bytes, which dir may exceed
+	sockDir, err := ioutil.TempDir("", "mantle-qemu-sock")
+	if err != nil {
+		return nil, err
+	}
+
 	qm := &machine{
 		qc:          qc,
 		id:          id,
 		journal:     journal,
 		consolePath: filepath.Join(dir, "console.txt"),
+		qmpPath:     filepath.Join(sockDir, "qmp.sock"),
 	}
 
-	qmCmd, extraFiles, err := platform.CreateQEMUCommand(qc.flight.opts.Board, qm.id, qc.flight.opts.BIOSImage, qm.consolePath, confPath, qc.flight.diskImagePath, conf.IsIgnition(), options)
+	qmCmd, extraFiles, err := platform.CreateQEMUCommand(qc.flight.opts.Board, qm.id, qc.flight.opts.BIOSImage, qm.consolePath, filepath.Join(sockDir, "console.sock"), qm.qmpPath, confPath, qc.flight.diskImagePath, conf.IsIgnition(), options)
 	if err != nil {
+		os.RemoveAll(sockDir)
 		return nil, err
 	}
 
@@ -101,7 +119,7 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 
 	qc.mu.Lock()
 
-	qmCmd = append(qmCmd, "-netdev", "user,id=eth0,hostfwd=tcp:127.0.0.1:0-:22", "-device", platform.Virtio(qc.flight.opts.Board, "net", "netdev=eth0"))
+	qmCmd = append(qmCmd, "-netdev", "user,id=eth0,hostfwd=tcp:127.0.0.1:0-:22", "-device", platform.Virtio(qc.flight.opts.Board, "net", "netdev=eth0,id="+platform.QEMUPrimaryNIC))
 
 	plog.Debugf("NewMachine: %q", qmCmd)
 
@@ -115,11 +133,24 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 	cmd.ExtraFiles = append(cmd.ExtraFiles, extraFiles...)
 
 	if err = qm.qemu.Start(); err != nil {
+		os.RemoveAll(sockDir)
 		return nil, err
 	}
 
 	plog.Debugf("qemu PID (manual cleanup needed if --remove=false): %v", qm.qemu.Pid())
 
+	if options.InteractiveConsole {
+		err := util.Retry(50, 100*time.Millisecond, func() error {
+			var err error
+			qm.serial, err = platform.NewSerialConsole(filepath.Join(sockDir, "console.sock"))
+			return err
+		})
+		if err != nil {
+			qm.Destroy()
+			return nil, err
+		}
+	}
+
 	pid := strconv.Itoa(qm.qemu.Pid())
 	err = util.Retry(6, 5*time.Second, func() error {
 		var err error
@@ -130,14 +161,17 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 		return nil
 	})
 	if err != nil {
+		qm.Destroy()
 		return nil, err
 	}
 
 	plog.Debugf("Localhost port for SSH connections: %q", qm.ip)
 
-	if err := platform.StartMachine(qm, qm.journal); err != nil {
-		qm.Destroy()
-		return nil, err
+	if !options.SkipStartMachine {
+		if err := platform.StartMachine(qm, qm.journal); err != nil {
+			qm.Destroy()
+			return nil, err
+		}
 	}
 
 	qc.AddMach(qm)
@@ -145,6 +179,38 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 	return qm, nil
 }
 
+// QMP returns the QMP client of m, which must be a machine of this cluster.
+func (qc *Cluster) QMP(m platform.Machine) (*platform.QMPClient, error) {
+	qm, ok := m.(*machine)
+	if !ok {
+		return nil, fmt.Errorf("machine %s is not a QEMU machine", m.ID())
+	}
+	return qm.QMP()
+}
+
+// HotplugDisk creates disk and attaches it to the running machine m under
+// the device ID id.
+func (qc *Cluster) HotplugDisk(m platform.Machine, id string, disk platform.Disk) error {
+	qmp, err := qc.QMP(m)
+	if err != nil {
+		return err
+	}
+	return qmp.HotplugDisk(qc.flight.opts.Board, id, disk)
+}
+
+// HotplugNIC attaches a network card with the device ID id to the running
+// machine m, backed by QEMU user mode networking.
+func (qc *Cluster) HotplugNIC(m platform.Machine, id string) error {
+	qmp, err := qc.QMP(m)
+	if err != nil {
+		return err
+	}
+	netdev := map[string]interface{}{
+		"type": "user",
+	}
+	return qmp.HotplugNIC(qc.flight.opts.Board, id, netdev, "")
+}
+
 func (qc *Cluster) Destroy() {
 	qc.BaseCluster.Destroy()
 	qc.flight.DelCluster(qc)
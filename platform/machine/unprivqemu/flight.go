@@ -15,6 +15,7 @@
 package unprivqemu
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/coreos/pkg/capnslog"
@@ -40,6 +41,11 @@ var (
 )
 
 func NewFlight(opts *qemu.Options) (platform.Flight, error) {
+	if opts.Boot != "" && opts.Boot != qemu.BootDisk {
+		// there is no DHCP server to hand out boot files
+		return nil, fmt.Errorf("boot mode %q requires the qemu platform", opts.Boot)
+	}
+
 	bf, err := platform.NewBaseFlight(opts.Options, Platform, "")
 	if err != nil {
 		return nil, err
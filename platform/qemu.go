@@ -34,6 +34,23 @@ import (
 
 type MachineOptions struct {
 	AdditionalDisks []Disk
+
+	// InteractiveConsole makes the serial console available through
+	// ConsoleMachine in addition to logging it.
+	InteractiveConsole bool
+
+	// SkipStartMachine returns the machine as soon as it was started
+	// instead of waiting for it to come up over SSH, e.g. to test boot
+	// failures through the interactive console.
+	SkipStartMachine bool
+
+	// PrimarySegment names the network segment of the primary network
+	// card, "br0" if empty.
+	PrimarySegment string
+
+	// NetworkSegments adds a network card for each named segment. The
+	// trunk bridge attaches a card carrying all VLAN segments tagged.
+	NetworkSegments []string
 }
 
 type Disk struct {
@@ -242,7 +259,7 @@ func mkpath(basedir string) (string, error) {
 	return f.Name(), nil
 }
 
-func CreateQEMUCommand(board, uuid, biosImage, consolePath, confPath, diskImagePath string, isIgnition bool, options MachineOptions) ([]string, []*os.File, error) {
+func CreateQEMUCommand(board, uuid, biosImage, consolePath, consoleSockPath, qmpPath, confPath, diskImagePath string, isIgnition bool, options MachineOptions) ([]string, []*os.File, error) {
 	var qmCmd []string
 
 	// As we expand this list of supported native + board
@@ -293,8 +310,19 @@ func CreateQEMUCommand(board, uuid, biosImage, consolePath, confPath, diskImageP
 		"-smp", "4",
 		"-uuid", uuid,
 		"-display", "none",
-		"-chardev", "file,id=log,path="+consolePath,
+	)
+
+	// QEMU waits for a client on the console socket before starting the
+	// machine, so that none of its output is missed.
+	if options.InteractiveConsole {
+		qmCmd = append(qmCmd, "-chardev", "socket,id=log,server,path="+consoleSockPath+",logfile="+consolePath)
+	} else {
+		qmCmd = append(qmCmd, "-chardev", "file,id=log,path="+consolePath)
+	}
+
+	qmCmd = append(qmCmd,
 		"-serial", "chardev:log",
+		"-qmp", "unix:"+qmpPath+",server,nowait",
 		"-object", "rng-random,filename=/dev/urandom,id=rng0",
 		"-device", "virtio-rng-pci,rng=rng0",
 	)
@@ -328,12 +356,15 @@ func CreateQEMUCommand(board, uuid, biosImage, consolePath, confPath, diskImageP
 		plog.Debugf("disabling auto-read-only for QEMU drives")
 	}
 
-	allDisks := append([]Disk{
-		{
+	// machines booting from the network have no image to boot from disk
+	var allDisks []Disk
+	if diskImagePath != "" {
+		allDisks = append(allDisks, Disk{
 			BackingFile: diskImagePath,
 			DeviceOpts:  primaryDiskOptions,
-		},
-	}, options.AdditionalDisks...)
+		})
+	}
+	allDisks = append(allDisks, options.AdditionalDisks...)
 
 	var extraFiles []*os.File
 	fdnum := 3 // first additional file starts at position 3
@@ -361,6 +392,10 @@ func CreateQEMUCommand(board, uuid, biosImage, consolePath, confPath, diskImageP
 // The virtio device name differs between machine types but otherwise
 // configuration is the same. Use this to help construct device args.
 func Virtio(board, device, args string) string {
+	return fmt.Sprintf("%s,%s", virtioDriver(board, device), args)
+}
+
+func virtioDriver(board, device string) string {
 	var suffix string
 	switch board {
 	case "amd64-usr":
@@ -370,5 +405,5 @@ func Virtio(board, device, args string) string {
 	default:
 		panic(board)
 	}
-	return fmt.Sprintf("virtio-%s-%s,%s", device, suffix, args)
+	return fmt.Sprintf("virtio-%s-%s", device, suffix)
 }
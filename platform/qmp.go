@@ -0,0 +1,437 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// QEMUPrimaryNIC is the QEMU device ID of the network card every
+	// QEMU machine is created with. It can be passed to QMPClient.SetLink.
+	QEMUPrimaryNIC = "net0"
+
+	qmpTimeout = 30 * time.Second
+)
+
+// QMPError is an error returned by QEMU in reply to a QMP command.
+type QMPError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *QMPError) Error() string {
+	return fmt.Sprintf("qmp: %s: %s", e.Class, e.Desc)
+}
+
+// QMPEvent is an asynchronous event emitted by QEMU, e.g. SHUTDOWN or
+// DEVICE_DELETED.
+type QMPEvent struct {
+	Event     string                 `json:"event"`
+	Data      map[string]interface{} `json:"data"`
+	Timestamp struct {
+		Seconds      int64 `json:"seconds"`
+		Microseconds int64 `json:"microseconds"`
+	} `json:"timestamp"`
+}
+
+// QMPBlockStats holds the I/O statistics of a single block device as
+// reported by query-blockstats.
+type QMPBlockStats struct {
+	Device   string `json:"device"`
+	NodeName string `json:"node-name"`
+	QDev     string `json:"qdev"`
+	Stats    struct {
+		ReadBytes       uint64 `json:"rd_bytes"`
+		WriteBytes      uint64 `json:"wr_bytes"`
+		ReadOperations  uint64 `json:"rd_operations"`
+		WriteOperations uint64 `json:"wr_operations"`
+		FlushOperations uint64 `json:"flush_operations"`
+		FailedReads     uint64 `json:"failed_rd_operations"`
+		FailedWrites    uint64 `json:"failed_wr_operations"`
+	} `json:"stats"`
+}
+
+// DeviceID returns the ID of the guest device the block device is
+// attached to, taken from its QOM path (e.g. "hotplug0" for
+// "/machine/peripheral/hotplug0/virtio-backend"), or "" if it has none.
+func (s QMPBlockStats) DeviceID() string {
+	const prefix = "/machine/peripheral/"
+	if !strings.HasPrefix(s.QDev, prefix) {
+		return ""
+	}
+	return strings.SplitN(strings.TrimPrefix(s.QDev, prefix), "/", 2)[0]
+}
+
+type qmpMessage struct {
+	QMP    json.RawMessage `json:"QMP"`
+	Return json.RawMessage `json:"return"`
+	Error  *QMPError       `json:"error"`
+	QMPEvent
+}
+
+// QMPClient talks the QEMU Machine Protocol over the control socket of a
+// QEMU machine. QEMU only serves a single client per socket, so machines
+// hand out a shared client; it is safe for concurrent use.
+type QMPClient struct {
+	mu     sync.Mutex
+	conn   *net.UnixConn
+	reader *bufio.Reader
+	events []QMPEvent
+}
+
+// NewQMPClient connects to the QMP socket at path and negotiates the
+// protocol capabilities.
+func NewQMPClient(path string) (*QMPClient, error) {
+	conn, err := net.DialTimeout("unix", path, qmpTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to QMP socket %s: %v", path, err)
+	}
+
+	q := &QMPClient{
+		conn:   conn.(*net.UnixConn),
+		reader: bufio.NewReader(conn),
+	}
+
+	// QEMU greets every new client before accepting commands.
+	q.conn.SetDeadline(time.Now().Add(qmpTimeout))
+	greeting, err := q.read()
+	if err != nil {
+		q.conn.Close()
+		return nil, fmt.Errorf("reading QMP greeting: %v", err)
+	}
+	if greeting.QMP == nil {
+		q.conn.Close()
+		return nil, fmt.Errorf("unexpected QMP greeting")
+	}
+
+	if err := q.Execute("qmp_capabilities", nil, nil); err != nil {
+		q.conn.Close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Close closes the connection to QEMU.
+func (q *QMPClient) Close() error {
+	return q.conn.Close()
+}
+
+func (q *QMPClient) read() (*qmpMessage, error) {
+	line, err := q.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	var msg qmpMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return nil, fmt.Errorf("decoding QMP message %q: %v", line, err)
+	}
+	return &msg, nil
+}
+
+// Execute runs command with the given arguments and decodes the reply into
+// result if it is non-nil. Events received while waiting for the reply
+// are queued for Events and WaitEvent.
+func (q *QMPClient) Execute(command string, args interface{}, result interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.execute(command, args, result, nil)
+}
+
+func (q *QMPClient) execute(command string, args interface{}, result interface{}, oob []byte) error {
+	req := struct {
+		Execute   string      `json:"execute"`
+		Arguments interface{} `json:"arguments,omitempty"`
+	}{command, args}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	q.conn.SetDeadline(time.Now().Add(qmpTimeout))
+	if _, _, err := q.conn.WriteMsgUnix(b, oob, nil); err != nil {
+		return fmt.Errorf("sending QMP command %s: %v", command, err)
+	}
+
+	for {
+		msg, err := q.read()
+		if err != nil {
+			return fmt.Errorf("reading QMP reply to %s: %v", command, err)
+		}
+		switch {
+		case msg.Event != "":
+			q.events = append(q.events, msg.QMPEvent)
+		case msg.Error != nil:
+			return msg.Error
+		case msg.Return != nil:
+			if result == nil {
+				return nil
+			}
+			if err := json.Unmarshal(msg.Return, result); err != nil {
+				return fmt.Errorf("decoding QMP reply to %s: %v", command, err)
+			}
+			return nil
+		}
+	}
+}
+
+// Events returns and forgets all events received so far.
+func (q *QMPClient) Events() []QMPEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	events := q.events
+	q.events = nil
+	return events
+}
+
+// WaitEvent waits up to timeout for an event called name and returns it.
+// Other events received in the meantime are kept for Events.
+func (q *QMPClient) WaitEvent(name string, timeout time.Duration) (*QMPEvent, error) {
+	return q.waitEvent(timeout, func(ev *QMPEvent) bool {
+		return ev.Event == name
+	})
+}
+
+func (q *QMPClient) waitEvent(timeout time.Duration, match func(*QMPEvent) bool) (*QMPEvent, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, ev := range q.events {
+		if match(&ev) {
+			q.events = append(q.events[:i], q.events[i+1:]...)
+			return &ev, nil
+		}
+	}
+
+	q.conn.SetDeadline(time.Now().Add(timeout))
+	for {
+		msg, err := q.read()
+		if err != nil {
+			return nil, fmt.Errorf("waiting for QMP event: %v", err)
+		}
+		if msg.Event == "" {
+			continue
+		}
+		if match(&msg.QMPEvent) {
+			return &msg.QMPEvent, nil
+		}
+		q.events = append(q.events, msg.QMPEvent)
+	}
+}
+
+// Stop pauses the virtual CPUs.
+func (q *QMPClient) Stop() error {
+	return q.Execute("stop", nil, nil)
+}
+
+// Cont resumes the virtual CPUs after Stop.
+func (q *QMPClient) Cont() error {
+	return q.Execute("cont", nil, nil)
+}
+
+// Status returns the run state of the machine, e.g. "running" or "paused".
+func (q *QMPClient) Status() (string, error) {
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := q.Execute("query-status", nil, &status); err != nil {
+		return "", err
+	}
+	return status.Status, nil
+}
+
+// InjectNMI injects a non-maskable interrupt into the guest.
+func (q *QMPClient) InjectNMI() error {
+	return q.Execute("inject-nmi", nil, nil)
+}
+
+// SystemPowerdown presses the ACPI power button.
+func (q *QMPClient) SystemPowerdown() error {
+	return q.Execute("system_powerdown", nil, nil)
+}
+
+// SystemReset resets the machine as if the reset button was pressed.
+func (q *QMPClient) SystemReset() error {
+	return q.Execute("system_reset", nil, nil)
+}
+
+// QueryBlockStats returns the I/O statistics of all block devices.
+func (q *QMPClient) QueryBlockStats() ([]QMPBlockStats, error) {
+	var stats []QMPBlockStats
+	if err := q.Execute("query-blockstats", nil, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// SetLink sets the link state of the network device name, e.g.
+// QEMUPrimaryNIC.
+func (q *QMPClient) SetLink(name string, up bool) error {
+	return q.Execute("set_link", map[string]interface{}{
+		"name": name,
+		"up":   up,
+	}, nil)
+}
+
+// DeviceAdd hotplugs a device. props must contain at least "driver".
+func (q *QMPClient) DeviceAdd(props map[string]interface{}) error {
+	return q.Execute("device_add", props, nil)
+}
+
+// DeviceDel requests removal of the device with the given ID and waits for
+// the guest to release it.
+func (q *QMPClient) DeviceDel(id string) error {
+	if err := q.Execute("device_del", map[string]interface{}{"id": id}, nil); err != nil {
+		return err
+	}
+	_, err := q.waitEvent(qmpTimeout, func(ev *QMPEvent) bool {
+		return ev.Event == "DEVICE_DELETED" && ev.Data["device"] == id
+	})
+	return err
+}
+
+// BlockdevAdd adds a block device backend. opts must contain at least
+// "driver" and "node-name".
+func (q *QMPClient) BlockdevAdd(opts map[string]interface{}) error {
+	return q.Execute("blockdev-add", opts, nil)
+}
+
+// BlockdevDel removes the block device backend nodeName.
+func (q *QMPClient) BlockdevDel(nodeName string) error {
+	return q.Execute("blockdev-del", map[string]interface{}{"node-name": nodeName}, nil)
+}
+
+// NetdevAdd adds a network backend. props must contain at least "type"
+// and "id".
+func (q *QMPClient) NetdevAdd(props map[string]interface{}) error {
+	return q.Execute("netdev_add", props, nil)
+}
+
+// NetdevDel removes the network backend id.
+func (q *QMPClient) NetdevDel(id string) error {
+	return q.Execute("netdev_del", map[string]interface{}{"id": id}, nil)
+}
+
+// GetFD passes f to QEMU, which makes it available to other commands
+// under name.
+func (q *QMPClient) GetFD(name string, f *os.File) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	rights := syscall.UnixRights(int(f.Fd()))
+	return q.execute("getfd", map[string]interface{}{"fdname": name}, nil, rights)
+}
+
+// HotplugDisk creates a disk like MachineOptions.AdditionalDisks does and
+// attaches it to the running machine under id.
+func (q *QMPClient) HotplugDisk(board, id string, disk Disk) error {
+	// Validate the device options before anything is added, so a bad
+	// option doesn't leave a dangling block device behind.
+	props := map[string]interface{}{
+		"driver": virtioDriver(board, "blk"),
+		"drive":  id,
+		"id":     id,
+	}
+	for _, opt := range disk.DeviceOpts {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid device option %q", opt)
+		}
+		props[kv[0]] = kv[1]
+	}
+
+	f, err := disk.setupFile()
+	if err != nil {
+		return err
+	}
+	// QEMU opens its own descriptor; the file is already unlinked.
+	defer f.Close()
+
+	err = q.BlockdevAdd(map[string]interface{}{
+		"driver":    "qcow2",
+		"node-name": id,
+		"file": map[string]interface{}{
+			"driver":   "file",
+			"filename": fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), f.Fd()),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("adding block device %s: %v", id, err)
+	}
+
+	if err := q.DeviceAdd(props); err != nil {
+		q.BlockdevDel(id)
+		return fmt.Errorf("adding disk device %s: %v", id, err)
+	}
+	return nil
+}
+
+// UnplugDisk detaches a disk added with HotplugDisk.
+func (q *QMPClient) UnplugDisk(id string) error {
+	if err := q.DeviceDel(id); err != nil {
+		return err
+	}
+	return q.BlockdevDel(id)
+}
+
+// HotplugNIC attaches a network card with device ID id to the running
+// machine. netdev describes the backend and must contain at least "type";
+// the backend gets id as its "id" too, netdev itself is not modified.
+// mac may be empty to let QEMU pick one.
+func (q *QMPClient) HotplugNIC(board, id string, netdev map[string]interface{}, mac string) error {
+	args := map[string]interface{}{"id": id}
+	for k, v := range netdev {
+		if k != "id" {
+			args[k] = v
+		}
+	}
+	if err := q.NetdevAdd(args); err != nil {
+		return fmt.Errorf("adding network backend %s: %v", id, err)
+	}
+
+	props := map[string]interface{}{
+		"driver": virtioDriver(board, "net"),
+		"netdev": id,
+		"id":     id,
+	}
+	if mac != "" {
+		props["mac"] = mac
+	}
+	if err := q.DeviceAdd(props); err != nil {
+		q.NetdevDel(id)
+		return fmt.Errorf("adding network device %s: %v", id, err)
+	}
+	return nil
+}
+
+// UnplugNIC detaches a network card added with HotplugNIC.
+func (q *QMPClient) UnplugNIC(id string) error {
+	if err := q.DeviceDel(id); err != nil {
+		return err
+	}
+	return q.NetdevDel(id)
+}
@@ -0,0 +1,179 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeQMP serves a QMP socket that answers each command with the reply
+// registered for it, preceded by any events registered for it.
+func fakeQMP(t *testing.T, replies map[string]string, events map[string][]string) string {
+	dir, err := ioutil.TempDir("", "qmp-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "qmp.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprintln(conn, `{"QMP": {"version": {}, "capabilities": []}}`)
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var req struct {
+				Execute string `json:"execute"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+				return
+			}
+			for _, ev := range events[req.Execute] {
+				fmt.Fprintln(conn, ev)
+			}
+			reply, ok := replies[req.Execute]
+			if !ok {
+				reply = `{"return": {}}`
+			}
+			fmt.Fprintln(conn, reply)
+		}
+	}()
+
+	return path
+}
+
+func TestQMPExecute(t *testing.T) {
+	path := fakeQMP(t, map[string]string{
+		"query-status":     `{"return": {"status": "paused", "running": false}}`,
+		"query-blockstats": `{"return": [{"device": "", "qdev": "/machine/peripheral-anon/device[1]/virtio-backend", "stats": {"rd_bytes": 512, "wr_operations": 3}}]}`,
+		"inject-nmi":       `{"error": {"class": "GenericError", "desc": "not supported"}}`,
+	}, nil)
+
+	q, err := NewQMPClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if err := q.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	status, err := q.Status()
+	if err != nil {
+		t.Fatalf("query-status: %v", err)
+	}
+	if status != "paused" {
+		t.Errorf("expected status paused, got %q", status)
+	}
+
+	stats, err := q.QueryBlockStats()
+	if err != nil {
+		t.Fatalf("query-blockstats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].Stats.ReadBytes != 512 || stats[0].Stats.WriteOperations != 3 {
+		t.Errorf("unexpected block stats %+v", stats)
+	}
+
+	err = q.InjectNMI()
+	if qerr, ok := err.(*QMPError); !ok || qerr.Class != "GenericError" {
+		t.Errorf("expected GenericError, got %v", err)
+	}
+}
+
+func TestQMPEvents(t *testing.T) {
+	path := fakeQMP(t, nil, map[string][]string{
+		"system_powerdown": {`{"event": "POWERDOWN", "data": {}, "timestamp": {"seconds": 1, "microseconds": 2}}`},
+		"device_del": {
+			`{"event": "DEVICE_DELETED", "data": {"device": "other"}, "timestamp": {"seconds": 3, "microseconds": 0}}`,
+			`{"event": "DEVICE_DELETED", "data": {"device": "disk1"}, "timestamp": {"seconds": 4, "microseconds": 0}}`,
+		},
+	})
+
+	q, err := NewQMPClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if err := q.SystemPowerdown(); err != nil {
+		t.Fatalf("system_powerdown: %v", err)
+	}
+	ev, err := q.WaitEvent("POWERDOWN", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Timestamp.Seconds != 1 || ev.Timestamp.Microseconds != 2 {
+		t.Errorf("unexpected timestamp %+v", ev.Timestamp)
+	}
+
+	if err := q.DeviceDel("disk1"); err != nil {
+		t.Fatalf("device_del: %v", err)
+	}
+	events := q.Events()
+	if len(events) != 1 || events[0].Data["device"] != "other" {
+		t.Errorf("unexpected remaining events %+v", events)
+	}
+	if len(q.Events()) != 0 {
+		t.Errorf("Events did not clear the queue")
+	}
+}
+
+func TestQMPBlockStatsDeviceID(t *testing.T) {
+	for qdev, id := range map[string]string{
+		"/machine/peripheral/hotplug0/virtio-backend":       "hotplug0",
+		"/machine/peripheral/disk1":                         "disk1",
+		"/machine/peripheral-anon/device[1]/virtio-backend": "",
+		"": "",
+	} {
+		if got := (QMPBlockStats{QDev: qdev}).DeviceID(); got != id {
+			t.Errorf("DeviceID of %q: expected %q, got %q", qdev, id, got)
+		}
+	}
+}
+
+func TestQMPHotplugNIC(t *testing.T) {
+	q, err := NewQMPClient(fakeQMP(t, nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	netdev := map[string]interface{}{"type": "user"}
+	if err := q.HotplugNIC("amd64-usr", "nic1", netdev, ""); err != nil {
+		t.Fatalf("hotplugging NIC: %v", err)
+	}
+	if _, ok := netdev["id"]; ok || len(netdev) != 1 {
+		t.Errorf("HotplugNIC modified netdev: %v", netdev)
+	}
+}
@@ -0,0 +1,486 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/flatcar-linux/mantle/system"
+)
+
+// Cache is a content-addressed store for SDK tarballs and images shared
+// by all repo checkouts of a user. Downloads are stored once under their
+// SHA256 digest and indexed by URL:
+//
+//	blobs/sha256/<digest>      content
+//	blobs/sha256/<digest>.sig  detached signature of signed entries
+//	index/<key>.json           CacheEntry for a URL
+//	tmp/                       partial downloads
+//
+// Fetches for the same URL are serialized with a lock per URL and
+// pruning excludes all fetches, so several processes can share a cache.
+type Cache struct {
+	Dir string
+}
+
+// CacheEntry describes a URL stored in the cache.
+type CacheEntry struct {
+	URL      string    `json:"url"`
+	Digest   string    `json:"digest"`
+	Size     int64     `json:"size"`
+	Signed   bool      `json:"signed"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+
+	// ETag and LastModified are the validators the server sent for
+	// unsigned content, used to check it for changes.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+
+	// Path is the location of the content in the cache.
+	Path string `json:"-"`
+}
+
+// DefaultCacheDir returns $XDG_CACHE_HOME/mantle, defaulting to
+// ~/.cache/mantle.
+func DefaultCacheDir() string {
+	if dir := envDir("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "mantle")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "mantle-cache")
+	}
+	return filepath.Join(home, ".cache", "mantle")
+}
+
+// DefaultCache returns the cache in DefaultCacheDir.
+func DefaultCache() *Cache {
+	return &Cache{Dir: DefaultCacheDir()}
+}
+
+func (c *Cache) blobPath(digest string) string {
+	return filepath.Join(c.Dir, "blobs", "sha256", digest)
+}
+
+func (c *Cache) key(url string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(url)))
+}
+
+func (c *Cache) entryPath(url string) string {
+	return filepath.Join(c.Dir, "index", c.key(url)+".json")
+}
+
+// lock takes a flock on path, creating it if needed. how is
+// syscall.LOCK_SH or syscall.LOCK_EX. Closing the file releases the lock.
+func lock(path string, how int) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("locking %s: %v", path, err)
+	}
+	return f, nil
+}
+
+// lockURL takes the shared cache lock and the lock for url.
+func (c *Cache) lockURL(url string) (func(), error) {
+	for _, dir := range []string{"blobs/sha256", "index", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(c.Dir, dir), 0777); err != nil {
+			return nil, err
+		}
+	}
+	global, err := lock(filepath.Join(c.Dir, "lock"), syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := lock(filepath.Join(c.Dir, "index", c.key(url)+".lock"), syscall.LOCK_EX)
+	if err != nil {
+		global.Close()
+		return nil, err
+	}
+	return func() {
+		entry.Close()
+		global.Close()
+	}, nil
+}
+
+func (c *Cache) readEntry(path string) (*CacheEntry, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e CacheEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	e.Path = c.blobPath(e.Digest)
+	return &e, nil
+}
+
+func (c *Cache) writeEntry(e *CacheEntry) error {
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := c.entryPath(e.URL)
+	if err := ioutil.WriteFile(path+".tmp", b, 0666); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// lookup returns the entry for url if its content is present.
+func (c *Cache) lookup(url string) *CacheEntry {
+	e, err := c.readEntry(c.entryPath(url))
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(e.Path); err != nil {
+		return nil
+	}
+	return e
+}
+
+// touch records a use of e.
+func (c *Cache) touch(e *CacheEntry) (*CacheEntry, error) {
+	e.LastUsed = time.Now().UTC()
+	return e, c.writeEntry(e)
+}
+
+// insert moves a downloaded file into the cache under its digest and
+// records it as the content of url.
+func (c *Cache) insert(url, file string, sig []byte) (*CacheEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	e := &CacheEntry{
+		URL:      url,
+		Digest:   fmt.Sprintf("%x", h.Sum(nil)),
+		Size:     size,
+		Signed:   sig != nil,
+		Created:  now,
+		LastUsed: now,
+	}
+	e.Path = c.blobPath(e.Digest)
+
+	if sig != nil {
+		if err := ioutil.WriteFile(e.Path+".sig", sig, 0666); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Rename(file, e.Path); err != nil {
+		return nil, err
+	}
+	return e, c.writeEntry(e)
+}
+
+// validators holds the headers by which a server tells whether content
+// changed.
+type validators struct {
+	etag         string
+	lastModified string
+}
+
+// check sends a conditional HEAD request for url and reports whether the
+// content is still the one of e, along with the current validators.
+// Servers which send no validators are never assumed unchanged.
+func check(url string, client *http.Client, e *CacheEntry) (bool, validators, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return false, validators{}, err
+	}
+	if e != nil && e.ETag != "" {
+		req.Header.Set("If-None-Match", e.ETag)
+	}
+	if e != nil && e.LastModified != "" {
+		req.Header.Set("If-Modified-Since", e.LastModified)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, validators{}, err
+	}
+	resp.Body.Close()
+
+	v := validators{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return e != nil && (e.ETag != "" || e.LastModified != ""), v, nil
+	case http.StatusOK:
+		return false, v, nil
+	default:
+		return false, validators{}, fmt.Errorf("%s: %s", resp.Status, url)
+	}
+}
+
+// Fetch returns the cache entry for url, downloading it unless the cache
+// already has the same content. Unsigned content is checked for changes
+// with a conditional request if the server supports it, and otherwise
+// downloaded again, but only stored once.
+func (c *Cache) Fetch(url string, client *http.Client) (*CacheEntry, error) {
+	unlock, err := c.lockURL(url)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cached := c.lookup(url)
+	if cached != nil && cached.Signed {
+		cached = nil
+	}
+	unchanged, v, err := check(url, client, cached)
+	if err != nil {
+		// the download reports real problems
+		plog.Debugf("checking %s: %v", url, err)
+	}
+	if unchanged {
+		plog.Infof("%s is up to date in cache", url)
+		return c.touch(cached)
+	}
+
+	tmp := filepath.Join(c.Dir, "tmp", c.key(url))
+	if err := DownloadFile(tmp, url, client); err != nil {
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	defer os.Remove(tmp)
+
+	e := cached
+	if e != nil {
+		if equal, err := cmpFileBytes(e.Path, tmp); err != nil || !equal {
+			e = nil
+		} else {
+			plog.Infof("%s is up to date in cache", url)
+		}
+	}
+	if e == nil {
+		if e, err = c.insert(url, tmp, nil); err != nil {
+			return nil, err
+		}
+	}
+	e.ETag, e.LastModified = v.etag, v.lastModified
+	return c.touch(e)
+}
+
+// FetchSigned returns the cache entry for url, which is verified with
+// the detached signature at url.sig. Only the signature is downloaded if
+// the cache already has content verified with the same signature.
+func (c *Cache) FetchSigned(url string, client *http.Client, verifyKeyFile string) (*CacheEntry, error) {
+	unlock, err := c.lockURL(url)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	tmp := filepath.Join(c.Dir, "tmp", c.key(url))
+	if err := os.Remove(tmp + ".sig"); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := DownloadFile(tmp+".sig", url+".sig", client); err != nil {
+		return nil, fmt.Errorf("%s: %v", url+".sig", err)
+	}
+	defer os.Remove(tmp + ".sig")
+	sig, err := ioutil.ReadFile(tmp + ".sig")
+	if err != nil {
+		return nil, err
+	}
+
+	if e := c.lookup(url); e != nil && e.Signed {
+		if cached, err := ioutil.ReadFile(e.Path + ".sig"); err == nil && bytes.Equal(cached, sig) {
+			plog.Infof("Verified cached file: %s", url)
+			return c.touch(e)
+		}
+	}
+
+	if err := DownloadFile(tmp, url, client); err != nil {
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	if err := VerifyFile(tmp, verifyKeyFile); err != nil {
+		// do not resume from a bad download next time
+		os.Remove(tmp)
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	plog.Infof("Verified file: %s", url)
+	return c.insert(url, tmp, sig)
+}
+
+// cloneFile makes dst a reflink of src where the filesystem supports it,
+// sharing the data until either is written, and a copy otherwise. dst
+// gets the modification time of src, and is left alone if its size and
+// modification time already match, so that a file which was not written
+// since the last clone is not copied again.
+func cloneFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if old, err := os.Stat(dst); err == nil && old.Mode().IsRegular() &&
+		old.Size() == info.Size() && old.ModTime().Equal(info.ModTime()) {
+		return nil
+	}
+
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlFileClone(int(out.Fd()), int(in.Fd()))
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	} else {
+		err = system.CopyRegularFile(src, dst)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// Link makes the content of e, and its signature if signed, available at
+// dst. The content is reflinked or copied rather than hard linked, so
+// writes to dst never reach the cache. A dst left unchanged since an
+// earlier Link of the same content is kept as it is.
+func (c *Cache) Link(e *CacheEntry, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return err
+	}
+	if err := cloneFile(e.Path, dst); err != nil {
+		return err
+	}
+	if e.Signed {
+		return cloneFile(e.Path+".sig", dst+".sig")
+	}
+	return nil
+}
+
+// List returns all entries in the cache, sorted by URL.
+func (c *Cache) List() ([]*CacheEntry, error) {
+	paths, err := filepath.Glob(filepath.Join(c.Dir, "index", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var entries []*CacheEntry
+	for _, path := range paths {
+		e, err := c.readEntry(path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	return entries, nil
+}
+
+// Prune removes the entries for which remove returns true, along with
+// content no longer referenced by any entry, and returns the removed
+// entries. Nothing is removed if dryRun is set.
+func (c *Cache) Prune(remove func(*CacheEntry) bool, dryRun bool) ([]*CacheEntry, error) {
+	if _, err := os.Stat(c.Dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	global, err := lock(filepath.Join(c.Dir, "lock"), syscall.LOCK_EX)
+	if err != nil {
+		return nil, err
+	}
+	defer global.Close()
+
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []*CacheEntry
+	used := make(map[string]bool)
+	for _, e := range entries {
+		if !remove(e) {
+			used[e.Digest] = true
+			continue
+		}
+		removed = append(removed, e)
+		if dryRun {
+			continue
+		}
+		path := c.entryPath(e.URL)
+		for _, p := range []string{path, strings.TrimSuffix(path, ".json") + ".lock"} {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+	if dryRun {
+		return removed, nil
+	}
+
+	blobs, err := filepath.Glob(filepath.Join(c.Dir, "blobs", "sha256", "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, blob := range blobs {
+		if used[strings.TrimSuffix(filepath.Base(blob), ".sig")] {
+			continue
+		}
+		if err := os.Remove(blob); err != nil {
+			return nil, err
+		}
+	}
+
+	tmp, err := filepath.Glob(filepath.Join(c.Dir, "tmp", "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tmp {
+		if err := os.Remove(t); err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
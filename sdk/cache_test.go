@@ -0,0 +1,237 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// testServer serves files with an ETag and counts their downloads.
+type testServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	files    map[string][]byte
+	requests map[string]int
+}
+
+func newTestServer() *testServer {
+	s := &testServer{
+		files:    make(map[string][]byte),
+		requests: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		data, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256(data)))
+		if r.Method == "GET" && r.Header.Get("If-None-Match") == "" {
+			s.requests[r.URL.Path]++
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	return s
+}
+
+func (s *testServer) set(path string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path] = data
+}
+
+func (s *testServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sdk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestCacheFetch(t *testing.T) {
+	s := newTestServer()
+	defer s.Close()
+	s.set("/a", []byte("same"))
+	s.set("/b", []byte("same"))
+
+	cache := &Cache{Dir: tempDir(t)}
+	a, err := cache.Fetch(s.URL+"/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cache.Fetch(s.URL+"/b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Digest != b.Digest || a.Path != b.Path {
+		t.Errorf("identical content stored twice: %+v %+v", a, b)
+	}
+
+	if _, err := cache.Fetch(s.URL+"/a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.count("/a"); n != 1 {
+		t.Errorf("expected 1 download of unchanged content, got %d", n)
+	}
+
+	s.set("/a", []byte("changed"))
+	a2, err := cache.Fetch(s.URL+"/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a2.Digest == a.Digest {
+		t.Errorf("changed content not updated")
+	}
+
+	entries, err := cache.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	dst := filepath.Join(tempDir(t), "out", "a")
+	if err := cache.Link(a2, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(dst); err != nil || string(data) != "changed" {
+		t.Errorf("unexpected linked content %q: %v", data, err)
+	}
+	linked, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Link(a2, dst); err != nil {
+		t.Fatal(err)
+	}
+	if relinked, err := os.Stat(dst); err != nil || !os.SameFile(linked, relinked) {
+		t.Errorf("unchanged linked file copied again: %v", err)
+	}
+	if err := ioutil.WriteFile(dst, []byte("overwritten"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(a2.Path); err != nil || string(data) != "changed" {
+		t.Errorf("writing linked file changed the cache: %q: %v", data, err)
+	}
+	if err := cache.Link(a2, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(dst); err != nil || string(data) != "changed" {
+		t.Errorf("written linked file not restored: %q: %v", data, err)
+	}
+
+	removed, err := cache.Prune(func(e *CacheEntry) bool { return e.URL == s.URL+"/b" }, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 {
+		t.Fatalf("expected 1 removed entry, got %d", len(removed))
+	}
+	if _, err := os.Stat(b.Path); !os.IsNotExist(err) {
+		t.Errorf("unreferenced content not removed: %v", err)
+	}
+	if _, err := os.Stat(a2.Path); err != nil {
+		t.Errorf("referenced content removed: %v", err)
+	}
+}
+
+func TestCacheFetchSigned(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var key bytes.Buffer
+	w, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	keyFile := filepath.Join(tempDir(t), "key.asc")
+	if err := ioutil.WriteFile(keyFile, key.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(data []byte) []byte {
+		var sig bytes.Buffer
+		if err := openpgp.DetachSign(&sig, entity, bytes.NewReader(data), nil); err != nil {
+			t.Fatal(err)
+		}
+		return sig.Bytes()
+	}
+
+	s := newTestServer()
+	defer s.Close()
+	data := []byte("sdk tarball")
+	s.set("/sdk.tar.bz2", data)
+	s.set("/sdk.tar.bz2.sig", sign(data))
+
+	cache := &Cache{Dir: tempDir(t)}
+	for i := 0; i < 2; i++ {
+		e, err := cache.FetchSigned(s.URL+"/sdk.tar.bz2", nil, keyFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !e.Signed {
+			t.Errorf("entry not signed")
+		}
+	}
+	if n := s.count("/sdk.tar.bz2"); n != 1 {
+		t.Errorf("expected 1 download of the tarball, got %d", n)
+	}
+
+	dst := filepath.Join(tempDir(t), "sdk.tar.bz2")
+	e, err := cache.FetchSigned(s.URL+"/sdk.tar.bz2", nil, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Link(e, dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFile(dst, keyFile); err != nil {
+		t.Errorf("linked file does not verify: %v", err)
+	}
+
+	s.set("/sdk.tar.bz2", []byte("tampered"))
+	s.set("/sdk.tar.bz2.sig", sign([]byte("other")))
+	if _, err := cache.FetchSigned(s.URL+"/sdk.tar.bz2", nil, keyFile); err == nil {
+		t.Errorf("expected verification error")
+	}
+}
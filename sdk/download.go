@@ -192,6 +192,8 @@ func DownloadSignedFile(file, url string, client *http.Client, verifyKeyFile str
 	return nil
 }
 
+// DownloadSDK fetches the SDK tarball through the shared download cache
+// and links it into the repo's cache directory.
 func DownloadSDK(urlHost, urlPath, version, verifyKeyFile, JSONKeyFile string) error {
 	tarFile := filepath.Join(RepoCache(), "sdks", TarballName(version))
 	tarURL := TarballURL(urlHost, urlPath, version)
@@ -204,9 +206,16 @@ func DownloadSDK(urlHost, urlPath, version, verifyKeyFile, JSONKeyFile string) e
 		}
 
 		client, err = auth.GoogleClientFromJSONKey(b, "https://www.googleapis.com/auth/devstorage.read_only")
+		if err != nil {
+			return err
+		}
 	}
 
-	return DownloadSignedFile(tarFile, tarURL, client, verifyKeyFile)
+	entry, err := DefaultCache().FetchSigned(tarURL, client, verifyKeyFile)
+	if err != nil {
+		return err
+	}
+	return DefaultCache().Link(entry, tarFile)
 }
 
 // false if both files do not exist
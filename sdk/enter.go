@@ -27,6 +27,7 @@ import (
 
 	"github.com/flatcar-linux/mantle/system"
 	"github.com/flatcar-linux/mantle/system/exec"
+	"github.com/flatcar-linux/mantle/system/ns"
 	"github.com/flatcar-linux/mantle/system/user"
 )
 
@@ -68,6 +69,16 @@ type enter struct {
 	UseHostDNS   bool       `json:",omitempty"`
 	User         *user.User `json:",omitempty"`
 	UserRunDir   string     `json:",omitempty"`
+	Rootless     bool       `json:",omitempty"`
+}
+
+// owner returns the IDs files created for the user should be owned by.
+// In rootless mode the user is root within the user namespace.
+func (e *enter) owner() (int, int) {
+	if e.Rootless {
+		return 0, 0
+	}
+	return e.User.UidNo, e.User.GidNo
 }
 
 type googleCreds struct {
@@ -158,6 +169,29 @@ func (e *enter) MountAPI() error {
 	return nil
 }
 
+// MountAPIRootless bind mounts the host's API filesystems, since a user
+// namespace that does not own a pid namespace may not mount proc or sysfs
+// itself. binfmt_misc is left as it is, `cork setup` needs real root.
+func (e *enter) MountAPIRootless() error {
+	if err := system.RecursiveBind(e.Chroot, e.Chroot); err != nil {
+		return err
+	}
+
+	for _, path := range []string{"/proc", "/sys", "/dev"} {
+		if err := system.RecursiveBind(path, filepath.Join(e.Chroot, path)); err != nil {
+			return err
+		}
+	}
+
+	if err := system.Mount("", filepath.Join(e.Chroot, "run"), "tmpfs", "nosuid,nodev,mode=755"); err != nil {
+		return err
+	}
+	if !system.IsSymlink("/dev/shm") {
+		return system.Mount("", filepath.Join(e.Chroot, "dev/shm"), "tmpfs", "nosuid,nodev")
+	}
+	return nil
+}
+
 // MountAgent bind mounts a SSH or GnuPG agent socket into the chroot
 func (e *enter) MountSSHAgent() error {
 	origPath := os.Getenv("SSH_AUTH_SOCK")
@@ -261,7 +295,8 @@ func (e *enter) CopyGoogleCreds() error {
 	if err != nil {
 		return err
 	}
-	if err := os.Chown(stateDir, e.User.UidNo, e.User.GidNo); err != nil {
+	uid, gid := e.owner()
+	if err := os.Chown(stateDir, uid, gid); err != nil {
 		return err
 	}
 
@@ -277,7 +312,7 @@ func (e *enter) CopyGoogleCreds() error {
 	if err := os.Mkdir(trackerDir, 0700); err != nil {
 		return err
 	}
-	if err := os.Chown(trackerDir, e.User.UidNo, e.User.GidNo); err != nil {
+	if err := os.Chown(trackerDir, uid, gid); err != nil {
 		return err
 	}
 
@@ -302,7 +337,7 @@ func (e *enter) CopyGoogleCreds() error {
 		return err
 	}
 
-	if err := boto.Chown(e.User.UidNo, e.User.GidNo); err != nil {
+	if err := boto.Chown(uid, gid); err != nil {
 		return err
 	}
 
@@ -316,7 +351,7 @@ func (e *enter) CopyGoogleCreds() error {
 		return err
 	}
 
-	if err := os.Chown(jsonPath, e.User.UidNo, e.User.GidNo); err != nil {
+	if err := os.Chown(jsonPath, uid, gid); err != nil {
 		return err
 	}
 
@@ -350,14 +385,23 @@ func enterChrootHelper(args []string) (err error) {
 		return err
 	}
 
-	username := os.Getenv("SUDO_USER")
-	if username == "" {
-		return fmt.Errorf("SUDO_USER environment variable is not set.")
-	}
-	if e.User, err = user.Lookup(username); err != nil {
-		return err
+	if e.Rootless {
+		// Already in new user and mount namespaces, the user was
+		// filled in by enterChroot.
+		if err := ns.WaitUserNs(); err != nil {
+			return err
+		}
+	} else {
+		username := os.Getenv("SUDO_USER")
+		if username == "" {
+			return fmt.Errorf("SUDO_USER environment variable is not set.")
+		}
+		if e.User, err = user.Lookup(username); err != nil {
+			return err
+		}
 	}
 	e.UserRunDir = filepath.Join(e.Chroot, "run", "user", e.User.Uid)
+	uid, gid := e.owner()
 
 	newRepoRoot := filepath.Join(e.Chroot, chrootRepoRoot)
 	if err := os.MkdirAll(newRepoRoot, 0755); err != nil {
@@ -372,8 +416,10 @@ func enterChrootHelper(args []string) (err error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
-	if err := syscall.Unshare(syscall.CLONE_NEWNS); err != nil {
-		return fmt.Errorf("Unsharing mount namespace failed: %v", err)
+	if !e.Rootless {
+		if err := syscall.Unshare(syscall.CLONE_NEWNS); err != nil {
+			return fmt.Errorf("Unsharing mount namespace failed: %v", err)
+		}
 	}
 
 	if err := system.RecursiveSlave("/"); err != nil {
@@ -384,7 +430,11 @@ func enterChrootHelper(args []string) (err error) {
 		return err
 	}
 
-	if err := e.MountAPI(); err != nil {
+	mountAPI := e.MountAPI
+	if e.Rootless {
+		mountAPI = e.MountAPIRootless
+	}
+	if err := mountAPI(); err != nil {
 		return err
 	}
 
@@ -392,7 +442,7 @@ func enterChrootHelper(args []string) (err error) {
 		return err
 	}
 
-	if err = os.Chown(e.UserRunDir, e.User.UidNo, e.User.GidNo); err != nil {
+	if err = os.Chown(e.UserRunDir, uid, gid); err != nil {
 		return err
 	}
 
@@ -424,11 +474,46 @@ func enterChrootHelper(args []string) (err error) {
 		}
 	}
 
+	if e.Rootless {
+		// sudo does not work without real root, run the command
+		// as root of the user namespace instead.
+		cmd := rootlessCommand(e.Cmd)
+		env := append(os.Environ(), "HOME="+filepath.Join("/home", e.User.Username))
+		return syscall.Exec(cmd[0], cmd, env)
+	}
+
 	sudo := "/usr/bin/sudo"
-	sudoArgs := append([]string{sudo, "-u", username}, e.Cmd...)
+	sudoArgs := append([]string{sudo, "-u", e.User.Username}, e.Cmd...)
 	return syscall.Exec(sudo, sudoArgs, os.Environ())
 }
 
+// rootlessCommand turns the sudo arguments used for enter.Cmd into a
+// command line. As with sudo, -i runs the command in a login shell.
+func rootlessCommand(args []string) []string {
+	login := false
+	for len(args) != 0 && strings.HasPrefix(args[0], "-") {
+		opt := args[0]
+		args = args[1:]
+		if opt == "--" {
+			break
+		} else if opt == "-i" {
+			login = true
+		}
+	}
+
+	const shell = "/bin/bash"
+	switch {
+	case login && len(args) == 0:
+		return []string{shell, "-l"}
+	case login:
+		return append([]string{shell, "-l", "-c", `exec "$@"`, shell}, args...)
+	case len(args) == 0:
+		return []string{shell}
+	default:
+		return append([]string{shell, "-c", `exec "$@"`, shell}, args...)
+	}
+}
+
 // Set an environment variable if it isn't already defined.
 func setDefault(environ []string, key, value string) []string {
 	prefix := key + "="
@@ -508,6 +593,10 @@ func enterChroot(e enter) error {
 	}
 	e.Chroot = filepath.Join(e.RepoRoot, e.Chroot)
 
+	if e.Rootless {
+		return enterChrootRootless(e)
+	}
+
 	enterJson, err := json.Marshal(e)
 	if err != nil {
 		return err
@@ -526,9 +615,63 @@ func enterChroot(e enter) error {
 	return sudo.Run()
 }
 
+// enterChrootRootless runs enterChrootHelper in new user and mount
+// namespaces instead of via sudo. The user's subordinate IDs from
+// /etc/subuid and /etc/subgid are mapped so that the SDK can own files
+// as other users; without any only the user itself is mapped, to root.
+func enterChrootRootless(e enter) error {
+	var err error
+	if e.User, err = user.Current(); err != nil {
+		return err
+	}
+	subuids, err := ns.SubIDs("/etc/subuid", e.User.Username, e.User.UidNo)
+	if err != nil {
+		return err
+	}
+	subgids, err := ns.SubIDs("/etc/subgid", e.User.Username, e.User.UidNo)
+	if err != nil {
+		return err
+	}
+	if len(subuids) == 0 || len(subgids) == 0 {
+		plog.Warningf("No subordinate IDs for %s, only mapping the user itself", e.User.Username)
+		subuids, subgids = nil, nil
+	}
+
+	enterJson, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	cmd := enterChrootCmd.Command(string(enterJson))
+	cmd.Env = setDefaultEmail(os.Environ())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := copyUserConfig(e.Chroot); err != nil {
+		return err
+	}
+
+	uids := ns.RootlessMappings(e.User.UidNo, subuids)
+	gids := ns.RootlessMappings(e.User.GidNo, subgids)
+	if err := ns.StartUserNs(cmd, uids, gids); err != nil {
+		return fmt.Errorf("starting user namespace: %v", err)
+	}
+	return cmd.Wait()
+}
+
 // Enter the chroot with a login shell, optionally invoking a command.
 // The command may be prefixed by environment variable assignments.
 func Enter(name string, bindGpgAgent, useHostDNS bool, args ...string) error {
+	return enterWith(name, bindGpgAgent, useHostDNS, false, args...)
+}
+
+// EnterRootless is like Enter but works without root privileges by using
+// user and mount namespaces instead of sudo.
+func EnterRootless(name string, bindGpgAgent, useHostDNS bool, args ...string) error {
+	return enterWith(name, bindGpgAgent, useHostDNS, true, args...)
+}
+
+func enterWith(name string, bindGpgAgent, useHostDNS, rootless bool, args ...string) error {
 	// pass -i to sudo to invoke a login shell
 	cmd := []string{"-i", "--"}
 	if len(args) > 0 {
@@ -541,6 +684,7 @@ func Enter(name string, bindGpgAgent, useHostDNS bool, args ...string) error {
 		Cmd:          cmd,
 		BindGpgAgent: bindGpgAgent,
 		UseHostDNS:   useHostDNS,
+		Rootless:     rootless,
 	}
 	return enterChroot(e)
 }
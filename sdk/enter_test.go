@@ -0,0 +1,36 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdk
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRootlessCommand(t *testing.T) {
+	for _, tt := range []struct {
+		args, cmd []string
+	}{
+		{[]string{"-i", "--"}, []string{"/bin/bash", "-l"}},
+		{[]string{"-i", "--", "env", "--", "ls"},
+			[]string{"/bin/bash", "-l", "-c", `exec "$@"`, "/bin/bash", "env", "--", "ls"}},
+		{[]string{"--", "repo", "sync"},
+			[]string{"/bin/bash", "-c", `exec "$@"`, "/bin/bash", "repo", "sync"}},
+	} {
+		if cmd := rootlessCommand(tt.args); !reflect.DeepEqual(cmd, tt.cmd) {
+			t.Errorf("%q: expected %q, got %q", tt.args, tt.cmd, cmd)
+		}
+	}
+}
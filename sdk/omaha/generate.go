@@ -18,29 +18,17 @@ import (
 	"encoding/xml"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/coreos/go-omaha/omaha"
 	"github.com/coreos/pkg/capnslog"
 
 	"github.com/flatcar-linux/mantle/sdk"
-)
-
-const (
-	privateKey = "/usr/share/update_engine/update-payload-key.key.pem"
-	publicKey  = "/usr/share/update_engine/update-payload-key.pub.pem"
+	"github.com/flatcar-linux/mantle/update/generator"
 )
 
 var plog = capnslog.NewPackageLogger("github.com/flatcar-linux/mantle", "sdk/omaha")
 
-func run(name string, arg ...string) error {
-	cmd := exec.Command(name, arg...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
 func xmlMarshalFile(path string, v interface{}) error {
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
@@ -82,6 +70,35 @@ func checkUpdate(dir, update_xml string) error {
 	return u.Packages[0].Verify(pkgdir)
 }
 
+// generatePayload writes a full update payload for the /usr image and
+// kernel to path, signed with the developer key.
+func generatePayload(image, kernel, path string) error {
+	var g generator.Generator
+	defer g.Destroy()
+
+	usr, err := generator.FullUpdate(image)
+	if err != nil {
+		return fmt.Errorf("generating /usr procedure: %v", err)
+	}
+	if err := g.Partition(usr); err != nil {
+		usr.Close()
+		return err
+	}
+
+	kern, err := generator.FullFileUpdate(kernel)
+	if err != nil {
+		return fmt.Errorf("generating kernel procedure: %v", err)
+	}
+	if err := g.Kernel(kern); err != nil {
+		kern.Close()
+		return err
+	}
+
+	return g.Write(path)
+}
+
+// GenerateFullUpdate writes an update payload and Omaha manifest for the
+// image in dir, unless a valid manifest already exists.
 func GenerateFullUpdate(dir string) error {
 	var (
 		update_prefix = filepath.Join(dir, "flatcar_production_update")
@@ -97,11 +114,7 @@ func GenerateFullUpdate(dir string) error {
 	}
 
 	plog.Noticef("Generating update payload: %s", update_gz)
-	if err := run("delta_generator",
-		"-new_image", update_bin,
-		"-new_kernel", vmlinuz,
-		"-out_file", update_gz,
-		"-private_key", privateKey); err != nil {
+	if err := generatePayload(update_bin, vmlinuz, update_gz); err != nil {
 		return err
 	}
 
@@ -155,7 +155,16 @@ func RepoVerifyTag(branch string) error {
 }
 
 func RepoSync(chroot string, force, verbose, useHostDNS bool) error {
+	return RepoSyncManifest(chroot, "", force, verbose, useHostDNS)
+}
+
+// RepoSyncManifest syncs the repo client like RepoSync but uses the given
+// manifest from .repo/manifests for this sync only, if name is not empty.
+func RepoSyncManifest(chroot, name string, force, verbose, useHostDNS bool) error {
 	args := []string{"--", "repo", "sync", "--no-clone-bundle"}
+	if name != "" {
+		args = append(args, "--manifest-name", name)
+	}
 	if force {
 		args = append(args, "--force-sync")
 	}
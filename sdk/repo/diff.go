@@ -0,0 +1,319 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/flatcar-linux/mantle/system/exec"
+)
+
+// LoadManifest reads the manifest file at path and resolves it the way
+// repo does: include elements are loaded relative to the manifest's
+// directory, extend-project and remove-project elements are applied, and
+// each project's path, remote and revision are filled in from the remote
+// and default elements. The result has no includes, extend-project or
+// remove-project elements left.
+func LoadManifest(path string) (*Manifest, error) {
+	var m Manifest
+	if err := loadManifest(&m, path, map[string]bool{}); err != nil {
+		return nil, err
+	}
+
+	remotes := make(map[string]Remote)
+	for _, r := range m.Remotes {
+		remotes[r.Name] = r
+	}
+	var def Default
+	if m.Default != nil {
+		def = *m.Default
+	}
+
+	paths := make(map[string]string)
+	for i := range m.Projects {
+		p := &m.Projects[i]
+		if p.Name == "" {
+			return nil, fmt.Errorf("%s: project missing name", path)
+		}
+		if len(p.SubProjects) != 0 {
+			return nil, fmt.Errorf("%s: project %s: sub-projects are not supported", path, p.Name)
+		}
+		if p.Path == "" {
+			p.Path = p.Name
+		}
+		if p.Remote == "" {
+			p.Remote = def.Remote
+		}
+		if p.Revision == "" {
+			p.Revision = remotes[p.Remote].Revision
+		}
+		if p.Revision == "" {
+			p.Revision = def.Revision
+		}
+		if other, ok := paths[p.Path]; ok {
+			return nil, fmt.Errorf("%s: projects %s and %s share path %s", path, other, p.Name, p.Path)
+		}
+		paths[p.Path] = p.Name
+	}
+
+	return &m, nil
+}
+
+// loadManifest merges the manifest at path into m. Includes are expanded
+// first, then remove-project elements are applied to the projects defined
+// so far, so the manifest itself may define a replacement.
+func loadManifest(m *Manifest, path string, seen map[string]bool) error {
+	if seen[path] {
+		return fmt.Errorf("%s: include loop", path)
+	}
+	seen[path] = true
+	defer delete(seen, path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var cur Manifest
+	if err := xml.NewDecoder(f).Decode(&cur); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	for _, inc := range cur.Includes {
+		if err := loadManifest(m, filepath.Join(filepath.Dir(path), inc.Name), seen); err != nil {
+			return err
+		}
+	}
+
+	if cur.Notice != "" {
+		m.Notice = cur.Notice
+	}
+	m.Remotes = append(m.Remotes, cur.Remotes...)
+	if cur.Default != nil {
+		if m.Default != nil {
+			return fmt.Errorf("%s: duplicate default element", path)
+		}
+		m.Default = cur.Default
+	}
+	if cur.ManifestServer != nil {
+		m.ManifestServer = cur.ManifestServer
+	}
+
+	for _, rm := range cur.RemoveProjects {
+		projects := m.Projects[:0]
+		for _, p := range m.Projects {
+			if p.Name != rm.Name {
+				projects = append(projects, p)
+			}
+		}
+		if len(projects) == len(m.Projects) {
+			return fmt.Errorf("%s: remove-project: no project %s", path, rm.Name)
+		}
+		m.Projects = projects
+	}
+
+	m.Projects = append(m.Projects, cur.Projects...)
+	if cur.RepoHooks != nil {
+		m.RepoHooks = cur.RepoHooks
+	}
+
+	for _, ext := range cur.ExtendProjects {
+		found := false
+		for i := range m.Projects {
+			p := &m.Projects[i]
+			if p.Name != ext.Name || (ext.Path != "" && p.Path != ext.Path) {
+				continue
+			}
+			found = true
+			if p.Groups == "" {
+				p.Groups = ext.Groups
+			} else if ext.Groups != "" {
+				p.Groups += "," + ext.Groups
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: extend-project: no project %s", path, ext.Name)
+		}
+	}
+
+	return nil
+}
+
+// Commit is a single line of a project's shortlog.
+type Commit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Subject string `json:"subject"`
+}
+
+// ProjectChange describes a project that differs between two manifests.
+// Added projects have no OldRevision and removed projects no NewRevision.
+type ProjectChange struct {
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`
+	OldRevision string   `json:"old_revision,omitempty"`
+	NewRevision string   `json:"new_revision,omitempty"`
+	Commits     []Commit `json:"commits,omitempty"`
+}
+
+// ManifestDiff lists the projects added, removed and changed between two
+// resolved manifests. Projects are matched by path.
+type ManifestDiff struct {
+	Added   []ProjectChange `json:"added"`
+	Removed []ProjectChange `json:"removed"`
+	Changed []ProjectChange `json:"changed"`
+}
+
+// DiffManifests compares two manifests returned by LoadManifest.
+func DiffManifests(oldManifest, newManifest *Manifest) *ManifestDiff {
+	oldProjects := make(map[string]Project)
+	for _, p := range oldManifest.Projects {
+		oldProjects[p.Path] = p
+	}
+
+	d := &ManifestDiff{
+		Added:   []ProjectChange{},
+		Removed: []ProjectChange{},
+		Changed: []ProjectChange{},
+	}
+	for _, p := range newManifest.Projects {
+		old, ok := oldProjects[p.Path]
+		delete(oldProjects, p.Path)
+		switch {
+		case !ok:
+			d.Added = append(d.Added, ProjectChange{
+				Name:        p.Name,
+				Path:        p.Path,
+				NewRevision: p.Revision,
+			})
+		case old.Name != p.Name || old.Revision != p.Revision:
+			d.Changed = append(d.Changed, ProjectChange{
+				Name:        p.Name,
+				Path:        p.Path,
+				OldRevision: old.Revision,
+				NewRevision: p.Revision,
+			})
+		}
+	}
+	for _, p := range oldProjects {
+		d.Removed = append(d.Removed, ProjectChange{
+			Name:        p.Name,
+			Path:        p.Path,
+			OldRevision: p.Revision,
+		})
+	}
+
+	for _, l := range [][]ProjectChange{d.Added, d.Removed, d.Changed} {
+		sort.Slice(l, func(i, j int) bool { return l[i].Path < l[j].Path })
+	}
+	return d
+}
+
+// mirrorGitDir finds a project in a local mirror, either created by
+// `repo init --mirror` and named after the project, or a checkout
+// organised by project path.
+func mirrorGitDir(mirror string, p *ProjectChange) (string, error) {
+	for _, dir := range []string{
+		filepath.Join(mirror, p.Name+".git"),
+		filepath.Join(mirror, p.Name),
+		filepath.Join(mirror, p.Path),
+	} {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("project %s not found in %s", p.Name, mirror)
+}
+
+// Shortlogs fills in the commits between the old and new revision of each
+// changed project from the git repositories in a local mirror.
+func (d *ManifestDiff) Shortlogs(mirror string) error {
+	for i := range d.Changed {
+		p := &d.Changed[i]
+		dir, err := mirrorGitDir(mirror, p)
+		if err != nil {
+			return err
+		}
+
+		git := exec.Command("git", "log", "--no-merges",
+			"--format=%h%x00%an%x00%s", p.OldRevision+".."+p.NewRevision)
+		git.Dir = dir
+		git.Stderr = os.Stderr
+		out, err := git.Output()
+		if err != nil {
+			return fmt.Errorf("git log for %s: %v", p.Name, err)
+		}
+
+		p.Commits = nil
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			fields := strings.SplitN(scanner.Text(), "\x00", 3)
+			if len(fields) != 3 {
+				continue
+			}
+			p.Commits = append(p.Commits, Commit{
+				Hash:    fields[0],
+				Author:  fields[1],
+				Subject: fields[2],
+			})
+		}
+	}
+	return nil
+}
+
+// WriteMarkdown writes the diff as Markdown suitable for release notes.
+func (d *ManifestDiff) WriteMarkdown(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	if len(d.Added) != 0 {
+		fmt.Fprintf(bw, "## Added projects\n\n")
+		for _, p := range d.Added {
+			fmt.Fprintf(bw, "- %s (`%s`) at `%s`\n", p.Name, p.Path, p.NewRevision)
+		}
+		fmt.Fprintln(bw)
+	}
+
+	if len(d.Removed) != 0 {
+		fmt.Fprintf(bw, "## Removed projects\n\n")
+		for _, p := range d.Removed {
+			fmt.Fprintf(bw, "- %s (`%s`) at `%s`\n", p.Name, p.Path, p.OldRevision)
+		}
+		fmt.Fprintln(bw)
+	}
+
+	if len(d.Changed) != 0 {
+		fmt.Fprintf(bw, "## Changed projects\n\n")
+		for _, p := range d.Changed {
+			fmt.Fprintf(bw, "### %s\n\n`%s` → `%s`\n\n", p.Name, p.OldRevision, p.NewRevision)
+			for _, c := range p.Commits {
+				fmt.Fprintf(bw, "- %s %s (%s)\n", c.Hash, c.Subject, c.Author)
+			}
+			if len(p.Commits) != 0 {
+				fmt.Fprintln(bw)
+			}
+		}
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flatcar-linux/mantle/system/exec"
+)
+
+func writeManifests(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "repo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadManifest(t *testing.T) {
+	dir := writeManifests(t, map[string]string{
+		"base.xml": `<manifest>
+  <remote name="github" fetch=".." revision="refs/heads/main"></remote>
+  <remote name="other" fetch="https://example.com/"></remote>
+  <default remote="github" revision="refs/heads/master"></default>
+  <project name="flatcar/scripts" path="src/scripts"></project>
+  <project name="flatcar/old" revision="v1"></project>
+  <project name="third/party" remote="other" groups="minilayout"></project>
+</manifest>`,
+		"default.xml": `<manifest>
+  <include name="base.xml"></include>
+  <project name="flatcar/new" path="src/new" revision="abc"></project>
+  <extend-project name="third/party" groups="extra"></extend-project>
+  <remove-project name="flatcar/old"></remove-project>
+</manifest>`,
+	})
+
+	m, err := LoadManifest(filepath.Join(dir, "default.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Project{
+		{Name: "flatcar/scripts", Path: "src/scripts", Remote: "github", Revision: "refs/heads/main"},
+		{Name: "third/party", Path: "third/party", Remote: "other", Revision: "refs/heads/master", Groups: "minilayout,extra"},
+		{Name: "flatcar/new", Path: "src/new", Remote: "github", Revision: "abc"},
+	}
+	if !reflect.DeepEqual(m.Projects, expected) {
+		t.Errorf("unexpected projects:\n%+v\nexpected:\n%+v", m.Projects, expected)
+	}
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	dir := writeManifests(t, map[string]string{
+		"loop.xml":   `<manifest><include name="loop.xml"></include></manifest>`,
+		"remove.xml": `<manifest><remove-project name="missing"></remove-project></manifest>`,
+		"dup.xml": `<manifest>
+  <project name="a" path="x"></project>
+  <project name="b" path="x"></project>
+</manifest>`,
+	})
+
+	for _, name := range []string{"loop.xml", "remove.xml", "dup.xml"} {
+		if _, err := LoadManifest(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestDiffManifests(t *testing.T) {
+	oldManifest := &Manifest{Projects: []Project{
+		{Name: "a", Path: "a", Revision: "1"},
+		{Name: "b", Path: "b", Revision: "1"},
+		{Name: "c", Path: "c", Revision: "1"},
+	}}
+	newManifest := &Manifest{Projects: []Project{
+		{Name: "a", Path: "a", Revision: "1"},
+		{Name: "b", Path: "b", Revision: "2"},
+		{Name: "d", Path: "d", Revision: "1"},
+	}}
+
+	d := DiffManifests(oldManifest, newManifest)
+	expected := &ManifestDiff{
+		Added:   []ProjectChange{{Name: "d", Path: "d", NewRevision: "1"}},
+		Removed: []ProjectChange{{Name: "c", Path: "c", OldRevision: "1"}},
+		Changed: []ProjectChange{{Name: "b", Path: "b", OldRevision: "1", NewRevision: "2"}},
+	}
+	if !reflect.DeepEqual(d, expected) {
+		t.Errorf("unexpected diff:\n%+v\nexpected:\n%+v", d, expected)
+	}
+}
+
+func TestShortlogs(t *testing.T) {
+	mirror := writeManifests(t, nil)
+	dir := filepath.Join(mirror, "proj.git")
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Tester", "GIT_AUTHOR_EMAIL=t@example.com",
+			"GIT_COMMITTER_NAME=Tester", "GIT_COMMITTER_EMAIL=t@example.com")
+		out, err := cmd.Output()
+		if exec.IsCmdNotFound(err) {
+			t.Skip(err)
+		} else if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "first")
+	first := git("rev-parse", "HEAD")
+	git("commit", "-q", "--allow-empty", "-m", "second")
+	git("commit", "-q", "--allow-empty", "-m", "third")
+	third := git("rev-parse", "HEAD")
+
+	d := &ManifestDiff{Changed: []ProjectChange{
+		{Name: "proj", Path: "src/proj", OldRevision: first, NewRevision: third},
+	}}
+	if err := d.Shortlogs(mirror); err != nil {
+		t.Fatal(err)
+	}
+	commits := d.Changed[0].Commits
+	if len(commits) != 2 || commits[0].Subject != "third" || commits[1].Subject != "second" || commits[0].Author != "Tester" {
+		t.Fatalf("unexpected commits %+v", commits)
+	}
+
+	var buf bytes.Buffer
+	if err := d.WriteMarkdown(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "### proj") || !strings.Contains(buf.String(), commits[0].Hash+" third (Tester)") {
+		t.Errorf("unexpected markdown:\n%s", buf.String())
+	}
+}
@@ -96,6 +96,15 @@ type Manifest struct {
 	ExtendProjects []ExtendProject `xml:"extend-project"`
 	RemoveProjects []RemoveProject `xml:"remove-project"`
 	RepoHooks      *RepoHooks      `xml:"repo-hooks"`
+
+	// SDK is not part of repo's format, repo ignores it. Pinned
+	// manifests written by cork record the SDK version in it.
+	SDK *SDK `xml:"sdk"`
+}
+
+// SDK records the SDK version a pinned manifest was built with.
+type SDK struct {
+	Version string `xml:"version,attr"`
 }
 
 // Remote
@@ -0,0 +1,259 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flatcar-linux/mantle/system/exec"
+)
+
+// Resolver maps the revision of a project to a commit SHA1.
+type Resolver func(p Project) (string, error)
+
+// PinManifest rewrites the revision of every project in m, which must have
+// been resolved by LoadManifest, to a commit SHA1. The original revision is
+// kept as upstream, as `repo manifest -r` does. Revisions that are already
+// a SHA1 are left alone.
+func PinManifest(m *Manifest, resolve Resolver) error {
+	for i := range m.Projects {
+		p := &m.Projects[i]
+		if isSHA1(p.Revision) {
+			continue
+		}
+		rev, err := resolve(*p)
+		if err != nil {
+			return fmt.Errorf("resolving %s of %s: %v", p.Revision, p.Name, err)
+		}
+		if !isSHA1(rev) {
+			return fmt.Errorf("resolving %s of %s: bad revision %q", p.Revision, p.Name, rev)
+		}
+		if p.Upstream == "" {
+			p.Upstream = p.Revision
+		}
+		p.Revision = rev
+	}
+	return nil
+}
+
+// IsPinned reports whether every project revision in m is a SHA1.
+func IsPinned(m *Manifest) bool {
+	for _, p := range m.Projects {
+		if !isSHA1(p.Revision) {
+			return false
+		}
+	}
+	return true
+}
+
+// TreeResolver pins projects to the commit checked out under root, the top
+// of a repo client.
+func TreeResolver(root string) Resolver {
+	return func(p Project) (string, error) {
+		r := repo{root: root}
+		return r.projectHEAD(p)
+	}
+}
+
+// RemoteResolver pins projects to the commit their revision points to on
+// their remote, using git ls-remote. Relative fetch URLs are resolved
+// against manifestURL the way repo does.
+func RemoteResolver(m *Manifest, manifestURL string) Resolver {
+	fetch := make(map[string]string)
+	for _, r := range m.Remotes {
+		fetch[r.Name] = r.Fetch
+	}
+
+	return func(p Project) (string, error) {
+		base, err := fetchURL(manifestURL, fetch[p.Remote])
+		if err != nil {
+			return "", err
+		}
+		return lsRemote(base+"/"+p.Name+".git", p.Revision)
+	}
+}
+
+func fetchURL(manifestURL, fetch string) (string, error) {
+	if fetch == "" {
+		return "", fmt.Errorf("remote has no fetch URL")
+	}
+	u, err := url.Parse(fetch)
+	if err != nil {
+		return "", err
+	}
+	if !u.IsAbs() {
+		base, err := url.Parse(manifestURL)
+		if err != nil {
+			return "", err
+		}
+		u = base.ResolveReference(u)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// lsRemote looks up rev on the remote at gitURL. Short names are tried as
+// branches and then as tags; annotated tags are peeled to their commit.
+func lsRemote(gitURL, rev string) (string, error) {
+	refs := []string{rev}
+	if !strings.HasPrefix(rev, "refs/") {
+		refs = []string{"refs/heads/" + rev, "refs/tags/" + rev}
+	}
+
+	args := []string{"ls-remote", gitURL}
+	for _, ref := range refs {
+		args = append(args, ref, ref+"^{}")
+	}
+	git := exec.Command("git", args...)
+	git.Stderr = os.Stderr
+	out, err := git.Output()
+	if err != nil {
+		return "", fmt.Errorf("git ls-remote %s: %v", gitURL, err)
+	}
+
+	found := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			found[fields[1]] = fields[0]
+		}
+	}
+	for _, ref := range refs {
+		if sha, ok := found[ref+"^{}"]; ok {
+			return sha, nil
+		}
+		if sha, ok := found[ref]; ok {
+			return sha, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found on %s", rev, gitURL)
+}
+
+// WriteManifest writes m as XML.
+func WriteManifest(w io.Writer, m *Manifest) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Kinds of Drift.
+const (
+	DriftMissing  = "missing"
+	DriftRevision = "revision"
+	DriftDirty    = "dirty"
+	DriftSDK      = "sdk-version"
+)
+
+// Drift is a difference between a pinned manifest and a repo client.
+type Drift struct {
+	Kind     string `json:"kind"`
+	Project  string `json:"project,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+func (d Drift) String() string {
+	switch d.Kind {
+	case DriftMissing:
+		return fmt.Sprintf("%s: project %s is missing", d.Path, d.Project)
+	case DriftDirty:
+		return fmt.Sprintf("%s: project %s has uncommitted changes", d.Path, d.Project)
+	case DriftSDK:
+		return fmt.Sprintf("SDK version is %s, expected %s", d.Actual, d.Expected)
+	default:
+		return fmt.Sprintf("%s: project %s is at %s, expected %s", d.Path, d.Project, d.Actual, d.Expected)
+	}
+}
+
+// VerifyPinned compares the repo client at root with the pinned manifest m
+// and returns every difference found. sdkVersion is the SDK version the
+// client is set up for; it is only compared if m records one.
+func VerifyPinned(root string, m *Manifest, sdkVersion string) ([]Drift, error) {
+	if !IsPinned(m) {
+		return nil, fmt.Errorf("manifest is not pinned")
+	}
+
+	r := repo{root: root}
+	drift := []Drift{}
+	if m.SDK != nil && m.SDK.Version != sdkVersion {
+		drift = append(drift, Drift{
+			Kind:     DriftSDK,
+			Expected: m.SDK.Version,
+			Actual:   sdkVersion,
+		})
+	}
+
+	for _, p := range m.Projects {
+		dir := filepath.Join(root, p.Path)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			drift = append(drift, Drift{
+				Kind:     DriftMissing,
+				Project:  p.Name,
+				Path:     p.Path,
+				Expected: p.Revision,
+			})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		head, err := r.projectHEAD(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p.Path, err)
+		}
+		if head != p.Revision {
+			drift = append(drift, Drift{
+				Kind:     DriftRevision,
+				Project:  p.Name,
+				Path:     p.Path,
+				Expected: p.Revision,
+				Actual:   head,
+			})
+		}
+
+		git := exec.Command("git", "status", "--porcelain")
+		git.Dir = dir
+		git.Stderr = os.Stderr
+		out, err := git.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s: git status: %v", p.Path, err)
+		}
+		if len(bytes.TrimSpace(out)) != 0 {
+			drift = append(drift, Drift{
+				Kind:    DriftDirty,
+				Project: p.Name,
+				Path:    p.Path,
+			})
+		}
+	}
+
+	return drift, nil
+}
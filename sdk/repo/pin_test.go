@@ -0,0 +1,210 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flatcar-linux/mantle/system/exec"
+)
+
+const (
+	sha1a = "0123456789abcdef0123456789abcdef01234567"
+	sha1b = "89abcdef0123456789abcdef0123456789abcdef"
+)
+
+// gitRepo creates a git repository at dir with one empty commit and
+// returns a function running git in it.
+func gitRepo(t *testing.T, dir string) func(args ...string) string {
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Tester", "GIT_AUTHOR_EMAIL=t@example.com",
+			"GIT_COMMITTER_NAME=Tester", "GIT_COMMITTER_EMAIL=t@example.com")
+		out, err := cmd.Output()
+		if exec.IsCmdNotFound(err) {
+			t.Skip(err)
+		} else if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "first")
+	return git
+}
+
+func TestPinManifest(t *testing.T) {
+	m := &Manifest{Projects: []Project{
+		{Name: "a", Path: "a", Revision: "refs/heads/main"},
+		{Name: "b", Path: "b", Revision: sha1b},
+	}}
+	err := PinManifest(m, func(p Project) (string, error) {
+		if p.Name != "a" {
+			t.Errorf("unexpected resolve of %s", p.Name)
+		}
+		return sha1a, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Project{
+		{Name: "a", Path: "a", Revision: sha1a, Upstream: "refs/heads/main"},
+		{Name: "b", Path: "b", Revision: sha1b},
+	}
+	if !reflect.DeepEqual(m.Projects, expected) {
+		t.Errorf("unexpected projects:\n%+v\nexpected:\n%+v", m.Projects, expected)
+	}
+	if !IsPinned(m) {
+		t.Errorf("manifest not pinned")
+	}
+
+	m.Projects[0].Revision = "main"
+	if err := PinManifest(m, func(p Project) (string, error) { return "main", nil }); err == nil {
+		t.Errorf("expected error for a non-SHA1 resolution")
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	m := &Manifest{
+		Projects: []Project{{Name: "a", Path: "a", Revision: sha1a}},
+		SDK:      &SDK{Version: "2905.0.0"},
+	}
+	var buf bytes.Buffer
+	if err := WriteManifest(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<sdk version="2905.0.0"></sdk>`) {
+		t.Errorf("SDK version missing:\n%s", buf.String())
+	}
+
+	var read Manifest
+	if err := xml.Unmarshal(buf.Bytes(), &read); err != nil {
+		t.Fatal(err)
+	}
+	if read.SDK == nil || read.SDK.Version != "2905.0.0" || !IsPinned(&read) {
+		t.Errorf("unexpected manifest %+v", read)
+	}
+}
+
+func TestFetchURL(t *testing.T) {
+	for _, tt := range []struct {
+		fetch, url string
+	}{
+		{"..", "https://github.com"},
+		{"../", "https://github.com"},
+		{".", "https://github.com/kinvolk"},
+		{"https://example.com/git/", "https://example.com/git"},
+	} {
+		u, err := fetchURL("https://github.com/kinvolk/manifest.git", tt.fetch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u != tt.url {
+			t.Errorf("fetch %q: expected %s, got %s", tt.fetch, tt.url, u)
+		}
+	}
+}
+
+func TestRemoteResolver(t *testing.T) {
+	remote, err := ioutil.TempDir("", "repo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(remote)
+
+	git := gitRepo(t, filepath.Join(remote, "proj.git"))
+	git("branch", "-M", "main")
+	first := git("rev-parse", "HEAD")
+	git("tag", "-a", "-m", "v1", "v1")
+	git("commit", "-q", "--allow-empty", "-m", "second")
+	second := git("rev-parse", "HEAD")
+
+	m := &Manifest{Remotes: []Remote{{Name: "origin", Fetch: "file://" + remote}}}
+	resolve := RemoteResolver(m, "https://example.com/manifest.git")
+	for rev, sha := range map[string]string{
+		"main":            second,
+		"refs/heads/main": second,
+		"v1":              first,
+		"refs/tags/v1":    first,
+	} {
+		got, err := resolve(Project{Name: "proj", Remote: "origin", Revision: rev})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != sha {
+			t.Errorf("%s: expected %s, got %s", rev, sha, got)
+		}
+	}
+
+	if _, err := resolve(Project{Name: "proj", Remote: "origin", Revision: "missing"}); err == nil {
+		t.Errorf("expected error for missing revision")
+	}
+}
+
+func TestVerifyPinned(t *testing.T) {
+	root, err := ioutil.TempDir("", "repo-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	gitRepo(t, filepath.Join(root, "clean"))
+	gitRepo(t, filepath.Join(root, "dirty"))
+	moved := gitRepo(t, filepath.Join(root, "moved"))
+	oldRev := moved("rev-parse", "HEAD")
+	moved("commit", "-q", "--allow-empty", "-m", "second")
+	newRev := moved("rev-parse", "HEAD")
+	if err := ioutil.WriteFile(filepath.Join(root, "dirty", "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manifest{SDK: &SDK{Version: "1.0.0"}}
+	resolve := TreeResolver(root)
+	for _, name := range []string{"clean", "dirty", "moved"} {
+		m.Projects = append(m.Projects, Project{Name: name, Path: name, Revision: "main"})
+	}
+	if err := PinManifest(m, resolve); err != nil {
+		t.Fatal(err)
+	}
+	m.Projects[2].Revision = oldRev
+	m.Projects = append(m.Projects, Project{Name: "gone", Path: "gone", Revision: sha1a})
+
+	drift, err := VerifyPinned(root, m, "2.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Drift{
+		{Kind: DriftSDK, Expected: "1.0.0", Actual: "2.0.0"},
+		{Kind: DriftDirty, Project: "dirty", Path: "dirty"},
+		{Kind: DriftRevision, Project: "moved", Path: "moved", Expected: oldRev, Actual: newRev},
+		{Kind: DriftMissing, Project: "gone", Path: "gone", Expected: sha1a},
+	}
+	if !reflect.DeepEqual(drift, expected) {
+		t.Errorf("unexpected drift:\n%+v\nexpected:\n%+v", drift, expected)
+	}
+}
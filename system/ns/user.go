@@ -0,0 +1,194 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ns
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/flatcar-linux/mantle/system/exec"
+)
+
+// userNsSyncEnv names the file descriptor a process started by StartUserNs
+// reads from to wait for its ID mappings.
+const userNsSyncEnv = "_MANTLE_USERNS_SYNC_FD"
+
+// IDMap maps a range of IDs in a user namespace to IDs on the host, the
+// format of /proc/<pid>/uid_map and the arguments of newuidmap.
+type IDMap struct {
+	ContainerID int
+	HostID      int
+	Size        int
+}
+
+// SubIDs returns the subordinate ID ranges delegated to a user in
+// /etc/subuid or /etc/subgid, as IDMaps with no ContainerID. Entries may
+// name the user by name or numeric ID. A missing file means no ranges.
+func SubIDs(path, name string, id int) ([]IDMap, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseSubIDs(f, name, id)
+}
+
+func parseSubIDs(r io.Reader, name string, id int) ([]IDMap, error) {
+	var ranges []IDMap
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed subordinate ID entry %q", line)
+		}
+		if fields[0] != name && fields[0] != strconv.Itoa(id) {
+			continue
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed subordinate ID entry %q: %v", line, err)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("malformed subordinate ID entry %q: %v", line, err)
+		}
+		ranges = append(ranges, IDMap{HostID: start, Size: count})
+	}
+	return ranges, scanner.Err()
+}
+
+// RootlessMappings maps id on the host to root in the namespace and the
+// subordinate ranges to the IDs following it.
+func RootlessMappings(id int, sub []IDMap) []IDMap {
+	maps := []IDMap{{ContainerID: 0, HostID: id, Size: 1}}
+	next := 1
+	for _, r := range sub {
+		maps = append(maps, IDMap{ContainerID: next, HostID: r.HostID, Size: r.Size})
+		next += r.Size
+	}
+	return maps
+}
+
+func sysProcIDMaps(maps []IDMap) []syscall.SysProcIDMap {
+	var s []syscall.SysProcIDMap
+	for _, m := range maps {
+		s = append(s, syscall.SysProcIDMap{
+			ContainerID: m.ContainerID,
+			HostID:      m.HostID,
+			Size:        m.Size,
+		})
+	}
+	return s
+}
+
+// writeIDMaps runs newuidmap or newgidmap for pid.
+func writeIDMaps(helper string, pid int, maps []IDMap) error {
+	args := []string{strconv.Itoa(pid)}
+	for _, m := range maps {
+		args = append(args, strconv.Itoa(m.ContainerID), strconv.Itoa(m.HostID), strconv.Itoa(m.Size))
+	}
+	out, err := exec.Command(helper, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s: %v", helper, strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// StartUserNs starts cmd in new user and mount namespaces with the given
+// mappings. Mappings of a single ID are written by the kernel directly.
+// Larger mappings need the setuid newuidmap and newgidmap helpers, which
+// can only be run once the process exists; the process must call
+// WaitUserNs first thing to wait for them.
+func StartUserNs(cmd *exec.ExecCmd, uids, gids []IDMap) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS
+
+	if len(uids) == 1 && len(gids) == 1 {
+		cmd.SysProcAttr.UidMappings = sysProcIDMaps(uids)
+		cmd.SysProcAttr.GidMappings = sysProcIDMaps(gids)
+		return cmd.Start()
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	cmd.ExtraFiles = append(cmd.ExtraFiles, r)
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env, fmt.Sprintf("%s=%d", userNsSyncEnv, 2+len(cmd.ExtraFiles)))
+
+	err = cmd.Start()
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := writeIDMaps("newuidmap", cmd.Process.Pid, uids); err != nil {
+		cmd.Kill()
+		return err
+	}
+	if err := writeIDMaps("newgidmap", cmd.Process.Pid, gids); err != nil {
+		cmd.Kill()
+		return err
+	}
+	return nil
+}
+
+// WaitUserNs waits for the mappings of a process started by StartUserNs
+// and then re-executes it: capabilities in the new user namespace are only
+// granted by an exec after the process has been mapped to root. It returns
+// immediately if the mappings were written by the kernel.
+func WaitUserNs() error {
+	fd := os.Getenv(userNsSyncEnv)
+	if fd == "" {
+		return nil
+	}
+	os.Unsetenv(userNsSyncEnv)
+
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return fmt.Errorf("bad %s: %v", userNsSyncEnv, err)
+	}
+	f := os.NewFile(uintptr(n), "userns-sync")
+	// the parent closes its end once the mappings are written
+	if _, err := io.Copy(ioutil.Discard, f); err != nil {
+		return err
+	}
+	f.Close()
+
+	if os.Getuid() != 0 {
+		return fmt.Errorf("user namespace mapping failed, running as uid %d", os.Getuid())
+	}
+	return syscall.Exec("/proc/self/exe", os.Args, os.Environ())
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 Kinvolk GmbH
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ns
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSubIDs(t *testing.T) {
+	const subuid = `# comment
+core:100000:65536
+other:165536:65536
+
+1000:231072:1000
+`
+	ranges, err := parseSubIDs(strings.NewReader(subuid), "core", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []IDMap{
+		{HostID: 100000, Size: 65536},
+		{HostID: 231072, Size: 1000},
+	}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("unexpected ranges %+v", ranges)
+	}
+
+	if _, err := parseSubIDs(strings.NewReader("core:1\n"), "core", 1000); err == nil {
+		t.Errorf("expected error for malformed entry")
+	}
+}
+
+func TestRootlessMappings(t *testing.T) {
+	maps := RootlessMappings(1000, []IDMap{
+		{HostID: 100000, Size: 65536},
+		{HostID: 231072, Size: 1000},
+	})
+	expected := []IDMap{
+		{ContainerID: 0, HostID: 1000, Size: 1},
+		{ContainerID: 1, HostID: 100000, Size: 65536},
+		{ContainerID: 65537, HostID: 231072, Size: 1000},
+	}
+	if !reflect.DeepEqual(maps, expected) {
+		t.Errorf("unexpected mappings %+v", maps)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package targen
+
+import (
+	"bufio"
+	"debug/elf"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultLibraryDirs are searched after the directories listed in
+// /etc/ld.so.conf, like the dynamic loader does.
+var defaultLibraryDirs = []string{"/lib64", "/usr/lib64", "/lib", "/usr/lib"}
+
+// elfDeps returns the libraries, including the dynamic loader, that
+// binary under root needs.  It follows the DT_NEEDED entries of the ELF
+// headers through the library directories of root, so binaries of any
+// architecture can be handled.
+func elfDeps(root, binary string) ([]string, error) {
+	dirs := append(ldSoConfDirs(root, "/etc/ld.so.conf"), defaultLibraryDirs...)
+
+	var libs []string
+	seen := map[string]bool{binary: true}
+	queue := []string{binary}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+
+		f, err := elf.Open(filepath.Join(root, path))
+		if err != nil {
+			return nil, err
+		}
+		interp, err := interpreter(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		needed, err := f.ImportedLibraries()
+		class, machine := f.Class, f.Machine
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		var deps []string
+		if interp != "" {
+			deps = append(deps, interp)
+		}
+		for _, name := range needed {
+			lib, err := findLibrary(root, dirs, name, class, machine)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			deps = append(deps, lib)
+		}
+		for _, dep := range deps {
+			if !seen[dep] {
+				seen[dep] = true
+				libs = append(libs, dep)
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	return libs, nil
+}
+
+// interpreter returns the dynamic loader requested by f, if any.
+func interpreter(f *elf.File) (string, error) {
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_INTERP {
+			continue
+		}
+		data, err := ioutil.ReadAll(p.Open())
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\x00"), nil
+	}
+	return "", nil
+}
+
+// findLibrary finds the library name for the given ELF class and
+// machine in dirs under root.
+func findLibrary(root string, dirs []string, name string, class elf.Class, machine elf.Machine) (string, error) {
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		f, err := elf.Open(filepath.Join(root, path))
+		if err != nil {
+			continue
+		}
+		ok := f.Class == class && f.Machine == machine
+		f.Close()
+		if ok {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("couldn't find library %s", name)
+}
+
+// ldSoConfDirs returns the library directories listed in the ld.so.conf
+// file path under root, following includes.
+func ldSoConfDirs(root, path string) []string {
+	f, err := os.Open(filepath.Join(root, path))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var dirs []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "include "):
+			pattern := strings.TrimSpace(strings.TrimPrefix(line, "include "))
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(path), pattern)
+			}
+			matches, _ := filepath.Glob(filepath.Join(root, pattern))
+			for _, m := range matches {
+				rel, err := filepath.Rel(root, m)
+				if err != nil {
+					continue
+				}
+				dirs = append(dirs, ldSoConfDirs(root, "/"+rel)...)
+			}
+		default:
+			dirs = append(dirs, line)
+		}
+	}
+	return dirs
+}
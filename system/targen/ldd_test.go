@@ -15,6 +15,7 @@
 package targen
 
 import (
+	"path/filepath"
 	"testing"
 )
 
@@ -31,3 +32,31 @@ func TestLdd(t *testing.T) {
 
 	t.Logf("%+v", deps)
 }
+
+func TestElfDeps(t *testing.T) {
+	bin := "/bin/sh"
+	lddDeps, err := ldd(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps, err := elfDeps("/", bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%+v", deps)
+
+	if len(deps) == 0 {
+		t.Fatalf("no deps of %q", bin)
+	}
+	// ldd may report different paths for the same libraries, so just
+	// compare their names.
+	names := make(map[string]bool)
+	for _, dep := range deps {
+		names[filepath.Base(dep)] = true
+	}
+	for _, dep := range lddDeps {
+		if !names[filepath.Base(dep)] {
+			t.Errorf("%s from ldd missing in %v", dep, deps)
+		}
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"archive/tar"
 	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/coreos/pkg/capnslog"
 )
@@ -28,6 +29,7 @@ import (
 var plog = capnslog.NewPackageLogger("github.com/flatcar-linux/mantle", "targen")
 
 type TarGen struct {
+	root     string
 	files    []string
 	binaries []string
 }
@@ -36,6 +38,14 @@ func New() *TarGen {
 	return &TarGen{}
 }
 
+// NewWithRoot returns a TarGen which takes files, binaries and their
+// libraries from the filesystem tree at root, such as a board sysroot
+// of another architecture, instead of from the host. Paths are given
+// and stored relative to root.
+func NewWithRoot(root string) *TarGen {
+	return &TarGen{root: root}
+}
+
 func (t *TarGen) AddFile(path string) *TarGen {
 	plog.Tracef("adding file %q", path)
 	t.files = append(t.files, path)
@@ -48,10 +58,11 @@ func (t *TarGen) AddBinary(path string) *TarGen {
 	return t
 }
 
-func tarWriteFile(tw *tar.Writer, file string) error {
+func (t *TarGen) tarWriteFile(tw *tar.Writer, file string) error {
 	plog.Tracef("writing file %q", file)
 
-	st, err := os.Stat(file)
+	src := filepath.Join(t.root, file)
+	st, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
@@ -66,7 +77,7 @@ func tarWriteFile(tw *tar.Writer, file string) error {
 		return err
 	}
 
-	f, err := os.Open(file)
+	f, err := os.Open(src)
 	if err != nil {
 		return err
 	}
@@ -94,7 +105,7 @@ func (t *TarGen) Generate(w io.Writer) error {
 
 		plog.Tracef("copying file %q", file)
 
-		if err := tarWriteFile(tw, file); err != nil {
+		if err := t.tarWriteFile(tw, file); err != nil {
 			return err
 		}
 
@@ -102,7 +113,7 @@ func (t *TarGen) Generate(w io.Writer) error {
 	}
 
 	for _, binary := range t.binaries {
-		libs, err := ldd(binary)
+		libs, err := t.libraries(binary)
 		if err != nil {
 			return err
 		}
@@ -116,7 +127,7 @@ func (t *TarGen) Generate(w io.Writer) error {
 
 			plog.Tracef("copying library %q", lib)
 
-			if err := tarWriteFile(tw, lib); err != nil {
+			if err := t.tarWriteFile(tw, lib); err != nil {
 				return err
 			}
 
@@ -130,7 +141,7 @@ func (t *TarGen) Generate(w io.Writer) error {
 
 		plog.Tracef("copying binary %q", binary)
 
-		if err := tarWriteFile(tw, binary); err != nil {
+		if err := t.tarWriteFile(tw, binary); err != nil {
 			return err
 		}
 
@@ -143,3 +154,13 @@ func (t *TarGen) Generate(w io.Writer) error {
 
 	return nil
 }
+
+// libraries returns the libraries binary needs, using ldd for host
+// binaries and the ELF headers for binaries under a root, which may
+// not run on the host.
+func (t *TarGen) libraries(binary string) ([]string, error) {
+	if t.root == "" {
+		return ldd(binary)
+	}
+	return elfDeps(t.root, binary)
+}
@@ -33,7 +33,20 @@ var (
 
 // FullUpdate generates an update Procedure for the given file, embedding its
 // entire contents in the payload so it does not depend any previous state.
+// The file size must be a multiple of BlockSize.
 func FullUpdate(path string) (*Procedure, error) {
+	return fullUpdate(path, false)
+}
+
+// FullFileUpdate is like FullUpdate but accepts files of any size, such as
+// a kernel image. The destination extent of the final operation is rounded
+// up to a whole block; update_engine only writes as much of it as there
+// is data for.
+func FullFileUpdate(path string) (*Procedure, error) {
+	return fullUpdate(path, true)
+}
+
+func fullUpdate(path string, unaligned bool) (*Procedure, error) {
 	source, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -50,7 +63,7 @@ func FullUpdate(path string) (*Procedure, error) {
 		return nil, err
 	}
 
-	scanner := fullScanner{payload: payload, source: source}
+	scanner := fullScanner{payload: payload, source: source, unaligned: unaligned}
 	for err == nil {
 		err = scanner.Scan()
 	}
@@ -81,6 +94,9 @@ type fullScanner struct {
 	source     io.Reader
 	offset     uint64
 	operations []*metadata.InstallOperation
+
+	// allow a final chunk that is not a whole number of blocks
+	unaligned bool
 }
 
 func (f *fullScanner) readChunk() ([]byte, error) {
@@ -97,12 +113,12 @@ func (f *fullScanner) Scan() error {
 	if err != nil {
 		return err
 	}
-	if len(chunk)%BlockSize != 0 {
+	if len(chunk)%BlockSize != 0 && !f.unaligned {
 		return errShortRead
 	}
 
 	startBlock := uint64(f.offset) / BlockSize
-	numBlocks := uint64(len(chunk)) / BlockSize
+	numBlocks := (uint64(len(chunk)) + BlockSize - 1) / BlockSize
 	f.offset += uint64(len(chunk))
 
 	// Try bzip2 compressing the data, hopefully it will shrink!
@@ -154,6 +154,29 @@ func TestFullUpdateScanUnaligned(t *testing.T) {
 	}
 }
 
+func TestFullFileUpdateScanUnaligned(t *testing.T) {
+	scanner := fullScanner{
+		payload:   &bytes.Buffer{},
+		source:    bytes.NewReader(testUnaligned),
+		unaligned: true,
+	}
+
+	if err := scanner.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	if err := scanner.Scan(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+
+	if len(scanner.operations) != 1 {
+		t.Fatalf("expected 1 operation, got %d", len(scanner.operations))
+	}
+	ext := scanner.operations[0].DstExtents
+	if len(ext) != 1 || ext[0].GetStartBlock() != 0 || ext[0].GetNumBlocks() != 2 {
+		t.Errorf("unexpected extents %v", ext)
+	}
+}
+
 func checkFullProc(t *testing.T, source, sourceHash []byte) *Procedure {
 	f, err := ioutil.TempFile("", "")
 	if err != nil {
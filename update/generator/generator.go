@@ -73,6 +73,35 @@ func (g *Generator) Partition(proc *Procedure) error {
 	return nil
 }
 
+// Kernel adds the given kernel update Procedure to the payload.
+func (g *Generator) Kernel(proc *Procedure) error {
+	proc.Type = metadata.InstallProcedure_KERNEL.Enum()
+	return g.Procedure(proc)
+}
+
+// Procedure adds the given update Procedure to the payload, after the
+// /usr partition if there is one. The procedure's Type must be set and
+// only one procedure of each type may be added, except for SYSEXT
+// procedures which must instead have a unique Name.
+func (g *Generator) Procedure(proc *Procedure) error {
+	if proc.Type == nil {
+		return errors.New("generator: procedure type not set")
+	}
+	if proc.GetType() == metadata.InstallProcedure_SYSEXT && proc.GetName() == "" {
+		return errors.New("generator: SYSEXT procedure name not set")
+	}
+	for _, p := range g.manifest.Procedures {
+		if p.GetType() == proc.GetType() && p.GetName() == proc.GetName() {
+			return ErrProcedureExists
+		}
+	}
+
+	g.AddCloser(proc)
+	g.manifest.Procedures = append(g.manifest.Procedures, &proc.InstallProcedure)
+	g.payloads = append(g.payloads, proc)
+	return nil
+}
+
 // Write finalizes the payload, writing it out to the given file path.
 func (g *Generator) Write(path string) (err error) {
 	if err = g.updateOffsets(); err != nil {
@@ -22,6 +22,8 @@ import (
 
 	"github.com/golang/protobuf/proto"
 
+	"github.com/flatcar-linux/mantle/system"
+	"github.com/flatcar-linux/mantle/system/exec"
 	"github.com/flatcar-linux/mantle/update"
 	"github.com/flatcar-linux/mantle/update/metadata"
 )
@@ -136,3 +138,141 @@ func TestGenerateOneBlockPartition(t *testing.T) {
 		t.Errorf("Updater did not replicate source block")
 	}
 }
+
+func fullFileProc(t *testing.T, data []byte) *Procedure {
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	proc, err := FullFileUpdate(f.Name())
+	if system.IsOpNotSupported(err) {
+		t.Skip("O_TMPFILE not supported")
+	} else if exec.IsCmdNotFound(err) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return proc
+}
+
+func TestGenerateProcedures(t *testing.T) {
+	g := testGenerator{t: t}
+	defer g.Destroy()
+
+	sources := []struct {
+		typ  metadata.InstallProcedure_Type
+		name string
+		data []byte
+	}{
+		{metadata.InstallProcedure_KERNEL, "", testUnaligned},
+		{metadata.InstallProcedure_OEM, "", testRand},
+		{metadata.InstallProcedure_SYSEXT, "docker", testOnes},
+		{metadata.InstallProcedure_SYSEXT, "containerd", testUnaligned},
+	}
+
+	if err := g.Partition(fullFileProc(t, testOnes)); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range sources {
+		proc := fullFileProc(t, s.data)
+		var err error
+		if s.typ == metadata.InstallProcedure_KERNEL {
+			err = g.Kernel(proc)
+		} else {
+			proc.Type = s.typ.Enum()
+			if s.name != "" {
+				proc.Name = proto.String(s.name)
+			}
+			err = g.Procedure(proc)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dup := fullFileProc(t, testOnes)
+	if err := g.Kernel(dup); err != ErrProcedureExists {
+		t.Errorf("expected ErrProcedureExists for second kernel, got %v", err)
+	}
+	dup.Close()
+	noname := fullFileProc(t, testOnes)
+	noname.Type = metadata.InstallProcedure_SYSEXT.Enum()
+	if err := g.Procedure(noname); err == nil {
+		t.Errorf("SYSEXT procedure without name was accepted")
+	}
+	noname.Close()
+
+	f, err := ioutil.TempFile("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	if err := g.Write(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := update.NewPayloadFrom(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	procs := payload.Procedures()
+	if len(procs) != len(sources)+1 {
+		t.Fatalf("expected %d procedures, got %d", len(sources)+1, len(procs))
+	}
+
+	expected := [][]byte{testOnes}
+	for i, s := range sources {
+		proc := procs[i+1]
+		if proc.GetType() != s.typ || proc.GetName() != s.name {
+			t.Errorf("procedure %d: expected %s %q, got %s %q",
+				i+1, s.typ, s.name, proc.GetType(), proc.GetName())
+		}
+		expected = append(expected, s.data)
+	}
+
+	for i, proc := range procs {
+		out, err := ioutil.TempFile("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer out.Close()
+		defer os.Remove(out.Name())
+
+		for _, op := range payload.Operations(proc) {
+			if err := op.Apply(out, nil); err != nil {
+				t.Fatalf("procedure %d: %v", i, err)
+			}
+		}
+		if err := update.VerifyInfo(out, proc.NewInfo); err != nil {
+			t.Errorf("procedure %d: %v", i, err)
+		}
+
+		if _, err := out.Seek(0, os.SEEK_SET); err != nil {
+			t.Fatal(err)
+		}
+		written, err := ioutil.ReadAll(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(written, expected[i]) {
+			t.Errorf("procedure %d: written data does not match source", i)
+		}
+	}
+
+	if err := payload.VerifySignature(); err != nil {
+		t.Fatal(err)
+	}
+}
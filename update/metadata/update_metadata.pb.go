@@ -75,13 +75,19 @@ type InstallProcedure_Type int32
 
 const (
 	InstallProcedure_KERNEL InstallProcedure_Type = 0
+	InstallProcedure_OEM    InstallProcedure_Type = 1
+	InstallProcedure_SYSEXT InstallProcedure_Type = 2
 )
 
 var InstallProcedure_Type_name = map[int32]string{
 	0: "KERNEL",
+	1: "OEM",
+	2: "SYSEXT",
 }
 var InstallProcedure_Type_value = map[string]int32{
 	"KERNEL": 0,
+	"OEM":    1,
+	"SYSEXT": 2,
 }
 
 func (x InstallProcedure_Type) Enum() *InstallProcedure_Type {
@@ -325,6 +331,8 @@ type InstallProcedure struct {
 	Operations       []*InstallOperation    `protobuf:"bytes,2,rep,name=operations" json:"operations,omitempty"`
 	OldInfo          *InstallInfo           `protobuf:"bytes,3,opt,name=old_info" json:"old_info,omitempty"`
 	NewInfo          *InstallInfo           `protobuf:"bytes,4,opt,name=new_info" json:"new_info,omitempty"`
+	// Identifies SYSEXT images, which may appear more than once.
+	Name             *string                `protobuf:"bytes,5,opt,name=name" json:"name,omitempty"`
 	XXX_unrecognized []byte                 `json:"-"`
 }
 
@@ -361,6 +369,13 @@ func (m *InstallProcedure) GetNewInfo() *InstallInfo {
 	return nil
 }
 
+func (m *InstallProcedure) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
 type DeltaArchiveManifest struct {
 	// The update procedure for the main partition (USR-A or USR-B). Once
 	// complete it should match the hash specified in new_partition_info.
@@ -484,40 +499,42 @@ func init() {
 }
 
 var fileDescriptor0 = []byte{
-	// 560 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xa4, 0x53, 0x5d, 0x6f, 0xd3, 0x30,
-	0x14, 0x5d, 0xdb, 0xd0, 0x76, 0x37, 0xdd, 0x1a, 0xcc, 0x80, 0xc0, 0x03, 0xaa, 0xc2, 0x4b, 0x41,
-	0x50, 0x41, 0x61, 0x93, 0x06, 0x48, 0xd0, 0xb1, 0x54, 0xaa, 0xd8, 0xd8, 0xb4, 0x21, 0x1e, 0x78,
-	0xb1, 0x42, 0xeb, 0x2e, 0x11, 0xa9, 0x1d, 0xc5, 0xee, 0x80, 0xfd, 0x09, 0x7e, 0x0a, 0x7f, 0x89,
-	0x9f, 0xc2, 0xb5, 0x9b, 0x26, 0xd3, 0xc4, 0x44, 0xa6, 0xbd, 0xf9, 0xeb, 0x9c, 0x7b, 0xcf, 0xb9,
-	0xc7, 0x70, 0x7b, 0x9e, 0x4c, 0x02, 0xc5, 0xe8, 0x8c, 0xa9, 0x00, 0x17, 0x41, 0x2f, 0x49, 0x85,
-	0x12, 0xe4, 0xce, 0x38, 0x4c, 0xc5, 0x8c, 0x09, 0x49, 0xb3, 0x7b, 0xc6, 0x4f, 0x22, 0xce, 0xbc,
-	0x3f, 0x55, 0x70, 0x46, 0x5c, 0xaa, 0x20, 0x8e, 0x0f, 0x12, 0x96, 0x06, 0x2a, 0x12, 0x9c, 0xbc,
-	0x06, 0x4b, 0xfd, 0x4c, 0x98, 0x5b, 0xe9, 0x54, 0xbb, 0xeb, 0xfd, 0xa7, 0xbd, 0x7f, 0x63, 0x7b,
-	0x17, 0x71, 0xbd, 0x4f, 0x08, 0x22, 0xb7, 0xc0, 0xd6, 0x75, 0xa9, 0x98, 0x4e, 0x25, 0x53, 0x6e,
-	0xb5, 0x53, 0xe9, 0xae, 0xe5, 0x87, 0x31, 0x42, 0x55, 0xe8, 0xd6, 0xcc, 0xe1, 0x0b, 0xb0, 0x65,
-	0x3a, 0xa6, 0xec, 0x87, 0x62, 0x5c, 0x49, 0xd7, 0xea, 0xd4, 0xba, 0x76, 0xff, 0xc1, 0x65, 0xd5,
-	0x7c, 0xf3, 0x8c, 0x10, 0x00, 0x0d, 0xca, 0x88, 0x6e, 0x20, 0x91, 0xa5, 0x89, 0x26, 0x52, 0xe5,
-	0x44, 0xf5, 0xb2, 0x44, 0x1a, 0x94, 0x11, 0x35, 0x0c, 0x91, 0x0b, 0x8e, 0x69, 0x53, 0x86, 0x41,
-	0x7f, 0x73, 0x8b, 0x86, 0x81, 0x0c, 0xdd, 0x26, 0xde, 0xb4, 0xbc, 0x6d, 0xb0, 0x8c, 0x3a, 0x1b,
-	0x1a, 0x47, 0xfe, 0xe1, 0xde, 0xe0, 0xbd, 0xef, 0xac, 0x90, 0x75, 0x80, 0x6c, 0x43, 0x77, 0xbe,
-	0x38, 0x15, 0xd2, 0x04, 0x6b, 0xff, 0xe0, 0xb3, 0xef, 0x54, 0x91, 0xbb, 0xbe, 0x73, 0xbc, 0x3b,
-	0x1a, 0x0e, 0x9d, 0x9a, 0xf7, 0x1c, 0xea, 0x59, 0x49, 0x74, 0x01, 0x1d, 0x4b, 0x15, 0xfd, 0x1a,
-	0x8b, 0xf1, 0x37, 0xb4, 0x57, 0xd7, 0xc4, 0xb7, 0x7c, 0x3e, 0x5b, 0x1c, 0x49, 0x63, 0x97, 0xe5,
-	0x9d, 0x01, 0x1c, 0x47, 0x27, 0x3c, 0x50, 0xf3, 0x94, 0x49, 0xf2, 0x0e, 0x25, 0xe7, 0x3b, 0x44,
-	0x69, 0x75, 0x4f, 0x2e, 0x53, 0x57, 0xe0, 0x8a, 0xe5, 0xfd, 0xc7, 0xb0, 0x9a, 0x6f, 0x48, 0x1b,
-	0x1a, 0xa7, 0x2c, 0x95, 0x38, 0x30, 0xd3, 0xc1, 0x1a, 0x69, 0x81, 0xa5, 0x55, 0x9b, 0xda, 0x2d,
-	0xef, 0x11, 0xd8, 0xd9, 0x60, 0x47, 0x7c, 0x2a, 0xf4, 0xa5, 0x8c, 0xce, 0x58, 0xd6, 0x2c, 0xee,
-	0x8c, 0x29, 0x8b, 0xa7, 0xbf, 0x8a, 0xf0, 0x1c, 0xa6, 0x62, 0xcc, 0x26, 0x9a, 0xfe, 0x6a, 0xe1,
-	0xc9, 0x71, 0x8b, 0xf0, 0xbc, 0x01, 0x10, 0xcb, 0x38, 0x69, 0x33, 0xb4, 0xd4, 0x6e, 0xd9, 0xfc,
-	0x91, 0x4d, 0x68, 0x8a, 0x78, 0x42, 0x23, 0xec, 0xdb, 0x44, 0xcc, 0xee, 0x3f, 0xfc, 0x0f, 0xd6,
-	0x48, 0x44, 0x18, 0x67, 0xdf, 0x17, 0x30, 0xab, 0x34, 0xcc, 0x23, 0x59, 0x24, 0x70, 0xd6, 0x1f,
-	0xfc, 0xa3, 0x8f, 0xfe, 0x9e, 0xb3, 0xe2, 0xfd, 0xae, 0xc1, 0xc6, 0x2e, 0x8b, 0x55, 0x30, 0x48,
-	0xc7, 0x61, 0x74, 0xca, 0xf6, 0x03, 0x1e, 0x4d, 0x99, 0x54, 0x64, 0x08, 0x1b, 0x09, 0x4e, 0x3e,
-	0xd2, 0x7d, 0xd2, 0x73, 0x12, 0x2b, 0x57, 0x94, 0x38, 0x80, 0x36, 0x17, 0x22, 0xa1, 0xd7, 0x70,
-	0xc9, 0x05, 0x30, 0x61, 0xa3, 0x66, 0xae, 0xe6, 0x2b, 0xbe, 0xb2, 0x5e, 0x3e, 0xdb, 0xde, 0x22,
-	0xf7, 0xe0, 0x66, 0x11, 0xb4, 0xe5, 0x07, 0xb6, 0xcc, 0xe0, 0xef, 0x42, 0xfb, 0xdc, 0x95, 0x41,
-	0x2e, 0xfe, 0xde, 0x5b, 0x20, 0xda, 0xf3, 0x42, 0x9c, 0xb1, 0xb1, 0x59, 0xde, 0x7d, 0x24, 0xd0,
-	0xee, 0x5f, 0x20, 0x58, 0x2d, 0x4f, 0x80, 0x99, 0x49, 0x96, 0x29, 0x92, 0x2e, 0x94, 0x72, 0x23,
-	0x8f, 0xdd, 0xdf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x53, 0xd4, 0x06, 0x13, 0x30, 0x05, 0x00, 0x00,
+	// 586 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x53, 0x51, 0x4f, 0x13, 0x4d,
+	0x14, 0x65, 0xdb, 0xf9, 0xda, 0x72, 0xb6, 0xc0, 0x7e, 0x03, 0xea, 0xea, 0x83, 0x69, 0xd6, 0x07,
+	0xab, 0xd1, 0x46, 0xab, 0x90, 0xa0, 0x24, 0x08, 0xb2, 0x24, 0x44, 0x10, 0x42, 0x89, 0x51, 0x5f,
+	0x36, 0x63, 0x3b, 0xa5, 0x1b, 0xb7, 0x33, 0x9b, 0x9d, 0x01, 0x85, 0x3f, 0x65, 0xe2, 0x2f, 0xf2,
+	0xa7, 0x98, 0x99, 0x2e, 0x5b, 0x42, 0x24, 0x2e, 0xf1, 0x6d, 0xe7, 0xce, 0x9e, 0x73, 0xe7, 0x9c,
+	0x7b, 0x2e, 0x6e, 0x9d, 0xa4, 0x03, 0xa6, 0x79, 0x34, 0xe6, 0x9a, 0x0d, 0x98, 0x66, 0x9d, 0x34,
+	0x93, 0x5a, 0xd2, 0xdb, 0xfd, 0x51, 0x26, 0xc7, 0x5c, 0xaa, 0x28, 0xbf, 0xe7, 0xe2, 0x38, 0x16,
+	0x3c, 0xf8, 0x55, 0x81, 0xb7, 0x23, 0x94, 0x66, 0x49, 0xb2, 0x9f, 0xf2, 0x8c, 0xe9, 0x58, 0x0a,
+	0xfa, 0x1a, 0x44, 0x9f, 0xa5, 0xdc, 0x77, 0x5a, 0x95, 0xf6, 0x7c, 0xf7, 0x69, 0xe7, 0xcf, 0xd8,
+	0xce, 0x55, 0x5c, 0xe7, 0xe8, 0x2c, 0xe5, 0x74, 0x11, 0xae, 0xe9, 0x1b, 0xc9, 0xe1, 0x50, 0x71,
+	0xed, 0x57, 0x5a, 0x4e, 0x7b, 0xae, 0x28, 0x26, 0x5c, 0x1c, 0xeb, 0x91, 0x5f, 0xb5, 0xc5, 0x17,
+	0x70, 0x55, 0xd6, 0x8f, 0xf8, 0x77, 0xcd, 0x85, 0x56, 0x3e, 0x69, 0x55, 0xdb, 0x6e, 0xf7, 0xfe,
+	0x75, 0xdd, 0x42, 0xfb, 0x1b, 0xa5, 0x80, 0x01, 0xe5, 0x44, 0xff, 0xb5, 0x9c, 0x36, 0x31, 0x44,
+	0x03, 0xa5, 0x0b, 0xa2, 0x5a, 0x59, 0x22, 0x03, 0xca, 0x89, 0xea, 0x96, 0xc8, 0x87, 0x67, 0x9f,
+	0xa9, 0x46, 0xac, 0xbb, 0xbc, 0x12, 0x8d, 0x98, 0x1a, 0xf9, 0x8d, 0x96, 0xd3, 0x6e, 0x06, 0xab,
+	0x20, 0x56, 0x9d, 0x8b, 0xfa, 0x61, 0x78, 0xb0, 0xbb, 0xf1, 0x36, 0xf4, 0x66, 0xe8, 0x3c, 0x90,
+	0x1f, 0xa2, 0xcd, 0xcf, 0x9e, 0x43, 0x1b, 0x20, 0x7b, 0xfb, 0x1f, 0x42, 0xaf, 0x42, 0x81, 0xda,
+	0x66, 0x6f, 0x6b, 0x67, 0x7b, 0xdb, 0xab, 0x06, 0xcf, 0x51, 0xcb, 0x5b, 0x2e, 0xc2, 0x55, 0x9a,
+	0x65, 0x3a, 0xfa, 0x92, 0xc8, 0xfe, 0x57, 0xdf, 0xb1, 0x3d, 0x29, 0x20, 0x4e, 0xc6, 0x93, 0x92,
+	0xb2, 0x76, 0x91, 0xe0, 0x1c, 0xe8, 0xc5, 0xc7, 0x82, 0xe9, 0x93, 0x8c, 0x2b, 0xfa, 0x06, 0x50,
+	0xc5, 0xc9, 0x77, 0xac, 0xba, 0x27, 0xd7, 0xa9, 0x9b, 0xe2, 0xa6, 0x9f, 0xf7, 0x1e, 0x63, 0xb6,
+	0x38, 0xd0, 0x05, 0xd4, 0x4f, 0x79, 0xa6, 0x62, 0x29, 0xec, 0x0b, 0xe6, 0x68, 0x13, 0xc4, 0xa8,
+	0xb6, 0xbd, 0x9b, 0xc1, 0x23, 0xb8, 0xf9, 0x60, 0x77, 0xc4, 0x50, 0x9a, 0x4b, 0x15, 0x9f, 0xf3,
+	0xfc, 0xb1, 0x4d, 0x10, 0x6b, 0xca, 0xe4, 0xd7, 0x9f, 0xd3, 0xf0, 0x1c, 0x64, 0xb2, 0xcf, 0x07,
+	0x86, 0xfe, 0x66, 0xe1, 0x29, 0x70, 0x93, 0xf0, 0xac, 0x01, 0xf2, 0x22, 0x4e, 0xc6, 0x0c, 0x23,
+	0xb5, 0x5d, 0x36, 0x7f, 0x74, 0x19, 0x0d, 0x99, 0x0c, 0xa2, 0x58, 0x0c, 0xa5, 0x8d, 0x98, 0xdb,
+	0x7d, 0xf0, 0x17, 0xac, 0x95, 0xb8, 0x8c, 0x86, 0xe0, 0xdf, 0x26, 0x30, 0x52, 0x1e, 0xd6, 0x04,
+	0x11, 0x6c, 0xcc, 0x6d, 0x06, 0x67, 0x83, 0x87, 0x79, 0x40, 0x80, 0xda, 0xbb, 0xf0, 0xf0, 0x7d,
+	0xb8, 0xeb, 0xcd, 0xd0, 0x3a, 0xaa, 0xfb, 0xe1, 0x9e, 0xe7, 0x98, 0x62, 0xef, 0x53, 0x2f, 0xfc,
+	0x78, 0xe4, 0x55, 0x82, 0x1f, 0x55, 0x2c, 0x6d, 0xf1, 0x44, 0xb3, 0x8d, 0xac, 0x3f, 0x8a, 0x4f,
+	0xf9, 0x1e, 0x13, 0xf1, 0x90, 0x2b, 0x4d, 0xb7, 0xb1, 0x94, 0xb2, 0x4c, 0xc7, 0x46, 0x4a, 0x74,
+	0xc9, 0x05, 0xe7, 0x86, 0x2e, 0x6c, 0x60, 0x41, 0x48, 0x99, 0x46, 0xff, 0x60, 0xa4, 0x0f, 0xd8,
+	0x3c, 0x46, 0x76, 0xf4, 0x76, 0x5b, 0x5f, 0x91, 0x97, 0xcf, 0x56, 0x57, 0xe8, 0x5d, 0xfc, 0x3f,
+	0xcd, 0xe2, 0xc5, 0x8e, 0x13, 0x9b, 0x8d, 0x3b, 0x58, 0xb8, 0x74, 0x65, 0x91, 0x93, 0xf5, 0x5c,
+	0x07, 0x35, 0x63, 0x99, 0x8a, 0xb3, 0x4e, 0x37, 0xca, 0x3b, 0xbd, 0x0e, 0x6a, 0x06, 0x74, 0x85,
+	0x60, 0xb6, 0x3c, 0xc1, 0x1a, 0x90, 0x5e, 0x04, 0x4d, 0xf9, 0x28, 0xe5, 0x46, 0x91, 0xcc, 0xdf,
+	0x03, 0x00, 0x84, 0x13, 0x12, 0xc9, 0x53, 0x05, 0x00, 0x00,
 }